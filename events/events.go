@@ -0,0 +1,233 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+
+// Package events provides an in-process, typed publish/subscribe bus, so handlers can
+// emit domain events consumed by workers or SSE hubs within the block.
+//
+// Usage:
+//
+//	bus := events.NewBus(events.Config{})
+//	events.Subscribe(bus, func(ctx context.Context, e UserCreated) error {
+//		return sendWelcomeMail(ctx, e.Email)
+//	})
+//	...
+//	err := events.Publish(c.Request().Context(), bus, UserCreated{Email: email})
+//	...
+//	// deliver the queued events after the server stopped serving requests
+//	s.OnShutdown(bus.Shutdown)
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/labstack/gommon/log"
+)
+
+// ErrClosed is returned by Publish after the bus is shut down.
+var ErrClosed = errors.New("event bus closed")
+
+// Config configures a Bus.
+type Config struct {
+	// BufferSize is the number of events queued per subscriber, 64 by default. Publish
+	// waits while the queue of a subscriber is full.
+	BufferSize int
+	// OnError is called with the errors returned by subscribers and the panics they
+	// recover from. Defaults to logging the error.
+	OnError func(event any, err error)
+}
+
+// DefaultConfig is the default Bus config.
+var DefaultConfig = Config{
+	BufferSize: 64,
+	OnError: func(event any, err error) {
+		log.Errorf("event %T: %v", event, err)
+	},
+}
+
+// Bus delivers published events to the subscribers of their type. Every subscriber
+// receives events in order, in its own goroutine, so a slow or failing subscriber does
+// not affect the others.
+type Bus struct {
+	config Config
+
+	mu          sync.RWMutex
+	closed      bool
+	subscribers map[reflect.Type][]*subscriber
+	wg          sync.WaitGroup
+}
+
+type subscriber struct {
+	queue   chan delivery
+	handler func(ctx context.Context, event any) error
+
+	// stop is closed first when the subscriber is closed, releasing the publishers
+	// waiting on a full queue, so the queue is then closed under mu.
+	stop   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+	once   sync.Once
+}
+
+type delivery struct {
+	ctx   context.Context
+	event any
+}
+
+// NewBus creates a Bus.
+func NewBus(config Config) *Bus {
+	if config.BufferSize == 0 {
+		config.BufferSize = DefaultConfig.BufferSize
+	}
+	if config.OnError == nil {
+		config.OnError = DefaultConfig.OnError
+	}
+	return &Bus{
+		config:      config,
+		subscribers: map[reflect.Type][]*subscriber{},
+	}
+}
+
+// Subscribe calls the handler with every event of type T published on the bus, until
+// the returned function is called.
+func Subscribe[T any](b *Bus, handler func(ctx context.Context, event T) error) (unsubscribe func()) {
+	eventType := reflect.TypeOf((*T)(nil)).Elem()
+	sub := &subscriber{
+		queue: make(chan delivery, b.config.BufferSize),
+		stop:  make(chan struct{}),
+		handler: func(ctx context.Context, event any) error {
+			return handler(ctx, event.(T))
+		},
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return func() {}
+	}
+	b.subscribers[eventType] = append(b.subscribers[eventType], sub)
+	b.wg.Add(1)
+	go b.deliver(sub)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		subs := b.subscribers[eventType]
+		for i, s := range subs {
+			if s == sub {
+				b.subscribers[eventType] = append(subs[:i:i], subs[i+1:]...)
+				sub.close()
+				break
+			}
+		}
+	}
+}
+
+// Publish queues the event for the subscribers of type T. It waits while the queue of
+// a subscriber is full, until the context is done or the bus is shut down. The context
+// is passed to the subscribers without its cancellation, so events outlive the request
+// publishing them.
+func Publish[T any](ctx context.Context, b *Bus, event T) error {
+	eventType := reflect.TypeOf((*T)(nil)).Elem()
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+	// the queues are sent to without the lock, so Shutdown is not blocked by a full queue
+	subs := append([]*subscriber(nil), b.subscribers[eventType]...)
+	b.mu.RUnlock()
+
+	d := delivery{ctx: context.WithoutCancel(ctx), event: event}
+	for _, sub := range subs {
+		if err := sub.send(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send queues the delivery, unless the subscriber is closed meanwhile.
+func (s *subscriber) send(ctx context.Context, d delivery) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
+	select {
+	case s.queue <- d:
+		return nil
+	case <-s.stop:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Bus) deliver(sub *subscriber) {
+	defer b.wg.Done()
+	for d := range sub.queue {
+		b.handle(sub, d)
+	}
+}
+
+// handle calls the subscriber, isolating the bus from its panics.
+func (b *Bus) handle(sub *subscriber, d delivery) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				err = fmt.Errorf("%v", r)
+			}
+			b.config.OnError(d.event, fmt.Errorf("subscriber panic: %w", err))
+		}
+	}()
+	if err := sub.handler(d.ctx, d.event); err != nil {
+		b.config.OnError(d.event, err)
+	}
+}
+
+// close stops accepting deliveries, and closes the queue once the publishers waiting
+// on it are released, so the queued deliveries are still delivered.
+func (s *subscriber) close() {
+	s.once.Do(func() {
+		close(s.stop)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		close(s.queue)
+	})
+}
+
+// Shutdown stops accepting events and waits until the queued events are delivered, or
+// the context is done.
+func (b *Bus) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	var closing []*subscriber
+	if !b.closed {
+		b.closed = true
+		for _, subs := range b.subscribers {
+			closing = append(closing, subs...)
+		}
+		b.subscribers = map[reflect.Type][]*subscriber{}
+	}
+	b.mu.Unlock()
+	for _, sub := range closing {
+		sub.close()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
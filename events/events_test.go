@@ -0,0 +1,177 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userCreated struct {
+	ID string
+}
+
+type orderPlaced struct {
+	ID string
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	bus := NewBus(Config{})
+	var mu sync.Mutex
+	var users, orders []string
+	Subscribe(bus, func(ctx context.Context, e userCreated) error {
+		mu.Lock()
+		defer mu.Unlock()
+		users = append(users, e.ID)
+		return nil
+	})
+	Subscribe(bus, func(ctx context.Context, e orderPlaced) error {
+		mu.Lock()
+		defer mu.Unlock()
+		orders = append(orders, e.ID)
+		return nil
+	})
+
+	ctx := context.Background()
+	require.NoError(t, Publish(ctx, bus, userCreated{ID: "1"}))
+	require.NoError(t, Publish(ctx, bus, userCreated{ID: "2"}))
+	require.NoError(t, Publish(ctx, bus, orderPlaced{ID: "a"}))
+	require.NoError(t, bus.Shutdown(ctx))
+
+	assert.Equal(t, []string{"1", "2"}, users)
+	assert.Equal(t, []string{"a"}, orders)
+	assert.ErrorIs(t, Publish(ctx, bus, userCreated{ID: "3"}), ErrClosed)
+}
+
+func TestSubscriberErrors(t *testing.T) {
+	var mu sync.Mutex
+	var errs []string
+	bus := NewBus(Config{OnError: func(event any, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err.Error())
+	}})
+	delivered := make(chan string, 2)
+	Subscribe(bus, func(ctx context.Context, e userCreated) error {
+		if e.ID == "panic" {
+			panic("boom")
+		}
+		return errors.New("failed " + e.ID)
+	})
+	Subscribe(bus, func(ctx context.Context, e userCreated) error {
+		delivered <- e.ID
+		return nil
+	})
+
+	ctx := context.Background()
+	require.NoError(t, Publish(ctx, bus, userCreated{ID: "panic"}))
+	require.NoError(t, Publish(ctx, bus, userCreated{ID: "1"}))
+	require.NoError(t, bus.Shutdown(ctx))
+
+	assert.Equal(t, []string{"subscriber panic: boom", "failed 1"}, errs)
+	assert.Equal(t, "panic", <-delivered)
+	assert.Equal(t, "1", <-delivered)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := NewBus(Config{})
+	var count int
+	unsubscribe := Subscribe(bus, func(ctx context.Context, e userCreated) error {
+		count++
+		return nil
+	})
+	ctx := context.Background()
+	require.NoError(t, Publish(ctx, bus, userCreated{}))
+	unsubscribe()
+	require.NoError(t, Publish(ctx, bus, userCreated{}))
+	require.NoError(t, bus.Shutdown(ctx))
+	assert.Equal(t, 1, count)
+}
+
+func TestPublishBackpressure(t *testing.T) {
+	bus := NewBus(Config{BufferSize: 1})
+	release := make(chan struct{})
+	Subscribe(bus, func(ctx context.Context, e userCreated) error {
+		<-release
+		return nil
+	})
+
+	// the first event is handled, the second is queued once the first is picked up
+	require.NoError(t, Publish(context.Background(), bus, userCreated{}))
+	require.NoError(t, Publish(context.Background(), bus, userCreated{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, Publish(ctx, bus, userCreated{}), context.DeadlineExceeded)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShutdown()
+	assert.ErrorIs(t, bus.Shutdown(shutdownCtx), context.DeadlineExceeded)
+	close(release)
+	assert.NoError(t, bus.Shutdown(context.Background()))
+}
+
+func TestShutdownWithBlockedPublisher(t *testing.T) {
+	bus := NewBus(Config{BufferSize: 1})
+	release := make(chan struct{})
+	handling := make(chan struct{}, 1)
+	Subscribe(bus, func(ctx context.Context, e userCreated) error {
+		handling <- struct{}{}
+		<-release
+		return nil
+	})
+	ctx := context.Background()
+	require.NoError(t, Publish(ctx, bus, userCreated{ID: "1"}))
+	<-handling
+	require.NoError(t, Publish(ctx, bus, userCreated{ID: "2"}))
+
+	// waits on the full queue
+	published := make(chan error, 1)
+	go func() {
+		published <- Publish(ctx, bus, userCreated{ID: "3"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, bus.Shutdown(shutdownCtx), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	select {
+	case err := <-published:
+		assert.ErrorIs(t, err, ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("publisher still blocked after shutdown")
+	}
+	close(release)
+	assert.NoError(t, bus.Shutdown(ctx))
+}
+
+func TestPublishFromSubscriberDuringShutdown(t *testing.T) {
+	bus := NewBus(Config{BufferSize: 1})
+	errs := make(chan error, 1)
+	Subscribe(bus, func(ctx context.Context, e userCreated) error {
+		// republishes to its own full queue until the bus is shut down
+		for {
+			if err := Publish(ctx, bus, userCreated{}); err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+				return nil
+			}
+		}
+	})
+	require.NoError(t, Publish(context.Background(), bus, userCreated{}))
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, bus.Shutdown(ctx))
+	assert.ErrorIs(t, <-errs, ErrClosed)
+}
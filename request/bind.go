@@ -0,0 +1,84 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MustBind fills a new T from the request of the echo context.
+// Any binding failure is returned as an *echo.HTTPError with status 400 Bad Request,
+// so a handler can return the error as is and let echo render the response.
+// Invalid parameters are listed as FieldErrors in the errors of the response body:
+//
+//	{"message": "invalid request parameters", "errors": [{"field": "limit", "source": "query", "code": "invalid_format", "message": "..."}]}
+//
+// The validators given with WithValidator run once the request is bound, and their
+// failures are returned as an *echo.HTTPError with status 422 Unprocessable Entity
+// wrapping a *ValidationError.
+func MustBind[T any](ctx echo.Context, opts ...BindOption) (T, error) {
+	param, err := mustBind[T](ctx.Request())
+	if err != nil {
+		return param, err
+	}
+	for _, validate := range newBindOptions(opts).validators {
+		err = validate(&param)
+		if err != nil {
+			return param, invalidEntity(&ValidationError{Err: err})
+		}
+	}
+	return param, nil
+}
+
+func mustBind[T any](req *http.Request) (T, error) {
+	var param T
+	err := GetRequestParameters(req, &param)
+	if err != nil {
+		if fieldErrs, ok := newFieldErrors(err, reflect.TypeOf(param)); ok {
+			return param, invalidParameters(fieldErrs)
+		}
+		return param, badRequest(err)
+	}
+	return param, nil
+}
+
+// ValidationError is a bound request rejected by a validator of MustBind. The server
+// error handlers render it as a 422, see ErrorPipeline to map it to another status.
+// A validator returning FieldErrors has them listed in the response.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed: " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func invalidEntity(err *ValidationError) *echo.HTTPError {
+	var fieldErrs FieldErrors
+	if errors.As(err, &fieldErrs) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, echo.Map{
+			"message": "invalid request parameters",
+			"errors":  fieldErrs,
+		}).SetInternal(err)
+	}
+	return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error()).SetInternal(err)
+}
+
+func badRequest(err error) *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+}
+
+func invalidParameters(fieldErrs FieldErrors) *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusBadRequest, echo.Map{
+		"message": "invalid request parameters",
+		"errors":  fieldErrs,
+	}).SetInternal(fieldErrs)
+}
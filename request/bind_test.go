@@ -0,0 +1,155 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMustBind(t *testing.T) {
+	type input struct {
+		Limit int `in:"query=limit;required"`
+	}
+	e := echo.New()
+	e.GET("/items", func(c echo.Context) error {
+		param, err := MustBind[input](c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, param)
+	})
+
+	t.Run("valid request", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items?limit=10", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"Limit": 10}`, rec.Body.String())
+	})
+	t.Run("invalid value", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items?limit=ten", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "limit")
+	})
+	t.Run("field errors", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items?limit=ten", nil))
+		assert.JSONEq(t, `{
+			"message": "invalid request parameters",
+			"errors": [{"field": "limit", "source": "query", "code": "invalid_format", "message": "strconv.Atoi: parsing \"ten\": invalid syntax"}]
+		}`, rec.Body.String())
+	})
+	t.Run("missing value", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("error keeps the cause", func(t *testing.T) {
+		ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/items", nil), nil)
+		_, err := MustBind[input](ctx)
+
+		var httpErr *echo.HTTPError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+		assert.NotNil(t, httpErr.Internal)
+	})
+}
+
+func TestMustBindPointers(t *testing.T) {
+	type input struct {
+		Limit   *int    `in:"query=limit"`
+		Name    *string `in:"query=name"`
+		Active  *bool   `in:"query=active"`
+		Version *int64  `in:"header=X-Version"`
+	}
+	bind := func(target string, header http.Header) input {
+		req := httptest.NewRequest(http.MethodPatch, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		param, err := MustBind[input](echo.New().NewContext(req, nil))
+		assert.NoError(t, err)
+		return param
+	}
+
+	t.Run("absent", func(t *testing.T) {
+		param := bind("/", nil)
+		assert.Nil(t, param.Limit)
+		assert.Nil(t, param.Name)
+		assert.Nil(t, param.Active)
+		assert.Nil(t, param.Version)
+	})
+	t.Run("zero values", func(t *testing.T) {
+		param := bind("/?limit=0&name=&active=false", http.Header{"X-Version": {"0"}})
+		if assert.NotNil(t, param.Limit) && assert.NotNil(t, param.Name) && assert.NotNil(t, param.Active) {
+			assert.Equal(t, 0, *param.Limit)
+			assert.Equal(t, "", *param.Name)
+			assert.False(t, *param.Active)
+		}
+		if assert.NotNil(t, param.Version) {
+			assert.Equal(t, int64(0), *param.Version)
+		}
+	})
+}
+
+func TestMustBindWithValidator(t *testing.T) {
+	type input struct {
+		From int `in:"query=from"`
+		To   int `in:"query=to"`
+	}
+	validRange := func(v any) error {
+		param := v.(*input)
+		if param.From > param.To {
+			return FieldErrors{{Field: "from", Source: "query", Code: CodeInvalid, Message: "must not be after to"}}
+		}
+		return nil
+	}
+	notEmpty := func(v any) error {
+		if v.(*input).To == 0 {
+			return errors.New("to is required")
+		}
+		return nil
+	}
+	bind := func(target string) (input, error) {
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, target, nil), nil)
+		return MustBind[input](ctx, WithValidator(validRange), WithValidator(notEmpty))
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		param, err := bind("/?from=1&to=2")
+		assert.NoError(t, err)
+		assert.Equal(t, input{From: 1, To: 2}, param)
+	})
+	t.Run("field errors", func(t *testing.T) {
+		_, err := bind("/?from=3&to=2")
+		var httpErr *echo.HTTPError
+		if assert.ErrorAs(t, err, &httpErr) {
+			assert.Equal(t, http.StatusUnprocessableEntity, httpErr.Code)
+		}
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		var fieldErrs FieldErrors
+		if assert.ErrorAs(t, err, &fieldErrs) {
+			assert.Equal(t, "from", fieldErrs[0].Field)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		_, err := bind("/?from=-1")
+		var httpErr *echo.HTTPError
+		if assert.ErrorAs(t, err, &httpErr) {
+			assert.Equal(t, http.StatusUnprocessableEntity, httpErr.Code)
+			assert.Equal(t, "validation failed: to is required", httpErr.Message)
+		}
+	})
+	t.Run("binding errors skip the validators", func(t *testing.T) {
+		_, err := bind("/?from=x")
+		var validationErr *ValidationError
+		assert.False(t, errors.As(err, &validationErr))
+	})
+}
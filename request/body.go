@@ -0,0 +1,244 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ggicci/httpin/core"
+	"github.com/labstack/echo/v4"
+)
+
+func init() {
+	// replaces the body directive of httpin, which consumes the body
+	core.RegisterDirective("body", &directiveBody{}, true)
+}
+
+// directiveBody implements the "body" directive, which decodes the complete body into
+// a struct, slice or map field, in a registered body format like `in:"body=xml"`.
+// Without a format, it is decoded with the serializer of the Content-Type of the
+// request, so XML bodies sent as application/xml or text/xml are decoded with
+// encoding/xml, and as JSON otherwise. Unlike the directive of httpin, the body is
+// buffered, so several fields and the handler can read it.
+//
+// A dot path after the format, or in place of it, binds a single value of a JSON body,
+// like `in:"body=user.address.city"` or `in:"body=json,items.0.id"` where numbers
+// index arrays. A top-level key is given with the format, like `in:"body=json,name"`.
+// The field is left unset when the path is not in the body.
+//
+// A form body, posted as application/x-www-form-urlencoded or multipart/form-data,
+// is decoded by `in:"body"` too, with the names of the json tags as the form fields,
+// so HTML forms bind into the same structs as JSON bodies. Single form fields are
+// bound with `in:"form=field"`.
+//
+//	type CreateUserInput struct {
+//		Tenant string `in:"header=X-Tenant"`
+//		User   User   `in:"body"`
+//		City   string `in:"body=user.address.city"`
+//	}
+type directiveBody struct {
+	core.DirectiveBody
+}
+
+func (d *directiveBody) Decode(rtm *core.DirectiveRuntime) error {
+	req := rtm.GetRequest()
+	if len(rtm.Directive.Argv) == 0 && isFormBody(req) {
+		return d.decodeForm(rtm)
+	}
+	data, err := bufferBody(req)
+	if err != nil {
+		return err
+	}
+	// the next body field or the handler reads the body from the start
+	defer func() {
+		req.Body = newBufferedBody(data)
+	}()
+	format, path := bodyPath(rtm.Directive.Argv)
+	if path == "" {
+		if serializer, ok := bodySerializer(req, rtm.Directive.Argv); ok {
+			err = serializer.Decode(req.Body, rtm.Value.Elem().Addr().Interface())
+		} else {
+			err = d.DirectiveBody.Decode(rtm)
+		}
+		if err != nil {
+			return err
+		}
+		rtm.MarkFieldSet(true)
+		return nil
+	}
+	if format != "json" {
+		return fmt.Errorf("body directive supports paths in JSON bodies only, got %s", format)
+	}
+	value, ok, err := lookupJSONPath(data, strings.Split(path, "."))
+	if err != nil || !ok {
+		return err
+	}
+	err = json.Unmarshal(value, rtm.Value.Interface())
+	if err != nil {
+		return err
+	}
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+// decodeForm decodes a form body, which httpin parsed already, into the field.
+func (*directiveBody) decodeForm(rtm *core.DirectiveRuntime) error {
+	values, err := formBodyValues(rtm.GetRequest())
+	if err != nil {
+		return err
+	}
+	err = decodeFormBody(values, rtm.Value.Elem())
+	if err != nil {
+		return err
+	}
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+// Encode sets the field as the body, or at its path in a JSON body shared with the
+// other body fields with a path.
+func (d *directiveBody) Encode(rtm *core.DirectiveRuntime) error {
+	format, path := bodyPath(rtm.Directive.Argv)
+	if path == "" {
+		return d.DirectiveBody.Encode(rtm)
+	}
+	if format != "json" {
+		return fmt.Errorf("body directive supports paths in JSON bodies only, got %s", format)
+	}
+	builder := rtm.GetRequestBuilder()
+	document := map[string]any{}
+	if builder.Body != nil {
+		err := json.NewDecoder(builder.Body).Decode(&document)
+		if err != nil {
+			return fmt.Errorf("body directive: path %s requires a JSON object body: %w", path, err)
+		}
+	}
+	segments := strings.Split(path, ".")
+	parent := document
+	for _, segment := range segments[:len(segments)-1] {
+		child, ok := parent[segment].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			parent[segment] = child
+		}
+		parent = child
+	}
+	parent[segments[len(segments)-1]] = rtm.Value.Interface()
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	builder.SetBody("json", io.NopCloser(bytes.NewReader(data)))
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+// bodySerializer returns the serializer registered for the content type of the
+// request, for a body directive without a format, like application/xml or text/xml.
+func bodySerializer(req *http.Request, argv []string) (Serializer, bool) {
+	if len(argv) > 0 {
+		return nil, false
+	}
+	return SerializerFor(req.Header.Get(echo.HeaderContentType))
+}
+
+// bodyPath returns the format and the dot path of the arguments of a body directive.
+// A single argument is a path when it contains a dot.
+func bodyPath(argv []string) (format, path string) {
+	switch {
+	case len(argv) == 0:
+		return "json", ""
+	case len(argv) > 1:
+		return strings.ToLower(argv[0]), argv[1]
+	case strings.Contains(argv[0], "."):
+		return "json", argv[0]
+	}
+	return strings.ToLower(argv[0]), ""
+}
+
+// lookupJSONPath returns the value at the path of a JSON document, and false when the
+// path is not in the document or leads to null.
+func lookupJSONPath(data []byte, segments []string) (json.RawMessage, bool, error) {
+	value := json.RawMessage(data)
+	for _, segment := range segments {
+		trimmed := bytes.TrimSpace(value)
+		if len(trimmed) == 0 {
+			return nil, false, nil
+		}
+		switch trimmed[0] {
+		case '{':
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal(trimmed, &object); err != nil {
+				return nil, false, err
+			}
+			next, ok := object[segment]
+			if !ok {
+				return nil, false, nil
+			}
+			value = next
+		case '[':
+			index, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, false, nil
+			}
+			var array []json.RawMessage
+			if err := json.Unmarshal(trimmed, &array); err != nil {
+				return nil, false, err
+			}
+			if index < 0 || index >= len(array) {
+				return nil, false, nil
+			}
+			value = array[index]
+		default:
+			if !json.Valid(trimmed) {
+				return nil, false, errors.New("invalid JSON body")
+			}
+			return nil, false, nil
+		}
+	}
+	if string(bytes.TrimSpace(value)) == "null" {
+		return nil, false, nil
+	}
+	return value, true, nil
+}
+
+// bufferedBody is a request body read by the body directive, which can be read again.
+type bufferedBody struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newBufferedBody(data []byte) *bufferedBody {
+	return &bufferedBody{Reader: bytes.NewReader(data), data: data}
+}
+
+func (*bufferedBody) Close() error {
+	return nil
+}
+
+// bufferBody reads the body of the request, unless it is buffered already, and
+// replaces it with a buffered body.
+func bufferBody(req *http.Request) ([]byte, error) {
+	if body, ok := req.Body.(*bufferedBody); ok {
+		req.Body = newBufferedBody(body.data)
+		return body.data, nil
+	}
+	var data []byte
+	if req.Body != nil {
+		var err error
+		data, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Body = newBufferedBody(data)
+	return data, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bodyAddress struct {
+	City string `json:"city"`
+}
+
+type bodyUser struct {
+	Name    string      `json:"name"`
+	Email   string      `json:"email,omitempty"`
+	Address bodyAddress `json:"address"`
+	Ignored string      `json:"-"`
+}
+
+func TestBodyDirective(t *testing.T) {
+	t.Run("struct", func(t *testing.T) {
+		type input struct {
+			User bodyUser `in:"body"`
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Ada","address":{"city":"London"},"Ignored":"x"}`))
+		var param input
+		require.NoError(t, GetRequestParameters(req, &param))
+		assert.Equal(t, bodyUser{Name: "Ada", Address: bodyAddress{City: "London"}}, param.User)
+	})
+
+	t.Run("slice", func(t *testing.T) {
+		type input struct {
+			Users []bodyUser `in:"body"`
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[{"name":"Ada"},{"name":"Grace"}]`))
+		var param input
+		require.NoError(t, GetRequestParameters(req, &param))
+		assert.Equal(t, []bodyUser{{Name: "Ada"}, {Name: "Grace"}}, param.Users)
+	})
+
+	t.Run("read by several fields and the handler", func(t *testing.T) {
+		type input struct {
+			User bodyUser       `in:"body"`
+			Raw  map[string]any `in:"body=json"`
+		}
+		e := echo.New()
+		e.POST("/", func(c echo.Context) error {
+			param, err := MustBind[input](c)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, "Ada", param.User.Name)
+			assert.Equal(t, "Ada", param.Raw["name"])
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			return c.String(http.StatusOK, string(body))
+		})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Ada"}`)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"name":"Ada"}`, rec.Body.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		type input struct {
+			Users []bodyUser `in:"body"`
+		}
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Ada"}`)), nil)
+		_, err := MustBind[input](ctx)
+		var httpErr *echo.HTTPError
+		require.ErrorAs(t, err, &httpErr)
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+		var fieldErrs FieldErrors
+		require.ErrorAs(t, err, &fieldErrs)
+		assert.Equal(t, FieldError{Field: "Users", Source: "body", Code: CodeInvalidFormat, Message: fieldErrs[0].Message}, fieldErrs[0])
+	})
+}
+
+func TestBodyDirectivePath(t *testing.T) {
+	type input struct {
+		City    string   `in:"body=user.address.city"`
+		Name    *string  `in:"body=json,name"`
+		FirstID int      `in:"body=json,items.0.id"`
+		Tags    []string `in:"body=user.tags"`
+		Zip     string   `in:"body=user.address.zip"`
+	}
+	body := `{"name":"order","user":{"address":{"city":"London"},"tags":["a","b"]},"items":[{"id":7},{"id":8}]}`
+
+	t.Run("decode", func(t *testing.T) {
+		var param input
+		require.NoError(t, GetRequestParameters(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), &param))
+		assert.Equal(t, "London", param.City)
+		require.NotNil(t, param.Name)
+		assert.Equal(t, "order", *param.Name)
+		assert.Equal(t, 7, param.FirstID)
+		assert.Equal(t, []string{"a", "b"}, param.Tags)
+		assert.Empty(t, param.Zip)
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		var param input
+		require.NoError(t, GetRequestParameters(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"user":null}`)), &param))
+		assert.Nil(t, param.Name)
+		assert.Empty(t, param.City)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"items":[{"id":"seven"}]}`)), nil)
+		_, err := MustBind[input](ctx)
+		var fieldErrs FieldErrors
+		require.ErrorAs(t, err, &fieldErrs)
+		assert.Equal(t, "items.0.id", fieldErrs[0].Field)
+		assert.Equal(t, "body", fieldErrs[0].Source)
+		assert.Equal(t, CodeInvalidFormat, fieldErrs[0].Code)
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		type input struct {
+			City string `in:"body=user.address.city"`
+			Name string `in:"body=json,name"`
+		}
+		req, err := NewRequest(context.Background(), http.MethodPost, "http://example.com/", &input{City: "London", Name: "Ada"})
+		require.NoError(t, err)
+		data, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"name":"Ada","user":{"address":{"city":"London"}}}`, string(data))
+	})
+}
+
+func TestBodyDirectiveContentType(t *testing.T) {
+	type xmlUser struct {
+		Name string `xml:"name" json:"name"`
+		City string `xml:"address>city" json:"city"`
+	}
+	type input struct {
+		User xmlUser `in:"body"`
+	}
+	bind := func(contentType, body string) (input, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set(echo.HeaderContentType, contentType)
+		}
+		return MustBind[input](echo.New().NewContext(req, nil))
+	}
+	const xmlBody = `<user><name>Ada</name><address><city>London</city></address></user>`
+	want := input{User: xmlUser{Name: "Ada", City: "London"}}
+
+	for _, contentType := range []string{"application/xml", "text/xml; charset=utf-8", "application/atom+xml"} {
+		t.Run(contentType, func(t *testing.T) {
+			param, err := bind(contentType, xmlBody)
+			require.NoError(t, err)
+			assert.Equal(t, want, param)
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		param, err := bind("application/json", `{"name":"Ada","city":"London"}`)
+		require.NoError(t, err)
+		assert.Equal(t, want, param)
+	})
+
+	t.Run("without a content type", func(t *testing.T) {
+		param, err := bind("", `{"name":"Ada"}`)
+		require.NoError(t, err)
+		assert.Equal(t, "Ada", param.User.Name)
+	})
+
+	t.Run("explicit format", func(t *testing.T) {
+		type input struct {
+			User xmlUser `in:"body=json"`
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Ada"}`))
+		req.Header.Set(echo.HeaderContentType, "application/xml")
+		var param input
+		require.NoError(t, GetRequestParameters(req, &param))
+		assert.Equal(t, "Ada", param.User.Name)
+	})
+
+	t.Run("invalid xml", func(t *testing.T) {
+		_, err := bind("application/xml", `<user><name>Ada</user>`)
+		var fieldErrs FieldErrors
+		require.ErrorAs(t, err, &fieldErrs)
+		assert.Equal(t, CodeInvalidFormat, fieldErrs[0].Code)
+		assert.Equal(t, "body", fieldErrs[0].Source)
+	})
+}
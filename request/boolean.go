@@ -0,0 +1,70 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/ggicci/httpin/core"
+)
+
+// strictBooleans is set by UseStrictBooleans.
+var strictBooleans atomic.Bool
+
+// UseStrictBooleans restricts boolean parameters to the spellings "true" and "false"
+// for every parameter helper and for the httpin binder used by GetRequestParameters.
+// By default the lenient strconv.ParseBool spellings like 1, t and F are accepted too.
+// It should be called once, before the server starts handling requests.
+func UseStrictBooleans() {
+	strictBooleans.Store(true)
+	core.RegisterCoder[bool](func(b *bool) (core.Stringable, error) {
+		return (*strictBool)(b), nil
+	})
+}
+
+// strictBool is a bool only accepting "true" and "false".
+type strictBool bool
+
+func (b strictBool) ToString() (string, error) {
+	return strconv.FormatBool(bool(b)), nil
+}
+
+func (b *strictBool) FromString(s string) error {
+	x, err := parseStrictBool(s)
+	if err != nil {
+		return err
+	}
+	*b = strictBool(x)
+	return nil
+}
+
+func parseStrictBool(s string) (bool, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q, expected true or false", s)
+}
+
+// checkStrictBool returns an error when the target is a bool, or a slice of bools,
+// and one of the elements is not "true" or "false".
+func checkStrictBool(rt reflect.Type, elements []string) error {
+	if rt.Kind() == reflect.Slice || rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Bool {
+		return nil
+	}
+	for _, element := range elements {
+		_, err := parseStrictBool(element)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
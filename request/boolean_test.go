@@ -0,0 +1,61 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictBool(t *testing.T) {
+	newContext := func(target string) echo.Context {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return echo.New().NewContext(req, nil)
+	}
+
+	t.Run("lenient by default", func(t *testing.T) {
+		res := false
+		err := GetQueryParam[bool](newContext("/?flag=1"), "flag", &res)
+		assert.NoError(t, err)
+		assert.True(t, res)
+	})
+	t.Run("strict rejects other spellings", func(t *testing.T) {
+		for _, val := range []string{"1", "t", "TRUE", "yes"} {
+			res := false
+			err := GetQueryParam[bool](newContext("/?flag="+val), "flag", &res, StrictBool())
+			assert.Error(t, err, val)
+		}
+	})
+	t.Run("strict accepts true and false", func(t *testing.T) {
+		res := false
+		err := GetQueryParam[bool](newContext("/?flag=true"), "flag", &res, StrictBool())
+		assert.NoError(t, err)
+		assert.True(t, res)
+	})
+	t.Run("strict slice", func(t *testing.T) {
+		res := []bool{}
+		err := GetQueryParam[[]bool](newContext("/?flags=true,0"), "flags", &res, StrictBool())
+		assert.Error(t, err)
+	})
+	t.Run("strict ignores other types", func(t *testing.T) {
+		res := 0
+		err := GetQueryParam[int](newContext("/?limit=1"), "limit", &res, StrictBool())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, res)
+	})
+}
+
+func TestStrictBoolCoder(t *testing.T) {
+	b := strictBool(false)
+	assert.NoError(t, b.FromString("true"))
+	assert.True(t, bool(b))
+	assert.Error(t, b.FromString("1"))
+
+	s, err := b.ToString()
+	assert.NoError(t, err)
+	assert.Equal(t, "true", s)
+}
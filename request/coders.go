@@ -0,0 +1,125 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/ggicci/httpin/core"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// WithFieldCoders wraps the executor of a directive binding string values, so it
+// converts them like the source directives of the binder: with the layout of the
+// format directive of a time.Time field, and with UnmarshalJSON for types only
+// implementing json.Unmarshaler, given the value as a JSON string. httpin converts
+// types implementing encoding.TextUnmarshaler itself. The query, header, form, default
+// and path directives are wrapped already, it is meant for custom directives.
+func WithFieldCoders(executor core.DirectiveExecutor) core.DirectiveExecutor {
+	return &fieldCoderExecutor{executor: executor}
+}
+
+type fieldCoderExecutor struct {
+	executor core.DirectiveExecutor
+}
+
+func (e *fieldCoderExecutor) Decode(rtm *core.DirectiveRuntime) error {
+	return withFieldCoder(rtm, e.executor.Decode)
+}
+
+func (e *fieldCoderExecutor) Encode(rtm *core.DirectiveRuntime) error {
+	return withFieldCoder(rtm, e.executor.Encode)
+}
+
+// withFieldCoder runs the executor with the coder of the field as its custom coder,
+// the one httpin uses to convert from and to strings.
+func withFieldCoder(rtm *core.DirectiveRuntime, execute func(*core.DirectiveRuntime) error) error {
+	coder := fieldCoder(rtm)
+	if coder == nil {
+		return execute(rtm)
+	}
+	// the resolver is shared between requests, the coder is set on a copy
+	resolver := *rtm.Resolver
+	resolver.Context = context.WithValue(resolver.Context, core.CtxCustomCoder, coder)
+	coded := *rtm
+	coded.Resolver = &resolver
+	err := execute(&coded)
+	// keeps the field marked as set for the next directives
+	rtm.Context = coded.Context
+	return err
+}
+
+func fieldCoder(rtm *core.DirectiveRuntime) *core.NamedAnyStringableAdaptor {
+	if rtm.GetCustomCoder() != nil {
+		// a coder or decoder directive
+		return nil
+	}
+	if layout, ok := timeLayout(rtm.Resolver); ok {
+		return &core.NamedAnyStringableAdaptor{
+			Name:     "format",
+			BaseType: timeType,
+			Adapt:    timeLayoutAdaptor(layout),
+		}
+	}
+	baseType, _ := core.BaseTypeOf(rtm.Resolver.Field.Type)
+	if baseType = indirectType(baseType); isJSONUnmarshaler(baseType) {
+		return &core.NamedAnyStringableAdaptor{
+			Name:     "json",
+			BaseType: baseType,
+			Adapt:    jsonAdaptor,
+		}
+	}
+	return nil
+}
+
+// isJSONUnmarshaler reports whether values of rt are converted with UnmarshalJSON:
+// they implement json.Unmarshaler, but neither encoding.TextUnmarshaler nor have a
+// decoder registered with RegisterDecoder.
+func isJSONUnmarshaler(rt reflect.Type) bool {
+	ptr := reflect.PointerTo(rt)
+	if _, registered := typeConverters[rt]; registered {
+		return false
+	}
+	return ptr.Implements(jsonUnmarshalerType) && !ptr.Implements(textUnmarshalerType)
+}
+
+func jsonAdaptor(v any) (core.Stringable, error) {
+	if _, ok := v.(json.Unmarshaler); !ok {
+		return nil, fmt.Errorf("%T does not implement json.Unmarshaler", v)
+	}
+	return &jsonStringable{value: v}, nil
+}
+
+// jsonStringable converts a json.Unmarshaler from and to strings, as JSON strings.
+type jsonStringable struct {
+	value any
+}
+
+func (s *jsonStringable) ToString() (string, error) {
+	data, err := json.Marshal(s.value)
+	if err != nil {
+		return "", err
+	}
+	// a value marshaled as a JSON string is sent without its quotes
+	var str string
+	if json.Unmarshal(data, &str) == nil {
+		return str, nil
+	}
+	return string(data), nil
+}
+
+func (s *jsonStringable) FromString(val string) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return s.value.(json.Unmarshaler).UnmarshalJSON(data)
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPriority is an enum implementing encoding.TextUnmarshaler.
+type testPriority string
+
+func (p *testPriority) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low", "high":
+		*p = testPriority(text)
+		return nil
+	}
+	return errors.New("unknown priority " + string(text))
+}
+
+func (p testPriority) MarshalText() ([]byte, error) {
+	return []byte(p), nil
+}
+
+// testCoordinate only implements json.Unmarshaler, from strings like "1:2".
+type testCoordinate struct {
+	X, Y string
+}
+
+func (c *testCoordinate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var ok bool
+	c.X, c.Y, ok = strings.Cut(s, ":")
+	if !ok {
+		return errors.New("coordinate must be x:y")
+	}
+	return nil
+}
+
+func (c testCoordinate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.X + ":" + c.Y)
+}
+
+func TestFieldCoders(t *testing.T) {
+	type input struct {
+		IP         net.IP           `in:"query=ip"`
+		Addr       netip.Addr       `in:"header=X-Addr"`
+		Priority   testPriority     `in:"query=priority;default=low"`
+		Priorities []testPriority   `in:"query=p"`
+		At         testCoordinate   `in:"query=at"`
+		From       *testCoordinate  `in:"query=from"`
+		Path       []testCoordinate `in:"query=path"`
+	}
+
+	t.Run("decode", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?ip=10.0.0.1&p=high&p=low&at=1:2&path=0:0&path=3:4", nil)
+		req.Header.Set("X-Addr", "2001:db8::1")
+		param, err := MustBind[input](echo.New().NewContext(req, nil))
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1", param.IP.String())
+		assert.Equal(t, netip.MustParseAddr("2001:db8::1"), param.Addr)
+		assert.Equal(t, testPriority("low"), param.Priority)
+		assert.Equal(t, []testPriority{"high", "low"}, param.Priorities)
+		assert.Equal(t, testCoordinate{"1", "2"}, param.At)
+		assert.Nil(t, param.From)
+		assert.Equal(t, []testCoordinate{{"0", "0"}, {"3", "4"}}, param.Path)
+		assert.NoError(t, ValidateStruct[input]())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for target, field := range map[string]string{"/?priority=urgent": "priority", "/?at=1": "at", "/?ip=x": "ip"} {
+			_, err := MustBind[input](echo.New().NewContext(httptest.NewRequest(http.MethodGet, target, nil), nil))
+			var fieldErrs FieldErrors
+			if assert.ErrorAs(t, err, &fieldErrs, target) {
+				assert.Equal(t, field, fieldErrs[0].Field)
+			}
+		}
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		values, err := EncodeQuery(input{Priority: "high", At: testCoordinate{"1", "2"}, Path: []testCoordinate{{"3", "4"}}})
+		require.NoError(t, err)
+		assert.Equal(t, "high", values.Get("priority"))
+		assert.Equal(t, "1:2", values.Get("at"))
+		assert.Equal(t, []string{"3:4"}, values["path"])
+	})
+
+	t.Run("parameter helpers", func(t *testing.T) {
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/?ip=10.0.0.1&ips=10.0.0.1,10.0.0.2&priority=urgent&at=1:2", nil), nil)
+		var ip net.IP
+		var ips []net.IP
+		var priority testPriority
+		var at testCoordinate
+		require.NoError(t, GetQueryParam(ctx, "ip", &ip))
+		require.NoError(t, GetQueryParam(ctx, "ips", &ips))
+		require.NoError(t, GetQueryParam(ctx, "at", &at))
+		assert.Equal(t, "10.0.0.1", ip.String())
+		assert.Len(t, ips, 2)
+		assert.Equal(t, testCoordinate{"1", "2"}, at)
+		assert.EqualError(t, GetQueryParam(ctx, "priority", &priority), "unknown priority urgent")
+	})
+}
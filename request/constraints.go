@@ -0,0 +1,217 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/ggicci/httpin/core"
+)
+
+func init() {
+	core.RegisterDirective("min", &directiveConstraint{check: checkMin})
+	core.RegisterDirective("max", &directiveConstraint{check: checkMax})
+	core.RegisterDirective("len", &directiveConstraint{check: checkLen})
+	core.RegisterDirective("pattern", &directiveConstraint{check: checkPattern})
+}
+
+var (
+	// ErrOutOfRange is a number below the min or above the max directive of its field.
+	ErrOutOfRange = errors.New("value out of range")
+	// ErrInvalidLength is a string, slice or map with a length outside the min, max or
+	// len directive of its field.
+	ErrInvalidLength = errors.New("invalid length")
+	// ErrPatternMismatch is a string not matching the pattern directive of its field.
+	ErrPatternMismatch = errors.New("value does not match the pattern")
+)
+
+// directiveConstraint implements the "min", "max", "len" and "pattern" directives,
+// which check the value bound by the directives before them, and fail the binding
+// with a FieldError otherwise:
+//
+//   - min and max bound numbers, and the length of strings, slices and maps.
+//   - len is the exact length of strings, slices and maps.
+//   - pattern is a regular expression matched by strings, or every element of string
+//     slices. It cannot contain a semicolon, which separates the directives.
+//
+// Missing parameters are not checked, unless they are required.
+//
+//	type ListInput struct {
+//		Limit int    `in:"query=limit;required;min=1;max=100"`
+//		Sort  string `in:"query=sort;pattern=^[a-z_]+$"`
+//	}
+type directiveConstraint struct {
+	check func(rv reflect.Value, arg string) error
+}
+
+func (d *directiveConstraint) Decode(rtm *core.DirectiveRuntime) error {
+	if !rtm.IsFieldSet() {
+		return nil
+	}
+	rv := indirectValue(rtm.Value.Elem())
+	if !rv.IsValid() {
+		return nil
+	}
+	return d.check(rv, constraintArg(rtm.Directive.Argv))
+}
+
+// Encode leaves the request as is, the constraints are checked by the server.
+func (*directiveConstraint) Encode(*core.DirectiveRuntime) error {
+	return nil
+}
+
+// constraintArg joins the arguments of a directive split by the tag parser, like the
+// commas of a pattern.
+func constraintArg(argv []string) string {
+	return strings.Join(argv, ",")
+}
+
+func checkMin(rv reflect.Value, arg string) error {
+	return checkBound(rv, arg, "at least", func(x, bound float64) bool { return x >= bound })
+}
+
+func checkMax(rv reflect.Value, arg string) error {
+	return checkBound(rv, arg, "at most", func(x, bound float64) bool { return x <= bound })
+}
+
+func checkBound(rv reflect.Value, arg, relation string, ok func(x, bound float64) bool) error {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return fmt.Errorf("invalid bound %q: %w", arg, err)
+	}
+	if length, isLength := valueLength(rv); isLength {
+		if !ok(float64(length), bound) {
+			return fmt.Errorf("%w: length must be %s %s", ErrInvalidLength, relation, arg)
+		}
+		return nil
+	}
+	x, isNumber := numberValue(rv)
+	if !isNumber {
+		return fmt.Errorf("bound requires a number, string, slice or map, got %s", rv.Type())
+	}
+	if !ok(x, bound) {
+		return fmt.Errorf("%w: must be %s %s", ErrOutOfRange, relation, arg)
+	}
+	return nil
+}
+
+func checkLen(rv reflect.Value, arg string) error {
+	expected, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("invalid length %q: %w", arg, err)
+	}
+	length, ok := valueLength(rv)
+	if !ok {
+		return fmt.Errorf("len requires a string, slice or map, got %s", rv.Type())
+	}
+	if length != expected {
+		return fmt.Errorf("%w: length must be %d", ErrInvalidLength, expected)
+	}
+	return nil
+}
+
+func checkPattern(rv reflect.Value, arg string) error {
+	pattern, err := compilePattern(arg)
+	if err != nil {
+		return err
+	}
+	values := []reflect.Value{rv}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		values = make([]reflect.Value, rv.Len())
+		for i := range values {
+			values[i] = rv.Index(i)
+		}
+	}
+	for _, value := range values {
+		if value.Kind() != reflect.String {
+			return fmt.Errorf("pattern requires a string, got %s", rv.Type())
+		}
+		if !pattern.MatchString(value.String()) {
+			return fmt.Errorf("%w %s", ErrPatternMismatch, arg)
+		}
+	}
+	return nil
+}
+
+// patterns caches the compiled pattern directives.
+var patterns sync.Map
+
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if cached, ok := patterns.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", expr, err)
+	}
+	patterns.Store(expr, pattern)
+	return pattern, nil
+}
+
+// valueLength returns the length of strings in characters, and of slices and maps.
+func valueLength(rv reflect.Value) (int, bool) {
+	switch rv.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(rv.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len(), true
+	}
+	return 0, false
+}
+
+func numberValue(rv reflect.Value) (float64, bool) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// validateConstraint checks the argument of a constraint directive of a field of type
+// rt, for ValidateStruct.
+func validateConstraint(name, arg string, rt reflect.Type) error {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	zero := reflect.New(rt).Elem()
+	_, isLength := valueLength(zero)
+	_, isNumber := numberValue(zero)
+	switch name {
+	case "min", "max":
+		if _, err := strconv.ParseFloat(arg, 64); err != nil {
+			return fmt.Errorf("%s directive: invalid bound %q", name, arg)
+		}
+		if !isLength && !isNumber {
+			return fmt.Errorf("%s directive requires a number, string, slice or map, got %s", name, rt)
+		}
+	case "len":
+		if _, err := strconv.Atoi(arg); err != nil {
+			return fmt.Errorf("len directive: invalid length %q", arg)
+		}
+		if !isLength {
+			return fmt.Errorf("len directive requires a string, slice or map, got %s", rt)
+		}
+	case "pattern":
+		if _, err := compilePattern(arg); err != nil {
+			return fmt.Errorf("pattern directive: %w", err)
+		}
+		if rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array {
+			rt = rt.Elem()
+		}
+		if rt.Kind() != reflect.String {
+			return fmt.Errorf("pattern directive requires a string, got %s", rt)
+		}
+	}
+	return nil
+}
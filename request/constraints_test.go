@@ -0,0 +1,100 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type constrainedInput struct {
+	Limit  int      `in:"query=limit;required;min=1;max=100"`
+	Ratio  *float64 `in:"query=ratio;min=0;max=0.5"`
+	Sort   string   `in:"query=sort;pattern=^[a-z_]{1,10}$"`
+	Code   string   `in:"query=code;len=3"`
+	Tags   []string `in:"query=tag;max=2;pattern=^[a-z]+$"`
+	Tenant string   `in:"header=X-Tenant;min=2"`
+}
+
+func TestConstraintDirectives(t *testing.T) {
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		param, err := MustBind[constrainedInput](c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, param)
+	})
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		rec := serve("/?limit=100&ratio=0.5&sort=created_at&code=abc&tag=a&tag=b")
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	})
+
+	t.Run("missing optional parameters are not checked", func(t *testing.T) {
+		rec := serve("/?limit=1")
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		want   FieldError
+	}{
+		{"below min", "/?limit=0", FieldError{Field: "limit", Source: "query", Code: CodeOutOfRange, Message: "value out of range: must be at least 1"}},
+		{"above max", "/?limit=101", FieldError{Field: "limit", Source: "query", Code: CodeOutOfRange, Message: "value out of range: must be at most 100"}},
+		{"float above max", "/?limit=1&ratio=0.7", FieldError{Field: "ratio", Source: "query", Code: CodeOutOfRange, Message: "value out of range: must be at most 0.5"}},
+		{"pattern", "/?limit=1&sort=Name", FieldError{Field: "sort", Source: "query", Code: CodePatternMismatch, Message: "value does not match the pattern ^[a-z_]{1,10}$"}},
+		{"len", "/?limit=1&code=abcd", FieldError{Field: "code", Source: "query", Code: CodeInvalidLength, Message: "invalid length: length must be 3"}},
+		{"slice length", "/?limit=1&tag=a&tag=b&tag=c", FieldError{Field: "tag", Source: "query", Code: CodeInvalidLength, Message: "invalid length: length must be at most 2"}},
+		{"slice element pattern", "/?limit=1&tag=a&tag=B", FieldError{Field: "tag", Source: "query", Code: CodePatternMismatch, Message: "value does not match the pattern ^[a-z]+$"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := e.NewContext(httptest.NewRequest(http.MethodGet, tt.target, nil), nil)
+			_, err := MustBind[constrainedInput](ctx)
+			var httpErr *echo.HTTPError
+			require.ErrorAs(t, err, &httpErr)
+			assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+			var fieldErrs FieldErrors
+			require.ErrorAs(t, err, &fieldErrs)
+			assert.Equal(t, FieldErrors{tt.want}, fieldErrs)
+		})
+	}
+
+	t.Run("header length", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?limit=1", nil)
+		req.Header.Set("X-Tenant", "a")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"invalid_length"`)
+	})
+}
+
+func TestValidateStructConstraints(t *testing.T) {
+	assert.NoError(t, ValidateStruct[constrainedInput]())
+
+	type invalidBound struct {
+		Limit int `in:"query=limit;min=one"`
+	}
+	assert.ErrorContains(t, ValidateStruct[invalidBound](), "invalid bound")
+	type invalidPattern struct {
+		Sort string `in:"query=sort;pattern=[a-"`
+	}
+	assert.ErrorContains(t, ValidateStruct[invalidPattern](), "invalid pattern")
+	type lenOfNumber struct {
+		Limit int `in:"query=limit;len=2"`
+	}
+	assert.ErrorContains(t, ValidateStruct[lenOfNumber](), "len directive requires")
+}
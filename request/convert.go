@@ -0,0 +1,184 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// converter sets the target value from the string representation of a parameter.
+type converter func(target reflect.Value, val string) error
+
+// converters maps each kind to its converter. Kinds without an entry are
+// decoded by treating the value as a JSON string, see convertJSON, like types
+// implementing json.Unmarshaler. Types implementing encoding.TextUnmarshaler are
+// decoded with UnmarshalText.
+var converters map[reflect.Kind]converter
+
+func init() {
+	converters = map[reflect.Kind]converter{
+		reflect.String:  convertString,
+		reflect.Bool:    convertBool,
+		reflect.Int:     convertInt,
+		reflect.Int8:    convertInt,
+		reflect.Int16:   convertInt,
+		reflect.Int32:   convertInt,
+		reflect.Int64:   convertInt,
+		reflect.Uint:    convertUint,
+		reflect.Uint8:   convertUint,
+		reflect.Uint16:  convertUint,
+		reflect.Uint32:  convertUint,
+		reflect.Uint64:  convertUint,
+		reflect.Float32: convertFloat,
+		reflect.Float64: convertFloat,
+		reflect.Slice:   convertSlice,
+		reflect.Pointer: convertPointer,
+	}
+}
+
+func convertToType[T any](target *T, val string) error {
+	return convertValue(reflect.ValueOf(target).Elem(), val)
+}
+
+// isSliceType reports whether the parameter is bound as a list of elements, unlike
+// slice types decoding themselves like net.IP.
+func isSliceType[T any](target *T) bool {
+	rt := reflect.TypeOf(target).Elem()
+	if _, registered := typeConverters[rt]; registered {
+		return false
+	}
+	return rt.Kind() == reflect.Slice && !reflect.PointerTo(rt).Implements(textUnmarshalerType)
+}
+
+func convertValue(target reflect.Value, val string) error {
+	return converterFor(target.Type())(target, val)
+}
+
+func converterFor(rt reflect.Type) converter {
+	if conv, ok := typeConverters[rt]; ok {
+		return conv
+	}
+	switch ptr := reflect.PointerTo(rt); {
+	case ptr.Implements(textUnmarshalerType):
+		return convertText
+	case ptr.Implements(jsonUnmarshalerType):
+		return convertJSON
+	}
+	if conv, ok := converters[rt.Kind()]; ok {
+		return conv
+	}
+	return convertJSON
+}
+
+func convertString(target reflect.Value, val string) error {
+	target.SetString(val)
+	return nil
+}
+
+func convertBool(target reflect.Value, val string) error {
+	x, err := strconv.ParseBool(val)
+	if err != nil {
+		return err
+	}
+	target.SetBool(x)
+	return nil
+}
+
+func convertInt(target reflect.Value, val string) error {
+	x, err := strconv.ParseInt(val, 10, target.Type().Bits())
+	if err != nil {
+		return err
+	}
+	target.SetInt(x)
+	return nil
+}
+
+func convertUint(target reflect.Value, val string) error {
+	x, err := strconv.ParseUint(val, 10, target.Type().Bits())
+	if err != nil {
+		return err
+	}
+	target.SetUint(x)
+	return nil
+}
+
+func convertFloat(target reflect.Value, val string) error {
+	x, err := strconv.ParseFloat(val, target.Type().Bits())
+	if err != nil {
+		return err
+	}
+	target.SetFloat(x)
+	return nil
+}
+
+func convertText(target reflect.Value, val string) error {
+	return target.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val))
+}
+
+// convertPointer allocates the value pointed to and converts into it, so an optional
+// parameter bound into a pointer stays nil when it is missing.
+func convertPointer(target reflect.Value, val string) error {
+	elem := reflect.New(target.Type().Elem())
+	err := convertValue(elem.Elem(), val)
+	if err != nil {
+		return err
+	}
+	target.Set(elem)
+	return nil
+}
+
+// convertSlice splits the value on commas and converts every element with the
+// converter of the element kind.
+func convertSlice(target reflect.Value, val string) error {
+	return convertSliceValues(target, splitList(val))
+}
+
+func convertSliceValues(target reflect.Value, parts []string) error {
+	conv := converterFor(target.Type().Elem())
+	slice := reflect.MakeSlice(target.Type(), len(parts), len(parts))
+	for i, part := range parts {
+		err := conv(slice.Index(i), part)
+		if err != nil {
+			return err
+		}
+	}
+	target.Set(slice)
+	return nil
+}
+
+// splitList splits a comma separated list. A comma escaped with a backslash,
+// like `a\,b`, is kept as part of the element.
+func splitList(val string) []string {
+	if !strings.Contains(val, `\,`) {
+		return strings.Split(val, ",")
+	}
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(val); i++ {
+		switch {
+		case val[i] == '\\' && i+1 < len(val) && val[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case val[i] == ',':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(val[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+// convertJSON decodes the value as a JSON string into the target, which lets
+// types implementing json.Unmarshaler handle their own format.
+func convertJSON(target reflect.Value, val string) error {
+	bodyBytes, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bodyBytes, target.Addr().Interface())
+}
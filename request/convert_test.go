@@ -0,0 +1,88 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertToType(t *testing.T) {
+	t.Run("int64", func(t *testing.T) {
+		var res int64
+		assert.NoError(t, convertToType(&res, "9007199254740993"))
+		assert.Equal(t, int64(9007199254740993), res)
+	})
+	t.Run("int8 overflow", func(t *testing.T) {
+		var res int8
+		assert.Error(t, convertToType(&res, "300"))
+	})
+	t.Run("uint", func(t *testing.T) {
+		var res uint
+		assert.NoError(t, convertToType(&res, "42"))
+		assert.Equal(t, uint(42), res)
+	})
+	t.Run("negative uint", func(t *testing.T) {
+		var res uint
+		assert.Error(t, convertToType(&res, "-1"))
+	})
+	t.Run("float32", func(t *testing.T) {
+		var res float32
+		assert.NoError(t, convertToType(&res, "1.5"))
+		assert.Equal(t, float32(1.5), res)
+	})
+	t.Run("named string type", func(t *testing.T) {
+		type status string
+		var res status
+		assert.NoError(t, convertToType(&res, "active"))
+		assert.Equal(t, status("active"), res)
+	})
+	t.Run("[]int", func(t *testing.T) {
+		var res []int
+		assert.NoError(t, convertToType(&res, "1,2,3"))
+		assert.Equal(t, []int{1, 2, 3}, res)
+	})
+	t.Run("[]int with invalid element", func(t *testing.T) {
+		var res []int
+		assert.Error(t, convertToType(&res, "1,x,3"))
+	})
+	t.Run("*int", func(t *testing.T) {
+		var res *int
+		assert.NoError(t, convertToType(&res, "0"))
+		if assert.NotNil(t, res) {
+			assert.Equal(t, 0, *res)
+		}
+		assert.Error(t, convertToType(&res, "x"))
+	})
+	t.Run("json fallback", func(t *testing.T) {
+		var res time.Time
+		assert.NoError(t, convertToType(&res, "2024-01-02T03:04:05Z"))
+		assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), res)
+	})
+}
+
+func BenchmarkConvertToType(b *testing.B) {
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		res := ""
+		for i := 0; i < b.N; i++ {
+			_ = convertToType(&res, "john")
+		}
+	})
+	b.Run("int", func(b *testing.B) {
+		b.ReportAllocs()
+		res := 0
+		for i := 0; i < b.N; i++ {
+			_ = convertToType(&res, "42")
+		}
+	})
+	b.Run("[]string", func(b *testing.B) {
+		b.ReportAllocs()
+		res := []string{}
+		for i := 0; i < b.N; i++ {
+			_ = convertToType(&res, "a,b,c")
+		}
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPosition struct {
+	LastID    int       `json:"last_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func TestCursorCodec(t *testing.T) {
+	codec := NewCursorCodec([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	codec.now = func() time.Time { return now }
+	position := testPosition{LastID: 42, CreatedAt: now.Add(-time.Minute)}
+
+	cursor, err := codec.Encode(position)
+	require.NoError(t, err)
+	assert.Equal(t, url.QueryEscape(cursor), cursor, "cursor must be URL safe")
+
+	t.Run("round trip", func(t *testing.T) {
+		var got testPosition
+		require.NoError(t, codec.Decode(cursor, &got))
+		assert.Equal(t, position, got)
+	})
+	t.Run("tampered", func(t *testing.T) {
+		other, err := codec.Encode(testPosition{LastID: 1})
+		require.NoError(t, err)
+		encoded, _, _ := strings.Cut(other, ".")
+		_, signature, _ := strings.Cut(cursor, ".")
+
+		var got testPosition
+		assert.ErrorIs(t, codec.Decode(encoded+"."+signature, &got), ErrInvalidCursor)
+		assert.ErrorIs(t, codec.Decode("garbage", &got), ErrInvalidCursor)
+		assert.ErrorIs(t, codec.Decode(encoded+".!!", &got), ErrInvalidCursor)
+	})
+	t.Run("other key", func(t *testing.T) {
+		var got testPosition
+		other := NewCursorCodec([]byte("another key"), time.Hour)
+		assert.ErrorIs(t, other.Decode(cursor, &got), ErrInvalidCursor)
+	})
+	t.Run("expired", func(t *testing.T) {
+		expired := *codec
+		expired.now = func() time.Time { return now.Add(2 * time.Hour) }
+		var got testPosition
+		assert.ErrorIs(t, expired.Decode(cursor, &got), ErrCursorExpired)
+	})
+	t.Run("wrong target type", func(t *testing.T) {
+		var got []string
+		assert.ErrorIs(t, codec.Decode(cursor, &got), ErrInvalidCursor)
+	})
+}
+
+func TestCursorCodecWithoutExpiry(t *testing.T) {
+	codec := NewCursorCodec([]byte("key"), 0)
+	cursor, err := codec.Encode(map[string]int{"offset": 10})
+	require.NoError(t, err)
+
+	codec.now = func() time.Time { return time.Now().AddDate(10, 0, 0) }
+	var got map[string]int
+	require.NoError(t, codec.Decode(cursor, &got))
+	assert.Equal(t, 10, got["offset"])
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/ggicci/httpin/core"
+)
+
+// typeConverters are the converters of the types registered with RegisterDecoder,
+// which take precedence over the converters of their kind.
+var typeConverters = map[reflect.Type]converter{}
+
+// RegisterDecoder registers how a parameter of type T, like a money amount, an id or
+// an enum, is decoded from its string representation, for the query, header, path
+// and form directives of the binder, and for GetQueryParam, GetPathParams and
+// GetHeaderParams. Slices and pointers of T are supported too. Values of T are encoded,
+// e.g. by EncodeQuery, with their String method, or else with fmt.Sprint.
+//
+// It must be called before binding, typically from init, and replaces the decoder of
+// any type including the built-in ones.
+//
+//	func init() {
+//		request.RegisterDecoder(func(s string) (Amount, error) {
+//			return ParseAmount(s)
+//		})
+//	}
+func RegisterDecoder[T any](decode func(string) (T, error)) {
+	core.RegisterCoder[T](func(v *T) (core.Stringable, error) {
+		return &decoderStringable[T]{value: v, decode: decode}, nil
+	})
+	typeConverters[reflect.TypeOf((*T)(nil)).Elem()] = func(target reflect.Value, val string) error {
+		decoded, err := decode(val)
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(decoded))
+		return nil
+	}
+}
+
+// decoderStringable converts a value of a type registered with RegisterDecoder from
+// and to strings.
+type decoderStringable[T any] struct {
+	value  *T
+	decode func(string) (T, error)
+}
+
+func (s *decoderStringable[T]) ToString() (string, error) {
+	if stringer, ok := any(*s.value).(fmt.Stringer); ok {
+		return stringer.String(), nil
+	}
+	return fmt.Sprint(*s.value), nil
+}
+
+func (s *decoderStringable[T]) FromString(val string) error {
+	decoded, err := s.decode(val)
+	if err != nil {
+		return err
+	}
+	*s.value = decoded
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAmount is an amount in cents, written like "12.34".
+type testAmount int64
+
+func (a testAmount) String() string {
+	return fmt.Sprintf("%d.%02d", a/100, a%100)
+}
+
+func parseTestAmount(s string) (testAmount, error) {
+	units, cents, ok := strings.Cut(s, ".")
+	if !ok || len(cents) != 2 {
+		return 0, errors.New("amount must have two decimals")
+	}
+	value, err := strconv.ParseInt(units+cents, 10, 64)
+	return testAmount(value), err
+}
+
+func init() {
+	RegisterDecoder(parseTestAmount)
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	type input struct {
+		Min     testAmount   `in:"query=min"`
+		Max     *testAmount  `in:"query=max"`
+		Amounts []testAmount `in:"query=amount"`
+		Limit   testAmount   `in:"header=X-Limit;default=1.00"`
+	}
+
+	t.Run("binder", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?min=1.50&max=20.00&amount=0.99&amount=2.00", nil)
+		param, err := MustBind[input](echo.New().NewContext(req, nil))
+		require.NoError(t, err)
+		assert.Equal(t, testAmount(150), param.Min)
+		require.NotNil(t, param.Max)
+		assert.Equal(t, testAmount(2000), *param.Max)
+		assert.Equal(t, []testAmount{99, 200}, param.Amounts)
+		assert.Equal(t, testAmount(100), param.Limit)
+		assert.NoError(t, ValidateStruct[input]())
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?min=1.5", nil)
+		_, err := MustBind[input](echo.New().NewContext(req, nil))
+		var fieldErrs FieldErrors
+		require.ErrorAs(t, err, &fieldErrs)
+		assert.Equal(t, FieldError{Field: "min", Source: "query", Code: CodeInvalid, Message: "amount must have two decimals"}, fieldErrs[0])
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		values, err := EncodeQuery(input{Min: 150, Amounts: []testAmount{5}})
+		require.NoError(t, err)
+		assert.Equal(t, "1.50", values.Get("min"))
+		assert.Equal(t, []string{"0.05"}, values["amount"])
+	})
+
+	t.Run("parameter helpers", func(t *testing.T) {
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/?min=3.00&amount=1.00,2.00", nil), nil)
+		var min testAmount
+		var amounts []testAmount
+		var max *testAmount
+		require.NoError(t, GetQueryParam(ctx, "min", &min))
+		require.NoError(t, GetQueryParam(ctx, "amount", &amounts))
+		require.NoError(t, GetQueryParam(ctx, "max", &max))
+		assert.Equal(t, testAmount(300), min)
+		assert.Equal(t, []testAmount{100, 200}, amounts)
+		assert.Nil(t, max)
+
+		ctx.SetParamNames("price")
+		ctx.SetParamValues("4")
+		assert.Error(t, GetPathParams(ctx, "price", &min))
+	})
+}
@@ -0,0 +1,229 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/ggicci/httpin/core"
+)
+
+func init() {
+	core.RegisterDirective("headers", &directiveHeaders{})
+	// replace the source directives of httpin: the query directive binds nothing
+	// without a key, and empty values fail instead of using the default directive
+	core.RegisterDirective("query", WithFieldCoders(&directiveQuery{}), true)
+	core.RegisterDirective("header", WithFieldCoders(&directiveHeader{}), true)
+	core.RegisterDirective("form", WithFieldCoders(&directiveForm{}), true)
+	core.RegisterDirective("cookie", WithFieldCoders(&directiveCookie{}))
+}
+
+var (
+	stringSliceMapType = reflect.TypeOf(map[string][]string{})
+	stringMapType      = reflect.TypeOf(map[string]string{})
+)
+
+// directiveHeaders implements the "headers" directive, which binds the complete
+// set of request headers into a field of type http.Header or map[string][]string.
+//
+//	type ForwardInput struct {
+//		Headers http.Header `in:"headers"`
+//	}
+type directiveHeaders struct{}
+
+func (*directiveHeaders) Decode(rtm *core.DirectiveRuntime) error {
+	target := rtm.Value.Elem()
+	if !target.Type().ConvertibleTo(stringSliceMapType) {
+		return fmt.Errorf("headers directive requires http.Header or map[string][]string, got %s", target.Type())
+	}
+	headers := map[string][]string(rtm.GetRequest().Header.Clone())
+	if headers == nil {
+		headers = map[string][]string{}
+	}
+	target.Set(reflect.ValueOf(headers).Convert(target.Type()))
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+func (*directiveHeaders) Encode(rtm *core.DirectiveRuntime) error {
+	target := rtm.Value
+	if !target.Type().ConvertibleTo(stringSliceMapType) {
+		return fmt.Errorf("headers directive requires http.Header or map[string][]string, got %s", target.Type())
+	}
+	headers := target.Convert(stringSliceMapType).Interface().(map[string][]string)
+	builder := rtm.GetRequestBuilder()
+	for key, values := range headers {
+		builder.SetHeader(http.CanonicalHeaderKey(key), values)
+	}
+	return nil
+}
+
+// directiveQuery implements the "query" directive. With a key it extracts the query
+// parameter, like the directive of httpin. Without a key it binds the complete query
+// string into a field of type url.Values, map[string][]string, or map[string]string
+// keeping the first value of each parameter, e.g. for passthrough handlers.
+//
+//	type SearchInput struct {
+//		Query string     `in:"query=q"`
+//		All   url.Values `in:"query"`
+//	}
+type directiveQuery struct {
+	core.DirectiveQuery
+}
+
+func (d *directiveQuery) Decode(rtm *core.DirectiveRuntime) error {
+	query := rtm.GetRequest().URL.Query()
+	if len(rtm.Directive.Argv) > 0 {
+		return ExtractValues(rtm, query, nil)
+	}
+	target := rtm.Value.Elem()
+	if err := checkQueryMapType(target.Type()); err != nil {
+		return err
+	}
+	if target.Type().ConvertibleTo(stringSliceMapType) {
+		target.Set(reflect.ValueOf(map[string][]string(query)).Convert(target.Type()))
+	} else {
+		values := make(map[string]string, len(query))
+		for key := range query {
+			values[key] = query.Get(key)
+		}
+		target.Set(reflect.ValueOf(values).Convert(target.Type()))
+	}
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+// checkQueryMapType returns an error for fields a query directive without a key cannot bind.
+func checkQueryMapType(rt reflect.Type) error {
+	if rt.ConvertibleTo(stringSliceMapType) || rt.ConvertibleTo(stringMapType) {
+		return nil
+	}
+	return fmt.Errorf("query directive without a key requires url.Values, map[string][]string or map[string]string, got %s", rt)
+}
+
+func (d *directiveQuery) Encode(rtm *core.DirectiveRuntime) error {
+	if len(rtm.Directive.Argv) > 0 {
+		return d.DirectiveQuery.Encode(rtm)
+	}
+	values := url.Values{}
+	if err := encodeQueryMap(values, rtm.Resolver.Field.Name, rtm.Value); err != nil {
+		return err
+	}
+	builder := rtm.GetRequestBuilder()
+	for key, vals := range values {
+		builder.SetQuery(key, vals)
+	}
+	return nil
+}
+
+// directiveHeader implements the "header" directive, like the directive of httpin.
+type directiveHeader struct {
+	core.DirectiveHeader
+}
+
+func (*directiveHeader) Decode(rtm *core.DirectiveRuntime) error {
+	return ExtractValues(rtm, rtm.GetRequest().Header, http.CanonicalHeaderKey)
+}
+
+// directiveForm implements the "form" directive, like the directive of httpin.
+type directiveForm struct {
+	core.DirectvieForm
+}
+
+func (*directiveForm) Decode(rtm *core.DirectiveRuntime) error {
+	req := rtm.GetRequest()
+	var form multipart.Form
+	if req.MultipartForm != nil {
+		form = *req.MultipartForm
+	} else if req.Form != nil {
+		form.Value = req.Form
+	}
+	form.Value = withoutEmptyValues(rtm, form.Value, nil)
+	extractor := &core.FormExtractor{Runtime: rtm, Form: form}
+	return extractor.Extract()
+}
+
+// directiveCookie implements the "cookie" directive, which binds the value of a
+// cookie, like the query directive binds a query parameter, with the required,
+// default and validation directives.
+//
+//	type SessionInput struct {
+//		SessionID string `in:"cookie=session_id;required"`
+//		Theme     string `in:"cookie=theme;default=light"`
+//	}
+type directiveCookie struct{}
+
+func (*directiveCookie) Decode(rtm *core.DirectiveRuntime) error {
+	cookies := map[string][]string{}
+	for _, cookie := range rtm.GetRequest().Cookies() {
+		cookies[cookie.Name] = append(cookies[cookie.Name], cookie.Value)
+	}
+	return ExtractValues(rtm, cookies, nil)
+}
+
+func (*directiveCookie) Encode(rtm *core.DirectiveRuntime) error {
+	builder := rtm.GetRequestBuilder()
+	encoder := &core.FormEncoder{
+		Setter: func(name string, values []string) {
+			for _, value := range values {
+				builder.Cookie = append(builder.Cookie, &http.Cookie{Name: name, Value: value})
+			}
+		},
+	}
+	return encoder.Execute(rtm)
+}
+
+// ExtractValues extracts the field of a directive from the values of a request part,
+// like the parameters of the query string, as the query, header and form directives
+// do. It is meant for custom source directives.
+func ExtractValues(rtm *core.DirectiveRuntime, values map[string][]string, normalizeKey func(string) string) error {
+	extractor := &core.FormExtractor{
+		Runtime:       rtm,
+		Form:          multipart.Form{Value: withoutEmptyValues(rtm, values, normalizeKey)},
+		KeyNormalizer: normalizeKey,
+	}
+	return extractor.Extract()
+}
+
+// withoutEmptyValues drops the keys of the field only given empty values, like
+// ?limit=, when the field has a default directive, so the default applies like for
+// a missing value.
+func withoutEmptyValues(rtm *core.DirectiveRuntime, values map[string][]string, normalizeKey func(string) string) map[string][]string {
+	if rtm.Resolver.GetDirective("default") == nil {
+		return values
+	}
+	var filtered map[string][]string
+	for _, key := range rtm.Directive.Argv {
+		if normalizeKey != nil {
+			key = normalizeKey(key)
+		}
+		if !allEmpty(values[key]) {
+			continue
+		}
+		if filtered == nil {
+			filtered = make(map[string][]string, len(values))
+			for k, v := range values {
+				filtered[k] = v
+			}
+		}
+		delete(filtered, key)
+	}
+	if filtered == nil {
+		return values
+	}
+	return filtered
+}
+
+// allEmpty reports whether the values are only empty strings.
+func allEmpty(values []string) bool {
+	for _, value := range values {
+		if value != "" {
+			return false
+		}
+	}
+	return len(values) > 0
+}
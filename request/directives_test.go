@@ -0,0 +1,209 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ggicci/httpin"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadersDirective(t *testing.T) {
+	t.Run("http.Header", func(t *testing.T) {
+		type input struct {
+			Token   string      `in:"header=X-Token"`
+			Headers http.Header `in:"headers"`
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Token", "secret")
+		req.Header.Add("Accept", "text/html")
+		req.Header.Add("Accept", "application/json")
+
+		res := input{}
+		assert.NoError(t, GetRequestParameters(req, &res))
+		assert.Equal(t, "secret", res.Token)
+		assert.Equal(t, []string{"text/html", "application/json"}, res.Headers.Values("Accept"))
+
+		// the bound headers are a copy of the request headers
+		res.Headers.Set("X-Token", "changed")
+		assert.Equal(t, "secret", req.Header.Get("X-Token"))
+	})
+	t.Run("map[string][]string", func(t *testing.T) {
+		type input struct {
+			Headers map[string][]string `in:"headers"`
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Token", "secret")
+
+		res := input{}
+		assert.NoError(t, GetRequestParameters(req, &res))
+		assert.Equal(t, []string{"secret"}, res.Headers["X-Token"])
+	})
+	t.Run("unsupported type", func(t *testing.T) {
+		type input struct {
+			Headers map[string]string `in:"headers"`
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.Error(t, GetRequestParameters(req, &input{}))
+	})
+	t.Run("encode", func(t *testing.T) {
+		type input struct {
+			Headers http.Header `in:"headers"`
+		}
+		req, err := httpin.NewRequest(http.MethodGet, "/", &input{Headers: http.Header{"X-Token": {"secret"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", req.Header.Get("X-Token"))
+	})
+}
+
+func TestQueryDirective(t *testing.T) {
+	t.Run("url.Values", func(t *testing.T) {
+		type input struct {
+			Query string     `in:"query=q"`
+			All   url.Values `in:"query"`
+		}
+		req := httptest.NewRequest(http.MethodGet, "/?q=shoes&tag=a&tag=b", nil)
+
+		res := input{}
+		assert.NoError(t, GetRequestParameters(req, &res))
+		assert.Equal(t, "shoes", res.Query)
+		assert.Equal(t, url.Values{"q": {"shoes"}, "tag": {"a", "b"}}, res.All)
+	})
+	t.Run("map[string][]string", func(t *testing.T) {
+		type input struct {
+			All map[string][]string `in:"query"`
+		}
+		req := httptest.NewRequest(http.MethodGet, "/?tag=a&tag=b", nil)
+
+		res := input{}
+		assert.NoError(t, GetRequestParameters(req, &res))
+		assert.Equal(t, map[string][]string{"tag": {"a", "b"}}, res.All)
+	})
+	t.Run("map[string]string", func(t *testing.T) {
+		type input struct {
+			All map[string]string `in:"query"`
+		}
+		req := httptest.NewRequest(http.MethodGet, "/?tag=a&tag=b&q=shoes", nil)
+
+		res := input{}
+		assert.NoError(t, GetRequestParameters(req, &res))
+		assert.Equal(t, map[string]string{"tag": "a", "q": "shoes"}, res.All)
+	})
+	t.Run("empty query", func(t *testing.T) {
+		type input struct {
+			All url.Values `in:"query"`
+		}
+		res := input{}
+		assert.NoError(t, GetRequestParameters(httptest.NewRequest(http.MethodGet, "/", nil), &res))
+		assert.Equal(t, url.Values{}, res.All)
+	})
+	t.Run("unsupported type", func(t *testing.T) {
+		type input struct {
+			All []string `in:"query"`
+		}
+		req := httptest.NewRequest(http.MethodGet, "/?tag=a", nil)
+		assert.Error(t, GetRequestParameters(req, &input{}))
+	})
+	t.Run("encode", func(t *testing.T) {
+		type input struct {
+			Query string     `in:"query=q"`
+			All   url.Values `in:"query"`
+		}
+		req, err := httpin.NewRequest(http.MethodGet, "/", &input{Query: "shoes", All: url.Values{"tag": {"a", "b"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, url.Values{"q": {"shoes"}, "tag": {"a", "b"}}, req.URL.Query())
+	})
+}
+
+func TestDefaultDirective(t *testing.T) {
+	type input struct {
+		Limit   int    `in:"query=limit;default=50"`
+		Offset  int    `in:"query=offset"`
+		Verbose bool   `in:"query=verbose;default=true"`
+		Sort    string `in:"header=X-Sort;default=name"`
+		Color   string `in:"form=color;default=blue"`
+	}
+	bind := func(target string, header http.Header) (input, error) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		var res input
+		err := GetRequestParameters(req, &res)
+		return res, err
+	}
+
+	t.Run("absent", func(t *testing.T) {
+		res, err := bind("/", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, input{Limit: 50, Verbose: true, Sort: "name", Color: "blue"}, res)
+	})
+	t.Run("empty", func(t *testing.T) {
+		res, err := bind("/?limit=&verbose=&color=", http.Header{"X-Sort": {""}})
+		assert.NoError(t, err)
+		assert.Equal(t, input{Limit: 50, Verbose: true, Sort: "name", Color: "blue"}, res)
+	})
+	t.Run("given", func(t *testing.T) {
+		res, err := bind("/?limit=10&verbose=false&color=red", http.Header{"X-Sort": {"date"}})
+		assert.NoError(t, err)
+		assert.Equal(t, input{Limit: 10, Sort: "date", Color: "red"}, res)
+	})
+	t.Run("empty without default", func(t *testing.T) {
+		_, err := bind("/?offset=", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestCookieDirective(t *testing.T) {
+	type input struct {
+		SessionID string `in:"cookie=session_id;required"`
+		Theme     string `in:"cookie=theme;default=light"`
+		Visits    int    `in:"cookie=visits"`
+	}
+
+	t.Run("decode", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: "abc"})
+		req.AddCookie(&http.Cookie{Name: "visits", Value: "3"})
+		var res input
+		assert.NoError(t, GetRequestParameters(req, &res))
+		assert.Equal(t, input{SessionID: "abc", Theme: "light", Visits: 3}, res)
+		assert.NoError(t, ValidateStruct[input]())
+	})
+	t.Run("required", func(t *testing.T) {
+		_, err := MustBind[input](echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), nil))
+		var fieldErrs FieldErrors
+		if assert.ErrorAs(t, err, &fieldErrs) {
+			assert.Equal(t, FieldError{Field: "session_id", Source: "cookie", Code: CodeRequired, Message: "missing required field"}, fieldErrs[0])
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: "abc"})
+		req.AddCookie(&http.Cookie{Name: "visits", Value: "many"})
+		_, err := MustBind[input](echo.New().NewContext(req, nil))
+		var fieldErrs FieldErrors
+		if assert.ErrorAs(t, err, &fieldErrs) {
+			assert.Equal(t, "visits", fieldErrs[0].Field)
+			assert.Equal(t, "cookie", fieldErrs[0].Source)
+			assert.Equal(t, CodeInvalidFormat, fieldErrs[0].Code)
+		}
+	})
+	t.Run("encode", func(t *testing.T) {
+		req, err := httpin.NewRequest(http.MethodGet, "/", &input{SessionID: "abc", Visits: 2})
+		assert.NoError(t, err)
+		cookie, err := req.Cookie("session_id")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "abc", cookie.Value)
+		}
+		cookie, err = req.Cookie("visits")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "2", cookie.Value)
+		}
+	})
+}
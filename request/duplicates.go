@@ -0,0 +1,72 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// DuplicateKeyError is returned by GetBody with the DisallowDuplicateKeys option
+// when a JSON object in the body contains the same key more than once.
+type DuplicateKeyError struct {
+	// Key is the path of the duplicated key, like "user.emails[1].address".
+	Key string
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %q in request body", e.Key)
+}
+
+// checkDuplicateKeys walks the JSON document and returns a *DuplicateKeyError for
+// the first object key that appears twice in the same object.
+func checkDuplicateKeys(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return checkDuplicateKeysIn(decoder, "")
+}
+
+func checkDuplicateKeysIn(decoder *json.Decoder, path string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return nil
+	}
+	switch delim {
+	case '{':
+		seen := make(map[string]bool)
+		for decoder.More() {
+			token, err = decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := token.(string)
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			if seen[key] {
+				return &DuplicateKeyError{Key: keyPath}
+			}
+			seen[key] = true
+			err = checkDuplicateKeysIn(decoder, keyPath)
+			if err != nil {
+				return err
+			}
+		}
+	case '[':
+		for i := 0; decoder.More(); i++ {
+			err = checkDuplicateKeysIn(decoder, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// consume the closing delimiter
+	_, err = decoder.Token()
+	return err
+}
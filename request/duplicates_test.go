@@ -0,0 +1,58 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisallowDuplicateKeys(t *testing.T) {
+	type user struct {
+		Role string `json:"role"`
+	}
+	newContext := func(body string) echo.Context {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+		return echo.New().NewContext(req, nil)
+	}
+
+	t.Run("duplicates are accepted by default", func(t *testing.T) {
+		res := user{}
+		err := GetBody(newContext(`{"role": "user", "role": "admin"}`), &res)
+		assert.NoError(t, err)
+		assert.Equal(t, "admin", res.Role)
+	})
+	t.Run("top level duplicate", func(t *testing.T) {
+		res := user{}
+		err := GetBody(newContext(`{"role": "user", "role": "admin"}`), &res, DisallowDuplicateKeys())
+
+		var dupErr *DuplicateKeyError
+		assert.True(t, errors.As(err, &dupErr))
+		assert.Equal(t, "role", dupErr.Key)
+		assert.Equal(t, "", res.Role)
+	})
+	t.Run("nested duplicate", func(t *testing.T) {
+		res := map[string]any{}
+		err := GetBody(newContext(`{"users": [{"id": 1}, {"id": 2, "id": 3}]}`), &res, DisallowDuplicateKeys())
+
+		var dupErr *DuplicateKeyError
+		assert.True(t, errors.As(err, &dupErr))
+		assert.Equal(t, "users[1].id", dupErr.Key)
+	})
+	t.Run("same key in different objects", func(t *testing.T) {
+		res := map[string]any{}
+		err := GetBody(newContext(`{"a": {"id": 1}, "b": {"id": 2}}`), &res, DisallowDuplicateKeys())
+		assert.NoError(t, err)
+	})
+	t.Run("invalid json", func(t *testing.T) {
+		res := user{}
+		err := GetBody(newContext(`{"role": `), &res, DisallowDuplicateKeys())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/ggicci/httpin"
+)
+
+// NewRequest builds an outgoing request from a struct with `in` tags, the inverse of
+// GetRequestParameters, so a client and a server can share one definition of the
+// parameters of an operation. Path parameters replace the placeholders of the url,
+// written as in echo routes like /users/:id, or as /users/{id}. Query parameters and
+// headers are encoded like the binder decodes them, and a `in:"body=json"` field becomes
+// the JSON body. Bodies in a format registered with RegisterSerializer get its content type.
+//
+// Usage:
+//
+//	type GetUserInput struct {
+//		ID     string   `in:"path=id"`
+//		Fields []string `in:"query=fields"`
+//	}
+//
+//	req, err := request.NewRequest(ctx, http.MethodGet, "http://users/users/:id", &GetUserInput{ID: "42"})
+func NewRequest(ctx context.Context, method, target string, input any) (*http.Request, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = pathPlaceholders(u.Path)
+	u.RawPath = ""
+	req, err := httpin.NewRequestWithContext(ctx, method, u.String(), input)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil && req.Header.Get("Content-Type") == "" {
+		if contentType := formatContentType(inputBodyFormat(input)); contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+	return req, nil
+}
+
+// inputBodyFormat returns the format of the body directive of the input struct.
+func inputBodyFormat(input any) string {
+	t := reflect.TypeOf(input)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if args, ok := parseInTag(t.Field(i).Tag.Get("in"))["body"]; ok {
+			if len(args) == 0 {
+				return "json"
+			}
+			return strings.ToLower(args[0])
+		}
+	}
+	return ""
+}
+
+// pathPlaceholders replaces the echo placeholders of the path, like :id, with the
+// {id} placeholders understood by httpin.
+func pathPlaceholders(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok && name != "" {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
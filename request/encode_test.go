@@ -0,0 +1,69 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type encodeUser struct {
+	Name string `json:"name"`
+}
+
+type encodeInput struct {
+	ID     string     `in:"path=id"`
+	Fields []string   `in:"query=fields"`
+	Limit  int        `in:"query=limit"`
+	Token  string     `in:"header=Authorization"`
+	User   encodeUser `in:"body=json"`
+}
+
+func TestNewRequest(t *testing.T) {
+	input := &encodeInput{
+		ID:     "a b",
+		Fields: []string{"name", "email"},
+		Limit:  10,
+		Token:  "Bearer abc",
+		User:   encodeUser{Name: "alice"},
+	}
+	req, err := NewRequest(context.Background(), http.MethodPut, "http://users:8080/users/:id", input)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.Equal(t, "users:8080", req.URL.Host)
+	assert.Equal(t, "/users/a b", req.URL.Path)
+	assert.Equal(t, []string{"name", "email"}, req.URL.Query()["fields"])
+	assert.Equal(t, "10", req.URL.Query().Get("limit"))
+	assert.Equal(t, "Bearer abc", req.Header.Get(echo.HeaderAuthorization))
+	assert.Equal(t, echo.MIMEApplicationJSON, req.Header.Get(echo.HeaderContentType))
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"alice"}`, string(body))
+}
+
+func TestNewRequestRoundTrip(t *testing.T) {
+	type listInput struct {
+		Tags   []string `in:"query=tags"`
+		Active bool     `in:"query=active"`
+	}
+	req, err := NewRequest(context.Background(), http.MethodGet, "/users", &listInput{Tags: []string{"a", "b"}, Active: true})
+	require.NoError(t, err)
+
+	decoded, err := mustBind[listInput](httptest.NewRequest(req.Method, req.URL.String(), nil))
+	require.NoError(t, err)
+	assert.Equal(t, listInput{Tags: []string{"a", "b"}, Active: true}, decoded)
+}
+
+func TestPathPlaceholders(t *testing.T) {
+	assert.Equal(t, "/users/{id}/posts/{post}", pathPlaceholders("/users/:id/posts/:post"))
+	assert.Equal(t, "/users/{id}", pathPlaceholders("/users/{id}"))
+	assert.Equal(t, "/files/*", pathPlaceholders("/files/*"))
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ggicci/httpin/core"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// EncodeQuery encodes the fields of a struct with `in:"query=..."` tags into query
+// parameters, which the binder decodes back into an equal struct. It is meant for
+// building links, like the next page of a listing, and for client calls.
+//
+//   - Slices become repeated parameters, like ?tag=a&tag=b.
+//   - Times are formatted as RFC 3339, or with the layout of the format directive.
+//   - Zero values and nil pointers are omitted, since the binder leaves absent parameters
+//     zero, unless the field has a default or required directive. Pointers to zero values
+//     are encoded.
+//   - A map[string][]string or map[string]string field tagged `in:"query"` without a key
+//     adds all of its entries.
+//
+// Nested structs without an `in` tag are encoded field by field, like the binder decodes them.
+func EncodeQuery(v any) (url.Values, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return url.Values{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("EncodeQuery requires a struct, got %T", v)
+	}
+	// httpin formats values through their address
+	addressable := reflect.New(rv.Type()).Elem()
+	addressable.Set(rv)
+
+	values := url.Values{}
+	err := encodeQueryStruct(values, addressable)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func encodeQueryStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		// the promoted fields of an unexported embedded struct are bound too
+		if !field.IsExported() && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		fv := rv.Field(i)
+		tag, ok := field.Tag.Lookup("in")
+		if !ok {
+			if nested := indirectValue(fv); nested.Kind() == reflect.Struct && nested.Type() != timeType {
+				err := encodeQueryStruct(values, nested)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		directives := parseInTag(tag)
+		keys, ok := directives["query"]
+		if !ok {
+			continue
+		}
+		_, hasDefault := directives["default"]
+		_, required := directives["required"]
+		// a set pointer is encoded even when it points to a zero value
+		if fv.IsZero() && !hasDefault && !required {
+			continue
+		}
+		fv = indirectValue(fv)
+		if !fv.IsValid() {
+			continue
+		}
+		if len(keys) == 0 {
+			err := encodeQueryMap(values, field.Name, fv)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var adapt core.AnyStringableAdaptor
+		if layout, ok := directives["format"]; ok && len(layout) > 0 {
+			adapt = timeLayoutAdaptor(strings.Join(layout, ","))
+		} else if baseType, _ := core.BaseTypeOf(fv.Type()); isJSONUnmarshaler(indirectType(baseType)) {
+			adapt = jsonAdaptor
+		}
+		slicable, err := core.NewStringSlicable(fv, adapt)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		strs, err := slicable.ToStringSlice()
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		values[keys[0]] = strs
+	}
+	return nil
+}
+
+func encodeQueryMap(values url.Values, name string, fv reflect.Value) error {
+	switch m := fv.Interface().(type) {
+	case map[string][]string:
+		for key, vals := range m {
+			values[key] = append(values[key], vals...)
+		}
+	case url.Values:
+		for key, vals := range m {
+			values[key] = append(values[key], vals...)
+		}
+	case map[string]string:
+		for key, val := range m {
+			values.Add(key, val)
+		}
+	default:
+		return fmt.Errorf("field %s: query without key requires map[string][]string or map[string]string, got %s", name, fv.Type())
+	}
+	return nil
+}
+
+// indirectType dereferences pointer types.
+func indirectType(rt reflect.Type) reflect.Type {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	return rt
+}
+
+// indirectValue dereferences pointers, returning the zero Value for a nil pointer.
+func indirectValue(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// parseInTag parses an `in` tag like "query=a,b;required" into the arguments of each directive.
+func parseInTag(tag string) map[string][]string {
+	directives := map[string][]string{}
+	for _, part := range strings.Split(tag, ";") {
+		name, args, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+		if args == "" {
+			directives[name] = nil
+			continue
+		}
+		directives[name] = strings.Split(args, ",")
+	}
+	return directives
+}
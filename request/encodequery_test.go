@@ -0,0 +1,81 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type encodeQueryPage struct {
+	Page    int `in:"query=page"`
+	PerPage int `in:"query=per_page;default=20"`
+}
+
+type encodeQueryInput struct {
+	Paging encodeQueryPage
+	Search string    `in:"query=q"`
+	Tags   []string  `in:"query=tag"`
+	Since  time.Time `in:"query=since"`
+	Active *bool     `in:"query=active"`
+	Token  string    `in:"header=Authorization"`
+}
+
+func TestEncodeQuery(t *testing.T) {
+	active := false
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	input := encodeQueryInput{
+		Paging: encodeQueryPage{Page: 2},
+		Tags:   []string{"a", "b"},
+		Since:  since,
+		Active: &active,
+		Token:  "secret",
+	}
+
+	values, err := EncodeQuery(input)
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"page":     {"2"},
+		"per_page": {"0"},
+		"tag":      {"a", "b"},
+		"since":    {"2024-05-01T12:00:00Z"},
+		"active":   {"false"},
+	}, values)
+
+	decoded, err := mustBind[encodeQueryInput](httptest.NewRequest(http.MethodGet, "/?"+values.Encode(), nil))
+	require.NoError(t, err)
+	assert.Equal(t, input.Paging, decoded.Paging)
+	assert.Equal(t, input.Tags, decoded.Tags)
+	assert.Equal(t, input.Since, decoded.Since)
+}
+
+func TestEncodeQueryMap(t *testing.T) {
+	type passthrough struct {
+		Query map[string][]string `in:"query"`
+		Sort  string              `in:"query=sort"`
+	}
+	values, err := EncodeQuery(&passthrough{Query: map[string][]string{"a": {"1", "2"}}, Sort: "name"})
+	require.NoError(t, err)
+	assert.Equal(t, "a=1&a=2&sort=name", values.Encode())
+}
+
+func TestEncodeQueryErrors(t *testing.T) {
+	_, err := EncodeQuery("query")
+	assert.EqualError(t, err, "EncodeQuery requires a struct, got string")
+
+	type invalidMap struct {
+		Query map[string]int `in:"query"`
+	}
+	_, err = EncodeQuery(invalidMap{Query: map[string]int{"a": 1}})
+	assert.ErrorContains(t, err, "field Query")
+
+	values, err := EncodeQuery((*encodeQueryInput)(nil))
+	require.NoError(t, err)
+	assert.Empty(t, values)
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ggicci/httpin/core"
+	"github.com/ggicci/owl"
+)
+
+// Codes of a FieldError. They are stable, so clients can map them to their own messages.
+const (
+	// CodeRequired is a required parameter missing from the request.
+	CodeRequired = "required"
+	// CodeMultipleValues is a parameter sent several times where a single value is expected.
+	CodeMultipleValues = "multiple_values"
+	// CodeInvalidFormat is a value that cannot be parsed as the type of the parameter.
+	CodeInvalidFormat = "invalid_format"
+	// CodeOutOfRange is a number below the min or above the max directive of its field.
+	CodeOutOfRange = "out_of_range"
+	// CodeInvalidLength is a value with a length outside the min, max or len directive
+	// of its field.
+	CodeInvalidLength = "invalid_length"
+	// CodePatternMismatch is a value not matching the pattern directive of its field.
+	CodePatternMismatch = "pattern_mismatch"
+	// CodeFileTooLarge is an uploaded file larger than the max-size of its file directive.
+	CodeFileTooLarge = "file_too_large"
+	// CodeUnsupportedFileType is an uploaded file with a content type not allowed by its
+	// file directive.
+	CodeUnsupportedFileType = "unsupported_file_type"
+	// CodeInvalid is any other invalid value.
+	CodeInvalid = "invalid"
+)
+
+// FieldError describes why a single request parameter failed to bind.
+type FieldError struct {
+	// Field is the name of the parameter in the request, e.g. the query parameter name.
+	Field string `json:"field"`
+	// Source is where the parameter is read from: query, header, path, form, cookie, file or body.
+	Source  string `json:"source"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Source + " parameter " + strconv.Quote(e.Field) + ": " + e.Message
+}
+
+// FieldErrors are the binding failures of a request, rendered as the errors of the
+// 400 response by MustBind.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// sourceDirectives are the directives reading a field from a part of the request.
+var sourceDirectives = map[string]bool{
+	"query":   true,
+	"header":  true,
+	"path":    true,
+	"form":    true,
+	"cookie":  true,
+	"file":    true,
+	"body":    true,
+	"rawbody": true,
+}
+
+// newFieldErrors converts the httpin errors of decoding the parameter struct rt to
+// FieldErrors. It returns false for errors not caused by an invalid field.
+func newFieldErrors(err error, rt reflect.Type) (FieldErrors, bool) {
+	var invalidFields core.MultiInvalidFieldError
+	if !errors.As(err, &invalidFields) {
+		var invalidField *core.InvalidFieldError
+		if !errors.As(err, &invalidField) || invalidField.Field == "" {
+			return nil, false
+		}
+		invalidFields = core.MultiInvalidFieldError{invalidField}
+	}
+
+	fieldErrs := make(FieldErrors, 0, len(invalidFields))
+	for _, invalidField := range invalidFields {
+		source, key := invalidField.Directive, invalidField.Key
+		if !sourceDirectives[source] || key == "" {
+			source, key = fieldSource(rt, invalidField.Field)
+		}
+		cause := error(invalidField)
+		var directiveErr *owl.DirectiveExecutionError
+		if errors.As(invalidField, &directiveErr) {
+			cause = directiveErr.Err
+		}
+		fieldErrs = append(fieldErrs, FieldError{
+			Field:   key,
+			Source:  source,
+			Code:    fieldErrorCode(invalidField.Directive, cause),
+			Message: cause.Error(),
+		})
+	}
+	return fieldErrs, true
+}
+
+// fieldSource returns the source directive and key from the `in` tag of the named field.
+// The struct field name is returned as the key when the tag has no source.
+func fieldSource(rt reflect.Type, name string) (string, string) {
+	field, ok := findField(rt, name)
+	if !ok {
+		return "", name
+	}
+	for _, directive := range strings.Split(field.Tag.Get("in"), ";") {
+		directiveName, args, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if !sourceDirectives[directiveName] {
+			continue
+		}
+		key, _, _ := strings.Cut(args, ",")
+		if directiveName == "body" {
+			_, key = bodyPath(strings.Split(args, ","))
+		}
+		if key == "" {
+			key = name
+		}
+		return directiveName, key
+	}
+	return "", name
+}
+
+func findField(rt reflect.Type, name string) (reflect.StructField, bool) {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	if field, ok := rt.FieldByName(name); ok {
+		return field, true
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		if _, ok := rt.Field(i).Tag.Lookup("in"); ok {
+			continue
+		}
+		if field, ok := findField(rt.Field(i).Type, name); ok {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func fieldErrorCode(directive string, err error) string {
+	var (
+		numErr       *strconv.NumError
+		timeErr      *time.ParseError
+		syntaxErr    *json.SyntaxError
+		unmarshalErr *json.UnmarshalTypeError
+		xmlErr       *xml.SyntaxError
+	)
+	switch {
+	case directive == "required", errors.Is(err, ErrMissingParameter):
+		return CodeRequired
+	case errors.Is(err, ErrMultipleValues):
+		return CodeMultipleValues
+	case errors.Is(err, ErrOutOfRange):
+		return CodeOutOfRange
+	case errors.Is(err, ErrInvalidLength):
+		return CodeInvalidLength
+	case errors.Is(err, ErrPatternMismatch):
+		return CodePatternMismatch
+	case errors.Is(err, ErrPartTooLarge):
+		return CodeFileTooLarge
+	case errors.Is(err, ErrUnsupportedFileType):
+		return CodeUnsupportedFileType
+	case errors.As(err, &numErr), errors.As(err, &timeErr), errors.As(err, &syntaxErr),
+		errors.As(err, &unmarshalErr), errors.As(err, &xmlErr), errors.Is(err, core.ErrTypeMismatch):
+		return CodeInvalidFormat
+	}
+	return CodeInvalid
+}
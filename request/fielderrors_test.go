@@ -0,0 +1,89 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFieldErrors(t *testing.T) {
+	type page struct {
+		Limit int `in:"query=limit,max"`
+	}
+	type input struct {
+		Page    page
+		Tenant  string `in:"header=X-Tenant;required"`
+		Payload struct {
+			Name string `json:"name"`
+		} `in:"body=json"`
+	}
+	decode := func(req *http.Request) error {
+		var param input
+		return GetRequestParameters(req, &param)
+	}
+	rt := reflect.TypeOf(input{})
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		want FieldError
+	}{
+		{
+			name: "invalid format",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/?limit=ten", strings.NewReader(`{}`))
+			},
+			want: FieldError{Field: "limit", Source: "query", Code: CodeInvalidFormat},
+		},
+		{
+			name: "required",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+			},
+			want: FieldError{Field: "X-Tenant", Source: "header", Code: CodeRequired, Message: "missing required field"},
+		},
+		{
+			name: "invalid body",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": 1}`))
+				req.Header.Set("X-Tenant", "acme")
+				return req
+			},
+			want: FieldError{Field: "Payload", Source: "body", Code: CodeInvalidFormat},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fieldErrs, ok := newFieldErrors(decode(tt.req()), rt)
+			require.True(t, ok)
+			require.Len(t, fieldErrs, 1)
+			got := fieldErrs[0]
+			assert.NotEmpty(t, got.Message)
+			if tt.want.Message == "" {
+				got.Message = ""
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewFieldErrorsOther(t *testing.T) {
+	_, ok := newFieldErrors(errors.New("boom"), reflect.TypeOf(struct{}{}))
+	assert.False(t, ok)
+}
+
+func TestFieldErrorsError(t *testing.T) {
+	err := FieldErrors{
+		{Field: "limit", Source: "query", Code: CodeInvalidFormat, Message: "not a number"},
+		{Field: "X-Tenant", Source: "header", Code: CodeRequired, Message: "missing required field"},
+	}
+	assert.Equal(t, `query parameter "limit": not a number; header parameter "X-Tenant": missing required field`, err.Error())
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ggicci/httpin/core"
+)
+
+func init() {
+	core.RegisterDirective("file", &directiveFile{})
+}
+
+// ErrUnsupportedFileType is returned for an uploaded file whose content type is not
+// allowed by the content-type modifier of its file directive.
+var ErrUnsupportedFileType = errors.New("unsupported file type")
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// directiveFile implements the "file" directive, which binds the files uploaded in a
+// multipart/form-data request under a form field name, into a *multipart.FileHeader
+// field, or a []*multipart.FileHeader field for several files. The field is left unset
+// when no file is uploaded, unless it is required.
+//
+// The modifiers after the name check every file, failing the binding with a FieldError:
+//
+//   - max-size is the largest size of a file, in bytes or with a KB, MB or GB suffix.
+//   - content-type is an allowed content type, like image/png, or image/* for every
+//     subtype. It can be repeated.
+//
+// ErrPartTooLarge is returned for larger files, and ErrUnsupportedFileType for other
+// content types.
+//
+// The modifiers are checked after the form is parsed, when the files are received and
+// spilled to temporary files, so max-size does not limit what a client uploads: limit
+// the request body with the echo BodyLimit middleware or the bodyLimit of the route in
+// the server config. content-type checks the Content-Type header the client declared
+// for the part, not the content of the file: sniff it, e.g. with http.DetectContentType,
+// before trusting it.
+//
+//	type UploadInput struct {
+//		Avatar      *multipart.FileHeader   `in:"file=avatar,max-size=2MB,content-type=image/png,content-type=image/jpeg;required"`
+//		Attachments []*multipart.FileHeader `in:"file=attachments,max-size=10MB"`
+//	}
+type directiveFile struct{}
+
+func (*directiveFile) Decode(rtm *core.DirectiveRuntime) error {
+	argv := rtm.Directive.Argv
+	if len(argv) == 0 {
+		return errors.New("file directive requires a form field name")
+	}
+	limits, err := parseFileLimits(argv[1:])
+	if err != nil {
+		return err
+	}
+	req := rtm.GetRequest()
+	if req.MultipartForm == nil || len(req.MultipartForm.File[argv[0]]) == 0 {
+		return nil
+	}
+	files := req.MultipartForm.File[argv[0]]
+	for _, file := range files {
+		err = limits.check(file)
+		if err != nil {
+			return err
+		}
+	}
+	target := rtm.Value.Elem()
+	switch target.Type() {
+	case fileHeaderType:
+		if len(files) > 1 {
+			return fmt.Errorf("%w: %s", ErrMultipleValues, argv[0])
+		}
+		target.Set(reflect.ValueOf(files[0]))
+	case fileHeaderSliceType:
+		target.Set(reflect.ValueOf(files))
+	default:
+		return fmt.Errorf("file directive requires *multipart.FileHeader or []*multipart.FileHeader, got %s", target.Type())
+	}
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+// Encode leaves the request as is, files are uploaded with the form directive and
+// httpin.File fields.
+func (*directiveFile) Encode(*core.DirectiveRuntime) error {
+	return nil
+}
+
+// fileLimits are the modifiers of a file directive.
+type fileLimits struct {
+	maxSize      int64
+	contentTypes []string
+}
+
+func parseFileLimits(modifiers []string) (fileLimits, error) {
+	var limits fileLimits
+	for _, modifier := range modifiers {
+		name, value, _ := strings.Cut(strings.TrimSpace(modifier), "=")
+		switch name {
+		case "max-size":
+			size, err := parseFileSize(value)
+			if err != nil {
+				return limits, err
+			}
+			limits.maxSize = size
+		case "content-type":
+			limits.contentTypes = append(limits.contentTypes, strings.ToLower(value))
+		default:
+			return limits, fmt.Errorf("file directive: unknown modifier %q", name)
+		}
+	}
+	return limits, nil
+}
+
+// validateFile checks the arguments of a file directive of a field of type rt, for
+// ValidateStruct.
+func validateFile(arg string, rt reflect.Type) error {
+	argv := strings.Split(arg, ",")
+	if argv[0] == "" {
+		return errors.New("file directive requires a form field name")
+	}
+	if _, err := parseFileLimits(argv[1:]); err != nil {
+		return err
+	}
+	if rt != fileHeaderType && rt != fileHeaderSliceType {
+		return fmt.Errorf("file directive requires *multipart.FileHeader or []*multipart.FileHeader, got %s", rt)
+	}
+	return nil
+}
+
+// parseFileSize parses a size in bytes, like 512, or with a binary unit suffix, like 2MB.
+func parseFileSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	number, unit := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+	for _, u := range units {
+		if trimmed, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = strings.TrimSpace(trimmed), u.size
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("file directive: invalid max-size %q", value)
+	}
+	return size * unit, nil
+}
+
+func (l fileLimits) check(file *multipart.FileHeader) error {
+	if l.maxSize > 0 && file.Size > l.maxSize {
+		return fmt.Errorf("%w: %s is larger than %d bytes", ErrPartTooLarge, file.Filename, l.maxSize)
+	}
+	if len(l.contentTypes) == 0 {
+		return nil
+	}
+	contentType := file.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		for _, allowed := range l.contentTypes {
+			prefix, wildcard := strings.CutSuffix(allowed, "/*")
+			if mediaType == allowed || wildcard && strings.HasPrefix(mediaType, prefix+"/") {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w %q, allowed types: %s", ErrUnsupportedFileType, contentType, strings.Join(l.contentTypes, ", "))
+}
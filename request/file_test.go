@@ -0,0 +1,158 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testUpload struct {
+	field, name, contentType, content string
+}
+
+func newUploadRequest(t *testing.T, fields map[string]string, uploads ...testUpload) *http.Request {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for key, val := range fields {
+		require.NoError(t, writer.WriteField(key, val))
+	}
+	for _, upload := range uploads {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, upload.field, upload.name))
+		header.Set("Content-Type", upload.contentType)
+		part, err := writer.CreatePart(header)
+		require.NoError(t, err)
+		_, err = part.Write([]byte(upload.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/", &buf)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	return req
+}
+
+type uploadInput struct {
+	Title       string                  `in:"form=title"`
+	Avatar      *multipart.FileHeader   `in:"file=avatar,max-size=8B,content-type=image/png,content-type=image/jpeg;required"`
+	Attachments []*multipart.FileHeader `in:"file=attachments,content-type=text/*"`
+}
+
+func TestFileDirective(t *testing.T) {
+	bind := func(req *http.Request) (uploadInput, error) {
+		return MustBind[uploadInput](echo.New().NewContext(req, nil))
+	}
+
+	t.Run("files", func(t *testing.T) {
+		req := newUploadRequest(t, map[string]string{"title": "report"},
+			testUpload{"avatar", "me.png", "image/png", "png"},
+			testUpload{"attachments", "a.txt", "text/plain", "a"},
+			testUpload{"attachments", "b.csv", "text/csv; charset=utf-8", "b,c"},
+		)
+		param, err := bind(req)
+		require.NoError(t, err)
+		assert.Equal(t, "report", param.Title)
+		require.NotNil(t, param.Avatar)
+		assert.Equal(t, "me.png", param.Avatar.Filename)
+		assert.Equal(t, int64(3), param.Avatar.Size)
+		require.Len(t, param.Attachments, 2)
+		assert.Equal(t, "b.csv", param.Attachments[1].Filename)
+
+		file, err := param.Avatar.Open()
+		require.NoError(t, err)
+		defer file.Close()
+		content := make([]byte, 3)
+		_, err = file.Read(content)
+		require.NoError(t, err)
+		assert.Equal(t, "png", string(content))
+	})
+
+	t.Run("optional files", func(t *testing.T) {
+		param, err := bind(newUploadRequest(t, nil, testUpload{"avatar", "me.jpg", "image/jpeg", "jpg"}))
+		require.NoError(t, err)
+		assert.NotNil(t, param.Avatar)
+		assert.Nil(t, param.Attachments)
+	})
+
+	tests := []struct {
+		name    string
+		uploads []testUpload
+		want    FieldError
+	}{
+		{
+			name: "missing",
+			want: FieldError{Field: "avatar", Source: "file", Code: CodeRequired, Message: "missing required field"},
+		},
+		{
+			name:    "too large",
+			uploads: []testUpload{{"avatar", "me.png", "image/png", "0123456789"}},
+			want:    FieldError{Field: "avatar", Source: "file", Code: CodeFileTooLarge, Message: "multipart part too large: me.png is larger than 8 bytes"},
+		},
+		{
+			name:    "content type",
+			uploads: []testUpload{{"avatar", "me.gif", "image/gif", "gif"}},
+			want:    FieldError{Field: "avatar", Source: "file", Code: CodeUnsupportedFileType, Message: `unsupported file type "image/gif", allowed types: image/png, image/jpeg`},
+		},
+		{
+			name:    "several files for a single field",
+			uploads: []testUpload{{"avatar", "a.png", "image/png", "a"}, {"avatar", "b.png", "image/png", "b"}},
+			want:    FieldError{Field: "avatar", Source: "file", Code: CodeMultipleValues, Message: "multiple values for scalar parameter: avatar"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := bind(newUploadRequest(t, nil, tt.uploads...))
+			var httpErr *echo.HTTPError
+			require.ErrorAs(t, err, &httpErr)
+			assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+			var fieldErrs FieldErrors
+			require.ErrorAs(t, err, &fieldErrs)
+			assert.Equal(t, FieldErrors{tt.want}, fieldErrs)
+		})
+	}
+
+	t.Run("url-encoded body", func(t *testing.T) {
+		req := newFormRequest("/", map[string][]string{"title": {"report"}})
+		_, err := bind(req)
+		var fieldErrs FieldErrors
+		require.ErrorAs(t, err, &fieldErrs)
+		assert.Equal(t, CodeRequired, fieldErrs[0].Code)
+	})
+}
+
+func TestValidateStructFile(t *testing.T) {
+	assert.NoError(t, ValidateStruct[uploadInput]())
+
+	type wrongType struct {
+		Avatar multipart.File `in:"file=avatar"`
+	}
+	assert.ErrorContains(t, ValidateStruct[wrongType](), "file directive requires")
+	type invalidSize struct {
+		Avatar *multipart.FileHeader `in:"file=avatar,max-size=big"`
+	}
+	assert.ErrorContains(t, ValidateStruct[invalidSize](), "invalid max-size")
+	type unknownModifier struct {
+		Avatar *multipart.FileHeader `in:"file=avatar,types=image/png"`
+	}
+	assert.ErrorContains(t, ValidateStruct[unknownModifier](), "unknown modifier")
+}
+
+func TestParseFileSize(t *testing.T) {
+	tests := map[string]int64{"512": 512, "8B": 8, "2KB": 2 << 10, "10 mb": 10 << 20, "1GB": 1 << 30}
+	for value, want := range tests {
+		size, err := parseFileSize(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, size, value)
+	}
+	_, err := parseFileSize("-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FilterOperator compares a field with the value of a FilterCondition.
+type FilterOperator string
+
+const (
+	FilterEq   FilterOperator = "eq"
+	FilterNe   FilterOperator = "ne"
+	FilterGt   FilterOperator = "gt"
+	FilterGte  FilterOperator = "gte"
+	FilterLt   FilterOperator = "lt"
+	FilterLte  FilterOperator = "lte"
+	FilterLike FilterOperator = "like"
+	// FilterIn matches any of the values, separated by "|".
+	FilterIn FilterOperator = "in"
+)
+
+// FilterType is the type the values of a filter field are parsed as.
+type FilterType int
+
+const (
+	// FilterString values are kept as strings.
+	FilterString FilterType = iota
+	// FilterNumber values are parsed as float64.
+	FilterNumber
+	// FilterBool values are parsed with strconv.ParseBool.
+	FilterBool
+	// FilterTime values are parsed as RFC 3339 timestamps or dates like 2024-01-01.
+	FilterTime
+)
+
+// FilterField declares a field that may be filtered on.
+type FilterField struct {
+	Type FilterType
+	// Operators are the operators allowed on the field, FilterEq only by default.
+	Operators []FilterOperator
+}
+
+// FilterConfig is the allowlist of fields and operators for ParseFilter.
+type FilterConfig map[string]FilterField
+
+// FilterCondition compares a field with a value. Value has the Go type of the field's
+// FilterType: string, float64, bool or time.Time. For FilterIn it is a slice of that type.
+type FilterCondition struct {
+	Field    string
+	Operator FilterOperator
+	Value    any
+}
+
+// Filter is a conjunction of conditions: an item matches when it matches all of them.
+type Filter []FilterCondition
+
+// GetFilter parses the filter query parameter of the request, see ParseFilter.
+// An invalid filter is returned as a 400 *echo.HTTPError, like MustBind.
+func GetFilter(ctx echo.Context, config FilterConfig) (Filter, error) {
+	filter, err := ParseFilter(ctx.QueryParam("filter"), config)
+	if err != nil {
+		return nil, invalidParameters(FieldErrors{{
+			Field:   "filter",
+			Source:  "query",
+			Code:    CodeInvalid,
+			Message: err.Error(),
+		}})
+	}
+	return filter, nil
+}
+
+// ParseFilter parses a filter expression like "status:eq:active,created_at:gte:2024-01-01"
+// into a Filter. Conditions are separated by commas and written as field:operator:value.
+// A comma inside a value is escaped with a backslash. Only the fields and operators in
+// the config are accepted, so the filter can be translated to a storage query safely.
+func ParseFilter(expr string, config FilterConfig) (Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	parts := splitList(expr)
+	filter := make(Filter, 0, len(parts))
+	for _, part := range parts {
+		condition, err := parseFilterCondition(strings.TrimSpace(part), config)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, condition)
+	}
+	return filter, nil
+}
+
+func parseFilterCondition(expr string, config FilterConfig) (FilterCondition, error) {
+	name, rest, ok := strings.Cut(expr, ":")
+	operator, value, ok2 := strings.Cut(rest, ":")
+	if !ok || !ok2 {
+		return FilterCondition{}, fmt.Errorf("invalid condition %q, expected field:operator:value", expr)
+	}
+	field, ok := config[name]
+	if !ok {
+		return FilterCondition{}, fmt.Errorf("filtering on %q is not supported", name)
+	}
+	condition := FilterCondition{Field: name, Operator: FilterOperator(operator)}
+	operators := field.Operators
+	if len(operators) == 0 {
+		operators = []FilterOperator{FilterEq}
+	}
+	if !slices.Contains(operators, condition.Operator) {
+		return FilterCondition{}, fmt.Errorf("operator %q is not supported on %q", operator, name)
+	}
+
+	var err error
+	if condition.Operator == FilterIn {
+		condition.Value, err = parseFilterValues(field.Type, strings.Split(value, "|"))
+	} else {
+		condition.Value, err = parseFilterValue(field.Type, value)
+	}
+	if err != nil {
+		return FilterCondition{}, fmt.Errorf("invalid value for %q: %w", name, err)
+	}
+	return condition, nil
+}
+
+func parseFilterValues(filterType FilterType, values []string) (any, error) {
+	switch filterType {
+	case FilterNumber:
+		return parseEach(values, parseFilterNumber)
+	case FilterBool:
+		return parseEach(values, strconv.ParseBool)
+	case FilterTime:
+		return parseEach(values, parseFilterTime)
+	}
+	return values, nil
+}
+
+func parseEach[T any](values []string, parse func(string) (T, error)) ([]T, error) {
+	parsed := make([]T, len(values))
+	for i, value := range values {
+		var err error
+		parsed[i], err = parse(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+func parseFilterValue(filterType FilterType, value string) (any, error) {
+	switch filterType {
+	case FilterNumber:
+		return parseFilterNumber(value)
+	case FilterBool:
+		return strconv.ParseBool(value)
+	case FilterTime:
+		return parseFilterTime(value)
+	}
+	return value, nil
+}
+
+// parseFilterNumber parses a finite number, rejecting the NaN and Inf values
+// strconv.ParseFloat accepts.
+func parseFilterNumber(value string) (float64, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", value)
+	}
+	return number, nil
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
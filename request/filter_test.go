@@ -0,0 +1,83 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFilterConfig = FilterConfig{
+	"status":     {Operators: []FilterOperator{FilterEq, FilterNe, FilterIn}},
+	"name":       {Operators: []FilterOperator{FilterLike}},
+	"price":      {Type: FilterNumber, Operators: []FilterOperator{FilterGte, FilterLt, FilterIn}},
+	"active":     {Type: FilterBool},
+	"created_at": {Type: FilterTime, Operators: []FilterOperator{FilterGte}},
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter(`status:eq:active,name:like:a\,b,price:gte:9.5,price:in:1|2,active:eq:true,created_at:gte:2024-01-01,created_at:gte:2024-01-01T10:00:00Z,status:in:new|open`, testFilterConfig)
+	require.NoError(t, err)
+	assert.Equal(t, Filter{
+		{Field: "status", Operator: FilterEq, Value: "active"},
+		{Field: "name", Operator: FilterLike, Value: "a,b"},
+		{Field: "price", Operator: FilterGte, Value: 9.5},
+		{Field: "price", Operator: FilterIn, Value: []float64{1, 2}},
+		{Field: "active", Operator: FilterEq, Value: true},
+		{Field: "created_at", Operator: FilterGte, Value: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Field: "created_at", Operator: FilterGte, Value: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{Field: "status", Operator: FilterIn, Value: []string{"new", "open"}},
+	}, filter)
+}
+
+func TestParseFilterEmpty(t *testing.T) {
+	filter, err := ParseFilter(" ", testFilterConfig)
+	assert.NoError(t, err)
+	assert.Nil(t, filter)
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"status", `invalid condition "status", expected field:operator:value`},
+		{"password:eq:x", `filtering on "password" is not supported`},
+		{"status:gt:x", `operator "gt" is not supported on "status"`},
+		{"active:ne:true", `operator "ne" is not supported on "active"`},
+		{"price:gte:cheap", `invalid value for "price"`},
+		{"price:in:1|x", `invalid value for "price"`},
+		{"price:gte:NaN", `"NaN" is not a finite number`},
+		{"price:lt:Inf", `"Inf" is not a finite number`},
+		{"price:in:1|-Infinity", `"-Infinity" is not a finite number`},
+		{"created_at:gte:yesterday", `invalid value for "created_at"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseFilter(tt.expr, testFilterConfig)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestGetFilter(t *testing.T) {
+	e := echo.New()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/items?filter=status:eq:active", nil), nil)
+	filter, err := GetFilter(ctx, testFilterConfig)
+	require.NoError(t, err)
+	assert.Equal(t, Filter{{Field: "status", Operator: FilterEq, Value: "active"}}, filter)
+
+	ctx = e.NewContext(httptest.NewRequest(http.MethodGet, "/items?filter=secret:eq:1", nil), nil)
+	_, err = GetFilter(ctx, testFilterConfig)
+	var fieldErrs FieldErrors
+	require.True(t, errors.As(err, &fieldErrs))
+	assert.Equal(t, "filter", fieldErrs[0].Field)
+	assert.Equal(t, CodeInvalid, fieldErrs[0].Code)
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// isFormBody reports whether the request has a form body, sent as
+// application/x-www-form-urlencoded or multipart/form-data by HTML forms.
+func isFormBody(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return false
+	}
+	return mediaType == echo.MIMEApplicationForm || mediaType == echo.MIMEMultipartForm
+}
+
+// formBodyValues returns the values of the form body, without the query parameters.
+// httpin parses the form before the directives run, which consumes the body.
+func formBodyValues(req *http.Request) (url.Values, error) {
+	if req.PostForm == nil {
+		var err error
+		if mediaType, _, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType)); mediaType == echo.MIMEMultipartForm {
+			err = req.ParseMultipartForm(defaultMaxMemory)
+		} else {
+			err = req.ParseForm()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return req.PostForm, nil
+}
+
+// defaultMaxMemory is the memory used to parse multipart forms, like httpin does.
+const defaultMaxMemory = 32 << 20
+
+// decodeFormBody decodes the values of a form body into a struct, with the names of
+// its json tags, or into a map like url.Values, for the body directive.
+func decodeFormBody(values url.Values, target reflect.Value) error {
+	switch rt := target.Type(); {
+	case rt.ConvertibleTo(stringSliceMapType):
+		target.Set(reflect.ValueOf(map[string][]string(values)).Convert(rt))
+		return nil
+	case rt.ConvertibleTo(stringMapType):
+		flat := make(map[string]string, len(values))
+		for key := range values {
+			flat[key] = values.Get(key)
+		}
+		target.Set(reflect.ValueOf(flat).Convert(rt))
+		return nil
+	case rt.Kind() == reflect.Pointer:
+		if target.IsNil() {
+			target.Set(reflect.New(rt.Elem()))
+		}
+		return decodeFormBody(values, target.Elem())
+	case rt.Kind() != reflect.Struct:
+		return fmt.Errorf("body directive decodes forms into a struct or map, got %s", rt)
+	}
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		name, ok := formFieldName(field)
+		if !ok {
+			continue
+		}
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		err := convertFormValues(target.Field(i), vals)
+		if err != nil {
+			return fmt.Errorf("form field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// formFieldName returns the name of the json tag of an exported field, or its name.
+func formFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	}
+	return name, true
+}
+
+// convertFormValues converts the values of a form field, every value being an element
+// of a slice field.
+func convertFormValues(target reflect.Value, vals []string) error {
+	rt := target.Type()
+	if _, registered := typeConverters[rt]; !registered && rt.Kind() == reflect.Slice &&
+		!reflect.PointerTo(rt).Implements(textUnmarshalerType) {
+		return convertSliceValues(target, vals)
+	}
+	return convertValue(target, vals[0])
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type formSignup struct {
+	Name    string   `json:"name"`
+	Age     int      `json:"age"`
+	Tags    []string `json:"tags"`
+	Consent *bool    `json:"consent,omitempty"`
+	Ignored string   `json:"-"`
+}
+
+func newFormRequest(target string, values url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm+"; charset=utf-8")
+	return req
+}
+
+func newMultipartRequest(t *testing.T, target string, values url.Values) *http.Request {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for key, vals := range values {
+		for _, val := range vals {
+			require.NoError(t, writer.WriteField(key, val))
+		}
+	}
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, target, &buf)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	return req
+}
+
+func TestFormBody(t *testing.T) {
+	type input struct {
+		Source string     `in:"query=source"`
+		Name   string     `in:"form=name;required"`
+		Signup formSignup `in:"body"`
+	}
+	values := url.Values{
+		"name":    {"Ada"},
+		"age":     {"36"},
+		"tags":    {"math", "engines"},
+		"consent": {"true"},
+		"Ignored": {"x"},
+	}
+	consent := true
+	want := input{
+		Source: "landing",
+		Name:   "Ada",
+		Signup: formSignup{Name: "Ada", Age: 36, Tags: []string{"math", "engines"}, Consent: &consent},
+	}
+
+	t.Run("urlencoded", func(t *testing.T) {
+		req := newFormRequest("/?source=landing", values)
+		param, err := MustBind[input](echo.New().NewContext(req, nil))
+		require.NoError(t, err)
+		assert.Equal(t, want, param)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		req := newMultipartRequest(t, "/?source=landing", values)
+		param, err := MustBind[input](echo.New().NewContext(req, nil))
+		require.NoError(t, err)
+		assert.Equal(t, want, param)
+	})
+
+	t.Run("query parameters are not body fields", func(t *testing.T) {
+		type input struct {
+			Signup formSignup `in:"body"`
+		}
+		req := newFormRequest("/?age=40", url.Values{"name": {"Ada"}})
+		var param input
+		require.NoError(t, GetRequestParameters(req, &param))
+		assert.Equal(t, formSignup{Name: "Ada"}, param.Signup)
+	})
+
+	t.Run("maps", func(t *testing.T) {
+		type input struct {
+			All   url.Values        `in:"body"`
+			First map[string]string `in:"body"`
+		}
+		req := newFormRequest("/", url.Values{"tag": {"a", "b"}})
+		var param input
+		require.NoError(t, GetRequestParameters(req, &param))
+		assert.Equal(t, url.Values{"tag": {"a", "b"}}, param.All)
+		assert.Equal(t, map[string]string{"tag": "a"}, param.First)
+	})
+
+	t.Run("json body", func(t *testing.T) {
+		type input struct {
+			Signup formSignup `in:"body"`
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Ada","age":36}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		var param input
+		require.NoError(t, GetRequestParameters(req, &param))
+		assert.Equal(t, formSignup{Name: "Ada", Age: 36}, param.Signup)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		type input struct {
+			Signup formSignup `in:"body"`
+		}
+		req := newFormRequest("/", url.Values{"age": {"old"}})
+		_, err := MustBind[input](echo.New().NewContext(req, nil))
+		var httpErr *echo.HTTPError
+		require.ErrorAs(t, err, &httpErr)
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+		assert.ErrorContains(t, err, "form field age")
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		type input struct {
+			Names []string `in:"body"`
+		}
+		req := newFormRequest("/", url.Values{"name": {"Ada"}})
+		assert.ErrorContains(t, GetRequestParameters(req, &input{}), "struct or map")
+	})
+}
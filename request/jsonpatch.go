@@ -0,0 +1,349 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMEApplicationJSONPatchJSON is the content type of JSON Patch (RFC 6902) bodies.
+const MIMEApplicationJSONPatchJSON = "application/json-patch+json"
+
+var (
+	// ErrInvalidPatch is returned for malformed patch operations and operations that
+	// cannot be applied, like removing a missing member.
+	ErrInvalidPatch = errors.New("invalid JSON patch")
+	// ErrPatchPathNotAllowed is returned for operations on paths not in the allowlist.
+	ErrPatchPathNotAllowed = errors.New("JSON patch path not allowed")
+	// ErrPatchTestFailed is returned when a test operation does not match.
+	ErrPatchTestFailed = errors.New("JSON patch test failed")
+)
+
+// PatchOperation is a single operation of a JSON Patch.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch is a JSON Patch document (RFC 6902).
+type JSONPatch []PatchOperation
+
+// GetJSONPatch reads and validates the application/json-patch+json body of the request.
+func GetJSONPatch(ctx echo.Context, patch *JSONPatch) error {
+	if err := checkContentType(ctx, MIMEApplicationJSONPatchJSON); err != nil {
+		return err
+	}
+	if err := GetBody(ctx, patch); err != nil {
+		return err
+	}
+	return patch.Validate()
+}
+
+// Validate checks that every operation is known and has the members it needs.
+func (p JSONPatch) Validate() error {
+	for i, op := range p {
+		if err := op.validate(); err != nil {
+			return fmt.Errorf("%w: operation %d: %s", ErrInvalidPatch, i, err)
+		}
+	}
+	return nil
+}
+
+func (op PatchOperation) validate() error {
+	if _, err := parsePointer(op.Path); err != nil {
+		return err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return fmt.Errorf("%s needs a value", op.Op)
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return fmt.Errorf("from: %s", err)
+		}
+		if op.Op == "move" && strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+			return fmt.Errorf("cannot move %q into itself", op.From)
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return nil
+}
+
+// Apply applies the operations in order onto the target, a pointer to the existing
+// resource, using its JSON encoding. When allowedPaths are given, every path written
+// or moved from must be one of them or below one of them; a "*" segment matches any
+// single segment, like "/tags/*". The target is left unchanged when an error is returned.
+func (p JSONPatch) Apply(target any, allowedPaths ...string) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("JSON patch target must be a non-nil pointer, got %T", target)
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	original, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	doc, err := decodeJSONValue(original)
+	if err != nil {
+		return err
+	}
+	for i, op := range p {
+		if err := op.checkAllowed(allowedPaths); err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+		doc, err = op.apply(doc)
+		if err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	result := reflect.New(rv.Elem().Type())
+	if err := json.Unmarshal(patched, result.Interface()); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	rv.Elem().Set(result.Elem())
+	return nil
+}
+
+func (op PatchOperation) checkAllowed(allowedPaths []string) error {
+	if len(allowedPaths) == 0 {
+		return nil
+	}
+	paths := []string{op.Path}
+	if op.Op == "move" {
+		paths = append(paths, op.From)
+	}
+	for _, path := range paths {
+		if op.Op != "test" && !pathAllowed(path, allowedPaths) {
+			return fmt.Errorf("%w: %q", ErrPatchPathNotAllowed, path)
+		}
+	}
+	return nil
+}
+
+func pathAllowed(path string, allowedPaths []string) bool {
+	tokens, _ := parsePointer(path)
+	for _, allowed := range allowedPaths {
+		allowedTokens, err := parsePointer(allowed)
+		if err != nil || len(allowedTokens) > len(tokens) {
+			continue
+		}
+		matches := true
+		for i, token := range allowedTokens {
+			if token != "*" && token != tokens[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func (op PatchOperation) apply(doc any) (any, error) {
+	path, _ := parsePointer(op.Path)
+	switch op.Op {
+	case "add", "replace":
+		value, err := decodeJSONValue(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value: %w", ErrInvalidPatch, err)
+		}
+		return setPointer(doc, path, value, op.Op == "add")
+	case "remove":
+		doc, _, err := removePointer(doc, path)
+		return doc, err
+	case "move":
+		from, _ := parsePointer(op.From)
+		doc, value, err := removePointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return setPointer(doc, path, value, true)
+	case "copy":
+		from, _ := parsePointer(op.From)
+		value, err := getPointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		copied, err := deepCopyJSON(value)
+		if err != nil {
+			return nil, err
+		}
+		return setPointer(doc, path, copied, true)
+	case "test":
+		expected, err := decodeJSONValue(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value: %w", ErrInvalidPatch, err)
+		}
+		actual, err := getPointer(doc, path)
+		if err != nil || !reflect.DeepEqual(actual, expected) {
+			return nil, fmt.Errorf("%w: %q", ErrPatchTestFailed, op.Path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func getPointer(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, token)
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse %q", ErrInvalidPatch, token)
+		}
+	}
+	return doc, nil
+}
+
+// setPointer adds or replaces the value at the path and returns the updated document.
+func setPointer(doc any, path []string, value any, add bool) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			if _, ok := container[token]; !ok && !add {
+				return nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, token)
+			}
+			container[token] = value
+			return container, nil
+		case []any:
+			if !add {
+				index, err := arrayIndex(token, len(container)-1)
+				if err != nil {
+					return nil, err
+				}
+				container[index] = value
+				return container, nil
+			}
+			index := len(container)
+			if token != "-" {
+				var err error
+				if index, err = arrayIndex(token, len(container)); err != nil {
+					return nil, err
+				}
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		return nil, fmt.Errorf("%w: cannot set %q", ErrInvalidPatch, token)
+	})
+}
+
+// removePointer removes the value at the path and returns the updated document and the value.
+func removePointer(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+	var removed any
+	doc, err := updateParent(doc, path, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, token)
+			}
+			removed = value
+			delete(container, token)
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[index]
+			return append(container[:index], container[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: cannot remove %q", ErrInvalidPatch, token)
+	})
+	return doc, removed, err
+}
+
+// updateParent calls update with the parent of the path and its last token, writing
+// the returned container back, since arrays may be reallocated.
+func updateParent(doc any, path []string, update func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+	child, err := getPointer(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = updateParent(child, path[1:], update)
+	if err != nil {
+		return nil, err
+	}
+	switch container := doc.(type) {
+	case map[string]any:
+		container[path[0]] = child
+	case []any:
+		index, _ := arrayIndex(path[0], len(container)-1)
+		container[index] = child
+	}
+	return doc, nil
+}
+
+func arrayIndex(token string, maxIndex int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > maxIndex || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	return index, nil
+}
+
+func deepCopyJSON(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONValue(data)
+}
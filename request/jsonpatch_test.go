@@ -0,0 +1,113 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseTestPatch(t *testing.T, patch string) JSONPatch {
+	var p JSONPatch
+	require.NoError(t, json.Unmarshal([]byte(patch), &p))
+	return p
+}
+
+func TestJSONPatchApply(t *testing.T) {
+	user := patchUser{
+		Name:    "John",
+		Age:     40,
+		Tags:    []string{"a", "b"},
+		Address: &patchAddress{Street: "Main St", City: "Springfield"},
+	}
+	patch := parseTestPatch(t, `[
+		{"op": "test", "path": "/name", "value": "John"},
+		{"op": "replace", "path": "/name", "value": "Jane"},
+		{"op": "add", "path": "/tags/0", "value": "first"},
+		{"op": "add", "path": "/tags/-", "value": "last"},
+		{"op": "remove", "path": "/tags/1"},
+		{"op": "copy", "from": "/address/city", "path": "/address/street"},
+		{"op": "move", "from": "/tags/2", "path": "/tags/0"}
+	]`)
+
+	require.NoError(t, patch.Apply(&user))
+	assert.Equal(t, patchUser{
+		Name:    "Jane",
+		Age:     40,
+		Tags:    []string{"last", "first", "b"},
+		Address: &patchAddress{Street: "Springfield", City: "Springfield"},
+	}, user)
+}
+
+func TestJSONPatchApplyAllowlist(t *testing.T) {
+	user := patchUser{Name: "John", Tags: []string{"a"}, Address: &patchAddress{}}
+
+	err := parseTestPatch(t, `[{"op": "replace", "path": "/age", "value": 1}]`).Apply(&user, "/name", "/tags/*", "/address")
+	assert.ErrorIs(t, err, ErrPatchPathNotAllowed)
+
+	err = parseTestPatch(t, `[{"op": "move", "from": "/name", "path": "/address/city"}]`).Apply(&user, "/address")
+	assert.ErrorIs(t, err, ErrPatchPathNotAllowed)
+
+	err = parseTestPatch(t, `[
+		{"op": "test", "path": "/age", "value": 0},
+		{"op": "replace", "path": "/tags/0", "value": "b"},
+		{"op": "replace", "path": "/address/city", "value": "Springfield"}
+	]`).Apply(&user, "/name", "/tags/*", "/address")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, user.Tags)
+	assert.Equal(t, "Springfield", user.Address.City)
+}
+
+func TestJSONPatchApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  error
+	}{
+		{"test failed", `[{"op": "test", "path": "/name", "value": "Jane"}]`, ErrPatchTestFailed},
+		{"missing member", `[{"op": "remove", "path": "/missing"}]`, ErrInvalidPatch},
+		{"replace missing member", `[{"op": "replace", "path": "/missing", "value": 1}]`, ErrInvalidPatch},
+		{"index out of range", `[{"op": "add", "path": "/tags/5", "value": "x"}]`, ErrInvalidPatch},
+		{"wrong type", `[{"op": "replace", "path": "/age", "value": "old"}]`, ErrInvalidPatch},
+		{"unknown op", `[{"op": "merge", "path": "/name"}]`, ErrInvalidPatch},
+		{"missing value", `[{"op": "add", "path": "/name"}]`, ErrInvalidPatch},
+		{"relative path", `[{"op": "remove", "path": "name"}]`, ErrInvalidPatch},
+		{"move into itself", `[{"op": "move", "from": "/address", "path": "/address/city"}]`, ErrInvalidPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := patchUser{Name: "John", Tags: []string{"a"}, Address: &patchAddress{}}
+			err := parseTestPatch(t, tt.patch).Apply(&user)
+			assert.ErrorIs(t, err, tt.want)
+			assert.Equal(t, patchUser{Name: "John", Tags: []string{"a"}, Address: &patchAddress{}}, user)
+		})
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tokens, err := parsePointer("/a~1b/c~0d/0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/b", "c~d", "0"}, tokens)
+}
+
+func TestGetJSONPatch(t *testing.T) {
+	newContext := func(contentType, body string) echo.Context {
+		req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		return echo.New().NewContext(req, nil)
+	}
+
+	var patch JSONPatch
+	require.NoError(t, GetJSONPatch(newContext(MIMEApplicationJSONPatchJSON, `[{"op": "remove", "path": "/name"}]`), &patch))
+	assert.Equal(t, JSONPatch{{Op: "remove", Path: "/name"}}, patch)
+
+	assert.ErrorIs(t, GetJSONPatch(newContext(MIMEApplicationJSONPatchJSON, `[{"op": "drop", "path": "/name"}]`), &patch), ErrInvalidPatch)
+	assert.ErrorIs(t, GetJSONPatch(newContext(echo.MIMEApplicationJSON, `[]`), &patch), ErrUnsupportedContentType)
+}
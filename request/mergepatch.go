@@ -0,0 +1,123 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMEApplicationMergePatchJSON is the content type of JSON Merge Patch (RFC 7386) bodies.
+const MIMEApplicationMergePatchJSON = "application/merge-patch+json"
+
+// ErrUnsupportedContentType is returned when the body is not of the content type a
+// function reads.
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// MergePatch is a JSON Merge Patch document (RFC 7386).
+type MergePatch json.RawMessage
+
+// GetMergePatch reads the application/merge-patch+json body of the request into the patch.
+func GetMergePatch(ctx echo.Context, patch *MergePatch) error {
+	if err := checkContentType(ctx, MIMEApplicationMergePatchJSON); err != nil {
+		return err
+	}
+	var raw json.RawMessage
+	if err := GetBody(ctx, &raw); err != nil {
+		return err
+	}
+	*patch = MergePatch(raw)
+	return nil
+}
+
+func checkContentType(ctx echo.Context, contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(ctx.Request().Header.Get(echo.HeaderContentType))
+	if err != nil || mediaType != contentType {
+		return fmt.Errorf("%w: expected %s", ErrUnsupportedContentType, contentType)
+	}
+	return nil
+}
+
+// Apply merges the patch onto the target, a pointer to the existing resource, using
+// its JSON encoding: patch members replace target members, objects are merged
+// recursively, and null removes a member, resetting the field to its zero value.
+// It returns the JSON paths of the changed members, like "address.city", sorted.
+// The target is left unchanged when an error is returned.
+func (p MergePatch) Apply(target any) ([]string, error) {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return nil, fmt.Errorf("merge patch target must be a non-nil pointer, got %T", target)
+	}
+	patch, err := decodeJSONValue(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	original, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeJSONValue(original)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	merged, err := json.Marshal(mergePatch(doc, patch, "", &changed))
+	if err != nil {
+		return nil, err
+	}
+	result := reflect.New(rv.Elem().Type())
+	if err := json.Unmarshal(merged, result.Interface()); err != nil {
+		return nil, err
+	}
+	rv.Elem().Set(result.Elem())
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func decodeJSONValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+// mergePatch implements the MergePatch algorithm of RFC 7386, recording changed paths.
+func mergePatch(doc, patch any, path string, changed *[]string) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		if !reflect.DeepEqual(doc, patch) {
+			*changed = append(*changed, path)
+		}
+		return patch
+	}
+	docObject, ok := doc.(map[string]any)
+	if !ok {
+		docObject = map[string]any{}
+	}
+	for key, value := range patchObject {
+		memberPath := key
+		if path != "" {
+			memberPath = path + "." + key
+		}
+		if value == nil {
+			if current, ok := docObject[key]; ok {
+				if current != nil {
+					*changed = append(*changed, memberPath)
+				}
+				delete(docObject, key)
+			}
+			continue
+		}
+		docObject[key] = mergePatch(docObject[key], value, memberPath, changed)
+	}
+	return docObject
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type patchAddress struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+type patchUser struct {
+	Name    string        `json:"name"`
+	Email   *string       `json:"email"`
+	Age     int           `json:"age"`
+	Tags    []string      `json:"tags"`
+	Address *patchAddress `json:"address"`
+}
+
+func TestMergePatchApply(t *testing.T) {
+	email := "john@example.com"
+	user := patchUser{
+		Name:    "John",
+		Email:   &email,
+		Age:     40,
+		Tags:    []string{"a", "b"},
+		Address: &patchAddress{Street: "Main St", City: "Springfield"},
+	}
+
+	changed, err := MergePatch(`{"name": "John", "email": null, "age": 41, "tags": ["c"], "address": {"city": "Shelbyville"}}`).Apply(&user)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"address.city", "age", "email", "tags"}, changed)
+	assert.Equal(t, patchUser{
+		Name:    "John",
+		Age:     41,
+		Tags:    []string{"c"},
+		Address: &patchAddress{Street: "Main St", City: "Shelbyville"},
+	}, user)
+}
+
+func TestMergePatchApplyObjectOntoNull(t *testing.T) {
+	user := patchUser{Name: "John"}
+	changed, err := MergePatch(`{"address": {"city": "Springfield"}}`).Apply(&user)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"address.city"}, changed)
+	assert.Equal(t, &patchAddress{City: "Springfield"}, user.Address)
+}
+
+func TestMergePatchApplyErrors(t *testing.T) {
+	user := patchUser{Name: "John"}
+	_, err := MergePatch(`{"name":`).Apply(&user)
+	assert.ErrorContains(t, err, "invalid merge patch")
+
+	_, err = MergePatch(`{"age": "old"}`).Apply(&user)
+	assert.Error(t, err)
+	assert.Equal(t, patchUser{Name: "John"}, user)
+
+	_, err = MergePatch(`{}`).Apply(user)
+	assert.ErrorContains(t, err, "non-nil pointer")
+}
+
+func TestGetMergePatch(t *testing.T) {
+	newContext := func(contentType string) echo.Context {
+		req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(`{"name": null}`))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		return echo.New().NewContext(req, nil)
+	}
+
+	var patch MergePatch
+	require.NoError(t, GetMergePatch(newContext(MIMEApplicationMergePatchJSON+"; charset=utf-8"), &patch))
+	assert.JSONEq(t, `{"name": null}`, string(patch))
+
+	assert.ErrorIs(t, GetMergePatch(newContext(echo.MIMEApplicationJSON), &patch), ErrUnsupportedContentType)
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrPartTooLarge is returned by StreamMultipart when a part exceeds its size limit.
+var ErrPartTooLarge = errors.New("multipart part too large")
+
+// PartInfo describes a file part of a multipart request.
+type PartInfo struct {
+	// FormName is the name of the form field.
+	FormName    string
+	FileName    string
+	ContentType string
+	Header      textproto.MIMEHeader
+}
+
+// PartStorage receives the file parts of a multipart request, like an S3 bucket.
+type PartStorage interface {
+	// Create returns the writer the part is streamed to. The writer is closed once the
+	// part is written, and its error is returned by StreamMultipart.
+	Create(ctx context.Context, part PartInfo) (io.WriteCloser, error)
+}
+
+// StoredPart is a file part written to the PartStorage.
+type StoredPart struct {
+	PartInfo
+	Size int64
+	// SHA256 is the hex encoded SHA-256 checksum of the part.
+	SHA256 string
+}
+
+// MultipartResult is the outcome of StreamMultipart.
+type MultipartResult struct {
+	Files []StoredPart
+	// Fields holds the values of the parts that are not files.
+	Fields map[string][]string
+}
+
+// MultipartOption changes how StreamMultipart reads a multipart request.
+type MultipartOption func(*multipartOptions)
+
+type multipartOptions struct {
+	maxFileSize  int64
+	maxFieldSize int64
+}
+
+func newMultipartOptions(opts []MultipartOption) *multipartOptions {
+	options := &multipartOptions{maxFieldSize: 1 << 20}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// MaxFileSize returns ErrPartTooLarge for file parts larger than size bytes.
+func MaxFileSize(size int64) MultipartOption {
+	return func(o *multipartOptions) {
+		o.maxFileSize = size
+	}
+}
+
+// MaxFieldSize returns ErrPartTooLarge for non-file parts larger than size bytes, 1 MiB by default.
+func MaxFieldSize(size int64) MultipartOption {
+	return func(o *multipartOptions) {
+		o.maxFieldSize = size
+	}
+}
+
+// StreamMultipart reads a multipart/form-data request part by part, streaming every
+// file part to the storage without buffering it in memory or on disk, and reports the
+// size and checksum of each. Parts already stored are kept when an error is returned,
+// so the storage must discard them if the upload is to be atomic.
+func StreamMultipart(ctx echo.Context, storage PartStorage, opts ...MultipartOption) (MultipartResult, error) {
+	options := newMultipartOptions(opts)
+	result := MultipartResult{Fields: map[string][]string{}}
+	reader, err := ctx.Request().MultipartReader()
+	if err != nil {
+		return result, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if part.FileName() == "" {
+			value, err := readLimited(part, options.maxFieldSize)
+			part.Close()
+			if err != nil {
+				return result, fmt.Errorf("field %q: %w", part.FormName(), err)
+			}
+			result.Fields[part.FormName()] = append(result.Fields[part.FormName()], string(value))
+			continue
+		}
+
+		info := PartInfo{
+			FormName:    part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get(echo.HeaderContentType),
+			Header:      part.Header,
+		}
+		stored, err := storePart(ctx.Request().Context(), storage, info, part, options.maxFileSize)
+		part.Close()
+		if err != nil {
+			return result, fmt.Errorf("file %q: %w", info.FileName, err)
+		}
+		result.Files = append(result.Files, stored)
+	}
+}
+
+func storePart(ctx context.Context, storage PartStorage, info PartInfo, part io.Reader, maxSize int64) (StoredPart, error) {
+	writer, err := storage.Create(ctx, info)
+	if err != nil {
+		return StoredPart{}, err
+	}
+	hash := sha256.New()
+	if maxSize > 0 {
+		// read one byte more than allowed to detect larger parts
+		part = io.LimitReader(part, maxSize+1)
+	}
+	size, err := io.Copy(io.MultiWriter(writer, hash), part)
+	if err == nil && maxSize > 0 && size > maxSize {
+		err = ErrPartTooLarge
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return StoredPart{}, err
+	}
+	return StoredPart{PartInfo: info, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	value, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(value)) > maxSize {
+		return nil, ErrPartTooLarge
+	}
+	return value, nil
+}
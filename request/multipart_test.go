@@ -0,0 +1,98 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryPartStorage struct {
+	parts map[string]*bytes.Buffer
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (s *memoryPartStorage) Create(_ context.Context, part PartInfo) (io.WriteCloser, error) {
+	buf := &bytes.Buffer{}
+	s.parts[part.FileName] = buf
+	return nopWriteCloser{buf}, nil
+}
+
+func newMultipartContext(t *testing.T, write func(w *multipart.Writer)) echo.Context {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	write(writer)
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	return echo.New().NewContext(req, nil)
+}
+
+func TestStreamMultipart(t *testing.T) {
+	ctx := newMultipartContext(t, func(w *multipart.Writer) {
+		require.NoError(t, w.WriteField("title", "holiday"))
+		file, err := w.CreateFormFile("photos", "a.jpg")
+		require.NoError(t, err)
+		_, _ = file.Write([]byte("first photo"))
+		file, err = w.CreateFormFile("photos", "b.jpg")
+		require.NoError(t, err)
+		_, _ = file.Write([]byte("second"))
+	})
+	storage := &memoryPartStorage{parts: map[string]*bytes.Buffer{}}
+
+	result, err := StreamMultipart(ctx, storage)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"title": {"holiday"}}, result.Fields)
+	require.Len(t, result.Files, 2)
+
+	checksum := sha256.Sum256([]byte("first photo"))
+	assert.Equal(t, "photos", result.Files[0].FormName)
+	assert.Equal(t, "a.jpg", result.Files[0].FileName)
+	assert.Equal(t, "application/octet-stream", result.Files[0].ContentType)
+	assert.Equal(t, int64(11), result.Files[0].Size)
+	assert.Equal(t, hex.EncodeToString(checksum[:]), result.Files[0].SHA256)
+	assert.Equal(t, "first photo", storage.parts["a.jpg"].String())
+	assert.Equal(t, int64(6), result.Files[1].Size)
+}
+
+func TestStreamMultipartLimits(t *testing.T) {
+	storage := &memoryPartStorage{parts: map[string]*bytes.Buffer{}}
+
+	ctx := newMultipartContext(t, func(w *multipart.Writer) {
+		file, err := w.CreateFormFile("file", "big.bin")
+		require.NoError(t, err)
+		_, _ = file.Write([]byte(strings.Repeat("x", 11)))
+	})
+	_, err := StreamMultipart(ctx, storage, MaxFileSize(10))
+	assert.ErrorIs(t, err, ErrPartTooLarge)
+
+	ctx = newMultipartContext(t, func(w *multipart.Writer) {
+		require.NoError(t, w.WriteField("note", strings.Repeat("x", 11)))
+	})
+	_, err = StreamMultipart(ctx, storage, MaxFieldSize(10))
+	assert.ErrorIs(t, err, ErrPartTooLarge)
+}
+
+func TestStreamMultipartNotMultipart(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	_, err := StreamMultipart(echo.New().NewContext(req, nil), &memoryPartStorage{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import "errors"
+
+var (
+	// ErrMissingParameter is returned when a required parameter is not present in the request.
+	ErrMissingParameter = errors.New("key not found")
+	// ErrMultipleValues is returned by the SingleValue option when a scalar parameter is repeated.
+	ErrMultipleValues = errors.New("multiple values for scalar parameter")
+)
+
+// ParamOption changes how GetPathParams, GetQueryParam and GetHeaderParams read a parameter.
+type ParamOption func(*paramOptions)
+
+type paramOptions struct {
+	required    bool
+	singleValue bool
+	noExplode   bool
+	strictBool  bool
+}
+
+func newParamOptions(opts []ParamOption) *paramOptions {
+	options := &paramOptions{strictBool: strictBooleans.Load()}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// Required returns ErrMissingParameter when the parameter is absent from the request.
+// A parameter that is present with an empty value, like ?q=, is not missing.
+func Required() ParamOption {
+	return func(o *paramOptions) {
+		o.required = true
+	}
+}
+
+// SingleValue returns ErrMultipleValues when a parameter is given more than once, like ?id=1&id=2,
+// and the return value is not a slice. Without it the values are joined with commas.
+func SingleValue() ParamOption {
+	return func(o *paramOptions) {
+		o.singleValue = true
+	}
+}
+
+// NoExplode binds every value of a repeated parameter as one slice element, without
+// splitting it on commas, so ?tag=a,b&tag=c gives []string{"a,b", "c"}.
+// Without it commas can be kept in an element by escaping them as \,.
+func NoExplode() ParamOption {
+	return func(o *paramOptions) {
+		o.noExplode = true
+	}
+}
+
+// StrictBool only accepts "true" and "false" for a boolean parameter, instead of
+// every spelling understood by strconv.ParseBool. See UseStrictBooleans to enable it globally.
+func StrictBool() ParamOption {
+	return func(o *paramOptions) {
+		o.strictBool = true
+	}
+}
+
+// BodyOption changes how GetBody decodes the request body.
+type BodyOption func(*bodyOptions)
+
+type bodyOptions struct {
+	disallowDuplicateKeys bool
+}
+
+func newBodyOptions(opts []BodyOption) *bodyOptions {
+	options := &bodyOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// DisallowDuplicateKeys rejects bodies in which an object contains the same key twice
+// with a *DuplicateKeyError, instead of silently keeping the last value.
+func DisallowDuplicateKeys() BodyOption {
+	return func(o *bodyOptions) {
+		o.disallowDuplicateKeys = true
+	}
+}
+
+// BindOption changes how MustBind binds a request.
+type BindOption func(*bindOptions)
+
+type bindOptions struct {
+	validators []func(any) error
+}
+
+func newBindOptions(opts []BindOption) *bindOptions {
+	options := &bindOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithValidator runs validate with a pointer to the bound value, once the request is
+// bound. It fits the Struct method of go-playground/validator, or any check across
+// several parameters:
+//
+//	v := validator.New()
+//	param, err := request.MustBind[CreateUserInput](c, request.WithValidator(v.Struct))
+func WithValidator(validate func(any) error) BindOption {
+	return func(o *bindOptions) {
+		o.validators = append(o.validators, validate)
+	}
+}
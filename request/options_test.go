@@ -0,0 +1,133 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequired(t *testing.T) {
+	newContext := func(target string) echo.Context {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return echo.New().NewContext(req, nil)
+	}
+
+	t.Run("missing query parameter", func(t *testing.T) {
+		res := ""
+		err := GetQueryParam[string](newContext("/"), "q", &res, Required())
+		assert.ErrorIs(t, err, ErrMissingParameter)
+	})
+	t.Run("empty query parameter is present", func(t *testing.T) {
+		res := "untouched"
+		err := GetQueryParam[string](newContext("/?q="), "q", &res, Required())
+		assert.NoError(t, err)
+		assert.Equal(t, "", res)
+	})
+	t.Run("false is present", func(t *testing.T) {
+		res := true
+		err := GetQueryParam[bool](newContext("/?flag=false"), "flag", &res, Required())
+		assert.NoError(t, err)
+		assert.False(t, res)
+	})
+	t.Run("empty int is reported as invalid, not missing", func(t *testing.T) {
+		res := 0
+		err := GetQueryParam[int](newContext("/?limit="), "limit", &res, Required())
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrMissingParameter)
+	})
+	t.Run("missing optional parameter is left untouched", func(t *testing.T) {
+		res := 50
+		err := GetQueryParam[int](newContext("/"), "limit", &res)
+		assert.NoError(t, err)
+		assert.Equal(t, 50, res)
+	})
+	t.Run("missing header", func(t *testing.T) {
+		res := ""
+		err := GetHeaderParams[string](newContext("/"), "X-Token", &res, Required())
+		assert.ErrorIs(t, err, ErrMissingParameter)
+	})
+	t.Run("empty header is present", func(t *testing.T) {
+		ctx := newContext("/")
+		ctx.Request().Header["X-Token"] = []string{""}
+		res := "untouched"
+		err := GetHeaderParams[string](ctx, "X-Token", &res, Required())
+		assert.NoError(t, err)
+		assert.Equal(t, "", res)
+	})
+	t.Run("missing path parameter", func(t *testing.T) {
+		res := ""
+		err := GetPathParams[string](newContext("/"), "id", &res)
+		assert.ErrorIs(t, err, ErrMissingParameter)
+	})
+}
+
+func TestSingleValue(t *testing.T) {
+	newContext := func(target string) echo.Context {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return echo.New().NewContext(req, nil)
+	}
+
+	t.Run("repeated scalar", func(t *testing.T) {
+		res := ""
+		err := GetQueryParam[string](newContext("/?id=1&id=2"), "id", &res, SingleValue())
+		assert.ErrorIs(t, err, ErrMultipleValues)
+		assert.Equal(t, "", res)
+	})
+	t.Run("single scalar", func(t *testing.T) {
+		res := 0
+		err := GetQueryParam[int](newContext("/?id=1"), "id", &res, SingleValue())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, res)
+	})
+	t.Run("repeated slice", func(t *testing.T) {
+		res := []int{}
+		err := GetQueryParam[[]int](newContext("/?id=1&id=2"), "id", &res, SingleValue())
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, res)
+	})
+	t.Run("repeated header", func(t *testing.T) {
+		ctx := newContext("/")
+		ctx.Request().Header.Add("X-Id", "1")
+		ctx.Request().Header.Add("X-Id", "2")
+		res := ""
+		err := GetHeaderParams[string](ctx, "X-Id", &res, SingleValue())
+		assert.ErrorIs(t, err, ErrMultipleValues)
+	})
+	t.Run("without the option values are joined", func(t *testing.T) {
+		res := ""
+		err := GetQueryParam[string](newContext("/?id=1&id=2"), "id", &res)
+		assert.NoError(t, err)
+		assert.Equal(t, "1,2", res)
+	})
+}
+
+func TestSliceEscaping(t *testing.T) {
+	newContext := func(target string) echo.Context {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return echo.New().NewContext(req, nil)
+	}
+
+	t.Run("escaped comma", func(t *testing.T) {
+		res := []string{}
+		err := GetQueryParam[[]string](newContext(`/?tags=a\,b,c`), "tags", &res)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a,b", "c"}, res)
+	})
+	t.Run("repeated values are split separately", func(t *testing.T) {
+		res := []string{}
+		err := GetQueryParam[[]string](newContext(`/?tags=a\,b&tags=c,d`), "tags", &res)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a,b", "c", "d"}, res)
+	})
+	t.Run("no explode", func(t *testing.T) {
+		res := []string{}
+		err := GetQueryParam[[]string](newContext("/?tags=red,green&tags=blue"), "tags", &res, NoExplode())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"red,green", "blue"}, res)
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SortField is a field to sort a list by, written as "name" or "+name" for ascending
+// and "-name" for descending order. The suffixes ":asc" and ":desc" are accepted too.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+func (f SortField) MarshalText() ([]byte, error) {
+	if f.Desc {
+		return []byte("-" + f.Field), nil
+	}
+	return []byte(f.Field), nil
+}
+
+func (f *SortField) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	*f = SortField{}
+	switch {
+	case strings.HasPrefix(value, "-"):
+		f.Desc = true
+		value = value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if field, ok := strings.CutSuffix(value, ":desc"); ok {
+		f.Desc = true
+		value = field
+	} else {
+		value = strings.TrimSuffix(value, ":asc")
+	}
+	if value == "" {
+		return fmt.Errorf("empty sort field %q", text)
+	}
+	f.Field = value
+	return nil
+}
+
+// PageParams are the pagination and sort parameters of a list endpoint. Embed it in
+// a parameter struct and call Normalize, or bind it on its own with BindPage.
+type PageParams struct {
+	Page    int         `in:"query=page"`
+	PerPage int         `in:"query=per_page"`
+	Cursor  string      `in:"query=cursor"`
+	Sort    []SortField `in:"query=sort"`
+}
+
+// PageConfig configures the bounds and sort fields of PageParams.
+type PageConfig struct {
+	// DefaultPerPage is used when no page size is requested, 20 by default.
+	DefaultPerPage int
+	// MaxPerPage is the largest page size, 100 by default. Larger sizes are clamped.
+	MaxPerPage int
+	// SortFields are the fields the list can be sorted by. Sorting by other fields is rejected.
+	SortFields []string
+	// DefaultSort is used when no sort is requested.
+	DefaultSort []SortField
+}
+
+// DefaultPageConfig is the default PageParams config.
+var DefaultPageConfig = PageConfig{
+	DefaultPerPage: 20,
+	MaxPerPage:     100,
+}
+
+// BindPage binds the PageParams of the request and normalizes them with the config.
+// Besides repeated sort parameters, sort accepts comma separated lists like
+// "?sort=name,-created_at". Invalid parameters are returned as a 400 *echo.HTTPError,
+// like MustBind.
+func BindPage(ctx echo.Context, config PageConfig) (PageParams, error) {
+	req := ctx.Request()
+	if sorts, ok := req.URL.Query()["sort"]; ok {
+		query := req.URL.Query()
+		query["sort"] = splitSortValues(sorts)
+		req = req.Clone(req.Context())
+		req.URL.RawQuery = query.Encode()
+	}
+
+	page, err := mustBind[PageParams](req)
+	if err != nil {
+		return page, err
+	}
+	var fieldErrs FieldErrors
+	if errors.As(page.Normalize(config), &fieldErrs) {
+		return page, invalidParameters(fieldErrs)
+	}
+	return page, nil
+}
+
+func splitSortValues(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				split = append(split, field)
+			}
+		}
+	}
+	return split
+}
+
+// Normalize clamps the page and page size to the bounds of the config, applies the
+// default sort, and returns FieldErrors when sorting by a field not in the config or
+// when the offset of the page does not fit in an int.
+func (p *PageParams) Normalize(config PageConfig) error {
+	if config.DefaultPerPage <= 0 {
+		config.DefaultPerPage = DefaultPageConfig.DefaultPerPage
+	}
+	if config.MaxPerPage <= 0 {
+		config.MaxPerPage = DefaultPageConfig.MaxPerPage
+	}
+	p.Page = max(p.Page, 1)
+	if p.PerPage <= 0 {
+		p.PerPage = config.DefaultPerPage
+	}
+	p.PerPage = min(p.PerPage, config.MaxPerPage)
+
+	var fieldErrs FieldErrors
+	if p.Page-1 > math.MaxInt/p.PerPage {
+		fieldErrs = append(fieldErrs, FieldError{
+			Field:   "page",
+			Source:  "query",
+			Code:    CodeOutOfRange,
+			Message: fmt.Sprintf("page %d is out of range", p.Page),
+		})
+	}
+	if len(p.Sort) == 0 {
+		p.Sort = slices.Clone(config.DefaultSort)
+	} else {
+		fieldErrs = append(fieldErrs, p.sortErrors(config)...)
+	}
+	if fieldErrs != nil {
+		return fieldErrs
+	}
+	return nil
+}
+
+func (p PageParams) sortErrors(config PageConfig) FieldErrors {
+	var fieldErrs FieldErrors
+	for _, sort := range p.Sort {
+		if !slices.Contains(config.SortFields, sort.Field) {
+			fieldErrs = append(fieldErrs, FieldError{
+				Field:   "sort",
+				Source:  "query",
+				Code:    CodeInvalid,
+				Message: fmt.Sprintf("sorting by %q is not supported", sort.Field),
+			})
+		}
+	}
+	return fieldErrs
+}
+
+// Offset returns the number of items before the page.
+func (p PageParams) Offset() int {
+	return (max(p.Page, 1) - 1) * p.PerPage
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortFieldUnmarshalText(t *testing.T) {
+	tests := []struct {
+		text string
+		want SortField
+	}{
+		{"name", SortField{Field: "name"}},
+		{"+name", SortField{Field: "name"}},
+		{"-name", SortField{Field: "name", Desc: true}},
+		{"name:asc", SortField{Field: "name"}},
+		{"name:desc", SortField{Field: "name", Desc: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var got SortField
+			require.NoError(t, got.UnmarshalText([]byte(tt.text)))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	var field SortField
+	assert.Error(t, field.UnmarshalText([]byte("-")))
+
+	text, err := SortField{Field: "name", Desc: true}.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "-name", string(text))
+}
+
+func TestBindPage(t *testing.T) {
+	config := PageConfig{
+		MaxPerPage:  50,
+		SortFields:  []string{"name", "created_at"},
+		DefaultSort: []SortField{{Field: "created_at", Desc: true}},
+	}
+	bind := func(target string) (PageParams, error) {
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, target, nil), nil)
+		return BindPage(ctx, config)
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		page, err := bind("/items")
+		require.NoError(t, err)
+		assert.Equal(t, PageParams{Page: 1, PerPage: 20, Sort: config.DefaultSort}, page)
+		assert.Equal(t, 0, page.Offset())
+	})
+	t.Run("clamped", func(t *testing.T) {
+		page, err := bind("/items?page=-1&per_page=1000")
+		require.NoError(t, err)
+		assert.Equal(t, 1, page.Page)
+		assert.Equal(t, 50, page.PerPage)
+	})
+	t.Run("sort lists and repeated values", func(t *testing.T) {
+		page, err := bind("/items?page=3&per_page=10&sort=name,-created_at&sort=created_at:asc&cursor=abc")
+		require.NoError(t, err)
+		assert.Equal(t, PageParams{
+			Page:    3,
+			PerPage: 10,
+			Cursor:  "abc",
+			Sort:    []SortField{{Field: "name"}, {Field: "created_at", Desc: true}, {Field: "created_at"}},
+		}, page)
+		assert.Equal(t, 20, page.Offset())
+	})
+	t.Run("sort field not allowed", func(t *testing.T) {
+		_, err := bind("/items?sort=password")
+
+		var httpErr *echo.HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+		var fieldErrs FieldErrors
+		require.True(t, errors.As(err, &fieldErrs))
+		assert.Equal(t, FieldErrors{{
+			Field: "sort", Source: "query", Code: CodeInvalid, Message: `sorting by "password" is not supported`,
+		}}, fieldErrs)
+	})
+	t.Run("invalid page", func(t *testing.T) {
+		_, err := bind("/items?page=first")
+		var fieldErrs FieldErrors
+		require.True(t, errors.As(err, &fieldErrs))
+		assert.Equal(t, "page", fieldErrs[0].Field)
+		assert.Equal(t, CodeInvalidFormat, fieldErrs[0].Code)
+	})
+	t.Run("page out of range", func(t *testing.T) {
+		_, err := bind("/items?page=" + strconv.Itoa(math.MaxInt) + "&per_page=10")
+
+		var httpErr *echo.HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+		var fieldErrs FieldErrors
+		require.True(t, errors.As(err, &fieldErrs))
+		assert.Equal(t, "page", fieldErrs[0].Field)
+		assert.Equal(t, CodeOutOfRange, fieldErrs[0].Code)
+	})
+	t.Run("last page in range", func(t *testing.T) {
+		page, err := bind("/items?page=" + strconv.Itoa(math.MaxInt/10+1) + "&per_page=10")
+		require.NoError(t, err)
+		assert.Equal(t, math.MaxInt/10*10, page.Offset())
+	})
+}
+
+func TestPageParamsEmbedded(t *testing.T) {
+	type listUsers struct {
+		PageParams
+		Status string `in:"query=status"`
+	}
+	var param listUsers
+	err := GetRequestParameters(httptest.NewRequest(http.MethodGet, "/users?status=active&sort=-name&per_page=5", nil), &param)
+	require.NoError(t, err)
+	require.NoError(t, param.Normalize(PageConfig{SortFields: []string{"name"}}))
+	assert.Equal(t, "active", param.Status)
+	assert.Equal(t, []SortField{{Field: "name", Desc: true}}, param.Sort)
+	assert.Equal(t, 5, param.PerPage)
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"reflect"
+
+	"github.com/ggicci/httpin"
+	"github.com/ggicci/httpin/core"
+	"github.com/labstack/echo/v4"
+)
+
+// Plan is a reusable binder for the request parameter struct T.
+// It is built once by Compile and is safe to share between requests.
+type Plan[T any] struct {
+	core *core.Core
+}
+
+// Compile resolves the `in` tags of T once and returns a Plan that can fill T
+// from any number of requests without repeating the reflection work.
+// It panics if T is not a valid parameter struct, so it should be called at startup.
+func Compile[T any]() *Plan[T] {
+	co, err := httpin.New(new(T))
+	if err != nil {
+		panic(err)
+	}
+	return &Plan[T]{core: co}
+}
+
+// Fill decodes the request of the echo context into a new value of T.
+func (p *Plan[T]) Fill(ctx echo.Context) (T, error) {
+	var result T
+	value, err := p.core.Decode(ctx.Request())
+	if err != nil {
+		return result, err
+	}
+	decoded := value.(*T)
+	err = decodeEmbedded(ctx.Request(), reflect.ValueOf(decoded).Elem())
+	if err != nil {
+		return result, err
+	}
+	return *decoded, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type listUsersInput struct {
+	Page   int    `in:"query=page"`
+	Search string `in:"query=q"`
+	Token  string `in:"header=X-Token"`
+}
+
+func TestCompile(t *testing.T) {
+	plan := Compile[listUsersInput]()
+
+	t.Run("fill from request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users?page=2&q=john", nil)
+		req.Header.Set("X-Token", "secret")
+		ctx := echo.New().NewContext(req, nil)
+
+		res, err := plan.Fill(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, listUsersInput{Page: 2, Search: "john", Token: "secret"}, res)
+	})
+	t.Run("plan is reusable", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users?page=3", nil)
+		ctx := echo.New().NewContext(req, nil)
+
+		res, err := plan.Fill(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, listUsersInput{Page: 3}, res)
+	})
+	t.Run("invalid value", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users?page=abc", nil)
+		ctx := echo.New().NewContext(req, nil)
+
+		_, err := plan.Fill(ctx)
+		assert.Error(t, err)
+	})
+	t.Run("invalid struct panics", func(t *testing.T) {
+		assert.Panics(t, func() {
+			Compile[struct {
+				Name string `in:"unknown=name"`
+			}]()
+		})
+	})
+}
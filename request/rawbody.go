@@ -0,0 +1,101 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/ggicci/httpin/core"
+	"github.com/labstack/echo/v4"
+)
+
+func init() {
+	core.RegisterDirective("rawbody", &directiveRawBody{})
+}
+
+var (
+	bytesType           = reflect.TypeOf([]byte(nil))
+	ioReaderType        = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	rawMessageType      = reflect.TypeOf(json.RawMessage(nil))
+	bufferedBodyPtrType = reflect.TypeOf((*bufferedBody)(nil))
+)
+
+// directiveRawBody implements the "rawbody" directive, which binds the unparsed body
+// into a []byte, json.RawMessage or io.Reader field, for handlers verifying the
+// signature of a payload or forwarding it verbatim. The body is buffered, so the body
+// directive of other fields and the handler can read it too. The field is left unset
+// when the body is empty, as are form bodies, which httpin parses before the directives.
+//
+//	type WebhookInput struct {
+//		Signature string `in:"header=X-Signature;required"`
+//		Payload   []byte `in:"rawbody"`
+//		Event     Event  `in:"body"`
+//	}
+type directiveRawBody struct{}
+
+func (*directiveRawBody) Decode(rtm *core.DirectiveRuntime) error {
+	target := rtm.Value.Elem()
+	if err := checkRawBodyType(target.Type()); err != nil {
+		return err
+	}
+	data, err := bufferBody(rtm.GetRequest())
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if target.Kind() == reflect.Interface {
+		target.Set(reflect.ValueOf(newBufferedBody(data)))
+	} else {
+		// the field keeps its copy when the body is read again
+		target.Set(reflect.ValueOf(append([]byte(nil), data...)).Convert(target.Type()))
+	}
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+// Encode sends the field as the body: as JSON for json.RawMessage, else in the format
+// of the Content-Type header field if it has a registered serializer.
+func (*directiveRawBody) Encode(rtm *core.DirectiveRuntime) error {
+	target := rtm.Value
+	if err := checkRawBodyType(target.Type()); err != nil {
+		return err
+	}
+	var body io.Reader
+	switch {
+	case target.Kind() == reflect.Interface:
+		if target.IsNil() {
+			return nil
+		}
+		body = target.Interface().(io.Reader)
+	case target.Len() == 0:
+		return nil
+	default:
+		body = newBufferedBody(target.Bytes())
+	}
+	builder := rtm.GetRequestBuilder()
+	format := "raw"
+	if target.Type() == rawMessageType {
+		format = "json"
+	} else if registered, ok := lookupSerializer(builder.Header.Get(echo.HeaderContentType)); ok {
+		format = registered.format
+	}
+	builder.SetBody(format, io.NopCloser(body))
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+// checkRawBodyType returns an error for fields the rawbody directive cannot bind.
+func checkRawBodyType(rt reflect.Type) error {
+	if rt.ConvertibleTo(bytesType) && rt.Kind() == reflect.Slice {
+		return nil
+	}
+	if rt.Kind() == reflect.Interface && bufferedBodyPtrType.Implements(rt) && rt.Implements(ioReaderType) {
+		return nil
+	}
+	return fmt.Errorf("rawbody directive requires []byte, json.RawMessage or io.Reader, got %s", rt)
+}
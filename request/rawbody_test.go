@@ -0,0 +1,92 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ggicci/httpin"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawBodyDirective(t *testing.T) {
+	type input struct {
+		Signature string          `in:"header=X-Signature;required"`
+		Payload   []byte          `in:"rawbody"`
+		Raw       json.RawMessage `in:"rawbody"`
+		Reader    io.Reader       `in:"rawbody"`
+		User      bodyUser        `in:"body"`
+	}
+	const body = `{"name":"Ada"}`
+
+	t.Run("decode", func(t *testing.T) {
+		e := echo.New()
+		e.POST("/", func(c echo.Context) error {
+			param, err := MustBind[input](c)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, body, string(param.Payload))
+			assert.JSONEq(t, body, string(param.Raw))
+			read, err := io.ReadAll(param.Reader)
+			require.NoError(t, err)
+			assert.Equal(t, body, string(read))
+			assert.Equal(t, "Ada", param.User.Name)
+			handlerBody, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			return c.String(http.StatusOK, string(handlerBody))
+		})
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("X-Signature", "sha256=abc")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, body, rec.Body.String())
+	})
+
+	t.Run("empty body", func(t *testing.T) {
+		type input struct {
+			Payload []byte    `in:"rawbody"`
+			Reader  io.Reader `in:"rawbody"`
+		}
+		var param input
+		require.NoError(t, GetRequestParameters(httptest.NewRequest(http.MethodPost, "/", nil), &param))
+		assert.Nil(t, param.Payload)
+		assert.Nil(t, param.Reader)
+
+		type required struct {
+			Payload []byte `in:"rawbody;required"`
+		}
+		assert.Error(t, GetRequestParameters(httptest.NewRequest(http.MethodPost, "/", nil), &required{}))
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		type input struct {
+			Raw json.RawMessage `in:"rawbody"`
+		}
+		req, err := httpin.NewRequest(http.MethodPost, "/", &input{Raw: json.RawMessage(body)})
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", req.Header.Get(echo.HeaderContentType))
+		sent, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(sent))
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		type input struct {
+			Payload string `in:"rawbody"`
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		assert.ErrorContains(t, GetRequestParameters(req, &input{}), "rawbody directive requires")
+		assert.ErrorContains(t, ValidateStruct[input](), "rawbody directive requires")
+	})
+}
@@ -3,12 +3,13 @@
 package request
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
-	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/ggicci/httpin"
 	"github.com/labstack/echo/v4"
@@ -25,103 +26,214 @@ func GetRequestParameters[T any](req *http.Request, param *T) error {
 	}
 	castParamValues := paramValues.(*T)
 	*param = *castParamValues
+	return decodeEmbedded(req, reflect.ValueOf(param).Elem())
+}
+
+// decodeEmbedded binds the fields promoted from unexported embedded structs, like a
+// shared `pagination` embedded into many parameter structs, which httpin skips as
+// unexported fields. Nested structs without an `in` tag are searched too.
+func decodeEmbedded(req *http.Request, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if _, tagged := field.Tag.Lookup("in"); tagged {
+			continue
+		}
+		fv := rv.Field(i)
+		switch {
+		case field.IsExported():
+			if nested := indirectValue(fv); nested.Kind() == reflect.Struct && nested.Type() != timeType {
+				err := decodeEmbedded(req, nested)
+				if err != nil {
+					return err
+				}
+			}
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			embedded := reflect.New(field.Type)
+			paramHandler, err := httpin.New(embedded.Interface())
+			if err != nil {
+				return err
+			}
+			decoded, err := paramHandler.Decode(req)
+			if err != nil {
+				return err
+			}
+			value := reflect.ValueOf(decoded).Elem()
+			err = decodeEmbedded(req, value)
+			if err != nil {
+				return err
+			}
+			// only the promoted fields of an unexported field can be set
+			for j := 0; j < field.Type.NumField(); j++ {
+				if field.Type.Field(j).IsExported() {
+					fv.Field(j).Set(value.Field(j))
+				}
+			}
+		}
+	}
 	return nil
 }
 
+// maxPooledBufferSize is the largest buffer returned to bodyBufferPool, so a single
+// very large payload does not pin its memory in the pool forever.
+const maxPooledBufferSize = 1 << 20
+
+// bodyBufferPool holds the buffers used to read request bodies before decoding.
+var bodyBufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBodyBuffer() *bytes.Buffer {
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBodyBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bodyBufferPool.Put(buf)
+}
+
 // GetBody function takes two arguments: an echo context and a pointer to the return value.
-// It used a JSON decoder to convert the request body into the return value.
+// It reads the request body into a pooled buffer and converts it into the return value,
+// with the Serializer registered for the content type of the request, or as JSON when
+// no serializer is registered for it.
 // If the decoding fails, the function returns an error.
-func GetBody[T any](ctx echo.Context, returnValue *T) error {
-	err := json.NewDecoder(ctx.Request().Body).Decode(returnValue)
+func GetBody[T any](ctx echo.Context, returnValue *T, opts ...BodyOption) error {
+	options := newBodyOptions(opts)
+	buf := getBodyBuffer()
+	defer putBodyBuffer(buf)
+
+	_, err := buf.ReadFrom(ctx.Request().Body)
+	if err != nil {
+		return err
+	}
+	registered, ok := lookupSerializer(ctx.Request().Header.Get(echo.HeaderContentType))
+	if !ok {
+		registered.serializer = JSONSerializer{}
+	}
+	if _, isJSON := registered.serializer.(JSONSerializer); !isJSON {
+		return registered.serializer.Decode(bytes.NewReader(buf.Bytes()), returnValue)
+	}
+	if options.disallowDuplicateKeys {
+		err = checkDuplicateKeys(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	err = json.Unmarshal(buf.Bytes(), returnValue)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// GetBodyStream function takes two arguments: an echo context and a callback.
+// It expects the request body to be a JSON array and decodes it one element at a time,
+// calling the callback for each element so the whole payload is never held in memory.
+// Decoding stops at the first error, including errors returned by the callback.
+func GetBodyStream[T any](ctx echo.Context, callback func(T) error) error {
+	decoder := json.NewDecoder(ctx.Request().Body)
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("request body is not a JSON array")
+	}
+	for decoder.More() {
+		var item T
+		err = decoder.Decode(&item)
+		if err != nil {
+			return err
+		}
+		err = callback(item)
+		if err != nil {
+			return err
+		}
+	}
+	// consume the closing bracket so a truncated array is reported
+	_, err = decoder.Token()
+	return err
+}
+
 // GetPathParams function takes three arguments: an echo context, a string key, and a pointer to the return value.
 // It returns the value of the key from the path parameters.
-// If the key is not found, the function returns an error.
-func GetPathParams[T any](ctx echo.Context, key string, returnValue *T) error {
+// If the key is not found, the function returns ErrMissingParameter.
+func GetPathParams[T any](ctx echo.Context, key string, returnValue *T, opts ...ParamOption) error {
 	vals := ctx.ParamValues()
 	keys := ctx.ParamNames()
 	for i, k := range keys {
 		if k == key {
-			val := vals[i]
-			return convertToType[T](returnValue, val)
+			return setParam(returnValue, key, vals[i:i+1], opts)
 		}
 	}
-	return fmt.Errorf("key not found")
+	return fmt.Errorf("%w: %s", ErrMissingParameter, key)
 }
 
 // GetQueryParam function takes three arguments: an echo context, a string key, and a pointer to the return value.
 // It returns the value of the key from the query parameters like /test?key=value
-// If the key is not found, the function returns an error.
-func GetQueryParam[T any](ctx echo.Context, key string, returnValue *T) error {
+// If the key is not found, the return value is left untouched, unless the Required option is given.
+func GetQueryParam[T any](ctx echo.Context, key string, returnValue *T, opts ...ParamOption) error {
 	vals := ctx.Request().URL.Query()[key]
-	return convertToType[T](returnValue, strings.Join(vals, ","))
+	return setParam(returnValue, key, vals, opts)
 }
 
 // GetHeaderParams function takes three arguments: an echo context, a string key, and a pointer to the return value.
 // It returns the value of the key from the header parameters.
-// If the key is not found, the function returns an error.
-func GetHeaderParams[T any](ctx echo.Context, key string, returnValue *T) error {
-	vals := ctx.Request().Header.Get(key)
-	return convertToType[T](returnValue, vals)
+// If the key is not found, the return value is left untouched, unless the Required option is given.
+func GetHeaderParams[T any](ctx echo.Context, key string, returnValue *T, opts ...ParamOption) error {
+	vals := ctx.Request().Header.Values(key)
+	return setParam(returnValue, key, vals, opts)
 }
 
-func convertToType[T any](target *T, val string) error {
-
-	var bodyBytes []byte
-	var err error
-
-	rt := reflect.TypeOf(*target)
-	kind := rt.Kind()
-	switch kind {
-	case reflect.Map:
-		bodyBytes, err = json.Marshal(val)
+// sliceElements returns the elements of a slice parameter. Every value is split on
+// unescaped commas, unless noExplode is set and each value is a single element.
+func sliceElements(vals []string, noExplode bool) []string {
+	if noExplode {
+		return vals
+	}
+	var elements []string
+	for _, val := range vals {
+		elements = append(elements, splitList(val)...)
+	}
+	return elements
+}
 
-	case reflect.Array | reflect.Slice:
-		x := strings.Split(val, ",")
-		bodyBytes, err = json.Marshal(x)
-	case reflect.String:
-		bodyBytes, err = json.Marshal(val)
-	case reflect.Bool:
-		x, err := strconv.ParseBool(val)
-		if err != nil {
-			return err
-		}
-		bodyBytes, err = json.Marshal(x)
-		if err != nil {
-			return err
-		}
-	case reflect.Float32, reflect.Float64:
-		x, err := strconv.ParseFloat(val, 64)
-		if err != nil {
-			return err
-		}
-		bodyBytes, err = json.Marshal(x)
-		if err != nil {
-			return err
+// setParam converts the values of a parameter into the return value.
+// A parameter without values is missing, a parameter with an empty value is present.
+func setParam[T any](returnValue *T, key string, vals []string, opts []ParamOption) error {
+	options := newParamOptions(opts)
+	if len(vals) == 0 {
+		if options.required {
+			return fmt.Errorf("%w: %s", ErrMissingParameter, key)
 		}
-	case reflect.Int:
-		x, err := strconv.Atoi(val)
-		if err != nil {
-			return err
+		return nil
+	}
+	target := reflect.ValueOf(returnValue).Elem()
+	if isSliceType(returnValue) {
+		elements := sliceElements(vals, options.noExplode)
+		if options.strictBool {
+			err := checkStrictBool(target.Type(), elements)
+			if err != nil {
+				return err
+			}
 		}
-		bodyBytes, err = json.Marshal(x)
+		return convertSliceValues(target, elements)
+	}
+	if options.singleValue && len(vals) > 1 {
+		return fmt.Errorf("%w: %s", ErrMultipleValues, key)
+	}
+	val := strings.Join(vals, ",")
+	if options.strictBool {
+		err := checkStrictBool(target.Type(), []string{val})
 		if err != nil {
 			return err
 		}
-	default:
-		bodyBytes, err = json.Marshal(val)
-	}
-	if err != nil {
-		return err
 	}
-	err = json.Unmarshal(bodyBytes, target)
-	if err != nil {
-		return err
-	}
-	return nil
+	return convertToType[T](returnValue, val)
 }
@@ -4,6 +4,7 @@ package request
 
 import (
 	"bytes"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -97,6 +98,22 @@ func TestParseRequestWithQueryParametersTyped(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, 42.42, res)
 	})
+	t.Run("*bool", func(t *testing.T) {
+		req := &http.Request{
+			URL: &url.URL{
+				Path:     "/path/to/resource",
+				RawQuery: "param1=false",
+			},
+		}
+		ctx := echo.New().NewContext(req, nil)
+		var res, missing *bool
+		assert.NoError(t, GetQueryParam(ctx, "param1", &res, StrictBool()))
+		assert.NoError(t, GetQueryParam(ctx, "param2", &missing))
+		if assert.NotNil(t, res) {
+			assert.False(t, *res)
+		}
+		assert.Nil(t, missing)
+	})
 }
 
 func TestParseRequestWithPathParameters(t *testing.T) {
@@ -171,6 +188,60 @@ func TestGetBody(t *testing.T) {
 	}
 }
 
+func TestGetBodyStream(t *testing.T) {
+	type item struct {
+		ID int `json:"id"`
+	}
+	newContext := func(body string) echo.Context {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+		return echo.New().NewContext(req, nil)
+	}
+
+	t.Run("decodes every element", func(t *testing.T) {
+		var ids []int
+		err := GetBodyStream(newContext(`[{"id": 1}, {"id": 2}, {"id": 3}]`), func(i item) error {
+			ids = append(ids, i.ID)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, ids)
+	})
+	t.Run("empty array", func(t *testing.T) {
+		calls := 0
+		err := GetBodyStream(newContext(`[]`), func(i item) error {
+			calls++
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, calls)
+	})
+	t.Run("body is not an array", func(t *testing.T) {
+		err := GetBodyStream(newContext(`{"id": 1}`), func(i item) error {
+			return nil
+		})
+		assert.Error(t, err)
+	})
+	t.Run("truncated array", func(t *testing.T) {
+		calls := 0
+		err := GetBodyStream(newContext(`[{"id": 1}, {"id": 2`), func(i item) error {
+			calls++
+			return nil
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("callback error stops decoding", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := GetBodyStream(newContext(`[{"id": 1}, {"id": 2}]`), func(i item) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+}
+
 func TestGetHeaderParams(t *testing.T) {
 	t.Run("GetHeaderParams", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/", nil)
@@ -196,3 +267,108 @@ func TestGetHeaderParams(t *testing.T) {
 		assert.Equal(t, "", res)
 	})
 }
+
+func BenchmarkGetQueryParam(b *testing.B) {
+	req := httptest.NewRequest(http.MethodGet, "/?name=john&limit=42&ratio=0.5&enabled=true&tags=a,b,c", nil)
+	ctx := echo.New().NewContext(req, nil)
+
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		res := ""
+		for i := 0; i < b.N; i++ {
+			_ = GetQueryParam[string](ctx, "name", &res)
+		}
+	})
+	b.Run("int", func(b *testing.B) {
+		b.ReportAllocs()
+		res := 0
+		for i := 0; i < b.N; i++ {
+			_ = GetQueryParam[int](ctx, "limit", &res)
+		}
+	})
+	b.Run("float64", func(b *testing.B) {
+		b.ReportAllocs()
+		res := 0.0
+		for i := 0; i < b.N; i++ {
+			_ = GetQueryParam[float64](ctx, "ratio", &res)
+		}
+	})
+	b.Run("bool", func(b *testing.B) {
+		b.ReportAllocs()
+		res := false
+		for i := 0; i < b.N; i++ {
+			_ = GetQueryParam[bool](ctx, "enabled", &res)
+		}
+	})
+	b.Run("[]string", func(b *testing.B) {
+		b.ReportAllocs()
+		res := []string{}
+		for i := 0; i < b.N; i++ {
+			_ = GetQueryParam[[]string](ctx, "tags", &res)
+		}
+	})
+}
+
+type Pagination struct {
+	Page  int `in:"query=page;default=1"`
+	Limit int `in:"query=limit;default=20"`
+}
+
+type sorting struct {
+	Sort  string `in:"query=sort"`
+	Order string `in:"query=order;default=asc"`
+}
+
+type userFilter struct {
+	Name string `in:"query=name"`
+	sorting
+}
+
+type nestedParamsInput struct {
+	Pagination
+	sorting
+	Filter userFilter
+	Tenant *struct {
+		ID string `in:"header=X-Tenant"`
+	}
+	Verbose bool `in:"query=verbose"`
+}
+
+func TestGetRequestParametersNestedStructs(t *testing.T) {
+	t.Run("embedded and nested", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?limit=5&sort=name&name=ada&verbose=true", nil)
+		req.Header.Set("X-Tenant", "acme")
+		var param nestedParamsInput
+		assert.NoError(t, GetRequestParameters(req, &param))
+		assert.Equal(t, Pagination{Page: 1, Limit: 5}, param.Pagination)
+		assert.Equal(t, sorting{Sort: "name", Order: "asc"}, param.sorting)
+		assert.Equal(t, userFilter{Name: "ada", sorting: sorting{Sort: "name", Order: "asc"}}, param.Filter)
+		if assert.NotNil(t, param.Tenant) {
+			assert.Equal(t, "acme", param.Tenant.ID)
+		}
+		assert.True(t, param.Verbose)
+	})
+	t.Run("invalid embedded field", func(t *testing.T) {
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/?limit=many", nil), nil)
+		_, err := MustBind[nestedParamsInput](ctx)
+		var fieldErrs FieldErrors
+		if assert.ErrorAs(t, err, &fieldErrs) {
+			assert.Equal(t, "limit", fieldErrs[0].Field)
+			assert.Equal(t, "query", fieldErrs[0].Source)
+		}
+	})
+	t.Run("compiled plan", func(t *testing.T) {
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/?sort=name", nil), nil)
+		param, err := Compile[nestedParamsInput]().Fill(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "name", param.Sort)
+		assert.Equal(t, "name", param.Filter.Sort)
+	})
+	t.Run("encode", func(t *testing.T) {
+		param := nestedParamsInput{Pagination: Pagination{Page: 2}, sorting: sorting{Sort: "name"}}
+		values, err := EncodeQuery(param)
+		assert.NoError(t, err)
+		assert.Equal(t, "2", values.Get("page"))
+		assert.Equal(t, "name", values.Get("sort"))
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ggicci/httpin/core"
+	"github.com/labstack/echo/v4"
+)
+
+// Serializer encodes and decodes values in a content type, like JSON or CBOR.
+type Serializer interface {
+	Decode(r io.Reader, v any) error
+	Encode(w io.Writer, v any) error
+}
+
+// JSONSerializer is the Serializer of application/json, with encoding/json.
+type JSONSerializer struct{}
+
+func (JSONSerializer) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+func (JSONSerializer) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// XMLSerializer is the Serializer of application/xml, with encoding/xml.
+type XMLSerializer struct{}
+
+func (XMLSerializer) Decode(r io.Reader, v any) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+func (XMLSerializer) Encode(w io.Writer, v any) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+type registeredSerializer struct {
+	contentType string
+	format      string
+	serializer  Serializer
+}
+
+// serializers holds the registered serializers by content type.
+var serializers = struct {
+	sync.RWMutex
+	byType map[string]registeredSerializer
+}{
+	byType: map[string]registeredSerializer{
+		echo.MIMEApplicationJSON: {echo.MIMEApplicationJSON, "json", JSONSerializer{}},
+		echo.MIMEApplicationXML:  {echo.MIMEApplicationXML, "xml", XMLSerializer{}},
+		echo.MIMETextXML:         {echo.MIMETextXML, "", XMLSerializer{}},
+	},
+}
+
+// RegisterSerializer registers the serializer for the content type, like
+// "application/cbor", replacing the serializer registered for it. The serializer is
+// used by GetBody for request bodies of the content type, and by the response layer of
+// the server package for clients accepting it. With a format, like "cbor", it is also
+// registered as a body format of the binder, so `in:"body=cbor"` fields are decoded
+// with it, and NewRequest encodes them with it.
+func RegisterSerializer(contentType, format string, serializer Serializer) {
+	contentType = strings.ToLower(contentType)
+	format = strings.ToLower(format)
+	serializers.Lock()
+	defer serializers.Unlock()
+	serializers.byType[contentType] = registeredSerializer{contentType, format, serializer}
+	if format != "" {
+		core.RegisterBodyFormat(format, bodyFormat{serializer}, true)
+	}
+}
+
+// SerializerFor returns the serializer registered for the media type of the content
+// type, or for its structured syntax suffix, so "application/problem+json" is handled
+// by the serializer of "application/json".
+func SerializerFor(contentType string) (Serializer, bool) {
+	registered, ok := lookupSerializer(contentType)
+	return registered.serializer, ok
+}
+
+func lookupSerializer(contentType string) (registeredSerializer, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return registeredSerializer{}, false
+	}
+	serializers.RLock()
+	defer serializers.RUnlock()
+	if registered, ok := serializers.byType[mediaType]; ok {
+		return registered, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		registered, ok := serializers.byType["application/"+mediaType[i+1:]]
+		return registered, ok
+	}
+	return registeredSerializer{}, false
+}
+
+// ContentTypes returns the content types with a registered serializer, sorted.
+func ContentTypes() []string {
+	serializers.RLock()
+	defer serializers.RUnlock()
+	types := make([]string, 0, len(serializers.byType))
+	for contentType := range serializers.byType {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// formatContentType returns the content type registered for the body format.
+func formatContentType(format string) string {
+	serializers.RLock()
+	defer serializers.RUnlock()
+	for _, registered := range serializers.byType {
+		if registered.format == format {
+			return registered.contentType
+		}
+	}
+	return ""
+}
+
+// bodyFormat adapts a Serializer to a body format of httpin.
+type bodyFormat struct {
+	serializer Serializer
+}
+
+func (f bodyFormat) Decode(src io.Reader, dst any) error {
+	return f.serializer.Decode(src, dst)
+}
+
+func (f bodyFormat) Encode(src any) (io.Reader, error) {
+	var buf bytes.Buffer
+	if err := f.serializer.Encode(&buf, src); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// prefixedSerializer writes JSON after a "prefixed:" marker, standing in for formats
+// like CBOR.
+type prefixedSerializer struct{}
+
+func (prefixedSerializer) Decode(r io.Reader, v any) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	data, ok := bytes.CutPrefix(data, []byte("prefixed:"))
+	if !ok {
+		return errors.New("missing prefix")
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (prefixedSerializer) Encode(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, "prefixed:"); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+func init() {
+	RegisterSerializer("application/x-prefixed", "prefixed", prefixedSerializer{})
+}
+
+func TestSerializerFor(t *testing.T) {
+	serializer, ok := SerializerFor("application/json; charset=utf-8")
+	assert.True(t, ok)
+	assert.Equal(t, JSONSerializer{}, serializer)
+
+	serializer, ok = SerializerFor("application/problem+json")
+	assert.True(t, ok)
+	assert.Equal(t, JSONSerializer{}, serializer)
+
+	serializer, ok = SerializerFor("text/xml")
+	assert.True(t, ok)
+	assert.Equal(t, XMLSerializer{}, serializer)
+
+	serializer, ok = SerializerFor("Application/X-Prefixed")
+	assert.True(t, ok)
+	assert.Equal(t, prefixedSerializer{}, serializer)
+
+	_, ok = SerializerFor("text/csv")
+	assert.False(t, ok)
+	_, ok = SerializerFor("")
+	assert.False(t, ok)
+
+	assert.Subset(t, ContentTypes(), []string{echo.MIMEApplicationJSON, echo.MIMEApplicationXML, "application/x-prefixed"})
+}
+
+type serializedUser struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func TestGetBodySerializer(t *testing.T) {
+	decode := func(contentType, body string) (serializedUser, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set(echo.HeaderContentType, contentType)
+		}
+		var user serializedUser
+		err := GetBody(echo.New().NewContext(req, nil), &user)
+		return user, err
+	}
+
+	user, err := decode("", `{"name":"alice"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Name)
+
+	user, err = decode(echo.MIMEApplicationXML, `<user><name>bob</name></user>`)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", user.Name)
+
+	user, err = decode("application/x-prefixed", `prefixed:{"name":"carol"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "carol", user.Name)
+
+	// unregistered content types are decoded as JSON, as before the registry
+	user, err = decode("text/plain", `{"name":"dave"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "dave", user.Name)
+}
+
+type prefixedInput struct {
+	User serializedUser `in:"body=prefixed"`
+}
+
+func TestSerializerBodyFormat(t *testing.T) {
+	req, err := NewRequest(context.Background(), http.MethodPut, "http://users/users", &prefixedInput{
+		User: serializedUser{Name: "alice"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-prefixed", req.Header.Get(echo.HeaderContentType))
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "prefixed:{\"name\":\"alice\"}\n", string(body))
+
+	req = httptest.NewRequest(http.MethodPut, "/users", bytes.NewReader(body))
+	input, err := mustBind[prefixedInput](req)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", input.User.Name)
+}
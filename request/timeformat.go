@@ -0,0 +1,75 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ggicci/httpin/core"
+	"github.com/ggicci/owl"
+)
+
+func init() {
+	core.RegisterDirective("format", &directiveFormat{})
+	core.RegisterDirective("default", WithFieldCoders(&core.DirectiveDefault{}), true)
+}
+
+// directiveFormat implements the "format" directive, which sets the layout, see
+// time.Parse, of a time.Time field bound from string values. Without it, times are
+// parsed as RFC 3339, dates like 2006-01-02 or unix timestamps, and formatted as
+// RFC 3339. The layout is applied by the source directives, see WithFieldCoders, so
+// the directive itself does nothing.
+//
+//	type ReportInput struct {
+//		Since time.Time `in:"query=since;format=2006-01-02"`
+//	}
+type directiveFormat struct{}
+
+func (*directiveFormat) Decode(*core.DirectiveRuntime) error {
+	return nil
+}
+
+func (*directiveFormat) Encode(*core.DirectiveRuntime) error {
+	return nil
+}
+
+// timeLayout returns the layout of the format directive of the field.
+func timeLayout(resolver *owl.Resolver) (string, bool) {
+	directive := resolver.GetDirective("format")
+	if directive == nil || len(directive.Argv) == 0 {
+		return "", false
+	}
+	// layouts like "Jan 2, 2006" are split at the comma by the tag parser
+	return strings.Join(directive.Argv, ","), true
+}
+
+func timeLayoutAdaptor(layout string) core.AnyStringableAdaptor {
+	return func(v any) (core.Stringable, error) {
+		t, ok := v.(*time.Time)
+		if !ok {
+			return nil, fmt.Errorf("format directive requires time.Time, got %T", v)
+		}
+		return &layoutTime{time: t, layout: layout}, nil
+	}
+}
+
+// layoutTime converts a time.Time from and to strings with a layout.
+type layoutTime struct {
+	time   *time.Time
+	layout string
+}
+
+func (t *layoutTime) ToString() (string, error) {
+	return t.time.Format(t.layout), nil
+}
+
+func (t *layoutTime) FromString(s string) error {
+	parsed, err := time.Parse(t.layout, s)
+	if err != nil {
+		return fmt.Errorf("expected layout %s: %w", t.layout, err)
+	}
+	*t.time = parsed
+	return nil
+}
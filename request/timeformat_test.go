@@ -0,0 +1,95 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ggicci/httpin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reportInput struct {
+	Created time.Time   `in:"query=created"`
+	Since   time.Time   `in:"query=since;format=2006-01-02"`
+	Until   *time.Time  `in:"query=until;format=2006-01-02"`
+	Days    []time.Time `in:"query=day;format=20060102"`
+	Expires time.Time   `in:"header=X-Expires;format=Jan 2, 2006"`
+	From    time.Time   `in:"query=from;default=2023-01-01;format=2006-01-02"`
+}
+
+func TestTimeFormat(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("layouts", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?created=2023-05-01T10:30:00Z&since=2023-05-02&until=2023-05-03&day=20230504&day=20230505", nil)
+		req.Header.Set("X-Expires", "Jun 1, 2023")
+		var param reportInput
+		require.NoError(t, GetRequestParameters(req, &param))
+		assert.Equal(t, time.Date(2023, 5, 1, 10, 30, 0, 0, time.UTC), param.Created)
+		assert.Equal(t, date(2023, 5, 2), param.Since)
+		require.NotNil(t, param.Until)
+		assert.Equal(t, date(2023, 5, 3), *param.Until)
+		assert.Equal(t, []time.Time{date(2023, 5, 4), date(2023, 5, 5)}, param.Days)
+		assert.Equal(t, date(2023, 6, 1), param.Expires)
+		assert.Equal(t, date(2023, 1, 1), param.From)
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		var param reportInput
+		require.NoError(t, GetRequestParameters(httptest.NewRequest(http.MethodGet, "/", nil), &param))
+		assert.True(t, param.Since.IsZero())
+		assert.Nil(t, param.Until)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var param reportInput
+		err := GetRequestParameters(httptest.NewRequest(http.MethodGet, "/?since=2023-05-02T10:30:00Z", nil), &param)
+		require.Error(t, err)
+		fieldErrs, ok := newFieldErrors(err, reflect.TypeOf(param))
+		require.True(t, ok)
+		assert.Equal(t, "since", fieldErrs[0].Field)
+		assert.Equal(t, CodeInvalidFormat, fieldErrs[0].Code)
+		assert.Contains(t, fieldErrs[0].Message, "expected layout 2006-01-02")
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		until := date(2023, 5, 3)
+		param := reportInput{
+			Since: date(2023, 5, 2),
+			Until: &until,
+			Days:  []time.Time{date(2023, 5, 4)},
+		}
+		values, err := EncodeQuery(param)
+		require.NoError(t, err)
+		assert.Equal(t, "2023-05-02", values.Get("since"))
+		assert.Equal(t, "2023-05-03", values.Get("until"))
+		assert.Equal(t, []string{"20230504"}, values["day"])
+
+		req, err := httpin.NewRequest(http.MethodGet, "/", &param)
+		require.NoError(t, err)
+		query, err := url.ParseQuery(req.URL.RawQuery)
+		require.NoError(t, err)
+		assert.Equal(t, "2023-05-02", query.Get("since"))
+		assert.Equal(t, "Jan 1, 0001", req.Header.Get("X-Expires"))
+	})
+
+	t.Run("requires time.Time", func(t *testing.T) {
+		type input struct {
+			Since string `in:"query=since;format=2006-01-02"`
+		}
+		err := ValidateStruct[input]()
+		require.Error(t, err)
+		assert.True(t, strings.Contains(err.Error(), "format directive requires time.Time"), err.Error())
+		assert.NoError(t, ValidateStruct[reportInput]())
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ggicci/httpin"
+	"github.com/ggicci/httpin/core"
+)
+
+// stringDirectives are the directives that decode a field from string values,
+// which requires the field type to be convertible from a string.
+var stringDirectives = map[string]bool{
+	"query":   true,
+	"header":  true,
+	"form":    true,
+	"path":    true,
+	"cookie":  true,
+	"default": true,
+}
+
+var fileableType = reflect.TypeOf((*core.Fileable)(nil)).Elem()
+
+// ValidateStruct checks the `in` tags of the parameter struct T: every directive must be
+// registered and parseable, and every field bound from string values must have a supported type.
+// It is meant to be called from init or a test, so malformed tags fail before the first request.
+func ValidateStruct[T any]() error {
+	_, err := httpin.New(new(T))
+	if err != nil {
+		return err
+	}
+	return validateFields(reflect.TypeOf((*T)(nil)).Elem(), "")
+}
+
+func validateFields(rt reflect.Type, prefix string) error {
+	var errs []error
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		name := prefix + field.Name
+
+		tag, ok := field.Tag.Lookup("in")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct {
+				errs = append(errs, validateFields(field.Type, name+"."))
+			}
+			continue
+		}
+		err := validateFieldType(field.Type, tag)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateFieldType(rt reflect.Type, tag string) error {
+	decodesStrings, formatted := false, false
+	for _, directive := range strings.Split(tag, ";") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch {
+		case name == "coder" || name == "decoder":
+			// a named coder decides itself which types it supports
+			return nil
+		case name == "format":
+			formatted = true
+		case name == "rawbody":
+			err := checkRawBodyType(rt)
+			if err != nil {
+				return err
+			}
+		case name == "file":
+			err := validateFile(arg, rt)
+			if err != nil {
+				return err
+			}
+		case name == "query" && arg == "":
+			// without a key the query directive binds the complete query string
+			err := checkQueryMapType(rt)
+			if err != nil {
+				return err
+			}
+		case name == "min" || name == "max" || name == "len" || name == "pattern":
+			err := validateConstraint(name, arg, rt)
+			if err != nil {
+				return err
+			}
+		case stringDirectives[name]:
+			decodesStrings = true
+		}
+	}
+	baseType, _ := core.BaseTypeOf(rt)
+	if formatted && indirectType(baseType) != timeType {
+		return fmt.Errorf("format directive requires time.Time, got %s", rt)
+	}
+	if !decodesStrings {
+		return nil
+	}
+
+	if baseType.Implements(fileableType) || reflect.PointerTo(baseType).Implements(fileableType) {
+		return nil
+	}
+	if elemType := indirectType(baseType); isJSONUnmarshaler(elemType) {
+		return nil
+	}
+	_, err := core.NewStringSlicable(reflect.New(rt).Elem(), nil)
+	return err
+}
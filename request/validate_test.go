@@ -0,0 +1,67 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package request
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ggicci/httpin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStruct(t *testing.T) {
+	t.Run("valid struct", func(t *testing.T) {
+		type pagination struct {
+			Page int `in:"query=page;default=1"`
+		}
+		type input struct {
+			pagination
+			IDs     []int64      `in:"query=id"`
+			Since   *time.Time   `in:"query=since"`
+			Token   string       `in:"header=X-Token;required"`
+			Avatar  *httpin.File `in:"form=avatar"`
+			Payload struct {
+				Name string
+			} `in:"body=json"`
+		}
+		assert.NoError(t, ValidateStruct[input]())
+	})
+	t.Run("unknown directive", func(t *testing.T) {
+		type input struct {
+			Name string `in:"unknown=name"`
+		}
+		assert.Error(t, ValidateStruct[input]())
+	})
+	t.Run("unsupported field type", func(t *testing.T) {
+		type input struct {
+			Filter map[string]string `in:"query=filter"`
+		}
+		err := ValidateStruct[input]()
+		assert.ErrorContains(t, err, "field Filter")
+	})
+	t.Run("query without a key", func(t *testing.T) {
+		type input struct {
+			All    url.Values          `in:"query"`
+			Values map[string][]string `in:"query"`
+			First  map[string]string   `in:"query"`
+		}
+		assert.NoError(t, ValidateStruct[input]())
+
+		type invalid struct {
+			All []string `in:"query"`
+		}
+		assert.ErrorContains(t, ValidateStruct[invalid](), "query directive without a key requires")
+	})
+	t.Run("unsupported nested field type", func(t *testing.T) {
+		type nested struct {
+			Callback func() `in:"query=cb"`
+		}
+		type input struct {
+			Nested nested
+		}
+		err := ValidateStruct[input]()
+		assert.ErrorContains(t, err, "field Nested.Callback")
+	})
+}
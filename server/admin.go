@@ -0,0 +1,260 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminToggle is a setting changed at runtime through the Admin API.
+type AdminToggle interface {
+	// Value returns the current value, written as JSON by the Admin API.
+	Value() any
+	// SetJSON sets the value from its JSON encoding.
+	SetJSON(data []byte) error
+}
+
+// Toggle holds a setting of a middleware which can be changed while the server is
+// running, like the Enabled toggle of Maintenance or the Percent of a Canary.
+type Toggle[T any] struct {
+	value    atomic.Pointer[T]
+	validate func(T) error
+}
+
+// NewToggle creates a Toggle holding value.
+func NewToggle[T any](value T) *Toggle[T] {
+	t := &Toggle[T]{}
+	t.value.Store(&value)
+	return t
+}
+
+// Get returns the value.
+func (t *Toggle[T]) Get() T {
+	return *t.value.Load()
+}
+
+// Set replaces the value.
+func (t *Toggle[T]) Set(value T) {
+	t.value.Store(&value)
+}
+
+// Validate sets a check of the values set with SetJSON, and returns the toggle.
+func (t *Toggle[T]) Validate(validate func(T) error) *Toggle[T] {
+	t.validate = validate
+	return t
+}
+
+func (t *Toggle[T]) Value() any {
+	return t.Get()
+}
+
+func (t *Toggle[T]) SetJSON(data []byte) error {
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if t.validate != nil {
+		if err := t.validate(value); err != nil {
+			return err
+		}
+	}
+	t.Set(value)
+	return nil
+}
+
+// ErrToggleNotFound is returned when setting a toggle not registered on the Admin.
+var ErrToggleNotFound = errors.New("toggle not found")
+
+// AuditEntry records a change of a toggle.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Principal is who made the change.
+	Principal string          `json:"principal"`
+	Toggle    string          `json:"toggle"`
+	Old       json.RawMessage `json:"old"`
+	New       json.RawMessage `json:"new"`
+	RequestID string          `json:"request_id,omitempty"`
+}
+
+// AdminConfig configures an Admin.
+type AdminConfig struct {
+	// AuditSize is the number of audit entries kept in memory, 100 by default.
+	AuditSize int
+	// Audit receives every change, e.g. to write it to a durable audit log.
+	Audit func(ctx context.Context, entry AuditEntry)
+	// PrincipalFunc returns who makes an admin request, the "sub" claim of the
+	// AuthClaimsKey by default. Requests without a principal are rejected with 401
+	// Unauthorized.
+	PrincipalFunc func(c echo.Context) string
+}
+
+// DefaultAdminConfig is the default Admin config.
+var DefaultAdminConfig = AdminConfig{
+	AuditSize: 100,
+	PrincipalFunc: func(c echo.Context) string {
+		if claims, ok := Get(c, AuthClaimsKey); ok {
+			if sub, ok := claims["sub"].(string); ok {
+				return sub
+			}
+		}
+		return ""
+	},
+}
+
+// Admin is a registry of toggles changed at runtime, like maintenance mode, the Dump
+// middleware, fault injection or canary percentages, keeping an audit trail of who
+// changed what.
+//
+// Usage:
+//
+//	maintenance := server.NewToggle(false)
+//	admin := server.NewAdmin(server.DefaultAdminConfig)
+//	admin.Register("maintenance", maintenance)
+//	s.Use(server.Maintenance(maintenance, time.Minute))
+//	s.UseAdmin(admin, authenticate)
+type Admin struct {
+	config AdminConfig
+
+	mu      sync.Mutex
+	toggles map[string]AdminToggle
+	audit   []AuditEntry
+	now     func() time.Time
+}
+
+// NewAdmin creates an Admin without toggles.
+func NewAdmin(config AdminConfig) *Admin {
+	if config.AuditSize == 0 {
+		config.AuditSize = DefaultAdminConfig.AuditSize
+	}
+	if config.PrincipalFunc == nil {
+		config.PrincipalFunc = DefaultAdminConfig.PrincipalFunc
+	}
+	return &Admin{config: config, toggles: map[string]AdminToggle{}, now: time.Now}
+}
+
+// Register adds a named toggle.
+func (a *Admin) Register(name string, toggle AdminToggle) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.toggles[name] = toggle
+}
+
+// Toggles returns the values of the toggles by name.
+func (a *Admin) Toggles() map[string]any {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	values := make(map[string]any, len(a.toggles))
+	for name, toggle := range a.toggles {
+		values[name] = toggle.Value()
+	}
+	return values
+}
+
+// Set sets the toggle from the JSON encoded value and records the change made by principal.
+func (a *Admin) Set(ctx context.Context, principal, name string, value []byte) error {
+	err := a.set(ctx, AuditEntry{Principal: principal, Toggle: name}, value)
+	if err != nil && !errors.Is(err, ErrToggleNotFound) {
+		return fmt.Errorf("toggle %s: %w", name, err)
+	}
+	return err
+}
+
+func (a *Admin) set(ctx context.Context, entry AuditEntry, value []byte) error {
+	a.mu.Lock()
+	toggle, ok := a.toggles[entry.Toggle]
+	if !ok {
+		a.mu.Unlock()
+		return ErrToggleNotFound
+	}
+	old, err := json.Marshal(toggle.Value())
+	if err == nil {
+		err = toggle.SetJSON(value)
+	}
+	if err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	entry.Time = a.now()
+	entry.Old = old
+	entry.New, _ = json.Marshal(toggle.Value())
+	a.audit = append(a.audit, entry)
+	if len(a.audit) > a.config.AuditSize {
+		a.audit = a.audit[len(a.audit)-a.config.AuditSize:]
+	}
+	a.mu.Unlock()
+
+	if a.config.Audit != nil {
+		a.config.Audit(ctx, entry)
+	}
+	return nil
+}
+
+// Audit returns the recorded changes, the latest last.
+func (a *Admin) Audit() []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]AuditEntry(nil), a.audit...)
+}
+
+// UseAdmin serves the admin API below /.kapeta/admin, guarded by the middlewares, which
+// must authenticate the caller:
+//
+//	GET /.kapeta/admin/toggles        the values of the toggles
+//	PUT /.kapeta/admin/toggles/:name  sets a toggle to the JSON body
+//	GET /.kapeta/admin/audit          the audit trail
+func (s *KapetaServer) UseAdmin(a *Admin, m ...echo.MiddlewareFunc) {
+	g := s.Group(adminPath, m...)
+	g.Use(requirePrincipal(a.config.PrincipalFunc))
+	g.GET("/toggles", a.listToggles)
+	g.PUT("/toggles/:name", a.setToggle)
+	g.GET("/audit", a.listAudit)
+}
+
+const adminPath = "/.kapeta/admin"
+
+// requirePrincipal rejects requests without a principal, after the middlewares of
+// UseAdmin and UseLogLevels.
+func requirePrincipal(principal func(c echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if principal(c) == "" {
+				return echo.ErrUnauthorized
+			}
+			return next(c)
+		}
+	}
+}
+
+func (a *Admin) listToggles(c echo.Context) error {
+	return c.JSON(http.StatusOK, a.Toggles())
+}
+
+func (a *Admin) setToggle(c echo.Context) error {
+	value, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	name := c.Param("name")
+	entry := AuditEntry{Principal: a.config.PrincipalFunc(c), Toggle: name, RequestID: requestID(c)}
+	if err := a.set(c.Request().Context(), entry, value); err != nil {
+		if errors.Is(err, ErrToggleNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "unknown toggle "+name)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, a.Toggles()[name])
+}
+
+func (a *Admin) listAudit(c echo.Context) error {
+	return c.JSON(http.StatusOK, a.Audit())
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToggle(t *testing.T) {
+	toggle := NewToggle(Fault{Percent: 10}).Validate(func(f Fault) error {
+		if f.Status != 0 && f.Status < 400 {
+			return errors.New("status must be an error status")
+		}
+		return nil
+	})
+	assert.Equal(t, Fault{Percent: 10}, toggle.Get())
+	assert.NoError(t, toggle.SetJSON([]byte(`{"percent":20,"status":503}`)))
+	assert.Equal(t, Fault{Percent: 20, Status: 503}, toggle.Value())
+	assert.EqualError(t, toggle.SetJSON([]byte(`{"status":200}`)), "status must be an error status")
+	assert.Error(t, toggle.SetJSON([]byte(`"on"`)))
+	assert.Equal(t, Fault{Percent: 20, Status: 503}, toggle.Get())
+}
+
+func TestAdmin(t *testing.T) {
+	var audited []AuditEntry
+	admin := NewAdmin(AdminConfig{
+		AuditSize: 2,
+		Audit: func(ctx context.Context, entry AuditEntry) {
+			audited = append(audited, entry)
+		},
+	})
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	admin.now = func() time.Time { return now }
+	maintenance := NewToggle(false)
+	admin.Register("maintenance", maintenance)
+
+	assert.ErrorIs(t, admin.Set(context.Background(), "alice", "dump", []byte("true")), ErrToggleNotFound)
+	assert.EqualError(t, admin.Set(context.Background(), "alice", "maintenance", []byte("1")),
+		"toggle maintenance: json: cannot unmarshal number into Go value of type bool")
+
+	for i, value := range []string{"true", "false", "true"} {
+		assert.NoError(t, admin.Set(context.Background(), "alice", "maintenance", []byte(value)), i)
+	}
+	assert.True(t, maintenance.Get())
+	assert.Len(t, audited, 3)
+	assert.Equal(t, []AuditEntry{
+		{Time: now, Principal: "alice", Toggle: "maintenance", Old: json.RawMessage("true"), New: json.RawMessage("false")},
+		{Time: now, Principal: "alice", Toggle: "maintenance", Old: json.RawMessage("false"), New: json.RawMessage("true")},
+	}, admin.Audit())
+	assert.Equal(t, map[string]any{"maintenance": true}, admin.Toggles())
+}
+
+func TestUseAdmin(t *testing.T) {
+	s := NewWithDefaults()
+	admin := NewAdmin(DefaultAdminConfig)
+	maintenance := NewToggle(false)
+	admin.Register("maintenance", maintenance)
+	canary := NewCanary(CanaryConfig{Percent: 5}, nil)
+	admin.Register("canary", canary.Percent())
+	s.UseAdmin(admin, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if user := c.Request().Header.Get("X-User"); user != "" {
+				Set(c, AuthClaimsKey, map[string]any{"sub": user})
+			}
+			return next(c)
+		}
+	})
+	serve := func(method, target, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, adminPath+"/toggles", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodGet, adminPath+"/toggles", "alice", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"maintenance":false,"canary":5}`, rec.Body.String())
+
+	rec = serve(http.MethodPut, adminPath+"/toggles/canary", "alice", "25")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "25\n", rec.Body.String())
+	assert.Equal(t, 25.0, canary.Percent().Get())
+
+	rec = serve(http.MethodPut, adminPath+"/toggles/canary", "alice", "250")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(http.MethodPut, adminPath+"/toggles/dump", "alice", "true")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodGet, adminPath+"/audit", "bob", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var audit []AuditEntry
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &audit))
+	if assert.Len(t, audit, 1) {
+		assert.Equal(t, "alice", audit[0].Principal)
+		assert.Equal(t, "canary", audit[0].Toggle)
+		assert.Equal(t, json.RawMessage("5"), audit[0].Old)
+		assert.Equal(t, json.RawMessage("25"), audit[0].New)
+		assert.NotEmpty(t, audit[0].RequestID)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdmissionConfig configures an AdmissionQueue.
+type AdmissionConfig struct {
+	// MaxConcurrent is the number of requests handled concurrently.
+	MaxConcurrent int
+	// MaxQueue is the number of requests waiting for a slot, MaxConcurrent by default.
+	// Requests arriving while the queue is full are rejected immediately.
+	MaxQueue int
+	// MaxWait is how long a request waits in the queue before it is rejected, 1 second
+	// by default.
+	MaxWait time.Duration
+	// Status is the status of rejected requests, 503 Service Unavailable by default.
+	// Use 429 Too Many Requests when the clients back off on it.
+	Status int
+	// RetryAfter is the number of seconds sent in the Retry-After header of rejected
+	// requests, 1 by default.
+	RetryAfter int
+}
+
+// DefaultAdmissionConfig is the default AdmissionQueue config.
+var DefaultAdmissionConfig = AdmissionConfig{
+	MaxWait:    time.Second,
+	Status:     http.StatusServiceUnavailable,
+	RetryAfter: 1,
+}
+
+// AdmissionQueue limits the number of requests handled concurrently, and queues the
+// excess requests for a short time instead of rejecting them, smoothing short traffic
+// spikes. Requests are admitted in arrival order. Unlike the LoadShedder, which rejects
+// excess requests immediately, it trades latency for fewer failed requests.
+//
+// Usage:
+//
+//	queue := server.NewAdmissionQueue(server.AdmissionConfig{MaxConcurrent: 100})
+//	api := s.Group("/api", queue.Middleware())
+type AdmissionQueue struct {
+	config     AdmissionConfig
+	retryAfter string
+
+	mu       sync.Mutex
+	inFlight int
+	// waiters are the channels of the queued requests in arrival order, closed when the
+	// slot of a finished request is handed over
+	waiters list.List
+}
+
+// NewAdmissionQueue creates an AdmissionQueue from the config.
+func NewAdmissionQueue(config AdmissionConfig) *AdmissionQueue {
+	config.MaxConcurrent = max(1, config.MaxConcurrent)
+	if config.MaxQueue == 0 {
+		config.MaxQueue = config.MaxConcurrent
+	}
+	if config.MaxWait == 0 {
+		config.MaxWait = DefaultAdmissionConfig.MaxWait
+	}
+	if config.Status == 0 {
+		config.Status = DefaultAdmissionConfig.Status
+	}
+	if config.RetryAfter == 0 {
+		config.RetryAfter = DefaultAdmissionConfig.RetryAfter
+	}
+	return &AdmissionQueue{
+		config:     config,
+		retryAfter: strconv.Itoa(config.RetryAfter),
+	}
+}
+
+// InFlight returns the number of requests currently handled.
+func (q *AdmissionQueue) InFlight() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.inFlight
+}
+
+// Queued returns the number of requests currently waiting for a slot.
+func (q *AdmissionQueue) Queued() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(q.waiters.Len())
+}
+
+// Middleware returns a middleware admitting the requests through the queue. The
+// middlewares of a queue share its slots.
+func (q *AdmissionQueue) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := q.admit(c); err != nil {
+				return err
+			}
+			defer q.release()
+			return next(c)
+		}
+	}
+}
+
+func (q *AdmissionQueue) admit(c echo.Context) error {
+	q.mu.Lock()
+	// a free slot is taken only when no request waits for it
+	if q.inFlight < q.config.MaxConcurrent && q.waiters.Len() == 0 {
+		q.inFlight++
+		q.mu.Unlock()
+		return nil
+	}
+	if q.waiters.Len() >= q.config.MaxQueue {
+		q.mu.Unlock()
+		return q.reject(c, "server busy, retry later")
+	}
+	admitted := make(chan struct{})
+	waiter := q.waiters.PushBack(admitted)
+	q.mu.Unlock()
+
+	timer := time.NewTimer(q.config.MaxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-admitted:
+		return nil
+	case <-timer.C:
+		err = q.reject(c, "server busy, request timed out in queue")
+	case <-c.Request().Context().Done():
+		err = c.Request().Context().Err()
+	}
+
+	q.mu.Lock()
+	select {
+	case <-admitted:
+		// the slot was handed over meanwhile, it is passed on
+		q.mu.Unlock()
+		q.release()
+	default:
+		q.waiters.Remove(waiter)
+		q.mu.Unlock()
+	}
+	return err
+}
+
+// release hands the slot of a finished request over to the first queued request.
+func (q *AdmissionQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if first := q.waiters.Front(); first != nil {
+		q.waiters.Remove(first)
+		close(first.Value.(chan struct{}))
+		return
+	}
+	q.inFlight--
+}
+
+func (q *AdmissionQueue) reject(c echo.Context, message string) error {
+	c.Response().Header().Set(echo.HeaderRetryAfter, q.retryAfter)
+	return echo.NewHTTPError(q.config.Status, message)
+}
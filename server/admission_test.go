@@ -0,0 +1,115 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmissionQueue(t *testing.T) {
+	queue := NewAdmissionQueue(AdmissionConfig{MaxConcurrent: 2, MaxQueue: 1, MaxWait: time.Minute, Status: http.StatusTooManyRequests})
+	release := make(chan struct{})
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		if c.QueryParam("block") == "true" {
+			<-release
+		}
+		return c.NoContent(http.StatusOK)
+	}, queue.Middleware())
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve("/?block=true")
+		}()
+	}
+	require.Eventually(t, func() bool { return queue.InFlight() == 2 }, time.Second, time.Millisecond)
+
+	// the queued request is handled once a slot is free
+	queued := make(chan int)
+	go func() {
+		queued <- serve("/").Code
+	}()
+	require.Eventually(t, func() bool { return queue.Queued() == 1 }, time.Second, time.Millisecond)
+
+	rec := serve("/")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get(echo.HeaderRetryAfter))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-queued)
+	wg.Wait()
+	assert.Equal(t, 0, queue.InFlight())
+	assert.Equal(t, int64(0), queue.Queued())
+}
+
+func TestAdmissionQueueMaxWait(t *testing.T) {
+	queue := NewAdmissionQueue(AdmissionConfig{MaxConcurrent: 1, MaxWait: 20 * time.Millisecond})
+	release := make(chan struct{})
+	defer close(release)
+	handler := queue.Middleware()(func(c echo.Context) error {
+		<-release
+		return nil
+	})
+	e := echo.New()
+	go handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+	require.Eventually(t, func() bool { return queue.InFlight() == 1 }, time.Second, time.Millisecond)
+
+	start := time.Now()
+	err := handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, errorStatus(err))
+	assert.Equal(t, int64(0), queue.Queued())
+}
+
+func TestAdmissionQueueOrder(t *testing.T) {
+	queue := NewAdmissionQueue(AdmissionConfig{MaxConcurrent: 1, MaxQueue: 3, MaxWait: time.Minute})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	handler := queue.Middleware()(func(c echo.Context) error {
+		mu.Lock()
+		order = append(order, c.QueryParam("id"))
+		mu.Unlock()
+		<-release
+		return nil
+	})
+	e := echo.New()
+	var wg sync.WaitGroup
+	serve := func(id string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/?id="+id, nil), httptest.NewRecorder()))
+		}()
+	}
+
+	serve("first")
+	require.Eventually(t, func() bool { return queue.InFlight() == 1 }, time.Second, time.Millisecond)
+	for i, id := range []string{"a", "b", "c"} {
+		serve(id)
+		require.Eventually(t, func() bool { return queue.Queued() == int64(i+1) }, time.Second, time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		release <- struct{}{}
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"first", "a", "b", "c"}, order)
+	assert.Equal(t, 0, queue.InFlight())
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	cacheControlImmutable = "public, max-age=31536000, immutable"
+	cacheControlNoCache   = "no-cache"
+)
+
+// Assets serves static files with content hash based file names and ETags. HTML
+// entry points keep their names and are revalidated on every request, while
+// fingerprinted assets like app.3f2a9c1b5d6e7f80.js are cached forever.
+//
+// Usage:
+//
+//	assets, err := server.NewAssets(webFS)
+//	...
+//	s.UseAssets("/static", assets)
+//	// in templates: <script src="{{ .Assets.Path "app.js" }}"></script>
+type Assets struct {
+	prefix string
+	fsys   fs.FS
+	// hashes holds the content hash of every file by its path
+	hashes map[string]string
+	// fingerprinted maps fingerprinted paths to file paths
+	fingerprinted map[string]string
+}
+
+// NewAssets hashes every file of the file system.
+func NewAssets(fsys fs.FS) (*Assets, error) {
+	assets := &Assets{
+		fsys:          fsys,
+		hashes:        map[string]string{},
+		fingerprinted: map[string]string{},
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		file, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return err
+		}
+		sum := hex.EncodeToString(hash.Sum(nil))[:16]
+		assets.hashes[name] = sum
+		if !isHTML(name) {
+			assets.fingerprinted[fingerprint(name, sum)] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// fingerprint inserts the hash before the extension, app.js becomes app.<hash>.js.
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func isHTML(name string) bool {
+	ext := path.Ext(name)
+	return ext == ".html" || ext == ".htm"
+}
+
+// Path returns the URL of the file, fingerprinted unless it is HTML. Unknown files
+// are returned unchanged under the prefix.
+func (a *Assets) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	hash, ok := a.hashes[name]
+	if !ok || isHTML(name) {
+		return a.prefix + "/" + name
+	}
+	return a.prefix + "/" + fingerprint(name, hash)
+}
+
+// UseAssets serves the assets under the prefix. Requests for a directory are served
+// its index.html.
+func (s *KapetaServer) UseAssets(prefix string, assets *Assets) {
+	assets.prefix = strings.TrimSuffix(prefix, "/")
+	s.GET(assets.prefix+"/*", assets.serve)
+	s.HEAD(assets.prefix+"/*", assets.serve)
+}
+
+func (a *Assets) serve(c echo.Context) error {
+	name := strings.TrimPrefix(path.Clean("/"+c.Param("*")), "/")
+	cacheControl := cacheControlImmutable
+	if original, ok := a.fingerprinted[name]; ok {
+		name = original
+	} else {
+		cacheControl = cacheControlNoCache
+		if _, ok := a.hashes[name]; !ok {
+			name = path.Join(name, "index.html")
+		}
+	}
+	hash, ok := a.hashes[name]
+	if !ok {
+		return echo.ErrNotFound
+	}
+
+	file, err := a.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, cacheControl)
+	header.Set("ETag", `"`+hash+`"`)
+	// ServeContent answers If-None-Match with the ETag, and sets the content type from the name
+	http.ServeContent(c.Response(), c.Request(), name, time.Time{}, content)
+	return nil
+}
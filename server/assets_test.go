@@ -0,0 +1,72 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssets(t *testing.T) {
+	assets, err := NewAssets(fstest.MapFS{
+		"index.html":      {Data: []byte("<html></html>")},
+		"js/app.js":       {Data: []byte("console.log(1)")},
+		"docs/index.html": {Data: []byte("<html>docs</html>")},
+	})
+	require.NoError(t, err)
+	s := New()
+	s.UseAssets("/static/", assets)
+
+	serve := func(target string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	appPath := assets.Path("js/app.js")
+	assert.Regexp(t, `^/static/js/app\.[0-9a-f]{16}\.js$`, appPath)
+	assert.Equal(t, "/static/index.html", assets.Path("/index.html"))
+	assert.Equal(t, "/static/missing.css", assets.Path("missing.css"))
+
+	t.Run("fingerprinted asset", func(t *testing.T) {
+		rec := serve(appPath)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "console.log(1)", rec.Body.String())
+		assert.Equal(t, cacheControlImmutable, rec.Header().Get(echo.HeaderCacheControl))
+		assert.Contains(t, rec.Header().Get(echo.HeaderContentType), "javascript")
+		etag := rec.Header().Get("ETag")
+		assert.True(t, strings.HasPrefix(etag, `"`))
+
+		assert.Equal(t, http.StatusNotModified, serve(appPath, "If-None-Match", etag).Code)
+	})
+	t.Run("html entry point", func(t *testing.T) {
+		rec := serve("/static/")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "<html></html>", rec.Body.String())
+		assert.Equal(t, cacheControlNoCache, rec.Header().Get(echo.HeaderCacheControl))
+		assert.NotEmpty(t, rec.Header().Get("ETag"))
+
+		rec = serve("/static/docs")
+		assert.Equal(t, "<html>docs</html>", rec.Body.String())
+	})
+	t.Run("unfingerprinted asset", func(t *testing.T) {
+		rec := serve("/static/js/app.js")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, cacheControlNoCache, rec.Header().Get(echo.HeaderCacheControl))
+	})
+	t.Run("missing", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("/static/js/missing.js").Code)
+		assert.Equal(t, http.StatusNotFound, serve("/static/../server.go").Code)
+	})
+}
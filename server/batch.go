@@ -0,0 +1,186 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BatchRequest is a sub-request of a batch.
+type BatchRequest struct {
+	// ID identifies the response of the sub-request, responses are returned in request order.
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the response of a sub-request. JSON bodies are embedded as is,
+// other bodies as a string.
+type BatchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchConfig configures the Batch handler.
+type BatchConfig struct {
+	// MaxRequests is the largest number of sub-requests in a batch, 20 by default.
+	MaxRequests int
+	// Concurrency is the number of sub-requests dispatched at the same time, 4 by default.
+	Concurrency int
+	// ForwardHeaders are copied from the batch request to every sub-request, so each
+	// is authenticated and authorized by the middlewares of its route.
+	// Defaults to Authorization, Cookie and X-Correlation-Id.
+	ForwardHeaders []string
+}
+
+// DefaultBatchConfig is the default Batch handler config.
+var DefaultBatchConfig = BatchConfig{
+	MaxRequests:    20,
+	Concurrency:    4,
+	ForwardHeaders: []string{echo.HeaderAuthorization, echo.HeaderCookie, HeaderXCorrelationID},
+}
+
+// batchKey marks the context of sub-requests, so batches cannot be nested.
+type batchKey struct{}
+
+// Batch returns a handler accepting a batch of sub-requests as {"requests": [...]} and
+// dispatching each through the router in-process, with all middlewares of its route.
+// It responds with {"responses": [...]} holding the status, headers and body of each
+// sub-request, letting clients save round trips.
+//
+// Usage:
+//
+//	s.POST("/batch", s.Batch(server.BatchConfig{}))
+func (s *KapetaServer) Batch(config BatchConfig) echo.HandlerFunc {
+	if config.MaxRequests == 0 {
+		config.MaxRequests = DefaultBatchConfig.MaxRequests
+	}
+	if config.Concurrency == 0 {
+		config.Concurrency = DefaultBatchConfig.Concurrency
+	}
+	if config.ForwardHeaders == nil {
+		config.ForwardHeaders = DefaultBatchConfig.ForwardHeaders
+	}
+	return func(c echo.Context) error {
+		if c.Request().Context().Value(batchKey{}) != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "batches cannot be nested")
+		}
+		var batch struct {
+			Requests []BatchRequest `json:"requests"`
+		}
+		if err := json.NewDecoder(c.Request().Body).Decode(&batch); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid batch: "+err.Error()).SetInternal(err)
+		}
+		if len(batch.Requests) > config.MaxRequests {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("batch of %d requests exceeds the limit of %d", len(batch.Requests), config.MaxRequests))
+		}
+
+		responses := make([]BatchResponse, len(batch.Requests))
+		slots := make(chan struct{}, config.Concurrency)
+		var wg sync.WaitGroup
+		for i, item := range batch.Requests {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i int, item BatchRequest) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				responses[i] = s.dispatchBatchRequest(c, config, item)
+			}(i, item)
+		}
+		wg.Wait()
+		return c.JSON(http.StatusOK, echo.Map{"responses": responses})
+	}
+}
+
+func (s *KapetaServer) dispatchBatchRequest(c echo.Context, config BatchConfig, item BatchRequest) BatchResponse {
+	response := BatchResponse{ID: item.ID}
+	if item.Method == "" || !strings.HasPrefix(item.Path, "/") {
+		response.Status = http.StatusBadRequest
+		response.Body = batchBody("", []byte("sub-request needs a method and an absolute path"))
+		return response
+	}
+
+	ctx := context.WithValue(c.Request().Context(), batchKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(item.Method), item.Path, bytes.NewReader(item.Body))
+	if err != nil {
+		response.Status = http.StatusBadRequest
+		response.Body = batchBody("", []byte(err.Error()))
+		return response
+	}
+	req.RemoteAddr = c.Request().RemoteAddr
+	req.Host = c.Request().Host
+	for _, name := range config.ForwardHeaders {
+		if values := c.Request().Header.Values(name); len(values) > 0 {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	for name, value := range item.Headers {
+		req.Header.Set(name, value)
+	}
+	if len(item.Body) > 0 && req.Header.Get(echo.HeaderContentType) == "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+
+	writer := &batchResponseWriter{header: http.Header{}}
+	s.ServeHTTP(writer, req)
+
+	response.Status = writer.status
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+	response.Headers = make(map[string]string, len(writer.header))
+	for name := range writer.header {
+		response.Headers[name] = writer.header.Get(name)
+	}
+	response.Body = batchBody(writer.header.Get(echo.HeaderContentType), writer.body.Bytes())
+	return response
+}
+
+// batchBody embeds JSON bodies as is and encodes other bodies as a JSON string.
+func batchBody(contentType string, body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if strings.Contains(contentType, "json") && json.Valid(body) {
+		return bytes.TrimSpace(body)
+	}
+	encoded, _ := json.Marshal(string(body))
+	return encoded
+}
+
+// batchResponseWriter records the response of a sub-request.
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
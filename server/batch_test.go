@@ -0,0 +1,100 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	s := New()
+	requireAuth := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get(echo.HeaderAuthorization) != "Bearer token" {
+				return echo.ErrUnauthorized
+			}
+			return next(c)
+		}
+	}
+	s.GET("/users/:id", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"id": c.Param("id")})
+	}, requireAuth)
+	s.POST("/users", func(c echo.Context) error {
+		var user map[string]any
+		if err := c.Bind(&user); err != nil {
+			return err
+		}
+		c.Response().Header().Set("Location", "/users/2")
+		return c.JSON(http.StatusCreated, user)
+	}, requireAuth)
+	s.GET("/text", func(c echo.Context) error {
+		return c.String(http.StatusOK, "hello")
+	})
+	s.POST("/batch", s.Batch(BatchConfig{MaxRequests: 5, Concurrency: 2}))
+
+	serve := func(body, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if auth != "" {
+			req.Header.Set(echo.HeaderAuthorization, auth)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("dispatches sub-requests", func(t *testing.T) {
+		rec := serve(`{"requests": [
+			{"id": "a", "method": "GET", "path": "/users/1"},
+			{"id": "b", "method": "post", "path": "/users", "body": {"name": "John"}},
+			{"id": "c", "method": "GET", "path": "/text"},
+			{"id": "d", "method": "GET", "path": "/missing"},
+			{"id": "e", "method": "POST", "path": "/batch", "body": {"requests": []}}
+		]}`, "Bearer token")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var body struct {
+			Responses []BatchResponse `json:"responses"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		require.Len(t, body.Responses, 5)
+
+		assert.Equal(t, "a", body.Responses[0].ID)
+		assert.Equal(t, http.StatusOK, body.Responses[0].Status)
+		assert.JSONEq(t, `{"id":"1"}`, string(body.Responses[0].Body))
+
+		assert.Equal(t, http.StatusCreated, body.Responses[1].Status)
+		assert.Equal(t, "/users/2", body.Responses[1].Headers["Location"])
+		assert.JSONEq(t, `{"name":"John"}`, string(body.Responses[1].Body))
+
+		assert.JSONEq(t, `"hello"`, string(body.Responses[2].Body))
+		assert.Equal(t, http.StatusNotFound, body.Responses[3].Status)
+		assert.Equal(t, http.StatusBadRequest, body.Responses[4].Status)
+	})
+	t.Run("per item auth", func(t *testing.T) {
+		rec := serve(`{"requests": [{"id": "a", "method": "GET", "path": "/users/1"}, {"id": "b", "method": "GET", "path": "/text"}]}`, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"id":"a","status":401`)
+		assert.Contains(t, rec.Body.String(), `"id":"b","status":200`)
+	})
+	t.Run("invalid sub-request", func(t *testing.T) {
+		rec := serve(`{"requests": [{"id": "a", "path": "users"}]}`, "")
+		assert.Contains(t, rec.Body.String(), `"id":"a","status":400`)
+	})
+	t.Run("too many requests", func(t *testing.T) {
+		rec := serve(`{"requests": [{},{},{},{},{},{}]}`, "")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+	t.Run("invalid batch", func(t *testing.T) {
+		rec := serve(`[`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
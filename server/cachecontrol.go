@@ -0,0 +1,134 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CachePolicy describes the Cache-Control and Vary headers of a route, see CacheControl.
+type CachePolicy struct {
+	directive            string
+	maxAge               time.Duration
+	sharedMaxAge         time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	immutable            bool
+	vary                 []string
+}
+
+// Public returns a policy allowing browsers and shared caches to store responses for maxAge.
+func Public(maxAge time.Duration) CachePolicy {
+	return CachePolicy{directive: "public", maxAge: maxAge}
+}
+
+// Private returns a policy allowing only browsers to store responses, for maxAge.
+func Private(maxAge time.Duration) CachePolicy {
+	return CachePolicy{directive: "private", maxAge: maxAge}
+}
+
+// NoCache returns a policy requiring caches to revalidate responses before using them.
+func NoCache() CachePolicy {
+	return CachePolicy{directive: "no-cache"}
+}
+
+// NoStore returns a policy forbidding caches to store responses.
+func NoStore() CachePolicy {
+	return CachePolicy{directive: "no-store"}
+}
+
+// SharedMaxAge sets how long shared caches store responses, overriding the max age.
+func (p CachePolicy) SharedMaxAge(d time.Duration) CachePolicy {
+	p.sharedMaxAge = d
+	return p
+}
+
+// StaleWhileRevalidate allows caches to serve stale responses for d while they revalidate.
+func (p CachePolicy) StaleWhileRevalidate(d time.Duration) CachePolicy {
+	p.staleWhileRevalidate = d
+	return p
+}
+
+// StaleIfError allows caches to serve stale responses for d when the server fails.
+func (p CachePolicy) StaleIfError(d time.Duration) CachePolicy {
+	p.staleIfError = d
+	return p
+}
+
+// Immutable tells caches that responses never change while they are fresh.
+func (p CachePolicy) Immutable() CachePolicy {
+	p.immutable = true
+	return p
+}
+
+// Vary adds request headers the responses vary on, like Accept-Language.
+func (p CachePolicy) Vary(headers ...string) CachePolicy {
+	p.vary = append(p.vary[:len(p.vary):len(p.vary)], headers...)
+	return p
+}
+
+// String returns the Cache-Control header value of the policy.
+func (p CachePolicy) String() string {
+	directives := []string{p.directive}
+	if p.directive == "public" || p.directive == "private" {
+		directives = append(directives, "max-age="+seconds(p.maxAge))
+	}
+	if p.sharedMaxAge > 0 {
+		directives = append(directives, "s-maxage="+seconds(p.sharedMaxAge))
+	}
+	if p.staleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(p.staleWhileRevalidate))
+	}
+	if p.staleIfError > 0 {
+		directives = append(directives, "stale-if-error="+seconds(p.staleIfError))
+	}
+	if p.immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+var cachePolicyKey = NewKey[CachePolicy]("kapeta.cache_policy")
+
+// CacheControl returns a middleware applying the policy to successful responses of the
+// routes it is registered on. A policy set on a route overrides the policy of its group,
+// and a Cache-Control header set by the handler overrides both. Responses with a status
+// of 400 or above are not given a policy.
+//
+// Usage:
+//
+//	api := s.Group("/api", server.CacheControl(server.Private(0)))
+//	api.GET("/countries", listCountries, server.CacheControl(
+//		server.Public(time.Hour).StaleWhileRevalidate(time.Minute).Vary("Accept-Language")))
+func CacheControl(policy CachePolicy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := Get(c, cachePolicyKey); !ok {
+				// the outermost middleware applies the innermost policy
+				res := c.Response()
+				res.Before(func() {
+					policy, _ := Get(c, cachePolicyKey)
+					header := res.Header()
+					if res.Status >= http.StatusBadRequest || header.Get(echo.HeaderCacheControl) != "" {
+						return
+					}
+					header.Set(echo.HeaderCacheControl, policy.String())
+					for _, vary := range policy.vary {
+						header.Add(echo.HeaderVary, vary)
+					}
+				})
+			}
+			Set(c, cachePolicyKey, policy)
+			return next(c)
+		}
+	}
+}
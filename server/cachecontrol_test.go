@@ -0,0 +1,53 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachePolicyString(t *testing.T) {
+	assert.Equal(t, "public, max-age=3600", Public(time.Hour).String())
+	assert.Equal(t, "private, max-age=0", Private(0).String())
+	assert.Equal(t, "no-store", NoStore().String())
+	assert.Equal(t, "no-cache", NoCache().String())
+	assert.Equal(t, "public, max-age=60, s-maxage=600, stale-while-revalidate=30, stale-if-error=86400, immutable",
+		Public(time.Minute).SharedMaxAge(10*time.Minute).StaleWhileRevalidate(30*time.Second).
+			StaleIfError(24*time.Hour).Immutable().String())
+}
+
+func TestCacheControl(t *testing.T) {
+	e := echo.New()
+	api := e.Group("/api", CacheControl(Private(0)))
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+	api.GET("/me", ok)
+	api.GET("/countries", ok, CacheControl(Public(time.Hour).Vary("Accept-Language")))
+	api.GET("/custom", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		return c.NoContent(http.StatusOK)
+	}, CacheControl(Public(time.Hour)))
+	api.GET("/error", func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	serve := func(target string) http.Header {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Header()
+	}
+
+	assert.Equal(t, "private, max-age=0", serve("/api/me").Get(echo.HeaderCacheControl))
+	header := serve("/api/countries")
+	assert.Equal(t, "public, max-age=3600", header.Get(echo.HeaderCacheControl))
+	assert.Equal(t, "Accept-Language", header.Get(echo.HeaderVary))
+	assert.Equal(t, "no-store", serve("/api/custom").Get(echo.HeaderCacheControl))
+	assert.Empty(t, serve("/api/error").Get(echo.HeaderCacheControl))
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Canary variants.
+const (
+	VariantStable = "stable"
+	VariantCanary = "canary"
+)
+
+// HeaderXCanary is the default request header forcing a canary variant.
+const HeaderXCanary = "X-Canary"
+
+// CanaryConfig configures a Canary.
+type CanaryConfig struct {
+	// Percent is the part of the requests routed to the canary, from 0 to 100. It can
+	// be changed at runtime with the Percent toggle of the Canary.
+	Percent float64
+	// Header forces the canary for requests sending "true", and the stable variant for
+	// requests sending "false". Defaults to HeaderXCanary, set to "-" to disable.
+	Header string
+	// Cookie forces a variant like Header, disabled when empty.
+	Cookie string
+	// Sticky sets Cookie to the chosen variant, so a client keeps its variant.
+	Sticky bool
+}
+
+// VariantMetrics counts the requests routed to a variant.
+type VariantMetrics struct {
+	Requests uint64
+	// Errors counts the 5xx responses.
+	Errors   uint64
+	Duration time.Duration
+}
+
+// Canary routes a part of the traffic of a route to an alternate handler, for gradual
+// rollouts. The route handler is the stable variant.
+//
+// Usage:
+//
+//	canary := server.NewCanary(server.CanaryConfig{Percent: 5}, listUsersV2)
+//	e.GET("/users", listUsers, canary.Middleware())
+type Canary struct {
+	config  CanaryConfig
+	handler echo.HandlerFunc
+	percent *Toggle[float64]
+	random  func() float64
+	metrics map[string]*variantCounters
+}
+
+type variantCounters struct {
+	requests atomic.Uint64
+	errors   atomic.Uint64
+	duration atomic.Int64
+}
+
+// NewCanary creates a Canary routing to the handler, see Upstream for routing to another service.
+func NewCanary(config CanaryConfig, handler echo.HandlerFunc) *Canary {
+	if config.Header == "" {
+		config.Header = HeaderXCanary
+	}
+	return &Canary{
+		config:  config,
+		handler: handler,
+		percent: NewToggle(config.Percent).Validate(func(percent float64) error {
+			if percent < 0 || percent > 100 {
+				return errors.New("percent must be from 0 to 100")
+			}
+			return nil
+		}),
+		random: rand.Float64,
+		metrics: map[string]*variantCounters{
+			VariantStable: {},
+			VariantCanary: {},
+		},
+	}
+}
+
+// Percent returns the toggle holding the part of the requests routed to the canary,
+// e.g. to register it on an Admin.
+func (ca *Canary) Percent() *Toggle[float64] {
+	return ca.percent
+}
+
+// Middleware returns a middleware routing requests to the canary or the route handler.
+func (ca *Canary) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			variant := ca.variant(c)
+			if ca.config.Sticky && ca.config.Cookie != "" {
+				c.SetCookie(&http.Cookie{Name: ca.config.Cookie, Value: variant, Path: "/", HttpOnly: true})
+			}
+			handler := next
+			if variant == VariantCanary {
+				handler = ca.handler
+			}
+
+			start := time.Now()
+			err := handler(c)
+			status := c.Response().Status
+			if err != nil {
+				status = errorStatus(err)
+			}
+			counters := ca.metrics[variant]
+			counters.requests.Add(1)
+			counters.duration.Add(int64(time.Since(start)))
+			if status >= http.StatusInternalServerError {
+				counters.errors.Add(1)
+			}
+			return err
+		}
+	}
+}
+
+func (ca *Canary) variant(c echo.Context) string {
+	forced := ""
+	if ca.config.Header != "-" {
+		forced = c.Request().Header.Get(ca.config.Header)
+	}
+	if forced == "" && ca.config.Cookie != "" {
+		if cookie, err := c.Cookie(ca.config.Cookie); err == nil {
+			forced = cookie.Value
+		}
+	}
+	switch forced {
+	case "true", VariantCanary:
+		return VariantCanary
+	case "false", VariantStable:
+		return VariantStable
+	}
+	if ca.random()*100 < ca.percent.Get() {
+		return VariantCanary
+	}
+	return VariantStable
+}
+
+// Metrics returns the metrics of the stable and canary variants.
+func (ca *Canary) Metrics() map[string]VariantMetrics {
+	metrics := make(map[string]VariantMetrics, len(ca.metrics))
+	for variant, counters := range ca.metrics {
+		metrics[variant] = VariantMetrics{
+			Requests: counters.requests.Load(),
+			Errors:   counters.errors.Load(),
+			Duration: time.Duration(counters.duration.Load()),
+		}
+	}
+	return metrics
+}
+
+// Upstream returns a handler proxying requests to the target, e.g. a canary deployment
+// of the service.
+func Upstream(target *url.URL) echo.HandlerFunc {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	return func(c echo.Context) error {
+		proxy.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanary(t *testing.T) {
+	canary := NewCanary(CanaryConfig{Percent: 25, Cookie: "variant"}, func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	})
+	rolls := []float64{0.1, 0.3, 0.5, 0.9}
+	canary.random = func() float64 {
+		roll := rolls[0]
+		rolls = rolls[1:]
+		return roll
+	}
+
+	e := echo.New()
+	e.GET("/users", func(c echo.Context) error {
+		return c.String(http.StatusOK, "stable")
+	}, canary.Middleware())
+
+	serve := func(header, cookie string) int {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		if header != "" {
+			req.Header.Set(HeaderXCanary, header)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "variant", Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 4; i++ {
+		serve("", "")
+	}
+	assert.Equal(t, http.StatusInternalServerError, serve("true", ""))
+	assert.Equal(t, http.StatusInternalServerError, serve("", VariantCanary))
+	assert.Equal(t, http.StatusOK, serve("false", VariantCanary))
+
+	metrics := canary.Metrics()
+	assert.Equal(t, uint64(3), metrics[VariantCanary].Requests)
+	assert.Equal(t, uint64(3), metrics[VariantCanary].Errors)
+	assert.Equal(t, uint64(4), metrics[VariantStable].Requests)
+	assert.Equal(t, uint64(0), metrics[VariantStable].Errors)
+}
+
+func TestCanaryPercent(t *testing.T) {
+	canary := NewCanary(CanaryConfig{Percent: 100}, func(c echo.Context) error {
+		return c.String(http.StatusOK, "canary")
+	})
+	e := echo.New()
+	e.GET("/users", func(c echo.Context) error {
+		return c.String(http.StatusOK, "stable")
+	}, canary.Middleware())
+	serve := func() string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, 100.0, canary.Percent().Get())
+	assert.Equal(t, "canary", serve())
+	assert.NoError(t, canary.Percent().SetJSON([]byte("0")))
+	assert.Equal(t, "stable", serve())
+	assert.Error(t, canary.Percent().SetJSON([]byte("101")))
+	assert.Equal(t, 0.0, canary.Percent().Get())
+}
+
+func TestCanarySticky(t *testing.T) {
+	canary := NewCanary(CanaryConfig{Percent: 100, Cookie: "variant", Sticky: true}, func(c echo.Context) error {
+		return c.NoContent(http.StatusAccepted)
+	})
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, canary.Middleware())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, VariantCanary, cookies[0].Value)
+}
+
+func TestUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("upstream " + r.URL.Path))
+	}))
+	defer upstream.Close()
+	target, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/users", func(c echo.Context) error {
+		return c.String(http.StatusOK, "stable")
+	}, NewCanary(CanaryConfig{Percent: 100}, Upstream(target)).Middleware())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	assert.Equal(t, "upstream /users", rec.Body.String())
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// captureResponseWriter passes the response through and keeps a copy of its status and
+// of the first limit bytes of its body, or of the whole body when limit is zero.
+type captureResponseWriter struct {
+	http.ResponseWriter
+	limit     int
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func newCaptureResponseWriter(w http.ResponseWriter, limit int) *captureResponseWriter {
+	return &captureResponseWriter{ResponseWriter: w, limit: limit, status: http.StatusOK}
+}
+
+func (w *captureResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureResponseWriter) Write(b []byte) (int, error) {
+	kept := b
+	if w.limit > 0 {
+		kept = b[:min(len(b), max(w.limit-w.body.Len(), 0))]
+	}
+	w.body.Write(kept)
+	w.truncated = w.truncated || len(kept) < len(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *captureResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureResponseWriter(t *testing.T) {
+	t.Run("limit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		writer := newCaptureResponseWriter(rec, 4)
+		writer.WriteHeader(http.StatusCreated)
+		_, _ = writer.Write([]byte("abc"))
+		assert.False(t, writer.truncated)
+		_, _ = writer.Write([]byte("def"))
+		_, _ = writer.Write([]byte("ghi"))
+		writer.Flush()
+
+		assert.Equal(t, "abcd", writer.body.String())
+		assert.True(t, writer.truncated)
+		assert.Equal(t, http.StatusCreated, writer.status)
+		assert.Equal(t, "abcdefghi", rec.Body.String())
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.True(t, rec.Flushed)
+		assert.Equal(t, rec, writer.Unwrap())
+	})
+	t.Run("unlimited", func(t *testing.T) {
+		writer := newCaptureResponseWriter(httptest.NewRecorder(), 0)
+		_, _ = writer.Write([]byte("abcdefghi"))
+		assert.Equal(t, "abcdefghi", writer.body.String())
+		assert.False(t, writer.truncated)
+		assert.Equal(t, http.StatusOK, writer.status)
+	})
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"strings"
+
+	"github.com/ggicci/httpin/core"
+	"github.com/labstack/echo/v4"
+)
+
+func init() {
+	core.RegisterDirective("clientip", &directiveClientIP{})
+}
+
+// HeaderForwarded is the standard proxy header of RFC 7239.
+const HeaderForwarded = "Forwarded"
+
+// TrustedProxiesConfig configures how the client IP is read from proxy headers.
+type TrustedProxiesConfig struct {
+	// Proxies are the addresses of the trusted proxies, as IPs or CIDR ranges like
+	// "10.0.0.0/8". Proxy headers are only read from requests sent by them.
+	Proxies []string
+	// Header is the header set by the proxies, X-Forwarded-For by default, or
+	// Forwarded.
+	Header string
+}
+
+// UseTrustedProxies makes c.RealIP and the clientip binding source read the client IP
+// from the proxy header, for requests sent by a trusted proxy. The header is read from
+// the right, skipping the trusted proxies, so addresses prepended by the client are
+// ignored. Without trusted proxies, the clientip source uses the remote address, while
+// echo trusts the X-Forwarded-For and X-Real-IP headers of any request.
+func (s *KapetaServer) UseTrustedProxies(config TrustedProxiesConfig) error {
+	extractor, err := NewClientIPExtractor(config)
+	if err != nil {
+		return err
+	}
+	s.IPExtractor = extractor
+	return nil
+}
+
+// NewClientIPExtractor returns the echo.IPExtractor of UseTrustedProxies, e.g. for the
+// echo instance of an HTTPAdapter.
+func NewClientIPExtractor(config TrustedProxiesConfig) (echo.IPExtractor, error) {
+	if config.Header == "" {
+		config.Header = echo.HeaderXForwardedFor
+	}
+	if !strings.EqualFold(config.Header, echo.HeaderXForwardedFor) && !strings.EqualFold(config.Header, HeaderForwarded) {
+		return nil, fmt.Errorf("trusted proxies: unsupported header %s, use %s or %s", config.Header, echo.HeaderXForwardedFor, HeaderForwarded)
+	}
+	proxies := make([]netip.Prefix, 0, len(config.Proxies))
+	for _, proxy := range config.Proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("trusted proxies: invalid address %q", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	trusted := func(addr netip.Addr) bool {
+		for _, prefix := range proxies {
+			if prefix.Contains(addr.Unmap()) || prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	forwarded := strings.EqualFold(config.Header, HeaderForwarded)
+	return func(req *http.Request) string {
+		remote, ok := parseHostAddr(req.RemoteAddr)
+		if !ok || !trusted(remote) {
+			return remoteIP(req)
+		}
+		var hops []string
+		if forwarded {
+			hops = forwardedFor(req.Header.Values(HeaderForwarded))
+		} else {
+			for _, value := range req.Header.Values(echo.HeaderXForwardedFor) {
+				hops = append(hops, strings.Split(value, ",")...)
+			}
+		}
+		client := remote
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseHostAddr(strings.TrimSpace(hops[i]))
+			if !ok {
+				// an obfuscated or invalid hop, the last valid one is the client
+				break
+			}
+			client = addr
+			if !trusted(addr) {
+				break
+			}
+		}
+		return client.Unmap().String()
+	}, nil
+}
+
+// forwardedFor returns the for parameters of Forwarded headers, closest proxy last.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(name, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseHostAddr parses an IP, optionally with a port, like "192.0.2.1:1234" or
+// "[2001:db8::1]:443".
+func parseHostAddr(s string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr(), true
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	return addr, err == nil
+}
+
+// remoteIP returns the IP of the remote address of the request.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+var (
+	netipAddrType = reflect.TypeOf(netip.Addr{})
+	netIPType     = reflect.TypeOf(net.IP{})
+)
+
+// directiveClientIP implements the "clientip" directive, which binds the client IP
+// into a field of type string, netip.Addr or net.IP: read from the proxy header when
+// the echo instance of the request has an IPExtractor, see UseTrustedProxies, or else
+// the remote address. The request must be bound through an echo context stored by
+// EchoContextMiddleware, otherwise the remote address is used.
+//
+//	type AuditInput struct {
+//		ClientIP netip.Addr `in:"clientip"`
+//	}
+type directiveClientIP struct{}
+
+func (*directiveClientIP) Decode(rtm *core.DirectiveRuntime) error {
+	req := rtm.GetRequest()
+	ip := remoteIP(req)
+	if c, ok := EchoContextFromRequest(req); ok && c.Echo().IPExtractor != nil {
+		ip = c.RealIP()
+	}
+	target := rtm.Value.Elem()
+	switch target.Type() {
+	case netipAddrType:
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return fmt.Errorf("clientip directive: invalid client IP %q", ip)
+		}
+		target.Set(reflect.ValueOf(addr))
+	case netIPType:
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return fmt.Errorf("clientip directive: invalid client IP %q", ip)
+		}
+		target.Set(reflect.ValueOf(parsed))
+	default:
+		if target.Kind() != reflect.String {
+			return fmt.Errorf("clientip directive requires string, netip.Addr or net.IP, got %s", target.Type())
+		}
+		target.SetString(ip)
+	}
+	rtm.MarkFieldSet(true)
+	return nil
+}
+
+// Encode leaves the request as is, the client IP is set by the connection.
+func (*directiveClientIP) Encode(*core.DirectiveRuntime) error {
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIPExtractor(t *testing.T) {
+	extractor, err := NewClientIPExtractor(TrustedProxiesConfig{Proxies: []string{"10.0.0.0/8", "2001:db8::1"}})
+	require.NoError(t, err)
+	forwarded, err := NewClientIPExtractor(TrustedProxiesConfig{Proxies: []string{"10.0.0.1"}, Header: HeaderForwarded})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		extractor echo.IPExtractor
+		remote    string
+		header    http.Header
+		expected  string
+	}{
+		{"untrusted remote", extractor, "192.0.2.1:1234", http.Header{echo.HeaderXForwardedFor: {"198.51.100.1"}}, "192.0.2.1"},
+		{"trusted proxy", extractor, "10.0.0.1:1234", http.Header{echo.HeaderXForwardedFor: {"198.51.100.1"}}, "198.51.100.1"},
+		{"spoofed hops", extractor, "10.0.0.1:1234", http.Header{echo.HeaderXForwardedFor: {"1.2.3.4, 198.51.100.1, 10.0.0.2"}}, "198.51.100.1"},
+		{"repeated headers", extractor, "10.0.0.1:1234", http.Header{echo.HeaderXForwardedFor: {"1.2.3.4", "198.51.100.1"}}, "198.51.100.1"},
+		{"only proxies", extractor, "10.0.0.1:1234", http.Header{echo.HeaderXForwardedFor: {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"no header", extractor, "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"invalid hop", extractor, "10.0.0.1:1234", http.Header{echo.HeaderXForwardedFor: {"1.2.3.4, garbage"}}, "10.0.0.1"},
+		{"ipv6 proxy", extractor, "[2001:db8::1]:443", http.Header{echo.HeaderXForwardedFor: {"2001:db8::2"}}, "2001:db8::2"},
+		{"forwarded", forwarded, "10.0.0.1:1234", http.Header{HeaderForwarded: {`for=1.2.3.4, for="[2001:db8::2]:4711";proto=https`}}, "2001:db8::2"},
+		{"forwarded obfuscated", forwarded, "10.0.0.1:1234", http.Header{HeaderForwarded: {"for=_hidden"}}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			req.Header = tt.header
+			assert.Equal(t, tt.expected, tt.extractor(req))
+		})
+	}
+
+	_, err = NewClientIPExtractor(TrustedProxiesConfig{Proxies: []string{"proxy.local"}})
+	assert.Error(t, err)
+	_, err = NewClientIPExtractor(TrustedProxiesConfig{Header: "X-Real-Ip"})
+	assert.Error(t, err)
+}
+
+func TestClientIPDirective(t *testing.T) {
+	type input struct {
+		IP     string     `in:"clientip"`
+		Addr   netip.Addr `in:"clientip"`
+		Legacy net.IP     `in:"clientip"`
+	}
+	bind := func(s *KapetaServer) input {
+		var bound input
+		s.GET("/", func(c echo.Context) error {
+			var err error
+			bound, err = request.MustBind[input](c)
+			return err
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.1")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		return bound
+	}
+
+	t.Run("remote address without trusted proxies", func(t *testing.T) {
+		bound := bind(NewWithDefaults())
+		assert.Equal(t, "10.0.0.1", bound.IP)
+	})
+
+	t.Run("trusted proxies", func(t *testing.T) {
+		s := NewWithDefaults()
+		require.NoError(t, s.UseTrustedProxies(TrustedProxiesConfig{Proxies: []string{"10.0.0.0/8"}}))
+		bound := bind(s)
+		assert.Equal(t, "198.51.100.1", bound.IP)
+		assert.Equal(t, netip.MustParseAddr("198.51.100.1"), bound.Addr)
+		assert.Equal(t, "198.51.100.1", bound.Legacy.String())
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		type input struct {
+			IP int `in:"clientip"`
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.Error(t, request.GetRequestParameters(req, &input{}))
+	})
+}
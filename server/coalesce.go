@@ -0,0 +1,195 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderXCoalesced is set to "true" on responses shared from another request by Coalesce.
+const HeaderXCoalesced = "X-Coalesced"
+
+var errCoalescedRequestFailed = errors.New("coalesced request failed")
+
+// CoalesceConfig configures the Coalesce middleware.
+type CoalesceConfig struct {
+	// KeyFunc returns the key of identical requests, or an empty key for a request that
+	// must not be coalesced. Defaults to the route, the path, the normalized query and
+	// the caller, see CoalesceKey.
+	KeyFunc func(c echo.Context) string
+}
+
+// credentialHeaders are the request headers identifying the caller.
+var credentialHeaders = []string{echo.HeaderAuthorization, "Proxy-Authorization", echo.HeaderCookie, "X-Api-Key"}
+
+// negotiatedHeaders are the request headers choosing the representation of a response.
+var negotiatedHeaders = []string{echo.HeaderAccept, echo.HeaderAcceptEncoding, "Accept-Language"}
+
+// CoalesceKey returns the default key of Coalesce: the matched route, the path, the query
+// with sorted parameters, the Accept, Accept-Encoding and Accept-Language headers and the
+// caller. The caller is the "sub" claim of the AuthClaimsKey claims or, without claims, a
+// hash of the Authorization, Proxy-Authorization, Cookie and X-Api-Key headers. It returns
+// an empty key, so the request is not coalesced, for claims without a "sub" claim.
+func CoalesceKey(c echo.Context) string {
+	principal, ok := coalescePrincipal(c)
+	if !ok {
+		return ""
+	}
+	req := c.Request()
+	key := c.Path() + " " + req.URL.Path + "?" + req.URL.Query().Encode()
+	for _, name := range negotiatedHeaders {
+		key += fmt.Sprintf(" %s=%q", name, strings.Join(req.Header.Values(name), ","))
+	}
+	return key + " " + principal
+}
+
+// coalescePrincipal returns the caller of the request, empty for a request without
+// credentials, and false when the caller cannot be determined.
+func coalescePrincipal(c echo.Context) (string, bool) {
+	if claims, ok := Get(c, AuthClaimsKey); ok {
+		sub, ok := claims["sub"]
+		if !ok || sub == nil || fmt.Sprint(sub) == "" {
+			return "", false
+		}
+		return "sub:" + fmt.Sprint(sub), true
+	}
+	hash := sha256.New()
+	found := false
+	for _, name := range credentialHeaders {
+		for _, value := range c.Request().Header.Values(name) {
+			found = true
+			fmt.Fprintf(hash, "%s: %s\n", name, value)
+		}
+	}
+	if !found {
+		return "", true
+	}
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// Coalesce returns a middleware collapsing concurrent identical GET requests into one
+// handler execution, whose response is sent to all of them. It protects expensive read
+// endpoints from thundering herds. Shared responses carry the X-Coalesced header. A
+// response is not shared with requests differing in a header listed in its Vary header,
+// which run the handler themselves.
+func Coalesce(config CoalesceConfig) echo.MiddlewareFunc {
+	if config.KeyFunc == nil {
+		config.KeyFunc = CoalesceKey
+	}
+	group := &coalesceGroup{calls: map[string]*coalescedCall{}}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Method != http.MethodGet {
+				return next(c)
+			}
+			key := config.KeyFunc(c)
+			if key == "" {
+				return next(c)
+			}
+			call, leader := group.join(key)
+			if !leader {
+				call.wg.Wait()
+				if !call.varyMatches(c.Request().Header) {
+					return next(c)
+				}
+				return call.writeTo(c)
+			}
+			defer group.done(key, call)
+
+			res := c.Response()
+			writer := newCaptureResponseWriter(res.Writer, 0)
+			res.Writer = writer
+			defer func() {
+				res.Writer = writer.ResponseWriter
+			}()
+			// reported to the coalesced requests when the handler panics
+			call.err = errCoalescedRequestFailed
+			err := next(c)
+			call.err = err
+			call.status = writer.status
+			call.header = res.Header().Clone()
+			call.requestHeader = c.Request().Header.Clone()
+			call.body = writer.body.Bytes()
+			return err
+		}
+	}
+}
+
+type coalesceGroup struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	wg     sync.WaitGroup
+	err    error
+	status int
+	header http.Header
+	body   []byte
+	// requestHeader is the header of the request which ran the handler
+	requestHeader http.Header
+}
+
+// join returns the call in flight for the key, or starts one when leader is true.
+func (g *coalesceGroup) join(key string) (call *coalescedCall, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if call, ok := g.calls[key]; ok {
+		return call, false
+	}
+	call = &coalescedCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	return call, true
+}
+
+func (g *coalesceGroup) done(key string, call *coalescedCall) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	call.wg.Done()
+}
+
+// varyMatches reports whether the header of a follower has the values of the request
+// of the leader for the headers listed in the Vary header of its response.
+func (call *coalescedCall) varyMatches(header http.Header) bool {
+	for _, vary := range call.header.Values(echo.HeaderVary) {
+		for _, name := range strings.Split(vary, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return false
+			}
+			if name != "" && strings.Join(header.Values(name), ",") != strings.Join(call.requestHeader.Values(name), ",") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// writeTo sends the response of the leader, or returns its error to be rendered by the
+// error handler of the follower.
+func (call *coalescedCall) writeTo(c echo.Context) error {
+	if call.err != nil {
+		return call.err
+	}
+	header := c.Response().Header()
+	for key, values := range call.header {
+		// the ids of the request are kept
+		if key != echo.HeaderXRequestID && key != HeaderXCorrelationID {
+			header[key] = values
+		}
+	}
+	header.Set(HeaderXCoalesced, "true")
+	c.Response().WriteHeader(call.status)
+	_, err := c.Response().Write(call.body)
+	return err
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalesce(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	e := echo.New()
+	e.GET("/reports/:id", func(c echo.Context) error {
+		calls.Add(1)
+		<-release
+		c.Response().Header().Set("X-Report", c.Param("id"))
+		return c.String(http.StatusOK, "report "+c.Param("id"))
+	}, Coalesce(CoalesceConfig{}))
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 5)
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/1?b=2&a=1", nil))
+		}(recs[i])
+	}
+	// a different query is not coalesced
+	other := httptest.NewRecorder()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		e.ServeHTTP(other, httptest.NewRequest(http.MethodGet, "/reports/1?a=2", nil))
+	}()
+
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+	// give the followers time to join
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	coalesced := 0
+	for _, rec := range recs {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "report 1", rec.Body.String())
+		assert.Equal(t, "1", rec.Header().Get("X-Report"))
+		if rec.Header().Get(HeaderXCoalesced) == "true" {
+			coalesced++
+		}
+	}
+	assert.Equal(t, 4, coalesced)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, "report 1", other.Body.String())
+}
+
+func TestCoalesceError(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		calls.Add(1)
+		<-release
+		return echo.NewHTTPError(http.StatusBadGateway)
+	}, Coalesce(CoalesceConfig{KeyFunc: func(c echo.Context) string { return "same" }}))
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 3)
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		}(recs[i])
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, rec := range recs {
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCoalesceKey(t *testing.T) {
+	e := echo.New()
+	key := func(auth string) string {
+		req := httptest.NewRequest(http.MethodGet, "/users?b=2&a=1", nil)
+		if auth != "" {
+			req.Header.Set(echo.HeaderAuthorization, auth)
+		}
+		return CoalesceKey(e.NewContext(req, httptest.NewRecorder()))
+	}
+	assert.Equal(t, key("Bearer a"), key("Bearer a"))
+	assert.NotEqual(t, key("Bearer a"), key("Bearer b"))
+	assert.Contains(t, key(""), "/users?a=1&b=2")
+
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/users", nil), httptest.NewRecorder())
+	Set(c, AuthClaimsKey, map[string]any{"sub": "alice"})
+	assert.Contains(t, CoalesceKey(c), "alice")
+
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/users", nil), httptest.NewRecorder())
+	Set(c, AuthClaimsKey, map[string]any{"scope": "read"})
+	assert.Empty(t, CoalesceKey(c), "claims without a sub are not coalesced")
+
+	header := func(name, value string) string {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(name, value)
+		return CoalesceKey(e.NewContext(req, httptest.NewRecorder()))
+	}
+	assert.NotEqual(t, header("X-Api-Key", "a"), header("X-Api-Key", "b"))
+	assert.NotEqual(t, header(echo.HeaderCookie, "session=a"), header(echo.HeaderCookie, "session=b"))
+	assert.NotEqual(t, key(""), header(echo.HeaderCookie, "session=a"))
+	assert.NotEqual(t, header(echo.HeaderAccept, "application/xml"), header(echo.HeaderAccept, "application/json"))
+	assert.NotEqual(t, header("Accept-Language", "fr"), header("Accept-Language", "en"))
+}
+
+func TestCoalesceVary(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	e := echo.New()
+	e.GET("/settings", func(c echo.Context) error {
+		calls.Add(1)
+		<-release
+		c.Response().Header().Set(echo.HeaderVary, "X-Tenant")
+		return c.String(http.StatusOK, "settings of "+c.Request().Header.Get("X-Tenant"))
+	}, Coalesce(CoalesceConfig{}))
+
+	var wg sync.WaitGroup
+	tenants := []string{"acme", "acme", "globex"}
+	recs := make([]*httptest.ResponseRecorder, len(tenants))
+	for i, tenant := range tenants {
+		recs[i] = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		req.Header.Set("X-Tenant", tenant)
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			e.ServeHTTP(rec, req)
+		}(recs[i])
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	// give the followers time to join
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, tenant := range tenants {
+		assert.Equal(t, "settings of "+tenant, recs[i].Body.String())
+	}
+	// the response of the first tenant is shared with the same tenant only
+	assert.GreaterOrEqual(t, calls.Load(), int32(2))
+}
+
+func TestCoalesceCookieSessions(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	e := echo.New()
+	e.GET("/me", func(c echo.Context) error {
+		calls.Add(1)
+		<-release
+		session, err := c.Cookie("session")
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, "profile of "+session.Value)
+	}, Coalesce(CoalesceConfig{}))
+
+	var wg sync.WaitGroup
+	users := []string{"alice", "bob"}
+	recs := make([]*httptest.ResponseRecorder, len(users))
+	for i, user := range users {
+		recs[i] = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: user})
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			e.ServeHTTP(rec, req)
+		}(recs[i])
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, user := range users {
+		assert.Equal(t, "profile of "+user, recs[i].Body.String())
+		assert.Empty(t, recs[i].Header().Get(HeaderXCoalesced))
+	}
+}
@@ -0,0 +1,455 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	gommonbytes "github.com/labstack/gommon/bytes"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvServerConfigPrefix prefixes the environment variables overriding the settings of
+// a ServerConfig, see LoadServerConfig.
+const EnvServerConfigPrefix = "KAPETA_SERVER_"
+
+// ServerConfig holds the server settings which can be declared in a file, see
+// LoadServerConfig, and applied with UseConfig.
+type ServerConfig struct {
+	Timeouts TimeoutsConfig `yaml:"timeouts"`
+	// BodyLimit is the largest request body accepted, like "2M", unlimited when empty.
+	BodyLimit string `yaml:"bodyLimit"`
+	// MaxConnections limits the number of simultaneously accepted connections, see
+	// Options.
+	MaxConnections int             `yaml:"maxConnections"`
+	CORS           CORSConfig      `yaml:"cors"`
+	RateLimit      RateLimitConfig `yaml:"rateLimit"`
+	// Routes override the timeout, body limit and rate limit for the requests matching
+	// their path and methods. The first matching route applies.
+	Routes []RouteConfig `yaml:"routes"`
+}
+
+// TimeoutsConfig holds the timeouts of the server, in Go duration syntax like "5s".
+type TimeoutsConfig struct {
+	// Read, ReadHeader, Write and Idle are the timeouts of the http.Server.
+	Read       time.Duration `yaml:"read"`
+	ReadHeader time.Duration `yaml:"readHeader"`
+	Write      time.Duration `yaml:"write"`
+	Idle       time.Duration `yaml:"idle"`
+	// Request cancels the context of a request after the duration.
+	Request time.Duration `yaml:"request"`
+}
+
+// CORSConfig enables cross-origin requests from the allowed origins.
+type CORSConfig struct {
+	// AllowOrigins enables CORS for the origins, like "https://app.example.com" or "*".
+	AllowOrigins     []string `yaml:"allowOrigins"`
+	AllowMethods     []string `yaml:"allowMethods"`
+	AllowHeaders     []string `yaml:"allowHeaders"`
+	AllowCredentials bool     `yaml:"allowCredentials"`
+	// MaxAge is how long browsers cache the preflight responses, in seconds.
+	MaxAge int `yaml:"maxAge"`
+}
+
+// RateLimitConfig limits the requests per client IP.
+type RateLimitConfig struct {
+	// Rate is the number of requests per second per client, unlimited when 0.
+	Rate float64 `yaml:"rate"`
+	// Burst is the number of requests a client may send at once, the rate rounded up
+	// by default.
+	Burst int `yaml:"burst"`
+}
+
+// RouteConfig overrides settings for the requests matching its path and methods.
+type RouteConfig struct {
+	// Path is matched like the path of a PolicyRule: a segment like :id or * matches
+	// any single segment, and a last segment * matches the rest of the path.
+	Path string `yaml:"path"`
+	// Methods limits the override to some methods, all methods when empty.
+	Methods []string `yaml:"methods"`
+	// Timeout, BodyLimit and RateLimit replace Timeouts.Request, BodyLimit and
+	// RateLimit of the server when set.
+	Timeout   time.Duration    `yaml:"timeout"`
+	BodyLimit string           `yaml:"bodyLimit"`
+	RateLimit *RateLimitConfig `yaml:"rateLimit"`
+}
+
+// ParseServerConfig parses and validates a YAML or JSON server config document:
+//
+//	timeouts:
+//	  read: 10s
+//	  request: 30s
+//	bodyLimit: 2M
+//	cors:
+//	  allowOrigins: [https://app.example.com]
+//	rateLimit:
+//	  rate: 20
+//	routes:
+//	  - path: /uploads/*
+//	    methods: [POST]
+//	    bodyLimit: 100M
+//	    timeout: 5m
+//
+// A kapeta.yml block definition is read as well, with the settings under spec.server.
+// Unknown settings are rejected, so typos do not go unnoticed.
+func ParseServerConfig(data []byte) (*ServerConfig, error) {
+	config, err := parseServerConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func parseServerConfig(data []byte) (*ServerConfig, error) {
+	var doc yaml.Node
+	// YAML is a superset of JSON, so the parser reads both
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse server config: %w", err)
+	}
+	config := &ServerConfig{}
+	if len(doc.Content) == 0 {
+		return config, nil
+	}
+	root := doc.Content[0]
+	if mappingValue(root, "kind") != nil {
+		// a kapeta.yml block definition
+		root = mappingValue(mappingValue(root, "spec"), "server")
+		if root == nil {
+			return config, nil
+		}
+	}
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(root); err != nil {
+		return nil, fmt.Errorf("parse server config: %w", err)
+	}
+	decoder := yaml.NewDecoder(&buf)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("parse server config: %w", err)
+	}
+	return config, nil
+}
+
+// mappingValue returns the value of the key of a YAML mapping, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// LoadServerConfig reads the server config from a file, see ParseServerConfig, applies
+// the overrides from the environment and validates the result. Without a path only the
+// environment is read. An environment variable is named after the path of the setting,
+// like KAPETA_SERVER_BODY_LIMIT or KAPETA_SERVER_TIMEOUTS_REQUEST, and lists are comma
+// separated, like KAPETA_SERVER_CORS_ALLOW_ORIGINS. Routes cannot be overridden.
+func LoadServerConfig(path string) (*ServerConfig, error) {
+	config := &ServerConfig{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if config, err = parseServerConfig(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnvOverrides(reflect.ValueOf(config).Elem(), EnvServerConfigPrefix, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnvOverrides sets the fields of the struct found in the environment, by the
+// upper snake case of their yaml names.
+func applyEnvOverrides(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + upperSnakeCase(name)
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct {
+			errs = append(errs, applyEnvOverrides(value, key+"_", lookup))
+			continue
+		}
+		env, ok := lookup(key)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(value, env); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setEnvValue(value reflect.Value, env string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, use a duration like 5s", env)
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(env)
+	case reflect.Int:
+		n, err := strconv.Atoi(env)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", env)
+		}
+		value.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(env, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", env)
+		}
+		value.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", env)
+		}
+		value.SetBool(b)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return errors.New("cannot be set from the environment")
+		}
+		var values []string
+		for _, s := range strings.Split(env, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		value.Set(reflect.ValueOf(values))
+	default:
+		return errors.New("cannot be set from the environment")
+	}
+	return nil
+}
+
+// upperSnakeCase converts a camel case name like bodyLimit to BODY_LIMIT.
+func upperSnakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// Validate checks the settings, reporting every invalid one by its path.
+func (c *ServerConfig) Validate() error {
+	var errs []error
+	invalid := func(path, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("invalid server config: %s: %s", path, fmt.Sprintf(format, args...)))
+	}
+	for _, timeout := range []struct {
+		path  string
+		value time.Duration
+	}{
+		{"timeouts.read", c.Timeouts.Read},
+		{"timeouts.readHeader", c.Timeouts.ReadHeader},
+		{"timeouts.write", c.Timeouts.Write},
+		{"timeouts.idle", c.Timeouts.Idle},
+		{"timeouts.request", c.Timeouts.Request},
+	} {
+		if timeout.value < 0 {
+			invalid(timeout.path, "must not be negative")
+		}
+	}
+	if c.BodyLimit != "" && !validBodyLimit(c.BodyLimit) {
+		invalid("bodyLimit", "invalid size %q, use a size like 2M", c.BodyLimit)
+	}
+	if c.MaxConnections < 0 {
+		invalid("maxConnections", "must not be negative")
+	}
+	for i, origin := range c.CORS.AllowOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			invalid(fmt.Sprintf("cors.allowOrigins[%d]", i), "origin %q must be * or start with http:// or https://", origin)
+		}
+	}
+	if c.CORS.AllowCredentials && len(c.CORS.AllowOrigins) == 1 && c.CORS.AllowOrigins[0] == "*" {
+		invalid("cors.allowCredentials", "credentials cannot be allowed for every origin, list the origins")
+	}
+	validateRateLimit("rateLimit", c.RateLimit, invalid)
+	for i, route := range c.Routes {
+		path := fmt.Sprintf("routes[%d]", i)
+		if !strings.HasPrefix(route.Path, "/") {
+			invalid(path+".path", "path %q must start with /", route.Path)
+		}
+		for j, method := range route.Methods {
+			if !containsFold(echoMethods, method) {
+				invalid(fmt.Sprintf("%s.methods[%d]", path, j), "unknown method %q", method)
+			}
+		}
+		if route.Timeout < 0 {
+			invalid(path+".timeout", "must not be negative")
+		}
+		if route.BodyLimit != "" && !validBodyLimit(route.BodyLimit) {
+			invalid(path+".bodyLimit", "invalid size %q, use a size like 2M", route.BodyLimit)
+		}
+		if route.RateLimit != nil {
+			validateRateLimit(path+".rateLimit", *route.RateLimit, invalid)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var echoMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace,
+}
+
+func validateRateLimit(path string, config RateLimitConfig, invalid func(path, format string, args ...any)) {
+	if config.Rate < 0 {
+		invalid(path+".rate", "must not be negative")
+	}
+	if config.Burst < 0 {
+		invalid(path+".burst", "must not be negative")
+	}
+}
+
+func validBodyLimit(limit string) bool {
+	size, err := gommonbytes.Parse(limit)
+	return err == nil && size > 0
+}
+
+// Options returns the connection options of the config, for StartWithOptions.
+func (c *ServerConfig) Options() Options {
+	return Options{
+		IdleTimeout:    c.Timeouts.Idle,
+		MaxConnections: c.MaxConnections,
+	}
+}
+
+// UseConfig applies the config: it sets the timeouts of the http.Server, enables CORS,
+// and adds a middleware enforcing the request timeout, the body limit and the rate
+// limit, with the overrides of the routes. Start the server with StartWithOptions and
+// the Options of the config to apply the connection settings. The rate limits are
+// counted in memory, per instance, and the routes without their own rate limit share
+// the one of the server.
+func (s *KapetaServer) UseConfig(config *ServerConfig) {
+	s.Server.ReadTimeout = config.Timeouts.Read
+	s.Server.ReadHeaderTimeout = config.Timeouts.ReadHeader
+	s.Server.WriteTimeout = config.Timeouts.Write
+
+	if len(config.CORS.AllowOrigins) > 0 {
+		s.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins:     config.CORS.AllowOrigins,
+			AllowMethods:     config.CORS.AllowMethods,
+			AllowHeaders:     config.CORS.AllowHeaders,
+			AllowCredentials: config.CORS.AllowCredentials,
+			MaxAge:           config.CORS.MaxAge,
+		}))
+	}
+
+	type routeChain struct {
+		route RouteConfig
+		chain echo.MiddlewareFunc
+	}
+	globalLimiter := rateLimiter(config.RateLimit)
+	global := configChain(config.Timeouts.Request, config.BodyLimit, globalLimiter)
+	routes := make([]routeChain, len(config.Routes))
+	for i, route := range config.Routes {
+		timeout, bodyLimit, limiter := config.Timeouts.Request, config.BodyLimit, globalLimiter
+		if route.Timeout != 0 {
+			timeout = route.Timeout
+		}
+		if route.BodyLimit != "" {
+			bodyLimit = route.BodyLimit
+		}
+		if route.RateLimit != nil {
+			limiter = rateLimiter(*route.RateLimit)
+		}
+		routes[i] = routeChain{route, configChain(timeout, bodyLimit, limiter)}
+	}
+	s.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		handlers := make([]echo.HandlerFunc, len(routes))
+		for i, route := range routes {
+			handlers[i] = route.chain(next)
+		}
+		globalHandler := global(next)
+		return func(c echo.Context) error {
+			req := c.Request()
+			for i, route := range routes {
+				if len(route.route.Methods) > 0 && !containsFold(route.route.Methods, req.Method) {
+					continue
+				}
+				if matchPolicyPath(route.route.Path, req.URL.Path) {
+					return handlers[i](c)
+				}
+			}
+			return globalHandler(c)
+		}
+	})
+}
+
+// rateLimiter returns the middleware enforcing the rate limit, nil without a rate.
+func rateLimiter(rateLimit RateLimitConfig) echo.MiddlewareFunc {
+	if rateLimit.Rate <= 0 {
+		return nil
+	}
+	burst := rateLimit.Burst
+	if burst == 0 {
+		burst = int(rateLimit.Rate + 0.999)
+	}
+	store := middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+		Rate:  rate.Limit(rateLimit.Rate),
+		Burst: burst,
+	})
+	return middleware.RateLimiter(store)
+}
+
+// configChain returns the middlewares enforcing the settings, in one middleware.
+func configChain(timeout time.Duration, bodyLimit string, limiter echo.MiddlewareFunc) echo.MiddlewareFunc {
+	var middlewares []echo.MiddlewareFunc
+	if limiter != nil {
+		middlewares = append(middlewares, limiter)
+	}
+	if bodyLimit != "" {
+		middlewares = append(middlewares, middleware.BodyLimit(bodyLimit))
+	}
+	if timeout > 0 {
+		middlewares = append(middlewares, middleware.ContextTimeout(timeout))
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
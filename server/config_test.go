@@ -0,0 +1,238 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const serverConfigDocument = `
+timeouts:
+  read: 10s
+  write: 15s
+  idle: 1m
+  request: 30s
+bodyLimit: 1K
+maxConnections: 100
+cors:
+  allowOrigins: [https://app.example.com]
+rateLimit:
+  rate: 1
+routes:
+  - path: /uploads/*
+    methods: [POST]
+    bodyLimit: 1M
+    rateLimit: {rate: 100}
+`
+
+func TestParseServerConfig(t *testing.T) {
+	config, err := ParseServerConfig([]byte(serverConfigDocument))
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, config.Timeouts.Read)
+	assert.Equal(t, 30*time.Second, config.Timeouts.Request)
+	assert.Equal(t, "1K", config.BodyLimit)
+	assert.Equal(t, []string{"https://app.example.com"}, config.CORS.AllowOrigins)
+	require.Len(t, config.Routes, 1)
+	assert.Equal(t, "/uploads/*", config.Routes[0].Path)
+	assert.Equal(t, 100.0, config.Routes[0].RateLimit.Rate)
+	assert.Equal(t, Options{IdleTimeout: time.Minute, MaxConnections: 100}, config.Options())
+
+	t.Run("json", func(t *testing.T) {
+		config, err := ParseServerConfig([]byte(`{"bodyLimit": "2M", "timeouts": {"request": "5s"}}`))
+		require.NoError(t, err)
+		assert.Equal(t, "2M", config.BodyLimit)
+		assert.Equal(t, 5*time.Second, config.Timeouts.Request)
+	})
+
+	t.Run("kapeta.yml", func(t *testing.T) {
+		config, err := ParseServerConfig([]byte(`
+kind: kapeta/block-type-service
+metadata:
+  name: acme/users
+spec:
+  server:
+    bodyLimit: 4M
+`))
+		require.NoError(t, err)
+		assert.Equal(t, "4M", config.BodyLimit)
+
+		config, err = ParseServerConfig([]byte("kind: kapeta/block-type-service\nspec: {}\n"))
+		require.NoError(t, err)
+		assert.Equal(t, &ServerConfig{}, config)
+	})
+
+	t.Run("unknown setting", func(t *testing.T) {
+		_, err := ParseServerConfig([]byte("bodylimit: 2M\n"))
+		assert.ErrorContains(t, err, "field bodylimit not found")
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		_, err := ParseServerConfig([]byte(`
+timeouts:
+  read: -1s
+bodyLimit: lots
+cors:
+  allowOrigins: ["*", app.example.com]
+routes:
+  - path: uploads
+    methods: [FETCH]
+    rateLimit: {burst: -1}
+`))
+		require.Error(t, err)
+		assert.Equal(t, strings.Join([]string{
+			"invalid server config: timeouts.read: must not be negative",
+			`invalid server config: bodyLimit: invalid size "lots", use a size like 2M`,
+			`invalid server config: cors.allowOrigins[1]: origin "app.example.com" must be * or start with http:// or https://`,
+			`invalid server config: routes[0].path: path "uploads" must start with /`,
+			`invalid server config: routes[0].methods[0]: unknown method "FETCH"`,
+			"invalid server config: routes[0].rateLimit.burst: must not be negative",
+		}, "\n"), err.Error())
+	})
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yml")
+	require.NoError(t, os.WriteFile(path, []byte(serverConfigDocument), 0o600))
+	t.Setenv("KAPETA_SERVER_BODY_LIMIT", "8M")
+	t.Setenv("KAPETA_SERVER_TIMEOUTS_REQUEST", "1m")
+	t.Setenv("KAPETA_SERVER_CORS_ALLOW_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("KAPETA_SERVER_CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("KAPETA_SERVER_RATE_LIMIT_RATE", "2.5")
+
+	config, err := LoadServerConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "8M", config.BodyLimit)
+	assert.Equal(t, time.Minute, config.Timeouts.Request)
+	assert.Equal(t, 10*time.Second, config.Timeouts.Read)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, config.CORS.AllowOrigins)
+	assert.True(t, config.CORS.AllowCredentials)
+	assert.Equal(t, 2.5, config.RateLimit.Rate)
+
+	t.Run("environment only", func(t *testing.T) {
+		config, err := LoadServerConfig("")
+		require.NoError(t, err)
+		assert.Equal(t, "8M", config.BodyLimit)
+		assert.Empty(t, config.Routes)
+	})
+
+	t.Run("invalid environment", func(t *testing.T) {
+		t.Setenv("KAPETA_SERVER_TIMEOUTS_READ", "10")
+		t.Setenv("KAPETA_SERVER_MAX_CONNECTIONS", "many")
+		_, err := LoadServerConfig(path)
+		assert.ErrorContains(t, err, `KAPETA_SERVER_TIMEOUTS_READ: invalid duration "10", use a duration like 5s`)
+		assert.ErrorContains(t, err, `KAPETA_SERVER_MAX_CONNECTIONS: invalid integer "many"`)
+	})
+
+	t.Run("validated after the overrides", func(t *testing.T) {
+		t.Setenv("KAPETA_SERVER_BODY_LIMIT", "0")
+		_, err := LoadServerConfig(path)
+		assert.ErrorContains(t, err, "bodyLimit: invalid size")
+	})
+
+	_, err = LoadServerConfig(filepath.Join(t.TempDir(), "missing.yml"))
+	assert.Error(t, err)
+}
+
+func TestUseConfig(t *testing.T) {
+	config, err := ParseServerConfig([]byte(serverConfigDocument))
+	require.NoError(t, err)
+	s := New()
+	s.UseConfig(config)
+	echoBody := func(c echo.Context) error {
+		return c.Stream(http.StatusOK, echo.MIMEOctetStream, c.Request().Body)
+	}
+	s.POST("/echo", echoBody)
+	s.POST("/uploads/file", echoBody)
+	s.GET("/ping", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	assert.Equal(t, 10*time.Second, s.Server.ReadTimeout)
+	assert.Equal(t, 15*time.Second, s.Server.WriteTimeout)
+
+	serve := func(method, path string, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:1234"
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	large := strings.Repeat("x", 2<<10)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(http.MethodPost, "/echo", large, nil).Code)
+	// the route allows larger bodies and more requests
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/uploads/file", large, nil).Code)
+	}
+	// the rate limit of the server allows 1 request per second, one was sent already
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodGet, "/ping", "", nil).Code)
+
+	rec := serve(http.MethodOptions, "/echo", "", http.Header{
+		echo.HeaderOrigin:                     {"https://app.example.com"},
+		echo.HeaderAccessControlRequestMethod: {http.MethodPost},
+	})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+}
+
+func TestUseConfigRequestTimeout(t *testing.T) {
+	s := New()
+	s.UseConfig(&ServerConfig{Timeouts: TimeoutsConfig{Request: 30 * time.Second}})
+	s.GET("/deadline", func(c echo.Context) error {
+		deadline, ok := c.Request().Context().Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(30*time.Second), deadline, time.Second)
+		return c.NoContent(http.StatusNoContent)
+	})
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/deadline", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestUseConfigSharedRateLimit(t *testing.T) {
+	s := New()
+	s.UseConfig(&ServerConfig{
+		RateLimit: RateLimitConfig{Rate: 1},
+		Routes: []RouteConfig{
+			{Path: "/reports/*", Timeout: time.Minute},
+			{Path: "/exports/*", BodyLimit: "1M"},
+		},
+	})
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}
+	s.GET("/reports/daily", ok)
+	s.GET("/exports/daily", ok)
+	s.GET("/ping", ok)
+	serve := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// the routes inherit the rate limit of the server and share its budget
+	assert.Equal(t, http.StatusNoContent, serve("/reports/daily"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/exports/daily"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/ping"))
+}
+
+func TestUpperSnakeCase(t *testing.T) {
+	assert.Equal(t, "BODY_LIMIT", upperSnakeCase("bodyLimit"))
+	assert.Equal(t, "CORS", upperSnakeCase("cors"))
+	assert.Equal(t, "READ_HEADER", upperSnakeCase("readHeader"))
+}
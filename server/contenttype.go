@@ -0,0 +1,53 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireContentType returns a middleware rejecting requests with a body whose content
+// type is not one of the given types, with 415 Unsupported Media Type listing the supported types.
+// A type like "multipart/*" accepts every subtype. Requests without a body are not checked.
+//
+// Usage:
+//
+//	e.POST("/users", createUser, server.RequireContentType(echo.MIMEApplicationJSON))
+func RequireContentType(types ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength == 0 && len(req.TransferEncoding) == 0 {
+				return next(c)
+			}
+			mediaType, _, err := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+			if err == nil && matchesContentType(mediaType, types) {
+				return next(c)
+			}
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType,
+				fmt.Sprintf("unsupported content type %q, supported types: %s",
+					req.Header.Get(echo.HeaderContentType), strings.Join(types, ", ")))
+		}
+	}
+}
+
+func matchesContentType(mediaType string, types []string) bool {
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireContentType(t *testing.T) {
+	e := echo.New()
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}
+	e.POST("/users", handler, RequireContentType(echo.MIMEApplicationJSON, "multipart/*"))
+
+	send := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set(echo.HeaderContentType, contentType)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("accepted type", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("application/json; charset=utf-8", `{}`).Code)
+	})
+	t.Run("wildcard subtype", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("multipart/form-data; boundary=x", `--x--`).Code)
+	})
+	t.Run("unsupported type", func(t *testing.T) {
+		rec := send("text/plain", `hello`)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.Contains(t, rec.Body.String(), "application/json, multipart/*")
+	})
+	t.Run("missing type", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, send("", `{}`).Code)
+	})
+	t.Run("no body", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("", "").Code)
+	})
+}
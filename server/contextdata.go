@@ -0,0 +1,47 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"github.com/labstack/echo/v4"
+	"golang.org/x/text/language"
+)
+
+// Key is a typed key for request scoped values, stored with Set and read with Get.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey creates a key for values of type T. The name must be unique within the
+// echo context, so prefix it with the name of the package or module defining it.
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+// String returns the name of the key.
+func (k Key[T]) String() string {
+	return k.name
+}
+
+// Keys for the request scoped values managed by the SDK.
+var (
+	// AuthClaimsKey holds the claims of the authenticated caller.
+	AuthClaimsKey = NewKey[map[string]any]("kapeta.auth.claims")
+	// TenantKey holds the tenant the request is made for.
+	TenantKey = NewKey[string]("kapeta.tenant")
+	// LocaleKey holds the locale negotiated by the I18n middleware.
+	LocaleKey = NewKey[language.Tag]("kapeta.locale")
+	// TraceIDKey holds the trace id of the request.
+	TraceIDKey = NewKey[string]("kapeta.trace_id")
+)
+
+// Set stores the value for the key in the echo context.
+func Set[T any](c echo.Context, key Key[T], value T) {
+	c.Set(key.name, value)
+}
+
+// Get returns the value stored for the key in the echo context, and whether it was set.
+func Get[T any](c echo.Context, key Key[T]) (T, bool) {
+	value, ok := c.Get(key.name).(T)
+	return value, ok
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextData(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), nil)
+
+	t.Run("not set", func(t *testing.T) {
+		tenant, ok := Get(c, TenantKey)
+		assert.False(t, ok)
+		assert.Equal(t, "", tenant)
+	})
+	t.Run("set and get", func(t *testing.T) {
+		Set(c, TenantKey, "acme")
+		tenant, ok := Get(c, TenantKey)
+		assert.True(t, ok)
+		assert.Equal(t, "acme", tenant)
+	})
+	t.Run("custom key", func(t *testing.T) {
+		type user struct{ ID int }
+		userKey := NewKey[*user]("test.user")
+		Set(c, userKey, &user{ID: 7})
+
+		u, ok := Get(c, userKey)
+		assert.True(t, ok)
+		assert.Equal(t, 7, u.ID)
+		assert.Equal(t, "test.user", userKey.String())
+	})
+	t.Run("value of another type", func(t *testing.T) {
+		c.Set(TraceIDKey.String(), 42)
+		_, ok := Get(c, TraceIDKey)
+		assert.False(t, ok)
+	})
+}
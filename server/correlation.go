@@ -0,0 +1,52 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderXCorrelationID carries the id correlating all requests caused by the same
+// client action, across every hop. Unlike X-Request-Id it is passed on unchanged.
+const HeaderXCorrelationID = "X-Correlation-Id"
+
+// CorrelationIDKey holds the correlation id of the request.
+var CorrelationIDKey = NewKey[string]("kapeta.correlation_id")
+
+// validCorrelationID limits client supplied ids to a safe size and alphabet, so they
+// can be logged and forwarded without escaping.
+var validCorrelationID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// CorrelationID returns a middleware reading the correlation id from the
+// X-Correlation-Id header. Missing or invalid ids are replaced by the request id, so
+// the middleware must run after middleware.RequestID. The id is stored under
+// CorrelationIDKey, written back to the request header for the access log, and
+// echoed in the response.
+func CorrelationID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(HeaderXCorrelationID)
+			if !validCorrelationID.MatchString(id) {
+				id = requestID(c)
+			}
+			if id != "" {
+				req.Header.Set(HeaderXCorrelationID, id)
+				c.Response().Header().Set(HeaderXCorrelationID, id)
+				Set(c, CorrelationIDKey, id)
+			}
+			return next(c)
+		}
+	}
+}
+
+// ForwardCorrelationID copies the correlation id of the incoming request to an
+// outgoing request, so downstream services log the same id.
+func ForwardCorrelationID(c echo.Context, out *http.Request) {
+	if id, ok := Get(c, CorrelationIDKey); ok {
+		out.Header.Set(HeaderXCorrelationID, id)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelationID(t *testing.T) {
+	e := echo.New()
+	e.Pre(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		Generator: func() string { return "req-1" },
+	}))
+	e.Pre(CorrelationID())
+	e.GET("/", func(c echo.Context) error {
+		id, _ := Get(c, CorrelationIDKey)
+		out := httptest.NewRequest(http.MethodGet, "/downstream", nil)
+		ForwardCorrelationID(c, out)
+		return c.String(http.StatusOK, id+"|"+out.Header.Get(HeaderXCorrelationID))
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "client supplied", header: "order-42", want: "order-42"},
+		{name: "missing", header: "", want: "req-1"},
+		{name: "invalid", header: "bad id\"", want: "req-1"},
+		{name: "too long", header: strings.Repeat("a", 129), want: "req-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(HeaderXCorrelationID, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.want+"|"+tt.want, rec.Body.String())
+			assert.Equal(t, tt.want, rec.Header().Get(HeaderXCorrelationID))
+			assert.Equal(t, "req-1", rec.Header().Get(echo.HeaderXRequestID))
+		})
+	}
+}
+
+func TestForwardCorrelationIDWithoutMiddleware(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	out := httptest.NewRequest(http.MethodGet, "/", nil)
+	ForwardCorrelationID(c, out)
+	assert.Empty(t, out.Header.Get(HeaderXCorrelationID))
+}
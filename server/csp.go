@@ -0,0 +1,188 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CSPDirective is a Content-Security-Policy directive.
+type CSPDirective string
+
+const (
+	CSPDefaultSrc     CSPDirective = "default-src"
+	CSPScriptSrc      CSPDirective = "script-src"
+	CSPStyleSrc       CSPDirective = "style-src"
+	CSPImgSrc         CSPDirective = "img-src"
+	CSPConnectSrc     CSPDirective = "connect-src"
+	CSPFontSrc        CSPDirective = "font-src"
+	CSPObjectSrc      CSPDirective = "object-src"
+	CSPFrameSrc       CSPDirective = "frame-src"
+	CSPFrameAncestors CSPDirective = "frame-ancestors"
+	CSPBaseURI        CSPDirective = "base-uri"
+	CSPFormAction     CSPDirective = "form-action"
+)
+
+// Content-Security-Policy source expressions.
+const (
+	CSPSelf          = "'self'"
+	CSPNone          = "'none'"
+	CSPStrictDynamic = "'strict-dynamic'"
+	CSPUnsafeInline  = "'unsafe-inline'"
+	// CSPNonce is replaced by the nonce of the request, see CSP.Middleware.
+	CSPNonce = "'nonce'"
+)
+
+// CSPNonceKey holds the nonce generated for the request by CSP.Middleware, to be
+// set on inline script and style tags rendered by templates. An echo.Renderer passes
+// it on to its templates from the context:
+//
+//	func (r *templates) Render(w io.Writer, name string, data any, c echo.Context) error {
+//		nonce, _ := server.Get(c, server.CSPNonceKey)
+//		return r.t.ExecuteTemplate(w, name, page{Nonce: nonce, Data: data})
+//	}
+//
+// with inline scripts written as <script nonce="{{.Nonce}}">.
+var CSPNonceKey = NewKey[string]("kapeta.csp_nonce")
+
+// CSP builds a Content-Security-Policy header.
+//
+// Usage:
+//
+//	csp := server.NewCSP().
+//		Add(server.CSPDefaultSrc, server.CSPSelf).
+//		Add(server.CSPScriptSrc, server.CSPSelf, server.CSPNonce).
+//		Add(server.CSPObjectSrc, server.CSPNone).
+//		ReportURI("/csp-reports")
+//	e.Use(csp.Middleware())
+//
+// Policies without CSPNonce can also be set with echo's Secure middleware, as
+// middleware.SecureConfig{ContentSecurityPolicy: csp.String()}.
+type CSP struct {
+	directives []CSPDirective
+	sources    map[CSPDirective][]string
+	reportURI  string
+	reportOnly bool
+}
+
+// NewCSP creates an empty policy.
+func NewCSP() *CSP {
+	return &CSP{sources: map[CSPDirective][]string{}}
+}
+
+// Add appends the sources to the directive. Directives are written in the order they
+// are first added. Add panics on an empty directive or source, or one containing
+// whitespace, ';' or ',', which would end the directive or the policy, or characters
+// outside printable ASCII.
+func (p *CSP) Add(directive CSPDirective, sources ...string) *CSP {
+	mustCSPToken("directive", string(directive))
+	for _, source := range sources {
+		mustCSPToken("source", source)
+	}
+	if _, ok := p.sources[directive]; !ok {
+		p.directives = append(p.directives, directive)
+	}
+	p.sources[directive] = append(p.sources[directive], sources...)
+	return p
+}
+
+// ReportURI sets the URI violations are reported to. Like Add, it panics on a URI
+// that would end the directive.
+func (p *CSP) ReportURI(uri string) *CSP {
+	mustCSPToken("report URI", uri)
+	p.reportURI = uri
+	return p
+}
+
+// ReportOnly sends the policy as Content-Security-Policy-Report-Only, reporting
+// violations without blocking, to try a policy before enforcing it.
+func (p *CSP) ReportOnly() *CSP {
+	p.reportOnly = true
+	return p
+}
+
+func mustCSPToken(kind, value string) {
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool {
+		return r == ';' || r == ',' || r <= ' ' || r >= 0x7f
+	}) {
+		panic(fmt.Sprintf("csp: invalid %s %q", kind, value))
+	}
+}
+
+// String returns the policy, with CSPNonce sources left out.
+func (p *CSP) String() string {
+	return p.build("")
+}
+
+func (p *CSP) build(nonce string) string {
+	parts := make([]string, 0, len(p.directives)+1)
+	for _, directive := range p.directives {
+		var sb strings.Builder
+		sb.WriteString(string(directive))
+		for _, source := range p.sources[directive] {
+			if source == CSPNonce {
+				if nonce == "" {
+					continue
+				}
+				source = "'nonce-" + nonce + "'"
+			}
+			sb.WriteString(" ")
+			sb.WriteString(source)
+		}
+		parts = append(parts, sb.String())
+	}
+	if p.reportURI != "" {
+		parts = append(parts, "report-uri "+p.reportURI)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (p *CSP) usesNonce() bool {
+	for _, sources := range p.sources {
+		for _, source := range sources {
+			if source == CSPNonce {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware returns a middleware setting the policy on every response. When the
+// policy uses CSPNonce, a new nonce is generated per request and stored under CSPNonceKey.
+func (p *CSP) Middleware() echo.MiddlewareFunc {
+	header := echo.HeaderContentSecurityPolicy
+	if p.reportOnly {
+		header = echo.HeaderContentSecurityPolicyReportOnly
+	}
+	static := p.String()
+	usesNonce := p.usesNonce()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !usesNonce {
+				c.Response().Header().Set(header, static)
+				return next(c)
+			}
+			nonce, err := newCSPNonce()
+			if err != nil {
+				return err
+			}
+			Set(c, CSPNonceKey, nonce)
+			c.Response().Header().Set(header, p.build(nonce))
+			return next(c)
+		}
+	}
+}
+
+func newCSPNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
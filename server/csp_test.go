@@ -0,0 +1,98 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSPString(t *testing.T) {
+	csp := NewCSP().
+		Add(CSPDefaultSrc, CSPSelf).
+		Add(CSPImgSrc, CSPSelf, "https://cdn.example.com").
+		Add(CSPDefaultSrc, "https://api.example.com").
+		Add(CSPObjectSrc, CSPNone).
+		ReportURI("/csp-reports")
+
+	assert.Equal(t, "default-src 'self' https://api.example.com; img-src 'self' https://cdn.example.com; object-src 'none'; report-uri /csp-reports", csp.String())
+}
+
+func TestCSPInvalid(t *testing.T) {
+	assert.PanicsWithValue(t, `csp: invalid source "'self'; script-src *"`, func() {
+		NewCSP().Add(CSPDefaultSrc, "'self'; script-src *")
+	})
+	assert.Panics(t, func() { NewCSP().Add(CSPImgSrc, "https://a.example.com,https://b.example.com") })
+	assert.Panics(t, func() { NewCSP().Add(CSPImgSrc, "https://cdn.example.com\r\nSet-Cookie: a=b") })
+	assert.Panics(t, func() { NewCSP().Add(CSPImgSrc, "") })
+	assert.Panics(t, func() { NewCSP().Add("img-src *; script-src", CSPSelf) })
+	assert.Panics(t, func() { NewCSP().ReportURI("/reports; script-src *") })
+}
+
+type cspTemplates struct {
+	t *template.Template
+}
+
+func (r cspTemplates) Render(w io.Writer, name string, data any, c echo.Context) error {
+	nonce, _ := Get(c, CSPNonceKey)
+	return r.t.ExecuteTemplate(w, name, map[string]any{"Nonce": nonce, "Data": data})
+}
+
+func TestCSPTemplateNonce(t *testing.T) {
+	e := echo.New()
+	e.Renderer = cspTemplates{template.Must(template.New("page").Parse(`<script nonce="{{.Nonce}}">greet({{.Data}})</script>`))}
+	e.GET("/", func(c echo.Context) error {
+		return c.Render(http.StatusOK, "page", "world")
+	}, NewCSP().Add(CSPScriptSrc, CSPNonce).Middleware())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	policy := rec.Header().Get(echo.HeaderContentSecurityPolicy)
+	nonce := strings.TrimSuffix(strings.TrimPrefix(policy, "script-src 'nonce-"), "'")
+	assert.NotEmpty(t, nonce)
+	assert.NotEqual(t, policy, nonce)
+	assert.Equal(t, `<script nonce="`+nonce+`">greet("world")</script>`, rec.Body.String())
+}
+
+func TestCSPMiddleware(t *testing.T) {
+	serve := func(csp *CSP) (*httptest.ResponseRecorder, string) {
+		e := echo.New()
+		var nonce string
+		e.GET("/", func(c echo.Context) error {
+			nonce, _ = Get(c, CSPNonceKey)
+			return c.HTML(http.StatusOK, `<script nonce="`+nonce+`"></script>`)
+		}, csp.Middleware())
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec, nonce
+	}
+
+	t.Run("static", func(t *testing.T) {
+		rec, nonce := serve(NewCSP().Add(CSPDefaultSrc, CSPSelf))
+		assert.Equal(t, "default-src 'self'", rec.Header().Get(echo.HeaderContentSecurityPolicy))
+		assert.Empty(t, nonce)
+	})
+	t.Run("nonce per request", func(t *testing.T) {
+		csp := NewCSP().Add(CSPScriptSrc, CSPNonce, CSPStrictDynamic)
+		rec, nonce := serve(csp)
+		assert.NotEmpty(t, nonce)
+		assert.Equal(t, "script-src 'nonce-"+nonce+"' 'strict-dynamic'", rec.Header().Get(echo.HeaderContentSecurityPolicy))
+		assert.Contains(t, rec.Body.String(), nonce)
+
+		_, other := serve(csp)
+		assert.NotEqual(t, nonce, other)
+	})
+	t.Run("report only", func(t *testing.T) {
+		rec, _ := serve(NewCSP().Add(CSPDefaultSrc, CSPSelf).ReportOnly())
+		assert.Empty(t, rec.Header().Get(echo.HeaderContentSecurityPolicy))
+		assert.Equal(t, "default-src 'self'", rec.Header().Get(echo.HeaderContentSecurityPolicyReportOnly))
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// DefaultDumpHeader is the request header enabling the dump for a single request.
+const DefaultDumpHeader = "X-Kapeta-Dump"
+
+// DumpConfig configures the Dump middleware.
+type DumpConfig struct {
+	// Enabled dumps every request, e.g. set from an environment variable in development.
+	Enabled bool
+	// Toggle dumps every request while it is on, so dumping can be switched at runtime,
+	// e.g. through the Admin API.
+	Toggle *Toggle[bool]
+	// Header dumps a single request when it is sent with the value "true".
+	// Defaults to DefaultDumpHeader, set to "-" to disable.
+	Header string
+	// MaxBodySize is the maximum number of bytes logged per body, 4 KiB by default.
+	MaxBodySize int
+	// Redactor removes sensitive data from the dumped headers and JSON bodies. Bodies
+	// that are not JSON, or larger than twice MaxBodySize, are not logged but replaced
+	// with [REDACTED]. Defaults to DefaultRedactor.
+	Redactor *Redactor
+}
+
+// DefaultDumpConfig is the default Dump middleware config.
+var DefaultDumpConfig = DumpConfig{
+	Header:      DefaultDumpHeader,
+	MaxBodySize: 4 << 10,
+	Redactor:    DefaultRedactor,
+}
+
+// Dump returns a middleware logging full request and response bodies, with size caps
+// and redaction of sensitive fields and headers, for debugging integration issues.
+// Dumps are written with the echo logger regardless of its level.
+func Dump(config DumpConfig) echo.MiddlewareFunc {
+	if config.Header == "" {
+		config.Header = DefaultDumpConfig.Header
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultDumpConfig.MaxBodySize
+	}
+	if config.Redactor == nil {
+		config.Redactor = DefaultDumpConfig.Redactor
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if !config.Enabled && (config.Toggle == nil || !config.Toggle.Get()) && (config.Header == "-" || req.Header.Get(config.Header) != "true") {
+				return next(c)
+			}
+
+			// twice the logged size is kept, so the redacted JSON body can still be parsed
+			limit := 2 * config.MaxBodySize
+			var reqBody []byte
+			if req.Body != nil {
+				var err error
+				reqBody, err = io.ReadAll(io.LimitReader(req.Body, int64(limit)+1))
+				if err != nil {
+					return err
+				}
+				req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), req.Body))
+			}
+
+			writer := newCaptureResponseWriter(c.Response().Writer, limit)
+			c.Response().Writer = writer
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response so it is part of the dump
+				c.Error(err)
+			}
+
+			c.Logger().Printj(log.JSON{
+				"dump":             req.Method + " " + config.Redactor.URI(req.RequestURI),
+				"request_headers":  config.Redactor.Header(req.Header),
+				"request_body":     config.redactBody(reqBody, len(reqBody) > limit),
+				"status":           c.Response().Status,
+				"response_headers": config.Redactor.Header(c.Response().Header()),
+				"response_body":    config.redactBody(writer.body.Bytes(), writer.truncated),
+			})
+			return nil
+		}
+	}
+}
+
+// redactBody returns the body with its sensitive values replaced, cut at MaxBodySize.
+// A truncated body or a body that is not valid JSON is replaced completely, as its
+// sensitive fields cannot be found.
+func (config DumpConfig) redactBody(body []byte, truncated bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if truncated || !json.Valid(body) {
+		return redactedValue
+	}
+	body = config.Redactor.JSON(body)
+	if len(body) > config.MaxBodySize {
+		return string(body[:config.MaxBodySize]) + "...(truncated)"
+	}
+	return string(body)
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDumpServer(config DumpConfig) (*echo.Echo, *bytes.Buffer) {
+	e := echo.New()
+	logs := &bytes.Buffer{}
+	e.Logger.SetOutput(logs)
+	e.Use(Dump(config))
+	e.POST("/login", func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		c.Response().Header().Set(echo.HeaderSetCookie, "session=abc")
+		return c.JSONBlob(http.StatusOK, body)
+	})
+	return e, logs
+}
+
+func readDump(t *testing.T, logs *bytes.Buffer) map[string]any {
+	var dump map[string]any
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &dump))
+	return dump
+}
+
+func TestDump(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		e, logs := newDumpServer(DumpConfig{})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{}`)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, logs.String())
+	})
+	t.Run("enabled by header with redaction", func(t *testing.T) {
+		e, logs := newDumpServer(DumpConfig{})
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user": "john", "password": "hunter2"}`))
+		req.Header.Set(DefaultDumpHeader, "true")
+		req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// the handler still sees the original body
+		assert.JSONEq(t, `{"user": "john", "password": "hunter2"}`, rec.Body.String())
+
+		dump := readDump(t, logs)
+		assert.Equal(t, "POST /login", dump["dump"])
+		assert.JSONEq(t, `{"user": "john", "password": "[REDACTED]"}`, dump["request_body"].(string))
+		assert.JSONEq(t, `{"user": "john", "password": "[REDACTED]"}`, dump["response_body"].(string))
+		assert.Equal(t, float64(http.StatusOK), dump["status"])
+		assert.Equal(t, []any{"[REDACTED]"}, dump["request_headers"].(map[string]any)["Authorization"])
+		assert.Equal(t, []any{"[REDACTED]"}, dump["response_headers"].(map[string]any)["Set-Cookie"])
+		assert.NotContains(t, logs.String(), "hunter2")
+	})
+	t.Run("body size cap", func(t *testing.T) {
+		e, logs := newDumpServer(DumpConfig{Enabled: true, MaxBodySize: 8})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`"a very long"`)))
+
+		dump := readDump(t, logs)
+		assert.Equal(t, `"a very ...(truncated)`, dump["request_body"])
+	})
+	t.Run("oversized json request is redacted completely", func(t *testing.T) {
+		e, logs := newDumpServer(DumpConfig{Enabled: true, MaxBodySize: 64})
+		body := `{"a_password":"hunter2","pad":"` + strings.Repeat("x", 200) + `"}`
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body)))
+
+		// the handler still reads the whole body
+		assert.Equal(t, body, rec.Body.String())
+		dump := readDump(t, logs)
+		assert.Equal(t, redactedValue, dump["request_body"])
+		assert.NotContains(t, logs.String(), "hunter2")
+	})
+	t.Run("oversized json response is redacted completely", func(t *testing.T) {
+		e, logs := newDumpServer(DumpConfig{Enabled: true, MaxBodySize: 64})
+		body := `{"a_password":"hunter2","pad":"` + strings.Repeat("x", 200) + `"}`
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body)))
+
+		assert.Equal(t, body, rec.Body.String())
+		dump := readDump(t, logs)
+		assert.Equal(t, redactedValue, dump["response_body"])
+		assert.NotContains(t, logs.String(), "hunter2")
+	})
+	t.Run("non json body is redacted completely", func(t *testing.T) {
+		e, logs := newDumpServer(DumpConfig{Enabled: true})
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`password=hunter2`)))
+
+		assert.Equal(t, redactedValue, readDump(t, logs)["request_body"])
+		assert.NotContains(t, logs.String(), "hunter2")
+	})
+	t.Run("errors are dumped", func(t *testing.T) {
+		e := echo.New()
+		logs := &bytes.Buffer{}
+		e.Logger.SetOutput(logs)
+		e.Use(Dump(DumpConfig{Enabled: true}))
+		e.GET("/missing", func(c echo.Context) error {
+			return echo.ErrNotFound
+		})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		dump := readDump(t, logs)
+		assert.Equal(t, float64(http.StatusNotFound), dump["status"])
+		assert.Contains(t, dump["response_body"], "Not Found")
+	})
+	t.Run("enabled by toggle", func(t *testing.T) {
+		toggle := NewToggle(false)
+		e, logs := newDumpServer(DumpConfig{Toggle: toggle})
+		serve := func() {
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{}`)))
+		}
+		serve()
+		assert.Empty(t, logs.String())
+
+		toggle.Set(true)
+		serve()
+		assert.Equal(t, "POST /login", readDump(t, logs)["dump"])
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrRouteExists is returned when adding a dynamic route already registered for the method and path.
+var ErrRouteExists = errors.New("route already registered")
+
+// DynamicRoutes is a set of routes added and removed while the server is running, like
+// tenant specific or user configured endpoints. The echo router must not change once
+// the server started, so the routes are matched by DynamicRoutes itself below the prefix
+// it is mounted on. Requests read an immutable snapshot of the routes, which Add and
+// Remove replace, so they never wait for a change.
+type DynamicRoutes struct {
+	prefix string
+
+	// mu serializes the changes, readers load the snapshot without locking
+	mu     sync.Mutex
+	routes atomic.Pointer[[]*dynamicRoute]
+}
+
+type dynamicRoute struct {
+	method   string
+	path     string
+	segments []string
+	names    []string
+	handler  echo.HandlerFunc
+}
+
+// DynamicRoutes mounts a new empty set of dynamic routes at prefix, like "/tenants".
+// Routes registered on the server take precedence over the dynamic routes, and the
+// middlewares run for all dynamic routes.
+func (s *KapetaServer) DynamicRoutes(prefix string, m ...echo.MiddlewareFunc) *DynamicRoutes {
+	prefix = strings.TrimSuffix(prefix, "/")
+	d := &DynamicRoutes{prefix: prefix}
+	d.routes.Store(&[]*dynamicRoute{})
+	if prefix != "" {
+		s.Any(prefix, d.handle, m...)
+	}
+	s.Any(prefix+"/*", d.handle, m...)
+	return d
+}
+
+// Add registers the handler for the method and path, relative to the prefix. Paths use
+// the echo syntax: ":name" matches a segment and a final "*" matches the rest of the path.
+// Static segments take precedence over parameters, and parameters over "*".
+func (d *DynamicRoutes) Add(method, path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) error {
+	path = "/" + strings.TrimPrefix(path, "/")
+	route := &dynamicRoute{method: method, path: path, segments: splitRoutePath(path)}
+	for i, segment := range route.segments {
+		switch {
+		case segment == "*":
+			if i != len(route.segments)-1 {
+				return errors.New("dynamic route " + path + ": * must be the last segment")
+			}
+			route.names = append(route.names, "*")
+		case strings.HasPrefix(segment, ":"):
+			route.names = append(route.names, segment[1:])
+		}
+	}
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
+	}
+	route.handler = h
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current := *d.routes.Load()
+	for _, r := range current {
+		if r.method == method && r.path == path {
+			return ErrRouteExists
+		}
+	}
+	routes := make([]*dynamicRoute, len(current), len(current)+1)
+	copy(routes, current)
+	routes = append(routes, route)
+	d.routes.Store(&routes)
+	return nil
+}
+
+// Remove unregisters the route for the method and path, and reports whether it was registered.
+// Requests already matched to the route complete normally.
+func (d *DynamicRoutes) Remove(method, path string) bool {
+	path = "/" + strings.TrimPrefix(path, "/")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current := *d.routes.Load()
+	for i, r := range current {
+		if r.method == method && r.path == path {
+			routes := make([]*dynamicRoute, 0, len(current)-1)
+			routes = append(routes, current[:i]...)
+			routes = append(routes, current[i+1:]...)
+			d.routes.Store(&routes)
+			return true
+		}
+	}
+	return false
+}
+
+// Routes returns the registered routes, with their full path including the prefix.
+func (d *DynamicRoutes) Routes() []echo.Route {
+	current := *d.routes.Load()
+	routes := make([]echo.Route, len(current))
+	for i, r := range current {
+		routes[i] = echo.Route{Method: r.method, Path: d.prefix + r.path}
+	}
+	return routes
+}
+
+func (d *DynamicRoutes) handle(c echo.Context) error {
+	req := c.Request()
+	segments := splitRoutePath(strings.TrimPrefix(req.URL.Path, d.prefix))
+
+	var match *dynamicRoute
+	var values []string
+	var allowed []string
+	for _, route := range *d.routes.Load() {
+		v, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if route.method != req.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+		if match == nil || route.precedes(match) {
+			match, values = route, v
+		}
+	}
+	if match == nil {
+		if len(allowed) > 0 {
+			slices.Sort(allowed)
+			c.Response().Header().Set(echo.HeaderAllow, strings.Join(slices.Compact(allowed), ", "))
+			return echo.ErrMethodNotAllowed
+		}
+		return echo.ErrNotFound
+	}
+
+	c.SetPath(d.prefix + match.path)
+	c.SetParamNames(match.names...)
+	c.SetParamValues(values...)
+	return match.handler(c)
+}
+
+// match returns the parameter values when the route matches the path segments.
+func (r *dynamicRoute) match(segments []string) ([]string, bool) {
+	values := make([]string, 0, len(r.names))
+	for i, segment := range r.segments {
+		if segment == "*" {
+			return append(values, strings.Join(segments[min(i, len(segments)):], "/")), true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			values = append(values, segments[i])
+		case segment != segments[i]:
+			return nil, false
+		}
+	}
+	return values, len(segments) == len(r.segments)
+}
+
+// precedes reports whether the route takes precedence over other, when both match.
+func (r *dynamicRoute) precedes(other *dynamicRoute) bool {
+	for i := 0; i < len(r.segments) && i < len(other.segments); i++ {
+		a, b := segmentKind(r.segments[i]), segmentKind(other.segments[i])
+		if a != b {
+			return a < b
+		}
+	}
+	return len(r.segments) > len(other.segments)
+}
+
+// segmentKind orders static segments before parameters, and parameters before "*".
+func segmentKind(segment string) int {
+	switch {
+	case segment == "*":
+		return 2
+	case strings.HasPrefix(segment, ":"):
+		return 1
+	}
+	return 0
+}
+
+func splitRoutePath(p string) []string {
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
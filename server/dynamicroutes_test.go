@@ -0,0 +1,123 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamicRoutes(t *testing.T) {
+	s := New()
+	s.GET("/tenants/static", func(c echo.Context) error {
+		return c.String(http.StatusOK, "static")
+	})
+	routes := s.DynamicRoutes("/tenants")
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/tenants/acme/orders")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	var path string
+	assert.NoError(t, routes.Add(http.MethodGet, "/:tenant/orders", func(c echo.Context) error {
+		path = c.Path()
+		return c.String(http.StatusOK, "orders of "+c.Param("tenant"))
+	}))
+	assert.NoError(t, routes.Add(http.MethodGet, "/acme/orders", func(c echo.Context) error {
+		return c.String(http.StatusOK, "acme orders")
+	}))
+	assert.NoError(t, routes.Add(http.MethodGet, "/:tenant/files/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Param("tenant")+" "+c.Param("*"))
+	}))
+	assert.ErrorIs(t, routes.Add(http.MethodGet, "acme/orders", nil), ErrRouteExists)
+	assert.Error(t, routes.Add(http.MethodGet, "/*/orders", nil))
+
+	rec = serve(http.MethodGet, "/tenants/globex/orders")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "orders of globex", rec.Body.String())
+	assert.Equal(t, "/tenants/:tenant/orders", path)
+
+	rec = serve(http.MethodGet, "/tenants/acme/orders")
+	assert.Equal(t, "acme orders", rec.Body.String())
+
+	rec = serve(http.MethodGet, "/tenants/acme/files/a/b.txt")
+	assert.Equal(t, "acme a/b.txt", rec.Body.String())
+
+	rec = serve(http.MethodGet, "/tenants/static")
+	assert.Equal(t, "static", rec.Body.String())
+
+	rec = serve(http.MethodPost, "/tenants/acme/orders")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodGet, rec.Header().Get(echo.HeaderAllow))
+
+	assert.True(t, routes.Remove(http.MethodGet, "/acme/orders"))
+	assert.False(t, routes.Remove(http.MethodGet, "/acme/orders"))
+	rec = serve(http.MethodGet, "/tenants/acme/orders")
+	assert.Equal(t, "orders of acme", rec.Body.String())
+
+	assert.Equal(t, []echo.Route{
+		{Method: http.MethodGet, Path: "/tenants/:tenant/orders"},
+		{Method: http.MethodGet, Path: "/tenants/:tenant/files/*"},
+	}, routes.Routes())
+}
+
+func TestDynamicRoutesMiddleware(t *testing.T) {
+	s := New()
+	header := func(name string) echo.MiddlewareFunc {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Response().Header().Add("X-Middleware", name)
+				return next(c)
+			}
+		}
+	}
+	routes := s.DynamicRoutes("", header("mount"))
+	assert.NoError(t, routes.Add(http.MethodGet, "/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, header("first"), header("second")))
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []string{"mount", "first", "second"}, rec.Header().Values("X-Middleware"))
+}
+
+func TestDynamicRoutesConcurrentChanges(t *testing.T) {
+	s := New()
+	routes := s.DynamicRoutes("/dynamic")
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("/route%d", i)
+			assert.NoError(t, routes.Add(http.MethodGet, path, handler))
+			if i%2 == 0 {
+				assert.True(t, routes.Remove(http.MethodGet, path))
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/dynamic/route%d", i), nil))
+			assert.Contains(t, []int{http.StatusOK, http.StatusNotFound}, rec.Code)
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, routes.Routes(), 5)
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PayloadEncryptionConfig configures the EncryptedPayloads middleware.
+type PayloadEncryptionConfig struct {
+	// Decrypt returns the plaintext of an encrypted request body, e.g. by decrypting a
+	// JWE. Requests without a body are not decrypted. Nil leaves requests as sent.
+	Decrypt func(c echo.Context, ciphertext []byte) ([]byte, error)
+	// Encrypt returns the encryption of a response body. Nil leaves responses as written.
+	Encrypt func(c echo.Context, plaintext []byte) ([]byte, error)
+	// EncryptedContentType is the content type of encrypted response bodies,
+	// application/jose by default.
+	EncryptedContentType string
+	// PlainContentType replaces the content type of decrypted request bodies, so the
+	// binder decodes the plaintext, application/json by default.
+	PlainContentType string
+	// MaxBodySize is the largest encrypted request body read, 1 MiB by default. Larger
+	// requests are rejected with 413 Request Entity Too Large.
+	MaxBodySize int64
+}
+
+// DefaultPayloadEncryptionConfig is the default EncryptedPayloads middleware config.
+var DefaultPayloadEncryptionConfig = PayloadEncryptionConfig{
+	EncryptedContentType: "application/jose",
+	PlainContentType:     echo.MIMEApplicationJSON,
+	MaxBodySize:          1 << 20,
+}
+
+// EncryptedPayloads returns a middleware decrypting request bodies before binding and
+// encrypting response bodies after serialization, for routes handling highly sensitive
+// payloads. Bodies that fail to decrypt are rejected with 400 Bad Request. The response
+// is buffered until the handler returns, so do not use it on streams.
+func EncryptedPayloads(config PayloadEncryptionConfig) echo.MiddlewareFunc {
+	if config.EncryptedContentType == "" {
+		config.EncryptedContentType = DefaultPayloadEncryptionConfig.EncryptedContentType
+	}
+	if config.PlainContentType == "" {
+		config.PlainContentType = DefaultPayloadEncryptionConfig.PlainContentType
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultPayloadEncryptionConfig.MaxBodySize
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := decryptRequest(c, config); err != nil {
+				return err
+			}
+			if config.Encrypt == nil {
+				return next(c)
+			}
+
+			res := c.Response()
+			writer := &bufferedResponseWriter{ResponseWriter: res.Writer}
+			res.Writer = writer
+			err := next(c)
+			res.Writer = writer.ResponseWriter
+			if !writer.written {
+				return err
+			}
+			if writer.body.Len() == 0 {
+				return writer.flush()
+			}
+
+			ciphertext, encryptErr := config.Encrypt(c, writer.body.Bytes())
+			if encryptErr != nil {
+				// the plaintext is dropped and the error handler answers instead
+				writer.reset(res)
+				return echo.NewHTTPError(http.StatusInternalServerError, "cannot encrypt response body").SetInternal(encryptErr)
+			}
+			res.Header().Set(echo.HeaderContentType, config.EncryptedContentType)
+			res.Header().Del(echo.HeaderContentLength)
+			writer.body.Reset()
+			writer.body.Write(ciphertext)
+			if flushErr := writer.flush(); flushErr != nil {
+				return flushErr
+			}
+			return err
+		}
+	}
+}
+
+func decryptRequest(c echo.Context, config PayloadEncryptionConfig) error {
+	req := c.Request()
+	if config.Decrypt == nil || req.Body == nil || (req.ContentLength == 0 && len(req.TransferEncoding) == 0) {
+		return nil
+	}
+	ciphertext, err := io.ReadAll(http.MaxBytesReader(c.Response(), req.Body, config.MaxBodySize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("request body exceeds %d bytes", config.MaxBodySize)).SetInternal(err)
+	}
+	if err != nil {
+		return err
+	}
+	plaintext, err := config.Decrypt(c, ciphertext)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot decrypt request body").SetInternal(err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(plaintext))
+	req.ContentLength = int64(len(plaintext))
+	req.Header.Set(echo.HeaderContentType, config.PlainContentType)
+	return nil
+}
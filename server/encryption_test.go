@@ -0,0 +1,87 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedPayloads(t *testing.T) {
+	// base64 stands in for a real cipher
+	config := PayloadEncryptionConfig{
+		Decrypt: func(c echo.Context, ciphertext []byte) ([]byte, error) {
+			return base64.StdEncoding.DecodeString(string(ciphertext))
+		},
+		Encrypt: func(c echo.Context, plaintext []byte) ([]byte, error) {
+			if strings.Contains(string(plaintext), "unencryptable") {
+				return nil, errors.New("key unavailable")
+			}
+			return []byte(base64.StdEncoding.EncodeToString(plaintext)), nil
+		},
+	}
+	e := echo.New()
+	e.POST("/secrets", func(c echo.Context) error {
+		var secret map[string]string
+		if err := c.Bind(&secret); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, secret)
+	}, EncryptedPayloads(config))
+	e.DELETE("/secrets", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, EncryptedPayloads(config))
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/secrets", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, "application/jose")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		rec := serve(http.MethodPost, base64.StdEncoding.EncodeToString([]byte(`{"pin":"1234"}`)))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "application/jose", rec.Header().Get(echo.HeaderContentType))
+		plaintext, err := base64.StdEncoding.DecodeString(rec.Body.String())
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"pin":"1234"}`, string(plaintext))
+	})
+	t.Run("invalid ciphertext", func(t *testing.T) {
+		rec := serve(http.MethodPost, "not base64!")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "cannot decrypt request body")
+	})
+	t.Run("encryption failure", func(t *testing.T) {
+		rec := serve(http.MethodPost, base64.StdEncoding.EncodeToString([]byte(`{"pin":"unencryptable"}`)))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "unencryptable")
+		assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+		assert.JSONEq(t, `{"message":"cannot encrypt response body"}`, rec.Body.String())
+	})
+	t.Run("body too large", func(t *testing.T) {
+		e := echo.New()
+		limited := config
+		limited.MaxBodySize = 8
+		e.POST("/secrets", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}, EncryptedPayloads(limited))
+		req := httptest.NewRequest(http.MethodPost, "/secrets", strings.NewReader(base64.StdEncoding.EncodeToString([]byte(`{"pin":"1234"}`))))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+	t.Run("empty bodies", func(t *testing.T) {
+		rec := serve(http.MethodDelete, "")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+}
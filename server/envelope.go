@@ -0,0 +1,61 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Envelope is the standard body of successful JSON responses when UseEnvelope is enabled.
+type Envelope struct {
+	Data any          `json:"data"`
+	Meta EnvelopeMeta `json:"meta"`
+}
+
+// EnvelopeMeta is the metadata of an Envelope.
+type EnvelopeMeta struct {
+	RequestID string `json:"request_id,omitempty"`
+	// DurationMs is the time from receiving the request to writing the response.
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// startTimeKey holds the time the request was received.
+var startTimeKey = NewKey[time.Time]("kapeta.start_time")
+
+// UseEnvelope wraps every successful JSON response in an Envelope, with the request id
+// and timing in the metadata, for APIs whose guidelines mandate envelopes.
+// Error responses and values already wrapped are written unchanged.
+func (s *KapetaServer) UseEnvelope() {
+	s.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			Set(c, startTimeKey, time.Now())
+			return next(c)
+		}
+	})
+	s.JSONSerializer = &envelopeSerializer{JSONSerializer: s.JSONSerializer}
+}
+
+type envelopeSerializer struct {
+	echo.JSONSerializer
+}
+
+func (s *envelopeSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	if c.Response().Status >= http.StatusMultipleChoices {
+		return s.JSONSerializer.Serialize(c, i, indent)
+	}
+	switch i.(type) {
+	case Envelope, *Envelope:
+		return s.JSONSerializer.Serialize(c, i, indent)
+	}
+	envelope := Envelope{
+		Data: i,
+		Meta: EnvelopeMeta{RequestID: requestID(c)},
+	}
+	if start, ok := Get(c, startTimeKey); ok {
+		envelope.Meta.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	}
+	return s.JSONSerializer.Serialize(c, envelope, indent)
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseEnvelope(t *testing.T) {
+	s := New()
+	s.Pre(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		Generator: func() string { return "req-1" },
+	}))
+	s.UseEnvelope()
+	s.GET("/user", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"name": "John"})
+	})
+	s.GET("/wrapped", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, Envelope{Data: "x", Meta: EnvelopeMeta{RequestID: "custom"}})
+	})
+	s.GET("/error", func(c echo.Context) error {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "bad"})
+	})
+
+	t.Run("success is wrapped", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/user", nil))
+
+		var body struct {
+			Data map[string]string `json:"data"`
+			Meta EnvelopeMeta      `json:"meta"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "John", body.Data["name"])
+		assert.Equal(t, "req-1", body.Meta.RequestID)
+		assert.GreaterOrEqual(t, body.Meta.DurationMs, 0.0)
+	})
+	t.Run("envelope is not wrapped twice", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/wrapped", nil))
+		assert.JSONEq(t, `{"data":"x","meta":{"request_id":"custom","duration_ms":0}}`, rec.Body.String())
+	})
+	t.Run("errors are not wrapped", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/error", nil))
+		assert.JSONEq(t, `{"message":"bad"}`, rec.Body.String())
+
+		rec = httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+		assert.JSONEq(t, `{"message":"Not Found"}`, rec.Body.String())
+	})
+}
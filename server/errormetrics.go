@@ -0,0 +1,138 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+)
+
+// BindingFailureKey identifies a counter of invalid request parameters.
+type BindingFailureKey struct {
+	Route  string
+	Source string
+	Field  string
+	Code   string
+}
+
+// ErrorResponseKey identifies a counter of error responses.
+type ErrorResponseKey struct {
+	Method string
+	Route  string
+	Status int
+}
+
+// ErrorMetricsSnapshot holds the counters of ErrorMetrics.
+type ErrorMetricsSnapshot struct {
+	BindingFailures map[BindingFailureKey]uint64
+	Responses       map[ErrorResponseKey]uint64
+}
+
+// ErrorMetrics counts binding failures per parameter and 4xx and 5xx responses per
+// route, so API quality issues are observable.
+//
+// Usage:
+//
+//	metrics := server.NewErrorMetrics()
+//	s.Use(metrics.Middleware())
+//	s.GET("/.kapeta/metrics/errors", metrics.Handler())
+type ErrorMetrics struct {
+	mu       sync.Mutex
+	bindings map[BindingFailureKey]uint64
+	statuses map[ErrorResponseKey]uint64
+}
+
+// NewErrorMetrics creates ErrorMetrics with no counts.
+func NewErrorMetrics() *ErrorMetrics {
+	return &ErrorMetrics{
+		bindings: map[BindingFailureKey]uint64{},
+		statuses: map[ErrorResponseKey]uint64{},
+	}
+}
+
+// Middleware returns a middleware counting the errors of the requests. Binding failures
+// are read from the request.FieldErrors of the returned error, see request.MustBind.
+func (m *ErrorMetrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			status := c.Response().Status
+			if err != nil {
+				status = errorStatus(err)
+			}
+			if status < http.StatusBadRequest {
+				return err
+			}
+
+			var fieldErrs request.FieldErrors
+			hasFieldErrs := errors.As(err, &fieldErrs)
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.statuses[ErrorResponseKey{Method: c.Request().Method, Route: c.Path(), Status: status}]++
+			if hasFieldErrs {
+				for _, fieldErr := range fieldErrs {
+					m.bindings[BindingFailureKey{Route: c.Path(), Source: fieldErr.Source, Field: fieldErr.Field, Code: fieldErr.Code}]++
+				}
+			}
+			return err
+		}
+	}
+}
+
+// Snapshot returns a copy of the counters.
+func (m *ErrorMetrics) Snapshot() ErrorMetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := ErrorMetricsSnapshot{
+		BindingFailures: make(map[BindingFailureKey]uint64, len(m.bindings)),
+		Responses:       make(map[ErrorResponseKey]uint64, len(m.statuses)),
+	}
+	for key, count := range m.bindings {
+		snapshot.BindingFailures[key] = count
+	}
+	for key, count := range m.statuses {
+		snapshot.Responses[key] = count
+	}
+	return snapshot
+}
+
+// Handler returns a handler writing the counters in the Prometheus text format, so they
+// can be scraped next to the other metrics of the service.
+func (m *ErrorMetrics) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		snapshot := m.Snapshot()
+		var lines []string
+		for key, count := range snapshot.BindingFailures {
+			lines = append(lines, fmt.Sprintf("kapeta_binding_failures_total{route=%s,source=%s,field=%s,code=%s} %d",
+				strconv.Quote(key.Route), strconv.Quote(key.Source), strconv.Quote(key.Field), strconv.Quote(key.Code), count))
+		}
+		sort.Strings(lines)
+		var b strings.Builder
+		b.WriteString("# HELP kapeta_binding_failures_total Invalid request parameters.\n")
+		b.WriteString("# TYPE kapeta_binding_failures_total counter\n")
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+
+		lines = lines[:0]
+		for key, count := range snapshot.Responses {
+			lines = append(lines, fmt.Sprintf("kapeta_error_responses_total{method=%s,route=%s,status=\"%d\"} %d",
+				strconv.Quote(key.Method), strconv.Quote(key.Route), key.Status, count))
+		}
+		sort.Strings(lines)
+		b.WriteString("# HELP kapeta_error_responses_total Responses with a 4xx or 5xx status.\n")
+		b.WriteString("# TYPE kapeta_error_responses_total counter\n")
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+		return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type errorMetricsInput struct {
+	Limit int `in:"query=limit"`
+}
+
+func TestErrorMetrics(t *testing.T) {
+	metrics := NewErrorMetrics()
+	e := echo.New()
+	e.Use(metrics.Middleware())
+	e.GET("/users", func(c echo.Context) error {
+		_, err := request.MustBind[errorMetricsInput](c)
+		if err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return c.NoContent(http.StatusBadGateway)
+	})
+	e.GET("/metrics", metrics.Handler())
+
+	for _, target := range []string{"/users?limit=x", "/users?limit=y", "/users?limit=1", "/fail", "/missing"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, map[BindingFailureKey]uint64{
+		{Route: "/users", Source: "query", Field: "limit", Code: request.CodeInvalidFormat}: 2,
+	}, snapshot.BindingFailures)
+	assert.Equal(t, uint64(2), snapshot.Responses[ErrorResponseKey{Method: http.MethodGet, Route: "/users", Status: http.StatusBadRequest}])
+	assert.Equal(t, uint64(1), snapshot.Responses[ErrorResponseKey{Method: http.MethodGet, Route: "/fail", Status: http.StatusBadGateway}])
+	assert.Len(t, snapshot.Responses, 3)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, `kapeta_binding_failures_total{route="/users",source="query",field="limit",code="invalid_format"} 2`)
+	assert.Contains(t, body, `kapeta_error_responses_total{method="GET",route="/fail",status="502"} 1`)
+}
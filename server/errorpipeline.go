@@ -0,0 +1,118 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorClassifier returns the status code for errors it recognizes, e.g. 404 for a
+// repository's not found error.
+type ErrorClassifier func(err error) (status int, ok bool)
+
+// ErrorEnricher adds details to the problem rendered for an error, like error codes
+// and links to documentation in Type.
+type ErrorEnricher func(c echo.Context, err error, problem *Problem)
+
+// ErrorRenderer writes the problem for an error as the response.
+type ErrorRenderer func(c echo.Context, err error, problem *Problem) error
+
+// ErrorPipeline is an error handler handling errors in three steps: the status is
+// classified by the first classifier recognizing the error, the problem is enriched by
+// every enricher in order, and finally rendered. Errors not recognized by a classifier
+// are classified as the status of an *echo.HTTPError, or 500.
+//
+// Usage:
+//
+//	s.UseErrorPipeline(server.ErrorPipeline{
+//		Classifiers: []server.ErrorClassifier{func(err error) (int, bool) {
+//			if errors.Is(err, sql.ErrNoRows) {
+//				return http.StatusNotFound, true
+//			}
+//			return 0, false
+//		}},
+//		Enrichers: []server.ErrorEnricher{func(c echo.Context, err error, problem *server.Problem) {
+//			problem.Type = "https://docs.example.com/errors/" + strconv.Itoa(problem.Status)
+//		}},
+//	})
+type ErrorPipeline struct {
+	Classifiers []ErrorClassifier
+	Enrichers   []ErrorEnricher
+	// Renderer defaults to RenderProblem.
+	Renderer ErrorRenderer
+}
+
+// UseErrorPipeline replaces the error handler with the pipeline. Error reporters
+// must be added after it.
+func (s *KapetaServer) UseErrorPipeline(pipeline ErrorPipeline) {
+	s.HTTPErrorHandler = pipeline.Handle
+}
+
+// Handle is the echo.HTTPErrorHandler of the pipeline.
+func (p ErrorPipeline) Handle(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	problem := p.problem(c, err)
+	for _, enrich := range p.Enrichers {
+		enrich(c, err, problem)
+	}
+	render := p.Renderer
+	if render == nil {
+		render = RenderProblem
+	}
+	if err := render(c, err, problem); err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// problem returns the problem of the classified error. Only the messages and invalid
+// parameters of client errors are exposed.
+func (p ErrorPipeline) problem(c echo.Context, err error) *Problem {
+	status := p.classify(err)
+	problem := &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  c.Request().URL.Path,
+		RequestID: requestID(c),
+	}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		problem.RequestID = panicErr.RequestID
+		return problem
+	}
+	if status >= http.StatusInternalServerError {
+		return problem
+	}
+	var fieldErrs request.FieldErrors
+	if errors.As(err, &fieldErrs) {
+		problem.Detail = "invalid request parameters"
+		problem.Errors = fieldErrs
+		return problem
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		if message, ok := httpErr.Message.(string); ok && message != problem.Title {
+			problem.Detail = message
+		}
+	}
+	return problem
+}
+
+func (p ErrorPipeline) classify(err error) int {
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return http.StatusInternalServerError
+	}
+	for _, classify := range p.Classifiers {
+		if status, ok := classify(err); ok {
+			return status
+		}
+	}
+	return errorStatus(err)
+}
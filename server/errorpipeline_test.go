@@ -0,0 +1,96 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var errNotFound = errors.New("not found")
+
+func TestErrorPipeline(t *testing.T) {
+	s := New()
+	s.UseErrorPipeline(ErrorPipeline{
+		Classifiers: []ErrorClassifier{func(err error) (int, bool) {
+			if errors.Is(err, errNotFound) {
+				return http.StatusNotFound, true
+			}
+			return 0, false
+		}},
+		Enrichers: []ErrorEnricher{
+			func(c echo.Context, err error, problem *Problem) {
+				problem.Code = "E" + http.StatusText(problem.Status)
+			},
+			func(c echo.Context, err error, problem *Problem) {
+				problem.Type = "https://docs.example.com/errors/" + problem.Code
+			},
+		},
+	})
+	s.Use(Recover())
+	s.GET("/classified", func(c echo.Context) error {
+		return errors.Join(errNotFound, errors.New("user 1"))
+	})
+	s.GET("/http", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing name")
+	})
+	s.GET("/bind", func(c echo.Context) error {
+		_, err := request.MustBind[struct {
+			Limit int `in:"query=limit;required"`
+		}](c)
+		return err
+	})
+	s.GET("/validate", func(c echo.Context) error {
+		_, err := request.MustBind[struct{}](c, request.WithValidator(func(any) error {
+			return errors.New("name taken")
+		}))
+		return err
+	})
+	s.GET("/internal", func(c echo.Context) error {
+		return errors.New("database password is hunter2")
+	})
+	s.GET("/panic", func(c echo.Context) error {
+		panic("boom")
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/classified", `{"type":"https://docs.example.com/errors/ENot Found","title":"Not Found","status":404,"instance":"/classified","code":"ENot Found"}`},
+		{"/http", `{"type":"https://docs.example.com/errors/EBad Request","title":"Bad Request","status":400,"detail":"missing name","instance":"/http","code":"EBad Request"}`},
+		{"/bind", `{"type":"https://docs.example.com/errors/EBad Request","title":"Bad Request","status":400,"detail":"invalid request parameters","instance":"/bind","code":"EBad Request","errors":[{"field":"limit","source":"query","code":"required","message":"missing required field"}]}`},
+		{"/validate", `{"type":"https://docs.example.com/errors/EUnprocessable Entity","title":"Unprocessable Entity","status":422,"detail":"validation failed: name taken","instance":"/validate","code":"EUnprocessable Entity"}`},
+		{"/internal", `{"type":"https://docs.example.com/errors/EInternal Server Error","title":"Internal Server Error","status":500,"instance":"/internal","code":"EInternal Server Error"}`},
+		{"/panic", `{"type":"https://docs.example.com/errors/EInternal Server Error","title":"Internal Server Error","status":500,"instance":"/panic","code":"EInternal Server Error"}`},
+		{"/missing", `{"type":"https://docs.example.com/errors/ENot Found","title":"Not Found","status":404,"instance":"/missing","code":"ENot Found"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+			assert.JSONEq(t, tt.want, rec.Body.String())
+		})
+	}
+}
+
+func TestErrorPipelineRenderer(t *testing.T) {
+	s := New()
+	s.UseErrorPipeline(ErrorPipeline{
+		Renderer: func(c echo.Context, err error, problem *Problem) error {
+			return c.String(problem.Status, problem.Title)
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "Not Found", rec.Body.String())
+}
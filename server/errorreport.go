@@ -0,0 +1,204 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// ErrorReport describes a recovered panic or a 5xx error for an ErrorReporter.
+type ErrorReport struct {
+	// Err is the error returned by the handler, or the recovered panic value.
+	Err error
+	// Panic is true when Err was recovered from a panic.
+	Panic bool
+	// Stack is the stack trace captured when a panic was recovered.
+	Stack []byte
+	// Status is the status code of the error response.
+	Status int
+	// RequestID is the id of the request, see middleware.RequestID.
+	RequestID string
+	// Method, URI and Route describe the failed request. The URI is redacted with DefaultRedactor.
+	Method string
+	URI    string
+	Route  string
+	// Header holds the request headers, redacted with DefaultRedactor.
+	Header http.Header
+	// RemoteIP is the client IP resolved by echo.
+	RemoteIP string
+}
+
+// ErrorReporter receives panics and 5xx errors, to forward them to services like Sentry or Rollbar.
+type ErrorReporter interface {
+	Report(ctx context.Context, report ErrorReport)
+}
+
+// ErrorReporterFunc is an adapter allowing a function to be used as an ErrorReporter.
+type ErrorReporterFunc func(ctx context.Context, report ErrorReport)
+
+func (f ErrorReporterFunc) Report(ctx context.Context, report ErrorReport) {
+	f(ctx, report)
+}
+
+// PanicError is the error passed to the error handler for a panic recovered by Recover.
+type PanicError struct {
+	Err       error
+	Stack     []byte
+	RequestID string
+}
+
+func (e *PanicError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PanicError) Unwrap() error {
+	return e.Err
+}
+
+// RecoverConfig configures the Recover middleware.
+type RecoverConfig struct {
+	// StackSize is the maximum size of the captured stack trace, 16 KiB by default.
+	StackSize int
+	// AllGoroutines captures the stacks of all goroutines instead of only the panicking one.
+	AllGoroutines bool
+	// PanicHandler is called with every recovered panic, before the error handler renders the response.
+	PanicHandler func(c echo.Context, err *PanicError)
+}
+
+// Recover returns a middleware recovering from panics in handlers, see RecoverWithConfig.
+func Recover() echo.MiddlewareFunc {
+	return RecoverWithConfig(RecoverConfig{})
+}
+
+// RecoverWithConfig returns a middleware recovering from panics in handlers. The panic is logged
+// with its stack trace and the request id, handed to the panic handler, and passed to the
+// error handler as a *PanicError. Use ProblemErrorHandler to render it as problem+json.
+func RecoverWithConfig(config RecoverConfig) echo.MiddlewareFunc {
+	if config.StackSize == 0 {
+		config.StackSize = 16 << 10
+	}
+	return middleware.RecoverWithConfig(middleware.RecoverConfig{
+		StackSize:       config.StackSize,
+		DisableStackAll: !config.AllGoroutines,
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			panicErr := &PanicError{Err: err, Stack: stack, RequestID: requestID(c)}
+			c.Logger().Printf("[PANIC RECOVER] request %s: %v %s\n", panicErr.RequestID, err, stack)
+			if config.PanicHandler != nil {
+				config.PanicHandler(c, panicErr)
+			}
+			return panicErr
+		},
+	})
+}
+
+// Problem is an RFC 7807 problem details response body.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Code is a stable machine readable error code, set by an ErrorEnricher.
+	Code string `json:"code,omitempty"`
+	// Errors lists the invalid request parameters of a binding failure.
+	Errors request.FieldErrors `json:"errors,omitempty"`
+}
+
+// MIMEApplicationProblemJSON is the content type of problem details responses.
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// ProblemErrorHandler renders errors recovered from panics as a problem+json 500 response
+// carrying the request id, without exposing the panic value. Other errors are passed to next.
+func ProblemErrorHandler(next echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) || c.Response().Committed {
+			next(err, c)
+			return
+		}
+		problem := Problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(http.StatusInternalServerError),
+			Status:    http.StatusInternalServerError,
+			Instance:  c.Request().URL.Path,
+			RequestID: panicErr.RequestID,
+		}
+		if err := RenderProblem(c, err, &problem); err != nil {
+			c.Logger().Error(err)
+		}
+	}
+}
+
+// RenderProblem writes the problem as a problem+json response. It is the default
+// ErrorRenderer of the ErrorPipeline.
+func RenderProblem(c echo.Context, _ error, problem *Problem) error {
+	c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(problem.Status)
+	}
+	return c.JSON(problem.Status, problem)
+}
+
+// UseErrorReporter reports every panic recovered by Recover and every error resulting
+// in a 5xx response to the reporter, before the error handler renders the response.
+func (s *KapetaServer) UseErrorReporter(reporter ErrorReporter) {
+	next := s.HTTPErrorHandler
+	s.HTTPErrorHandler = func(err error, c echo.Context) {
+		if report, ok := newErrorReport(err, c); ok {
+			reporter.Report(c.Request().Context(), report)
+		}
+		next(err, c)
+	}
+}
+
+func newErrorReport(err error, c echo.Context) (ErrorReport, bool) {
+	status := errorStatus(err)
+	var panicErr *PanicError
+	isPanic := errors.As(err, &panicErr)
+	if status < http.StatusInternalServerError && !isPanic {
+		return ErrorReport{}, false
+	}
+
+	req := c.Request()
+	report := ErrorReport{
+		Err:       err,
+		Status:    status,
+		RequestID: requestID(c),
+		Method:    req.Method,
+		URI:       DefaultRedactor.URI(req.RequestURI),
+		Route:     c.Path(),
+		Header:    DefaultRedactor.Header(req.Header),
+		RemoteIP:  c.RealIP(),
+	}
+	if isPanic {
+		report.Err = panicErr.Err
+		report.RequestID = panicErr.RequestID
+		report.Panic = true
+		report.Stack = panicErr.Stack
+	}
+	return report, true
+}
+
+// errorStatus returns the status the error handler responds with for the error.
+func errorStatus(err error) int {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// requestID returns the id set by the request id middleware, or sent by the client.
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
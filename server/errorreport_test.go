@@ -0,0 +1,118 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUseErrorReporter(t *testing.T) {
+	var reports []ErrorReport
+	s := NewWithDefaults()
+	s.Logger.SetOutput(io.Discard)
+	s.UseErrorReporter(ErrorReporterFunc(func(ctx context.Context, report ErrorReport) {
+		reports = append(reports, report)
+	}))
+	s.GET("/panic", func(c echo.Context) error {
+		panic("boom")
+	})
+	s.GET("/fail", func(c echo.Context) error {
+		return errors.New("database unavailable")
+	})
+	s.GET("/missing", func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		reports = nil
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("panic", func(t *testing.T) {
+		rec := serve("/panic?token=abc")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Len(t, reports, 1)
+
+		report := reports[0]
+		assert.True(t, report.Panic)
+		assert.EqualError(t, report.Err, "boom")
+		assert.NotEmpty(t, report.Stack)
+		assert.Equal(t, http.StatusInternalServerError, report.Status)
+		assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), report.RequestID)
+		assert.NotEmpty(t, report.RequestID)
+		assert.Equal(t, "/panic", report.Route)
+		assert.Equal(t, "/panic?token=%5BREDACTED%5D", report.URI)
+		assert.Equal(t, "[REDACTED]", report.Header.Get(echo.HeaderAuthorization))
+	})
+	t.Run("server error", func(t *testing.T) {
+		rec := serve("/fail")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Len(t, reports, 1)
+		assert.False(t, reports[0].Panic)
+		assert.EqualError(t, reports[0].Err, "database unavailable")
+	})
+	t.Run("client errors are not reported", func(t *testing.T) {
+		rec := serve("/missing")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Empty(t, reports)
+	})
+}
+
+func TestRecoverWithConfig(t *testing.T) {
+	var handled *PanicError
+	s := New()
+	s.Logger.SetOutput(io.Discard)
+	s.Pre(middleware.RequestID())
+	s.Use(RecoverWithConfig(RecoverConfig{
+		PanicHandler: func(c echo.Context, err *PanicError) {
+			handled = err
+		},
+	}))
+	s.HTTPErrorHandler = ProblemErrorHandler(s.DefaultHTTPErrorHandler)
+	s.GET("/panic", func(c echo.Context) error {
+		panic("boom")
+	})
+	s.GET("/missing", func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+
+	t.Run("panic renders problem json", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		assert.Equal(t, http.StatusInternalServerError, problem.Status)
+		assert.Equal(t, "/panic", problem.Instance)
+		assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), problem.RequestID)
+		assert.NotContains(t, rec.Body.String(), "boom")
+
+		assert.NotNil(t, handled)
+		assert.EqualError(t, handled, "boom")
+		assert.Contains(t, string(handled.Stack), "goroutine")
+		assert.Equal(t, problem.RequestID, handled.RequestID)
+	})
+	t.Run("other errors use the next handler", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderXDegraded lists the failed dependencies on responses served by a fallback handler.
+const HeaderXDegraded = "X-Degraded"
+
+// DependencyStatus reports whether a named dependency is available. It is implemented by
+// Health, and can be implemented by a circuit breaker.
+type DependencyStatus interface {
+	Healthy(name string) bool
+}
+
+// DependencyStatusFunc is an adapter allowing a function to be used as a DependencyStatus.
+type DependencyStatusFunc func(name string) bool
+
+func (f DependencyStatusFunc) Healthy(name string) bool {
+	return f(name)
+}
+
+// Healthy reports whether the last result of the named check is up. It does not run the
+// check, results are refreshed by the readiness probe. A check without a result is healthy.
+func (h *Health) Healthy(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result, ok := h.results[name]
+	return !ok || result.Status == HealthUp
+}
+
+// Fallback returns a middleware serving the fallback handler instead of the route when
+// any of the declared dependencies is unhealthy, e.g. to serve cached data or a reduced
+// payload while a database is down. The failed dependencies are listed in the
+// X-Degraded response header.
+//
+// Usage:
+//
+//	e.GET("/products", listProducts, server.Fallback(health, listCachedProducts, "db"))
+func Fallback(status DependencyStatus, fallback echo.HandlerFunc, dependencies ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var failed []string
+			for _, dependency := range dependencies {
+				if !status.Healthy(dependency) {
+					failed = append(failed, dependency)
+				}
+			}
+			if len(failed) == 0 {
+				return next(c)
+			}
+			c.Response().Header().Set(HeaderXDegraded, strings.Join(failed, ", "))
+			return fallback(c)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallback(t *testing.T) {
+	h := NewHealth(DefaultHealthConfig)
+	h.Register("db", func(ctx context.Context) error { return nil }, 0)
+	h.Register("search", func(ctx context.Context) error { return errors.New("down") }, 0)
+
+	e := echo.New()
+	fallback := func(c echo.Context) error {
+		return c.String(http.StatusOK, "cached")
+	}
+	handler := func(c echo.Context) error {
+		return c.String(http.StatusOK, "live")
+	}
+	e.GET("/products", handler, Fallback(h, fallback, "db"))
+	e.GET("/search", handler, Fallback(h, fallback, "db", "search"))
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	// checks without a result are healthy
+	rec := serve("/search")
+	assert.Equal(t, "live", rec.Body.String())
+
+	h.Check(context.Background())
+	rec = serve("/products")
+	assert.Equal(t, "live", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(HeaderXDegraded))
+
+	rec = serve("/search")
+	assert.Equal(t, "cached", rec.Body.String())
+	assert.Equal(t, "search", rec.Header().Get(HeaderXDegraded))
+}
+
+func TestFallbackDependencyStatusFunc(t *testing.T) {
+	open := map[string]bool{"payments": true}
+	status := DependencyStatusFunc(func(name string) bool {
+		return !open[name]
+	})
+
+	e := echo.New()
+	e.GET("/checkout", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, Fallback(status, func(c echo.Context) error {
+		return c.NoContent(http.StatusServiceUnavailable)
+	}, "payments", "inventory"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/checkout", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "payments", rec.Header().Get(HeaderXDegraded))
+}
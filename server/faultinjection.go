@@ -0,0 +1,59 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"math/rand"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Fault describes the faults injected by the FaultInjection middleware.
+type Fault struct {
+	// Percent is the part of the requests given the fault, from 0 to 100.
+	Percent float64 `json:"percent"`
+	// Delay is added before the request is handled.
+	Delay time.Duration `json:"delay_ns"`
+	// Status is the status of the error response replacing the handler, the handler
+	// runs when it is 0.
+	Status int `json:"status"`
+	// Routes limits the faults to these routes, like "/users/:id", when not empty.
+	Routes []string `json:"routes,omitempty"`
+}
+
+// FaultInjection returns a middleware delaying or failing a part of the requests as
+// described by the toggle, to test how clients and dependent services handle a slow or
+// failing service. No faults are injected while the Percent of the fault is 0, and the
+// probes and the admin API are never given faults.
+func FaultInjection(fault *Toggle[Fault]) echo.MiddlewareFunc {
+	return faultInjection(fault, rand.Float64)
+}
+
+func faultInjection(fault *Toggle[Fault], random func() float64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			f := fault.Get()
+			if f.Percent <= 0 || isOperationalPath(c.Request().URL.Path) ||
+				(len(f.Routes) > 0 && !slices.Contains(f.Routes, c.Path())) ||
+				random()*100 >= f.Percent {
+				return next(c)
+			}
+			if f.Delay > 0 {
+				timer := time.NewTimer(f.Delay)
+				select {
+				case <-timer.C:
+				case <-c.Request().Context().Done():
+					timer.Stop()
+					return c.Request().Context().Err()
+				}
+			}
+			if f.Status != 0 {
+				return echo.NewHTTPError(f.Status, http.StatusText(f.Status)+" (injected fault)")
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjection(t *testing.T) {
+	fault := NewToggle(Fault{})
+	rolls := []float64{0.1, 0.6}
+	random := func() float64 {
+		roll := rolls[0]
+		rolls = append(rolls[1:], roll)
+		return roll
+	}
+	e := echo.New()
+	e.Use(faultInjection(fault, random))
+	for _, path := range []string{"/users", "/orders", readyPath} {
+		e.GET(path, func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+	}
+	serve := func(target string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/users"))
+
+	fault.Set(Fault{Percent: 50, Status: http.StatusBadGateway})
+	assert.Equal(t, http.StatusBadGateway, serve("/users"))
+	assert.Equal(t, http.StatusOK, serve("/users"))
+	assert.Equal(t, http.StatusOK, serve(readyPath))
+
+	fault.Set(Fault{Percent: 100, Status: http.StatusServiceUnavailable, Routes: []string{"/orders"}})
+	assert.Equal(t, http.StatusOK, serve("/users"))
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/orders"))
+
+	fault.Set(Fault{Percent: 100, Delay: 20 * time.Millisecond})
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, serve("/users"))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestFaultInjectionCanceled(t *testing.T) {
+	fault := NewToggle(Fault{Percent: 100, Delay: time.Hour})
+	handler := FaultInjection(fault)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+	c := echo.New().NewContext(req.WithContext(ctx), httptest.NewRecorder())
+	assert.ErrorIs(t, handler(c), context.Canceled)
+}
@@ -0,0 +1,137 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+)
+
+// envHandover is set for a process started by Handover, which inherits the listening
+// socket as file descriptor 3 and signals it is ready by closing file descriptor 4.
+const envHandover = "KAPETA_HANDOVER"
+
+const (
+	handoverListenerFD = 3
+	handoverReadyFD    = 4
+)
+
+// handoverCommand creates the command starting the new process, the running binary
+// with the same arguments, so a replaced binary is started.
+var handoverCommand = func() (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(executable, os.Args[1:]...), nil
+}
+
+// Handover restarts the server without dropping connections, for services deployed
+// outside an orchestrator: it starts the binary again, e.g. after it was replaced by a
+// new version, passing the listening socket to the new process. Once the new process
+// listens on the socket, the server is shut down gracefully, completing the requests in
+// flight, while new connections are accepted by the new process. The ctx bounds both
+// the startup of the new process and the shutdown.
+//
+// The new process inherits the socket in the first call to Listen, e.g. by
+// StartWithOptions. Handover is typically triggered by a signal:
+//
+//	go func() {
+//		signals := make(chan os.Signal, 1)
+//		signal.Notify(signals, syscall.SIGUSR2)
+//		<-signals
+//		if err := s.Handover(context.Background()); err != nil {
+//			s.Logger.Error(err)
+//		}
+//	}()
+//	s.StartWithOptions(":8080", server.Options{})
+//
+// Processes sharing a port with SO_REUSEPORT, set by the Control of the Options, can
+// be restarted without Handover instead.
+func (s *KapetaServer) Handover(ctx context.Context) error {
+	if s.socket == nil {
+		return errors.New("handover: the server is not listening")
+	}
+	socket, ok := s.socket.(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("handover: cannot pass a %T listener", s.socket)
+	}
+	listenerFile, err := socket.File()
+	if err != nil {
+		return fmt.Errorf("handover: %w", err)
+	}
+	defer listenerFile.Close()
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("handover: %w", err)
+	}
+	defer readyReader.Close()
+
+	cmd, err := handoverCommand()
+	if err != nil {
+		readyWriter.Close()
+		return fmt.Errorf("handover: %w", err)
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, envHandover+"=1")
+	if cmd.Stdout == nil && cmd.Stderr == nil {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	}
+	cmd.ExtraFiles = []*os.File{listenerFile, readyWriter}
+	err = cmd.Start()
+	// the pipe is closed when the new process signals it is ready or exits
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("handover: %w", err)
+	}
+
+	ready := make(chan bool, 1)
+	go func() {
+		signal, _ := io.ReadAll(readyReader)
+		ready <- len(signal) > 0
+	}()
+	select {
+	case ok := <-ready:
+		if !ok {
+			cmd.Wait()
+			return errors.New("handover: the new process exited before listening")
+		}
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("handover: %w", ctx.Err())
+	}
+	// the new process outlives this one
+	cmd.Process.Release()
+	return s.Shutdown(ctx)
+}
+
+// inheritedListener returns the socket passed by the process calling Handover, or nil
+// when the process was not started by a handover. The socket is inherited only once.
+func inheritedListener() (net.Listener, error) {
+	if os.Getenv(envHandover) == "" {
+		return nil, nil
+	}
+	os.Unsetenv(envHandover)
+	listenerFile := os.NewFile(handoverListenerFD, "listener")
+	defer listenerFile.Close()
+	l, err := net.FileListener(listenerFile)
+	if err != nil {
+		return nil, fmt.Errorf("handover: inherit listener: %w", err)
+	}
+	readyFile := os.NewFile(handoverReadyFD, "ready")
+	_, err = readyFile.Write([]byte{1})
+	readyFile.Close()
+	if err != nil {
+		l.Close()
+		return nil, fmt.Errorf("handover: signal ready: %w", err)
+	}
+	return l, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandoverProcess is the process started by TestHandover.
+func TestHandoverProcess(t *testing.T) {
+	if os.Getenv("KAPETA_HANDOVER_TEST") == "" {
+		t.Skip("started by TestHandover")
+	}
+	s := New()
+	s.HideBanner = true
+	s.HidePort = true
+	s.GET("/", func(c echo.Context) error {
+		// exit once the handover was verified
+		time.AfterFunc(100*time.Millisecond, func() { s.Close() })
+		return c.String(http.StatusOK, "new")
+	})
+	time.AfterFunc(10*time.Second, func() { s.Close() })
+	s.StartWithOptions("127.0.0.1:0", Options{})
+}
+
+func TestHandover(t *testing.T) {
+	command := handoverCommand
+	defer func() { handoverCommand = command }()
+	handoverCommand = func() (*exec.Cmd, error) {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHandoverProcess$")
+		cmd.Env = append(os.Environ(), "KAPETA_HANDOVER_TEST=1")
+		cmd.Stdout, cmd.Stderr = io.Discard, io.Discard
+		return cmd, nil
+	}
+
+	s := New()
+	s.HideBanner = true
+	s.HidePort = true
+	assert.ErrorContains(t, s.Handover(context.Background()), "not listening")
+	s.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "old")
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.StartWithOptions("127.0.0.1:0", Options{})
+	}()
+	assert.Eventually(t, func() bool {
+		return s.ListenerAddr() != nil
+	}, time.Second, 10*time.Millisecond)
+	url := "http://" + s.ListenerAddr().String() + "/"
+	get := func() string {
+		res, err := http.Get(url)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return string(body)
+	}
+	assert.Equal(t, "old", get())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, s.Handover(ctx))
+	assert.ErrorIs(t, <-errs, http.ErrServerClosed)
+	http.DefaultClient.CloseIdleConnections()
+	assert.Equal(t, "new", get())
+}
+
+func TestHandoverProcessExits(t *testing.T) {
+	command := handoverCommand
+	defer func() { handoverCommand = command }()
+	handoverCommand = func() (*exec.Cmd, error) {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Stdout, cmd.Stderr = io.Discard, io.Discard
+		return cmd, nil
+	}
+
+	s := New()
+	l, err := s.Listen("127.0.0.1:0", Options{})
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.EqualError(t, s.Handover(context.Background()), "handover: the new process exited before listening")
+}
@@ -0,0 +1,336 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HealthCheck checks a dependency, like a database connection. It must return when
+// the context is done.
+type HealthCheck func(ctx context.Context) error
+
+// Health statuses.
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+	// HealthStarting is reported until all warm-up tasks completed.
+	HealthStarting = "starting"
+)
+
+// errHealthCheckTimeout is reported for checks not done within their timeout or the deadline.
+var errHealthCheckTimeout = errors.New("health check timed out")
+
+// HealthConfig configures a Health registry.
+type HealthConfig struct {
+	// Timeout is the default timeout of a check, 2 seconds by default.
+	Timeout time.Duration
+	// Deadline is the time all checks get together, 5 seconds by default. Checks not
+	// done by then are reported down, so the probe itself never times out.
+	Deadline time.Duration
+	// CacheTTL is how long a result is reused before the check runs again, 2 seconds
+	// by default, so frequent probes do not load the dependencies.
+	CacheTTL time.Duration
+}
+
+// DefaultHealthConfig is the default Health config.
+var DefaultHealthConfig = HealthConfig{
+	Timeout:  2 * time.Second,
+	Deadline: 5 * time.Second,
+	CacheTTL: 2 * time.Second,
+}
+
+// CheckResult is the outcome of a health check.
+type CheckResult struct {
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	// CheckedAt is when the check ran, results may be cached.
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthReport is the outcome of all health checks.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Health is a registry of health checks run concurrently for the readiness probe, and
+// of warm-up tasks run once at startup.
+type Health struct {
+	config HealthConfig
+
+	mu      sync.Mutex
+	checks  map[string]registeredCheck
+	results map[string]CheckResult
+
+	warmups        []warmupTask
+	warmupResults  map[string]CheckResult
+	warmupRunning  bool
+	warmupComplete bool
+	draining       bool
+}
+
+type warmupTask struct {
+	name string
+	task HealthCheck
+}
+
+type registeredCheck struct {
+	check   HealthCheck
+	timeout time.Duration
+}
+
+// NewHealth creates an empty Health registry.
+func NewHealth(config HealthConfig) *Health {
+	if config.Timeout == 0 {
+		config.Timeout = DefaultHealthConfig.Timeout
+	}
+	if config.Deadline == 0 {
+		config.Deadline = DefaultHealthConfig.Deadline
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = DefaultHealthConfig.CacheTTL
+	}
+	return &Health{
+		config:        config,
+		checks:        map[string]registeredCheck{},
+		results:       map[string]CheckResult{},
+		warmupResults: map[string]CheckResult{},
+	}
+}
+
+// Register adds a named check, with the default timeout when timeout is 0.
+func (h *Health) Register(name string, check HealthCheck, timeout time.Duration) {
+	if timeout == 0 {
+		timeout = h.config.Timeout
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = registeredCheck{check: check, timeout: timeout}
+	delete(h.results, name)
+}
+
+// AddWarmup adds a named task, like priming a cache or checking that migrations ran,
+// which must complete before the readiness probe reports healthy. Tasks are run in
+// order by Start.
+func (h *Health) AddWarmup(name string, task HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.warmups = append(h.warmups, warmupTask{name: name, task: task})
+	h.warmupComplete = false
+}
+
+// Start runs the warm-up tasks in order, stopping at the first failing task. Until all
+// tasks completed the startup and readiness probes report starting, and after a failure
+// the startup probe reports down, so the orchestrator restarts the service.
+func (h *Health) Start(ctx context.Context) error {
+	h.mu.Lock()
+	if h.warmupRunning {
+		h.mu.Unlock()
+		return errors.New("warm-up already running")
+	}
+	h.warmupRunning = true
+	warmups := h.warmups
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.warmupRunning = false
+		h.mu.Unlock()
+	}()
+
+	for _, warmup := range warmups {
+		start := time.Now()
+		err := warmup.task(ctx)
+		result := CheckResult{Status: HealthUp, Duration: time.Since(start), CheckedAt: start}
+		if err != nil {
+			result.Status = HealthDown
+			result.Error = err.Error()
+		}
+		h.mu.Lock()
+		h.warmupResults[warmup.name] = result
+		h.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("warm-up %s: %w", warmup.name, err)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.warmupComplete = len(h.warmups) == len(warmups)
+	return nil
+}
+
+// Started reports whether all warm-up tasks completed.
+func (h *Health) Started() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.started()
+}
+
+func (h *Health) started() bool {
+	return len(h.warmups) == 0 || h.warmupComplete
+}
+
+// Startup reports the status of the warm-up tasks: up when all completed, down when a
+// task failed and starting otherwise.
+func (h *Health) Startup() HealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	report := HealthReport{Status: HealthUp, Checks: make(map[string]CheckResult, len(h.warmupResults))}
+	for name, result := range h.warmupResults {
+		report.Checks[name] = result
+	}
+	if !h.started() {
+		report.Status = HealthStarting
+		for _, result := range report.Checks {
+			if result.Status == HealthDown {
+				report.Status = HealthDown
+			}
+		}
+	}
+	return report
+}
+
+// Check runs the checks without a fresh cached result concurrently, and reports the
+// status of all checks. The report is down when any check is down, and starting until
+// all warm-up tasks completed.
+func (h *Health) Check(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, h.config.Deadline)
+	defer cancel()
+
+	h.mu.Lock()
+	report := HealthReport{Status: HealthUp, Checks: make(map[string]CheckResult, len(h.checks))}
+	pending := map[string]registeredCheck{}
+	for name, check := range h.checks {
+		if result, ok := h.results[name]; ok && time.Since(result.CheckedAt) < h.config.CacheTTL {
+			report.Checks[name] = result
+		} else {
+			pending[name] = check
+		}
+	}
+	h.mu.Unlock()
+
+	type namedResult struct {
+		name   string
+		result CheckResult
+	}
+	done := make(chan namedResult, len(pending))
+	for name, check := range pending {
+		go func(name string, check registeredCheck) {
+			done <- namedResult{name, runHealthCheck(ctx, check)}
+		}(name, check)
+	}
+wait:
+	for n := len(pending); n > 0; n-- {
+		select {
+		case res := <-done:
+			report.Checks[res.name] = res.result
+			delete(pending, res.name)
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	now := time.Now()
+	for name := range pending {
+		report.Checks[name] = CheckResult{Status: HealthDown, Error: errHealthCheckTimeout.Error(), Duration: h.config.Deadline, CheckedAt: now}
+	}
+
+	h.mu.Lock()
+	for name, result := range report.Checks {
+		if _, ok := h.checks[name]; ok {
+			h.results[name] = result
+		}
+		if result.Status != HealthUp {
+			report.Status = HealthDown
+		}
+	}
+	if report.Status == HealthUp && !h.started() {
+		report.Status = HealthStarting
+	}
+	if h.draining {
+		report.Status = HealthDown
+	}
+	h.mu.Unlock()
+	return report
+}
+
+// Drain makes Check report down regardless of the checks, so the service is removed from
+// the load balancers before it shuts down.
+func (h *Health) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.draining = true
+}
+
+func runHealthCheck(ctx context.Context, check registeredCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout)
+	defer cancel()
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- check.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = errHealthCheckTimeout
+	}
+	result := CheckResult{Status: HealthUp, Duration: time.Since(start), CheckedAt: start}
+	if err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Handler responds with the HealthReport, with 503 Service Unavailable when it is not up.
+func (h *Health) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return healthResponse(c, h.Check(c.Request().Context()))
+	}
+}
+
+// StartupHandler responds with the Startup report, with 503 Service Unavailable until
+// all warm-up tasks completed.
+func (h *Health) StartupHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return healthResponse(c, h.Startup())
+	}
+}
+
+func healthResponse(c echo.Context, report HealthReport) error {
+	status := http.StatusOK
+	if report.Status != HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, report)
+}
+
+// UseHealth serves the checks of the registry as the readiness probe at /.kapeta/ready,
+// and the warm-up tasks as the startup probe at /.kapeta/startup. Call Start to run the
+// warm-up tasks, e.g. in a goroutine before starting the server.
+func (s *KapetaServer) UseHealth(h *Health) {
+	s.GET(readyPath, h.Handler())
+	s.GET(startupPath, h.StartupHandler())
+}
+
+// Paths of the probes, not written to the access log.
+const (
+	healthPath  = "/.kapeta/health"
+	readyPath   = "/.kapeta/ready"
+	startupPath = "/.kapeta/startup"
+)
+
+func isProbePath(path string) bool {
+	return path == healthPath || path == readyPath || path == startupPath || path == preStopPath
+}
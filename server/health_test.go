@@ -0,0 +1,181 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheck(t *testing.T) {
+	h := NewHealth(HealthConfig{Timeout: 50 * time.Millisecond, Deadline: time.Second})
+	h.Register("db", func(ctx context.Context) error { return nil }, 0)
+	h.Register("cache", func(ctx context.Context) error { return errors.New("connection refused") }, 0)
+	h.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 0)
+
+	start := time.Now()
+	report := h.Check(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, HealthDown, report.Status)
+	assert.Equal(t, HealthUp, report.Checks["db"].Status)
+	assert.Equal(t, "connection refused", report.Checks["cache"].Error)
+	assert.Equal(t, HealthDown, report.Checks["slow"].Status)
+}
+
+func TestHealthDrain(t *testing.T) {
+	h := NewHealth(DefaultHealthConfig)
+	h.Register("db", func(ctx context.Context) error { return nil }, 0)
+	assert.Equal(t, HealthUp, h.Check(context.Background()).Status)
+
+	h.Drain()
+	report := h.Check(context.Background())
+	assert.Equal(t, HealthDown, report.Status)
+	assert.Equal(t, HealthUp, report.Checks["db"].Status)
+}
+
+func TestHealthCheckIgnoringContext(t *testing.T) {
+	h := NewHealth(HealthConfig{Timeout: time.Minute, Deadline: 50 * time.Millisecond})
+	block := make(chan struct{})
+	defer close(block)
+	h.Register("stuck", func(ctx context.Context) error {
+		<-block
+		return nil
+	}, 0)
+
+	start := time.Now()
+	report := h.Check(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, HealthDown, report.Status)
+	assert.Equal(t, errHealthCheckTimeout.Error(), report.Checks["stuck"].Error)
+}
+
+func TestHealthCheckCache(t *testing.T) {
+	h := NewHealth(HealthConfig{CacheTTL: time.Minute})
+	var calls atomic.Int32
+	h.Register("db", func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}, 0)
+
+	h.Check(context.Background())
+	report := h.Check(context.Background())
+	assert.Equal(t, HealthUp, report.Status)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// registering again drops the cached result
+	h.Register("db", func(ctx context.Context) error {
+		calls.Add(1)
+		return errors.New("down")
+	}, 0)
+	report = h.Check(context.Background())
+	assert.Equal(t, HealthDown, report.Status)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestUseHealth(t *testing.T) {
+	s := NewWithDefaults()
+	h := NewHealth(DefaultHealthConfig)
+	h.Register("db", func(ctx context.Context) error { return nil }, 0)
+	s.UseHealth(h)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.kapeta/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var report HealthReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, HealthUp, report.Checks["db"].Status)
+
+	h.Register("db", func(ctx context.Context) error { return errors.New("down") }, 0)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.kapeta/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestHealthWarmup(t *testing.T) {
+	h := NewHealth(DefaultHealthConfig)
+	h.Register("db", func(ctx context.Context) error { return nil }, 0)
+	release := make(chan struct{})
+	h.AddWarmup("migrations", func(ctx context.Context) error { return nil })
+	h.AddWarmup("cache", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	assert.False(t, h.Started())
+	assert.Equal(t, HealthStarting, h.Startup().Status)
+	assert.Equal(t, HealthStarting, h.Check(context.Background()).Status)
+
+	done := make(chan error)
+	go func() { done <- h.Start(context.Background()) }()
+	close(release)
+	require.NoError(t, <-done)
+
+	assert.True(t, h.Started())
+	startup := h.Startup()
+	assert.Equal(t, HealthUp, startup.Status)
+	assert.Equal(t, HealthUp, startup.Checks["migrations"].Status)
+	assert.Equal(t, HealthUp, startup.Checks["cache"].Status)
+	assert.Equal(t, HealthUp, h.Check(context.Background()).Status)
+}
+
+func TestHealthWarmupFailure(t *testing.T) {
+	h := NewHealth(DefaultHealthConfig)
+	var cacheRan bool
+	h.AddWarmup("migrations", func(ctx context.Context) error { return errors.New("pending migrations") })
+	h.AddWarmup("cache", func(ctx context.Context) error {
+		cacheRan = true
+		return nil
+	})
+
+	err := h.Start(context.Background())
+	assert.EqualError(t, err, "warm-up migrations: pending migrations")
+	assert.False(t, cacheRan)
+	startup := h.Startup()
+	assert.Equal(t, HealthDown, startup.Status)
+	assert.Equal(t, "pending migrations", startup.Checks["migrations"].Error)
+	assert.Equal(t, HealthStarting, h.Check(context.Background()).Status)
+}
+
+func TestStartupProbe(t *testing.T) {
+	s := NewWithDefaults()
+	h := NewHealth(DefaultHealthConfig)
+	h.AddWarmup("cache", func(ctx context.Context) error { return nil })
+	s.UseHealth(h)
+
+	serve := func(target string) int {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/.kapeta/startup"))
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/.kapeta/ready"))
+	assert.Equal(t, http.StatusOK, serve("/.kapeta/health"))
+
+	require.NoError(t, h.Start(context.Background()))
+	assert.Equal(t, http.StatusOK, serve("/.kapeta/startup"))
+	assert.Equal(t, http.StatusOK, serve("/.kapeta/ready"))
+}
+
+func TestHealthCheckManyChecks(t *testing.T) {
+	h := NewHealth(DefaultHealthConfig)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		h.Register(name, func(ctx context.Context) error { return nil }, 0)
+	}
+	for i := 0; i < 20; i++ {
+		h.results = map[string]CheckResult{}
+		report := h.Check(context.Background())
+		assert.Equal(t, HealthUp, report.Status)
+		assert.Len(t, report.Checks, 6)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PathParamFunc returns a path parameter of a request routed outside echo, like
+// chi.URLParam, or a lookup in the params stored by a custom router.
+type PathParamFunc func(r *http.Request, name string) string
+
+// HTTPAdapter runs echo handlers and middlewares on other routers, like the
+// http.ServeMux or chi, so handlers using the binder of the request package, the
+// middlewares and the response helpers of this package can be adopted by services
+// without an echo router. Errors returned by the handlers are rendered by the error
+// handler of the adapter, the one of NewWithDefaults by default.
+//
+// Usage with chi:
+//
+//	adapter := server.NewHTTPAdapter(chi.URLParam)
+//	r := chi.NewRouter()
+//	r.Use(adapter.Middleware(server.CorrelationID()))
+//	r.Method(http.MethodGet, "/users/{id}", adapter.Handler("/users/{id}", getUser))
+type HTTPAdapter struct {
+	echo   *echo.Echo
+	params PathParamFunc
+}
+
+// NewHTTPAdapter creates an HTTPAdapter reading path parameters with params. Without
+// params, handlers see empty path parameters. Like NewWithDefaults, it registers the
+// path directive of the binder.
+func NewHTTPAdapter(params PathParamFunc) *HTTPAdapter {
+	e := echo.New()
+	e.HTTPErrorHandler = ProblemErrorHandler(e.DefaultHTTPErrorHandler)
+	// the path directive of the binder reads the parameters of the echo context
+	UseEchoPathRouter(e)
+	return &HTTPAdapter{echo: e, params: params}
+}
+
+// Echo returns the echo instance creating the contexts, to configure its error
+// handler, logger, binder or validator.
+func (a *HTTPAdapter) Echo() *echo.Echo {
+	return a.echo
+}
+
+// Handler returns an http.Handler running the handler with the middlewares. The pattern
+// is the one the handler is routed with, like "/users/{id}", "GET /users/{id}" for the
+// http.ServeMux, or "/users/:id", and names the path parameters of the context.
+func (a *HTTPAdapter) Handler(pattern string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) http.Handler {
+	path, names := routePattern(pattern)
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, done := a.context(w, r)
+		defer done()
+		c.SetPath(path)
+		values := make([]string, len(names))
+		if a.params != nil {
+			for i, name := range names {
+				values[i] = a.params(r, name)
+			}
+		}
+		c.SetParamNames(names...)
+		c.SetParamValues(values...)
+		if err := h(c); err != nil {
+			a.echo.HTTPErrorHandler(err, c)
+		}
+	})
+}
+
+// HandlerFunc is Handler returning an http.HandlerFunc, e.g. for http.HandleFunc.
+func (a *HTTPAdapter) HandlerFunc(pattern string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) http.HandlerFunc {
+	return a.Handler(pattern, h, m...).ServeHTTP
+}
+
+// Middleware converts an echo middleware to a net/http middleware, the type used by chi
+// and most routers. The values stored in the context by the middleware, see Set, are
+// seen by the handlers returned by Handler.
+func (a *HTTPAdapter) Middleware(m echo.MiddlewareFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		h := m(func(c echo.Context) error {
+			next.ServeHTTP(c.Response(), c.Request())
+			return nil
+		})
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, done := a.context(w, r)
+			defer done()
+			if err := h(c); err != nil {
+				a.echo.HTTPErrorHandler(err, c)
+			}
+		})
+	}
+}
+
+// context returns the echo context of a request: the one created by an outer
+// Middleware of the adapter, updated with the request and writer it passes on, or a new
+// one. done restores or releases the context.
+func (a *HTTPAdapter) context(w http.ResponseWriter, r *http.Request) (echo.Context, func()) {
+	if c, ok := EchoContextFromRequest(r); ok && c.Echo() == a.echo {
+		req, res := c.Request(), c.Response()
+		c.SetRequest(r)
+		// a net/http middleware in between may have wrapped the writer
+		if w != http.ResponseWriter(res) {
+			c.SetResponse(echo.NewResponse(w, a.echo))
+		}
+		return c, func() {
+			c.SetRequest(req)
+			c.SetResponse(res)
+		}
+	}
+	c := a.echo.AcquireContext()
+	c.Reset(r, w)
+	c.SetRequest(r.WithContext(context.WithValue(r.Context(), echoContextKey, c)))
+	return c, func() {
+		a.echo.ReleaseContext(c)
+	}
+}
+
+// routePattern converts a route pattern of the http.ServeMux, chi or echo to an echo
+// path, and returns the names of its parameters.
+func routePattern(pattern string) (string, []string) {
+	// the http.ServeMux prefixes patterns with the method and host
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = strings.TrimSpace(pattern[i+1:])
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		pattern = pattern[i:]
+	}
+	var names []string
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "{$}":
+			// the http.ServeMux marks an exact match of a path ending with a slash
+			segments[i] = ""
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"):
+			name := strings.TrimSuffix(segment[1:len(segment)-1], "...")
+			// chi allows a regular expression after the name
+			name, _, _ = strings.Cut(name, ":")
+			names = append(names, name)
+			segments[i] = ":" + name
+		case strings.HasPrefix(segment, ":"):
+			names = append(names, segment[1:])
+		case segment == "*":
+			names = append(names, "*")
+		}
+	}
+	return strings.Join(segments, "/"), names
+}
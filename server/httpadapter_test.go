@@ -0,0 +1,131 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type adapterParamsKey struct{}
+
+// adapterRouter stands in for a router like chi, storing the path parameters it
+// matched in the request context.
+func adapterRouter(pattern string, h http.Handler) http.Handler {
+	prefix := strings.TrimSuffix(strings.Split(pattern, "{")[0], "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		ctx := context.WithValue(r.Context(), adapterParamsKey{}, map[string]string{"id": id})
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func adapterParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(adapterParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+func TestHTTPAdapter(t *testing.T) {
+	type input struct {
+		ID      int    `in:"path=id"`
+		Verbose bool   `in:"query=verbose"`
+		Tenant  string `in:"header=X-Tenant"`
+	}
+	adapter := NewHTTPAdapter(adapterParam)
+	getUser := func(c echo.Context) error {
+		in, err := request.MustBind[input](c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]any{"id": in.ID, "verbose": in.Verbose, "tenant": in.Tenant, "path": c.Path()})
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/users/", adapterRouter("/users/{id}", adapter.Handler("/users/{id}", getUser)))
+	mux.HandleFunc("/fail", adapter.HandlerFunc("/fail", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusConflict, "conflict")
+	}))
+
+	t.Run("binds the request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/42?verbose=true", nil)
+		req.Header.Set("X-Tenant", "acme")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":42,"verbose":true,"tenant":"acme","path":"/users/:id"}`, rec.Body.String())
+	})
+
+	t.Run("renders errors", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/abc", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fail", nil))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
+
+func TestHTTPAdapterMiddleware(t *testing.T) {
+	adapter := NewHTTPAdapter(nil)
+	tenantKey := NewKey[string]("test.tenant")
+	setTenant := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("X-Tenant") == "" {
+				return echo.ErrUnauthorized
+			}
+			Set(c, tenantKey, c.Request().Header.Get("X-Tenant"))
+			err := next(c)
+			c.Response().Header().Set("X-Status-Seen", http.StatusText(c.Response().Status))
+			return err
+		}
+	}
+	// a net/http middleware in between the adapted middleware and handler
+	addHeader := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Net-Http", "true")
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := adapter.Middleware(setTenant)(addHeader(adapter.Handler("/", func(c echo.Context) error {
+		tenant, _ := Get(c, tenantKey)
+		return c.String(http.StatusCreated, tenant)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant", "acme")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "acme", rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get("X-Net-Http"))
+	assert.Equal(t, "Created", rec.Header().Get("X-Status-Seen"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestRoutePattern(t *testing.T) {
+	for pattern, expected := range map[string]struct {
+		path  string
+		names []string
+	}{
+		"/users":                          {"/users", nil},
+		"GET /users/{id}":                 {"/users/:id", []string{"id"}},
+		"GET example.com/files/{path...}": {"/files/:path", []string{"path"}},
+		"/users/{id:[0-9]+}/posts/{pid}":  {"/users/:id/posts/:pid", []string{"id", "pid"}},
+		"/users/:id/*":                    {"/users/:id/*", []string{"id", "*"}},
+		"/users/{$}":                      {"/users/", nil},
+	} {
+		path, names := routePattern(pattern)
+		assert.Equal(t, expected.path, path, pattern)
+		assert.Equal(t, expected.names, names, pattern)
+	}
+}
@@ -3,13 +3,41 @@
 package server
 
 import (
-	"mime/multipart"
+	"context"
 	"net/http"
+	"sync"
 
 	"github.com/ggicci/httpin/core"
+	"github.com/kapetacom/sdk-go-rest-server/request"
 	"github.com/labstack/echo/v4"
 )
 
+type contextKey int
+
+const (
+	// echoContextKey is the request context key holding the matched echo.Context.
+	echoContextKey contextKey = iota
+)
+
+// EchoContextMiddleware stores the echo.Context in the context of the request,
+// so httpin directives can read the already routed request state instead of routing again.
+// It must be registered with Use, which runs after the router has matched the request.
+func EchoContextMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), echoContextKey, c)))
+			return next(c)
+		}
+	}
+}
+
+// EchoContextFromRequest returns the echo.Context stored by EchoContextMiddleware.
+func EchoContextFromRequest(req *http.Request) (echo.Context, bool) {
+	c, ok := req.Context().Value(echoContextKey).(echo.Context)
+	return c, ok
+}
+
 // EchoMuxVarsFunc is mux.Vars
 type EchoMuxVarsFunc func(*http.Request) map[string]string
 
@@ -28,7 +56,8 @@ type EchoMuxVarsFunc func(*http.Request) map[string]string
 func UseEchoRouter(name string, e *echo.Echo) {
 	core.RegisterDirective(
 		name,
-		core.NewDirectivePath((&echoMuxVarsExtractor{e}).Execute),
+		// converts values like the other source directives of the binder
+		request.WithFieldCoders(core.NewDirectivePath(newEchoMuxVarsExtractor(e).Execute)),
 		true,
 	)
 }
@@ -37,29 +66,66 @@ func UseEchoPathRouter(e *echo.Echo) {
 	UseEchoRouter("path", e)
 }
 
+// maxCachedRoutes bounds the number of method+path resolutions kept by an extractor.
+// The cache is cleared when it is full, which keeps memory flat for paths with many distinct ids.
+const maxCachedRoutes = 1024
+
 // echoMuxVarsExtractor is an extractor for mux.Vars
 type echoMuxVarsExtractor struct {
 	e *echo.Echo
+
+	mu     sync.RWMutex
+	routes map[string]map[string][]string
+}
+
+func newEchoMuxVarsExtractor(e *echo.Echo) *echoMuxVarsExtractor {
+	return &echoMuxVarsExtractor{
+		e:      e,
+		routes: make(map[string]map[string][]string),
+	}
 }
 
 func (mux *echoMuxVarsExtractor) Execute(rtm *core.DirectiveRuntime) error {
 	req := rtm.GetRequest()
-	kvs := make(map[string][]string)
+	return request.ExtractValues(rtm, mux.pathParams(req), nil)
+}
+
+// pathParams returns the path parameters of the route matching the request.
+// The returned map is shared between requests and must not be modified.
+func (mux *echoMuxVarsExtractor) pathParams(req *http.Request) map[string][]string {
+	if c, ok := EchoContextFromRequest(req); ok {
+		kvs := make(map[string][]string)
+		for _, name := range c.ParamNames() {
+			kvs[name] = []string{c.Param(name)}
+		}
+		return kvs
+	}
+
+	key := req.Method + " " + req.URL.Path
+
+	mux.mu.RLock()
+	kvs, ok := mux.routes[key]
+	mux.mu.RUnlock()
+	if ok {
+		return kvs
+	}
 
-	c := mux.e.NewContext(req, nil)
-	c.SetRequest(req)
+	c := mux.e.AcquireContext()
+	defer mux.e.ReleaseContext(c)
+	c.Reset(req, nil)
 
 	mux.e.Router().Find(req.Method, req.URL.Path, c)
 
-	for _, key := range c.ParamNames() {
-		kvs[key] = []string{c.Param(key)}
+	kvs = make(map[string][]string)
+	for _, name := range c.ParamNames() {
+		kvs[name] = []string{c.Param(name)}
 	}
 
-	extractor := &core.FormExtractor{
-		Runtime: rtm,
-		Form: multipart.Form{
-			Value: kvs,
-		},
+	mux.mu.Lock()
+	if len(mux.routes) >= maxCachedRoutes {
+		mux.routes = make(map[string]map[string][]string)
 	}
-	return extractor.Extract()
+	mux.routes[key] = kvs
+	mux.mu.Unlock()
+	return kvs
 }
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ggicci/httpin"
 	"github.com/labstack/echo/v4"
@@ -49,3 +50,92 @@ func TestUseEchoMux(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code)
 	assert.Equal(t, `{"Username":"ggicci","PostID":123}`, strings.TrimSpace(rec.Body.String()))
 }
+
+func TestEchoMuxVarsExtractorCache(t *testing.T) {
+	e := echo.New()
+	e.GET("/users/:username/posts/:pid", func(c echo.Context) error { return nil })
+	mux := newEchoMuxVarsExtractor(e)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/ggicci/posts/123", nil)
+	params := mux.pathParams(req)
+	assert.Equal(t, map[string][]string{"username": {"ggicci"}, "pid": {"123"}}, params)
+	assert.Len(t, mux.routes, 1)
+
+	// the same method and path is served from the cache
+	again := mux.pathParams(httptest.NewRequest(http.MethodGet, "/users/ggicci/posts/123", nil))
+	assert.Equal(t, params, again)
+	assert.Len(t, mux.routes, 1)
+
+	other := mux.pathParams(httptest.NewRequest(http.MethodGet, "/users/john/posts/7", nil))
+	assert.Equal(t, map[string][]string{"username": {"john"}, "pid": {"7"}}, other)
+	assert.Len(t, mux.routes, 2)
+}
+
+func TestEchoMuxVarsExtractorCacheIsBounded(t *testing.T) {
+	e := echo.New()
+	e.GET("/posts/:pid", func(c echo.Context) error { return nil })
+	mux := newEchoMuxVarsExtractor(e)
+
+	for i := 0; i <= maxCachedRoutes; i++ {
+		mux.pathParams(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/posts/%d", i), nil))
+	}
+	assert.LessOrEqual(t, len(mux.routes), maxCachedRoutes)
+}
+
+func TestEchoContextMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(EchoContextMiddleware())
+	UseEchoPathRouter(e)
+
+	var stored echo.Context
+	e.GET("/users/:username/posts/:pid", func(c echo.Context) error {
+		var ok bool
+		stored, ok = EchoContextFromRequest(c.Request())
+		assert.True(t, ok)
+
+		param := &GetPostOfUserInput{}
+		if err := httpin.Decode(c.Request(), param); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, param)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/ggicci/posts/123", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"Username":"ggicci","PostID":123}`, strings.TrimSpace(rec.Body.String()))
+	assert.NotNil(t, stored)
+}
+
+func TestEchoContextFromRequestWithoutMiddleware(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, ok := EchoContextFromRequest(req)
+	assert.False(t, ok)
+}
+
+func TestEchoPathTimeFormat(t *testing.T) {
+	type input struct {
+		Day time.Time `in:"path=day;format=2006-01-02"`
+	}
+	e := echo.New()
+	e.Use(EchoContextMiddleware())
+	UseEchoPathRouter(e)
+	e.GET("/reports/:day", func(c echo.Context) error {
+		param := &input{}
+		if err := httpin.Decode(c.Request(), param); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.String(http.StatusOK, param.Day.Format(time.RFC3339))
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/2023-05-02", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2023-05-02T00:00:00Z", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/text/language"
+)
+
+// catalogKey holds the catalog used by T.
+var catalogKey = NewKey[*Catalog]("kapeta.i18n.catalog")
+
+// Catalog holds the translated messages for every supported language.
+type Catalog struct {
+	mu       sync.RWMutex
+	fallback language.Tag
+	tags     []language.Tag
+	messages map[language.Tag]map[string]string
+	matcher  language.Matcher
+}
+
+// NewCatalog creates an empty catalog. The fallback language is used when none of
+// the languages requested by a client is supported, and for keys missing in a language.
+func NewCatalog(fallback language.Tag) *Catalog {
+	return &Catalog{
+		fallback: fallback,
+		tags:     []language.Tag{fallback},
+		messages: map[language.Tag]map[string]string{fallback: {}},
+	}
+}
+
+// AddMessages adds messages, keyed by message id, to the given language.
+func (c *Catalog) AddMessages(lang language.Tag, messages map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	existing, ok := c.messages[lang]
+	if !ok {
+		existing = make(map[string]string)
+		c.messages[lang] = existing
+		c.tags = append(c.tags, lang)
+		c.matcher = nil
+	}
+	for id, message := range messages {
+		existing[id] = message
+	}
+}
+
+// LoadMessageFile loads a message file in the JSON format of go-i18n. The language
+// is taken from the file name, like "active.en.json" or "de-CH.json". A message is either
+// a plain string or an object with an "other" translation, nested objects prefix their ids.
+func (c *Catalog) LoadMessageFile(fsys fs.FS, name string) error {
+	parts := strings.Split(path.Base(name), ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("cannot detect the language of message file %q", name)
+	}
+	lang, err := language.Parse(parts[len(parts)-2])
+	if err != nil {
+		return fmt.Errorf("cannot detect the language of message file %q: %w", name, err)
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	var raw map[string]any
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return fmt.Errorf("invalid message file %q: %w", name, err)
+	}
+	messages := make(map[string]string)
+	err = flattenMessages(raw, "", messages)
+	if err != nil {
+		return fmt.Errorf("invalid message file %q: %w", name, err)
+	}
+	c.AddMessages(lang, messages)
+	return nil
+}
+
+func flattenMessages(raw map[string]any, prefix string, messages map[string]string) error {
+	for key, value := range raw {
+		id := prefix + key
+		switch v := value.(type) {
+		case string:
+			messages[id] = v
+		case map[string]any:
+			if other, ok := v["other"].(string); ok {
+				messages[id] = other
+				continue
+			}
+			err := flattenMessages(v, id+".", messages)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %q is neither a string nor an object", id)
+		}
+	}
+	return nil
+}
+
+// Match returns the supported language best matching the preferred languages.
+func (c *Catalog) Match(preferred ...language.Tag) language.Tag {
+	c.mu.Lock()
+	if c.matcher == nil {
+		c.matcher = language.NewMatcher(c.tags)
+	}
+	matcher, tags := c.matcher, c.tags
+	c.mu.Unlock()
+
+	_, index, confidence := matcher.Match(preferred...)
+	if confidence == language.No {
+		return c.fallback
+	}
+	return tags[index]
+}
+
+// Translate returns the message for the key in the given language, formatted with
+// the args like fmt.Sprintf. It falls back to the fallback language and then the key itself.
+func (c *Catalog) Translate(lang language.Tag, key string, args ...any) string {
+	c.mu.RLock()
+	message, ok := c.messages[lang][key]
+	if !ok {
+		message, ok = c.messages[c.fallback][key]
+	}
+	c.mu.RUnlock()
+	if !ok {
+		message = key
+	}
+	return formatMessage(message, args)
+}
+
+func formatMessage(message string, args []any) string {
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// I18nConfig configures the I18n middleware.
+type I18nConfig struct {
+	// Catalog provides the supported languages and their messages.
+	Catalog *Catalog
+	// QueryParam is the query parameter selecting the language, "lang" by default.
+	QueryParam string
+	// CookieName is the cookie selecting the language, "lang" by default.
+	CookieName string
+}
+
+// I18n returns a middleware negotiating the locale of each request. The query parameter
+// takes precedence over the cookie, which takes precedence over the Accept-Language header.
+// Use Locale and T in handlers to read the locale and translated messages.
+func I18n(config I18nConfig) echo.MiddlewareFunc {
+	if config.QueryParam == "" {
+		config.QueryParam = "lang"
+	}
+	if config.CookieName == "" {
+		config.CookieName = "lang"
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			Set(c, catalogKey, config.Catalog)
+			Set(c, LocaleKey, config.Catalog.Match(preferredLanguages(c, config)...))
+			return next(c)
+		}
+	}
+}
+
+func preferredLanguages(c echo.Context, config I18nConfig) []language.Tag {
+	var preferred []language.Tag
+	if lang := c.QueryParam(config.QueryParam); lang != "" {
+		if tag, err := language.Parse(lang); err == nil {
+			preferred = append(preferred, tag)
+		}
+	}
+	if cookie, err := c.Cookie(config.CookieName); err == nil {
+		if tag, err := language.Parse(cookie.Value); err == nil {
+			preferred = append(preferred, tag)
+		}
+	}
+	tags, _, _ := language.ParseAcceptLanguage(c.Request().Header.Get("Accept-Language"))
+	return append(preferred, tags...)
+}
+
+// Locale returns the locale negotiated by the I18n middleware, or language.Und
+// when the middleware is not installed.
+func Locale(c echo.Context) language.Tag {
+	if locale, ok := Get(c, LocaleKey); ok {
+		return locale
+	}
+	return language.Und
+}
+
+// T returns the message for the key in the locale of the request, formatted with
+// the args like fmt.Sprintf. Without the I18n middleware the key is returned.
+func T(c echo.Context, key string, args ...any) string {
+	catalog, ok := Get(c, catalogKey)
+	if !ok {
+		return formatMessage(key, args)
+	}
+	return catalog.Translate(Locale(c), key, args...)
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func newTestCatalog(t *testing.T) *Catalog {
+	catalog := NewCatalog(language.English)
+	fsys := fstest.MapFS{
+		"active.en.json": {Data: []byte(`{"greeting": "Hello %s", "errors": {"notFound": {"description": "resource missing", "other": "Not found"}}}`)},
+		"active.da.json": {Data: []byte(`{"greeting": "Hej %s"}`)},
+	}
+	assert.NoError(t, catalog.LoadMessageFile(fsys, "active.en.json"))
+	assert.NoError(t, catalog.LoadMessageFile(fsys, "active.da.json"))
+	return catalog
+}
+
+func TestCatalog(t *testing.T) {
+	catalog := newTestCatalog(t)
+
+	t.Run("translate", func(t *testing.T) {
+		assert.Equal(t, "Hej Kapeta", catalog.Translate(language.Danish, "greeting", "Kapeta"))
+		assert.Equal(t, "Hello Kapeta", catalog.Translate(language.English, "greeting", "Kapeta"))
+	})
+	t.Run("nested message with other", func(t *testing.T) {
+		assert.Equal(t, "Not found", catalog.Translate(language.English, "errors.notFound"))
+	})
+	t.Run("falls back to the fallback language", func(t *testing.T) {
+		assert.Equal(t, "Not found", catalog.Translate(language.Danish, "errors.notFound"))
+	})
+	t.Run("falls back to the key", func(t *testing.T) {
+		assert.Equal(t, "unknown", catalog.Translate(language.Danish, "unknown"))
+	})
+	t.Run("match", func(t *testing.T) {
+		assert.Equal(t, language.Danish, catalog.Match(language.MustParse("da-DK")))
+		assert.Equal(t, language.English, catalog.Match(language.Japanese))
+	})
+	t.Run("invalid file name", func(t *testing.T) {
+		err := catalog.LoadMessageFile(fstest.MapFS{"messages": {Data: []byte(`{}`)}}, "messages")
+		assert.Error(t, err)
+	})
+}
+
+func TestI18n(t *testing.T) {
+	e := echo.New()
+	e.Use(I18n(I18nConfig{Catalog: newTestCatalog(t)}))
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, Locale(c).String()+": "+T(c, "greeting", "Kapeta"))
+	})
+
+	serve := func(req *http.Request) string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	t.Run("accept language", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", "fr;q=0.9, da;q=0.8")
+		assert.Equal(t, "da: Hej Kapeta", serve(req))
+	})
+	t.Run("cookie before accept language", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", "da")
+		req.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+		assert.Equal(t, "en: Hello Kapeta", serve(req))
+	})
+	t.Run("query before cookie", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?lang=da", nil)
+		req.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+		assert.Equal(t, "da: Hej Kapeta", serve(req))
+	})
+	t.Run("unsupported language", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", "ja")
+		assert.Equal(t, "en: Hello Kapeta", serve(req))
+	})
+}
+
+func TestTWithoutMiddleware(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	assert.Equal(t, "greeting", T(c, "greeting"))
+	assert.Equal(t, language.Und, Locale(c))
+}
@@ -0,0 +1,176 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// KubernetesConfig configures the Kubernetes preset.
+type KubernetesConfig struct {
+	// Health is the registry of the readiness checks and warm-up tasks. Defaults to an
+	// empty registry.
+	Health *Health
+	// DrainDelay is how long the server keeps serving after it is asked to terminate,
+	// while the readiness probe reports down, so the pod is removed from the service
+	// endpoints before connections are refused. 5 seconds by default.
+	DrainDelay time.Duration
+	// ShutdownTimeout is how long the requests in flight get to complete after the drain
+	// delay, 20 seconds by default, so both fit the default termination grace period
+	// of 30 seconds.
+	ShutdownTimeout time.Duration
+	// Signals start the termination, SIGTERM and os.Interrupt by default.
+	Signals []os.Signal
+	// PreStopToken enables the preStop hook, for requests sending it in the
+	// X-Kapeta-PreStop-Token header. The hook drains the server for good, so it is not
+	// served without a token, and the server drains when it receives a signal instead.
+	PreStopToken string
+}
+
+// HeaderXPreStopToken carries the KubernetesConfig.PreStopToken in preStop hook requests.
+const HeaderXPreStopToken = "X-Kapeta-PreStop-Token"
+
+// DefaultKubernetesConfig is the default Kubernetes config.
+var DefaultKubernetesConfig = KubernetesConfig{
+	DrainDelay:      5 * time.Second,
+	ShutdownTimeout: 20 * time.Second,
+	Signals:         []os.Signal{syscall.SIGTERM, os.Interrupt},
+}
+
+// Kubernetes wires the probes and the termination of the server for rolling deploys
+// on Kubernetes, see UseKubernetes.
+type Kubernetes struct {
+	server *KapetaServer
+	config KubernetesConfig
+
+	drainOnce sync.Once
+	drained   chan struct{}
+}
+
+// UseKubernetes serves the liveness probe at /.kapeta/health, the readiness and startup
+// probes of the Health registry, see UseHealth, and, with a PreStopToken, a preStop hook
+// at /.kapeta/prestop which drains the server. Requests to the hook without the token
+// are rejected with 401 Unauthorized. Start the server with Run, which runs the warm-up
+// tasks and terminates the server gracefully on SIGTERM. Configure the pod with:
+//
+//	livenessProbe:
+//	  httpGet: {path: /.kapeta/health, port: http}
+//	readinessProbe:
+//	  httpGet: {path: /.kapeta/ready, port: http}
+//	startupProbe:
+//	  httpGet: {path: /.kapeta/startup, port: http}
+//	lifecycle:
+//	  preStop:
+//	    httpGet:
+//	      path: /.kapeta/prestop
+//	      port: http
+//	      httpHeaders: [{name: X-Kapeta-PreStop-Token, value: <PreStopToken>}]
+func (s *KapetaServer) UseKubernetes(config KubernetesConfig) *Kubernetes {
+	if config.Health == nil {
+		config.Health = NewHealth(DefaultHealthConfig)
+	}
+	if config.DrainDelay == 0 {
+		config.DrainDelay = DefaultKubernetesConfig.DrainDelay
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = DefaultKubernetesConfig.ShutdownTimeout
+	}
+	if len(config.Signals) == 0 {
+		config.Signals = DefaultKubernetesConfig.Signals
+	}
+	k := &Kubernetes{server: s, config: config, drained: make(chan struct{})}
+
+	// NewWithDefaults serves the liveness probe already
+	hasLiveness := false
+	for _, route := range s.Routes() {
+		if route.Method == http.MethodGet && route.Path == healthPath {
+			hasLiveness = true
+		}
+	}
+	if !hasLiveness {
+		s.GET(healthPath, func(c echo.Context) error {
+			return c.String(http.StatusOK, "OK")
+		})
+	}
+	s.UseHealth(config.Health)
+	if config.PreStopToken != "" {
+		s.GET(preStopPath, func(c echo.Context) error {
+			token := c.Request().Header.Get(HeaderXPreStopToken)
+			if subtle.ConstantTimeCompare([]byte(token), []byte(config.PreStopToken)) != 1 {
+				return echo.ErrUnauthorized
+			}
+			k.Drain(c.Request().Context())
+			return c.NoContent(http.StatusNoContent)
+		})
+	}
+	return k
+}
+
+// Health returns the registry of the readiness checks and warm-up tasks.
+func (k *Kubernetes) Health() *Health {
+	return k.config.Health
+}
+
+// Drain makes the readiness probe report down and waits for the drain delay, or until
+// ctx is done. The server is drained only once, later calls wait for the first drain.
+func (k *Kubernetes) Drain(ctx context.Context) {
+	k.drainOnce.Do(func() {
+		k.config.Health.Drain()
+		go func() {
+			time.Sleep(k.config.DrainDelay)
+			close(k.drained)
+		}()
+	})
+	select {
+	case <-k.drained:
+	case <-ctx.Done():
+	}
+}
+
+// Run starts the server on the address, runs the warm-up tasks, and terminates the
+// server when one of the signals is received or ctx is done: it drains the server,
+// unless the preStop hook did already, and shuts it down gracefully. It returns nil
+// after a graceful shutdown.
+func (k *Kubernetes) Run(ctx context.Context, address string, opts Options) error {
+	ctx, stop := signal.NotifyContext(ctx, k.config.Signals...)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- k.server.StartWithOptions(address, opts)
+	}()
+	go func() {
+		if err := k.config.Health.Start(ctx); err != nil {
+			k.server.Logger.Error(err)
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	k.Drain(context.Background())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), k.config.ShutdownTimeout)
+	defer cancel()
+	if err := k.server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+const preStopPath = "/.kapeta/prestop"
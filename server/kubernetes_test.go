@@ -0,0 +1,105 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseKubernetes(t *testing.T) {
+	s := New()
+	k := s.UseKubernetes(KubernetesConfig{DrainDelay: 50 * time.Millisecond, PreStopToken: "secret"})
+	serveWithToken := func(target, token string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set(HeaderXPreStopToken, token)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	serve := func(target string) int {
+		return serveWithToken(target, "")
+	}
+
+	assert.Equal(t, http.StatusOK, serve(healthPath))
+	assert.Equal(t, http.StatusOK, serve(readyPath))
+	assert.Equal(t, http.StatusOK, serve(startupPath))
+
+	// anonymous clients cannot drain the server
+	assert.Equal(t, http.StatusUnauthorized, serve(preStopPath))
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(preStopPath, "guess"))
+	assert.Equal(t, http.StatusOK, serve(readyPath))
+
+	start := time.Now()
+	assert.Equal(t, http.StatusNoContent, serveWithToken(preStopPath, "secret"))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(readyPath))
+	assert.Equal(t, http.StatusOK, serve(healthPath))
+
+	// the server is drained once
+	start = time.Now()
+	k.Drain(context.Background())
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestUseKubernetesWithDefaults(t *testing.T) {
+	s := NewWithDefaults()
+	s.UseKubernetes(DefaultKubernetesConfig)
+	count := 0
+	for _, route := range s.Routes() {
+		if route.Path == healthPath {
+			count++
+		}
+		// the preStop hook is opt-in
+		assert.NotEqual(t, preStopPath, route.Path)
+	}
+	assert.Equal(t, 1, count)
+	assert.True(t, isProbePath(preStopPath))
+}
+
+func TestKubernetesRun(t *testing.T) {
+	s := New()
+	s.HideBanner = true
+	s.HidePort = true
+	k := s.UseKubernetes(KubernetesConfig{DrainDelay: 100 * time.Millisecond})
+	warmedUp := make(chan struct{})
+	k.Health().AddWarmup("cache", func(ctx context.Context) error {
+		close(warmedUp)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- k.Run(ctx, "127.0.0.1:0", Options{})
+	}()
+	<-warmedUp
+	assert.Eventually(t, func() bool {
+		return s.ListenerAddr() != nil && k.Health().Started()
+	}, time.Second, 10*time.Millisecond)
+	url := "http://" + s.ListenerAddr().String() + readyPath
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	cancel()
+	// the server keeps serving during the drain delay, with the readiness probe down
+	assert.Eventually(t, func() bool {
+		res, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, <-errs)
+}
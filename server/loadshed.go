@@ -0,0 +1,98 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Priority is the QoS class of a route, deciding which traffic is shed first under load.
+type Priority int
+
+const (
+	// PriorityLow is for traffic that can be retried later, like bulk exports and previews.
+	PriorityLow Priority = iota
+	// PriorityNormal is for interactive API calls.
+	PriorityNormal
+	// PriorityCritical is for traffic that must not be shed, like health checks and logins.
+	PriorityCritical
+)
+
+// LoadShedderConfig configures a LoadShedder.
+type LoadShedderConfig struct {
+	// MaxInFlight is the number of concurrent requests the server handles.
+	MaxInFlight int
+	// Shares is the part of MaxInFlight each priority may use, in the range (0, 1].
+	// Requests of a priority are rejected once the in-flight count reaches its share,
+	// leaving the remaining capacity to higher priorities. Defaults to DefaultPriorityShares.
+	Shares map[Priority]float64
+	// RetryAfter is the number of seconds sent in the Retry-After header of rejected
+	// requests, 1 by default.
+	RetryAfter int
+}
+
+// DefaultPriorityShares reserves the last half of the capacity for normal and critical
+// traffic, and the last fifth for critical traffic.
+var DefaultPriorityShares = map[Priority]float64{
+	PriorityLow:      0.5,
+	PriorityNormal:   0.8,
+	PriorityCritical: 1,
+}
+
+// LoadShedder rejects requests with 503 Service Unavailable when the server is
+// overloaded, low priority requests first. Its middlewares share one in-flight count.
+//
+// Usage:
+//
+//	shedder := server.NewLoadShedder(server.LoadShedderConfig{MaxInFlight: 200})
+//	api := s.Group("/api", shedder.Middleware(server.PriorityNormal))
+//	exports := s.Group("/exports", shedder.Middleware(server.PriorityLow))
+type LoadShedder struct {
+	limits     map[Priority]int64
+	retryAfter string
+	inFlight   atomic.Int64
+}
+
+// NewLoadShedder creates a LoadShedder from the config.
+func NewLoadShedder(config LoadShedderConfig) *LoadShedder {
+	if config.Shares == nil {
+		config.Shares = DefaultPriorityShares
+	}
+	if config.RetryAfter == 0 {
+		config.RetryAfter = 1
+	}
+	limits := make(map[Priority]int64, len(config.Shares))
+	for priority, share := range config.Shares {
+		limits[priority] = max(1, int64(float64(config.MaxInFlight)*share))
+	}
+	return &LoadShedder{
+		limits:     limits,
+		retryAfter: strconv.Itoa(config.RetryAfter),
+	}
+}
+
+// InFlight returns the number of requests currently handled by the middlewares.
+func (l *LoadShedder) InFlight() int64 {
+	return l.inFlight.Load()
+}
+
+// Middleware returns a middleware admitting requests of the given priority while the
+// in-flight count is below its share. Priorities without a share are never shed.
+func (l *LoadShedder) Middleware(priority Priority) echo.MiddlewareFunc {
+	limit, limited := l.limits[priority]
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			inFlight := l.inFlight.Add(1)
+			defer l.inFlight.Add(-1)
+			if limited && inFlight > limit {
+				c.Response().Header().Set(echo.HeaderRetryAfter, l.retryAfter)
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "server overloaded, retry later")
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadShedder(t *testing.T) {
+	shedder := NewLoadShedder(LoadShedderConfig{MaxInFlight: 10})
+	release := make(chan struct{})
+
+	e := echo.New()
+	handler := func(c echo.Context) error {
+		if c.QueryParam("block") == "true" {
+			<-release
+		}
+		return c.NoContent(http.StatusOK)
+	}
+	e.GET("/low", handler, shedder.Middleware(PriorityLow))
+	e.GET("/normal", handler, shedder.Middleware(PriorityNormal))
+	e.GET("/critical", handler, shedder.Middleware(PriorityCritical))
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	// occupy 8 of the 10 slots
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve("/critical?block=true")
+		}()
+	}
+	require.Eventually(t, func() bool { return shedder.InFlight() == 8 }, time.Second, time.Millisecond)
+
+	rec := serve("/low")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/normal").Code)
+	assert.Equal(t, http.StatusOK, serve("/critical").Code)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(0), shedder.InFlight())
+	assert.Equal(t, http.StatusOK, serve("/low").Code)
+}
+
+func TestLoadShedderCustomShares(t *testing.T) {
+	shedder := NewLoadShedder(LoadShedderConfig{
+		MaxInFlight: 4,
+		Shares:      map[Priority]float64{PriorityLow: 0.1},
+		RetryAfter:  30,
+	})
+	assert.Equal(t, int64(1), shedder.limits[PriorityLow])
+	_, limited := shedder.limits[PriorityNormal]
+	assert.False(t, limited)
+	assert.Equal(t, "30", shedder.retryAfter)
+}
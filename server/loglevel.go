@@ -0,0 +1,266 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// LogLevelConfig configures LogLevels.
+type LogLevelConfig struct {
+	// TTL is how long a changed level or a debugged route lasts when no ttl is given,
+	// 15 minutes by default.
+	TTL time.Duration
+	// MaxTTL bounds the ttl of a change, 24 hours by default, so a forgotten change
+	// never lasts.
+	MaxTTL time.Duration
+	// PrincipalFunc returns who makes a request to the Handler served by UseLogLevels,
+	// like the PrincipalFunc of AdminConfig, which it defaults to. Requests without a
+	// principal are rejected with 401 Unauthorized.
+	PrincipalFunc func(c echo.Context) string
+}
+
+// DefaultLogLevelConfig is the default LogLevels config.
+var DefaultLogLevelConfig = LogLevelConfig{
+	TTL:           15 * time.Minute,
+	MaxTTL:        24 * time.Hour,
+	PrincipalFunc: DefaultAdminConfig.PrincipalFunc,
+}
+
+// logLevels names the gommon log levels.
+var logLevels = map[string]log.Lvl{
+	"debug": log.DEBUG,
+	"info":  log.INFO,
+	"warn":  log.WARN,
+	"error": log.ERROR,
+	"off":   log.OFF,
+}
+
+func logLevelName(level log.Lvl) string {
+	for name, l := range logLevels {
+		if l == level {
+			return name
+		}
+	}
+	return ""
+}
+
+// LogLevels changes the level of a logger and enables debug logging for single routes
+// at runtime, so production incidents can be debugged without a redeploy. Every change
+// is reverted after its ttl.
+type LogLevels struct {
+	config LogLevelConfig
+	logger echo.Logger
+	debug  *log.Logger
+
+	mu sync.Mutex
+	// base is the level of the logger before it was changed
+	base       log.Lvl
+	expires    time.Time
+	generation int
+	routes     map[string]time.Time
+	now        func() time.Time
+}
+
+// LogLevelState describes the changes of LogLevels.
+type LogLevelState struct {
+	Level string `json:"level"`
+	// ExpiresAt is when the level reverts, unset when the level was not changed.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Routes maps the debugged routes to when their debug logging ends.
+	Routes map[string]time.Time `json:"routes"`
+}
+
+// NewLogLevels creates LogLevels changing logger, like the echo Logger of the server.
+func NewLogLevels(logger echo.Logger, config LogLevelConfig) *LogLevels {
+	if config.TTL == 0 {
+		config.TTL = DefaultLogLevelConfig.TTL
+	}
+	if config.MaxTTL == 0 {
+		config.MaxTTL = DefaultLogLevelConfig.MaxTTL
+	}
+	if config.PrincipalFunc == nil {
+		config.PrincipalFunc = DefaultLogLevelConfig.PrincipalFunc
+	}
+	debug := log.New(logger.Prefix())
+	debug.SetOutput(logger.Output())
+	debug.SetLevel(log.DEBUG)
+	return &LogLevels{
+		config: config,
+		logger: logger,
+		debug:  debug,
+		routes: map[string]time.Time{},
+		now:    time.Now,
+	}
+}
+
+func (l *LogLevels) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return l.config.TTL
+	}
+	return min(ttl, l.config.MaxTTL)
+}
+
+// SetLevel changes the level of the logger for ttl, the configured TTL when 0, after
+// which it reverts to the level it had before the first change.
+func (l *LogLevels) SetLevel(level log.Lvl, ttl time.Duration) {
+	ttl = l.ttl(ttl)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.expires.IsZero() {
+		l.base = l.logger.Level()
+	}
+	l.logger.SetLevel(level)
+	l.expires = l.now().Add(ttl)
+	// a timer of an earlier change still firing must not revert this change
+	l.generation++
+	generation := l.generation
+	time.AfterFunc(ttl, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.generation == generation {
+			l.reset()
+		}
+	})
+}
+
+// Reset reverts the level of the logger and ends the debug logging of all routes.
+func (l *LogLevels) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reset()
+	l.routes = map[string]time.Time{}
+}
+
+func (l *LogLevels) reset() {
+	if !l.expires.IsZero() {
+		l.logger.SetLevel(l.base)
+		l.expires = time.Time{}
+	}
+	l.generation++
+}
+
+// DebugRoute enables debug logging for the requests matching the route, like
+// "/users/:id", for ttl, the configured TTL when 0. It needs the Middleware.
+func (l *LogLevels) DebugRoute(route string, ttl time.Duration) {
+	ttl = l.ttl(ttl)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.routes[route] = l.now().Add(ttl)
+}
+
+func (l *LogLevels) debugged(route string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expires, ok := l.routes[route]
+	if ok && !l.now().Before(expires) {
+		delete(l.routes, route)
+		return false
+	}
+	return ok
+}
+
+// State returns the current level and the debugged routes.
+func (l *LogLevels) State() LogLevelState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	state := LogLevelState{Level: logLevelName(l.logger.Level()), Routes: map[string]time.Time{}}
+	if !l.expires.IsZero() {
+		expires := l.expires
+		state.ExpiresAt = &expires
+	}
+	for route, expires := range l.routes {
+		if now.Before(expires) {
+			state.Routes[route] = expires
+		} else {
+			delete(l.routes, route)
+		}
+	}
+	return state
+}
+
+// Middleware gives the requests of debugged routes a logger with the debug level, and
+// logs them with their redacted headers.
+func (l *LogLevels) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !l.debugged(c.Path()) {
+				return next(c)
+			}
+			req := c.Request()
+			l.debug.Debugj(log.JSON{
+				"id":     requestID(c),
+				"route":  c.Path(),
+				"method": req.Method,
+				"uri":    DefaultRedactor.URI(req.RequestURI),
+				"header": DefaultRedactor.Header(req.Header),
+			})
+			logger := c.Logger()
+			c.SetLogger(l.debug)
+			defer c.SetLogger(logger)
+			return next(c)
+		}
+	}
+}
+
+// logLevelRequest is the body of a request changing the log levels. TTL is a duration
+// like "10m". Routes are debugged instead of changing the level when set.
+type logLevelRequest struct {
+	Level  string   `json:"level"`
+	TTL    string   `json:"ttl"`
+	Routes []string `json:"routes"`
+}
+
+// Handler responds with the State, and changes the level or debugs routes for PUT
+// requests with a JSON body like {"level": "debug", "ttl": "10m"} or
+// {"routes": ["/users/:id"], "ttl": "10m"}. DELETE requests Reset all changes.
+func (l *LogLevels) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodPut:
+			var body logLevelRequest
+			if err := c.Bind(&body); err != nil {
+				return err
+			}
+			var ttl time.Duration
+			if body.TTL != "" {
+				var err error
+				if ttl, err = time.ParseDuration(body.TTL); err != nil || ttl < 0 {
+					return echo.NewHTTPError(http.StatusBadRequest, "invalid ttl "+body.TTL)
+				}
+			}
+			if len(body.Routes) > 0 {
+				for _, route := range body.Routes {
+					l.DebugRoute(route, ttl)
+				}
+			} else {
+				level, ok := logLevels[strings.ToLower(body.Level)]
+				if !ok {
+					return echo.NewHTTPError(http.StatusBadRequest, "invalid level "+body.Level)
+				}
+				l.SetLevel(level, ttl)
+			}
+		case http.MethodDelete:
+			l.Reset()
+		}
+		return c.JSON(http.StatusOK, l.State())
+	}
+}
+
+// UseLogLevels serves the Handler at /.kapeta/loglevel, guarded by the middlewares,
+// which must authenticate the caller, and adds the Middleware to the server. Requests
+// without a principal, see LogLevelConfig.PrincipalFunc, are rejected.
+func (s *KapetaServer) UseLogLevels(l *LogLevels, m ...echo.MiddlewareFunc) {
+	s.Use(l.Middleware())
+	m = append(m[:len(m):len(m)], requirePrincipal(l.config.PrincipalFunc))
+	s.Match([]string{http.MethodGet, http.MethodPut, http.MethodDelete}, logLevelPath, l.Handler(), m...)
+}
+
+const logLevelPath = "/.kapeta/loglevel"
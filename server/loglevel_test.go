@@ -0,0 +1,143 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevelsSetLevel(t *testing.T) {
+	e := echo.New()
+	l := NewLogLevels(e.Logger, DefaultLogLevelConfig)
+
+	l.SetLevel(log.DEBUG, time.Hour)
+	l.SetLevel(log.INFO, 20*time.Millisecond)
+	assert.Equal(t, log.INFO, e.Logger.Level())
+	state := l.State()
+	assert.Equal(t, "info", state.Level)
+	assert.NotNil(t, state.ExpiresAt)
+
+	// reverts to the level before the first change
+	assert.Eventually(t, func() bool {
+		return e.Logger.Level() == log.ERROR
+	}, time.Second, 5*time.Millisecond)
+	assert.Nil(t, l.State().ExpiresAt)
+
+	l.SetLevel(log.WARN, 0)
+	l.Reset()
+	assert.Equal(t, log.ERROR, e.Logger.Level())
+}
+
+func TestLogLevelsDebugRoute(t *testing.T) {
+	var out bytes.Buffer
+	s := New()
+	s.Logger.SetOutput(&out)
+	l := NewLogLevels(s.Logger, LogLevelConfig{MaxTTL: time.Hour})
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	s.UseLogLevels(l)
+	for _, path := range []string{"/users/:id", "/orders"} {
+		s.GET(path, func(c echo.Context) error {
+			c.Logger().Debug("handling " + c.Path())
+			return c.NoContent(http.StatusOK)
+		})
+	}
+	serve := func(target string) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+		s.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	l.DebugRoute("/users/:id", 48*time.Hour)
+	assert.Equal(t, map[string]time.Time{"/users/:id": now.Add(time.Hour)}, l.State().Routes)
+
+	serve("/users/1")
+	serve("/orders")
+	logged := out.String()
+	assert.Contains(t, logged, "handling /users/:id")
+	assert.Contains(t, logged, `"route":"/users/:id"`)
+	assert.NotContains(t, logged, "secret")
+	assert.NotContains(t, logged, "handling /orders")
+	assert.Equal(t, log.ERROR, s.Logger.Level())
+
+	out.Reset()
+	now = now.Add(time.Hour)
+	serve("/users/1")
+	assert.Empty(t, out.String())
+	assert.Empty(t, l.State().Routes)
+}
+
+func TestLogLevelsHandler(t *testing.T) {
+	s := New()
+	l := NewLogLevels(s.Logger, DefaultLogLevelConfig)
+	s.UseLogLevels(l, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if user := c.Request().Header.Get("X-User"); user != "" {
+				Set(c, AuthClaimsKey, map[string]any{"sub": user})
+			}
+			return next(c)
+		}
+	})
+	serveAs := func(user, method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, logLevelPath, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		return serveAs("alice", method, body)
+	}
+
+	// anonymous callers cannot change the levels
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		assert.Equal(t, http.StatusUnauthorized, serveAs("", method, `{"level":"off"}`).Code, method)
+	}
+	assert.Equal(t, log.ERROR, s.Logger.Level())
+
+	rec := serve(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"error","routes":{}}`, rec.Body.String())
+
+	rec = serve(http.MethodPut, `{"level":"debug","ttl":"10m"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, log.DEBUG, s.Logger.Level())
+	assert.Contains(t, rec.Body.String(), `"expires_at"`)
+
+	rec = serve(http.MethodPut, `{"routes":["/users/:id"]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, l.State().Routes, "/users/:id")
+
+	rec = serve(http.MethodPut, `{"level":"verbose"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(http.MethodPut, `{"level":"info","ttl":"soon"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodDelete, "")
+	assert.JSONEq(t, `{"level":"error","routes":{}}`, rec.Body.String())
+	assert.Equal(t, log.ERROR, s.Logger.Level())
+}
+
+func TestUseLogLevelsMiddleware(t *testing.T) {
+	s := New()
+	s.UseLogLevels(NewLogLevels(s.Logger, DefaultLogLevelConfig), func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return echo.ErrUnauthorized
+		}
+	})
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, logLevelPath, nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
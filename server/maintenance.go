@@ -0,0 +1,35 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Maintenance returns a middleware responding with 503 Service Unavailable while the
+// toggle is on, with a Retry-After header when retryAfter is set. The probes and the
+// admin API stay available, so maintenance mode can be turned off again.
+func Maintenance(enabled *Toggle[bool], retryAfter time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !enabled.Get() || isOperationalPath(c.Request().URL.Path) {
+				return next(c)
+			}
+			if retryAfter > 0 {
+				c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())))
+			}
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "service under maintenance")
+		}
+	}
+}
+
+// isOperationalPath reports whether the path is served for operating the service, like
+// the probes, the preStop hook and the admin API, which runtime toggles must not disable.
+func isOperationalPath(path string) bool {
+	return isProbePath(path) || path == adminPath || strings.HasPrefix(path, adminPath+"/")
+}
@@ -0,0 +1,38 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenance(t *testing.T) {
+	enabled := NewToggle(false)
+	e := echo.New()
+	e.Use(Maintenance(enabled, 2*time.Minute))
+	for _, path := range []string{"/users", readyPath, adminPath + "/toggles"} {
+		e.GET(path, func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+	}
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/users").Code)
+
+	enabled.Set(true)
+	rec := serve("/users")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "120", rec.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, http.StatusOK, serve(readyPath).Code)
+	assert.Equal(t, http.StatusOK, serve(adminPath+"/toggles").Code)
+}
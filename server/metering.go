@@ -0,0 +1,232 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// UsageEvent records the billable usage of a request.
+type UsageEvent struct {
+	Time   time.Time
+	Method string
+	Route  string
+	Status int
+	Tenant string
+	// APIKey is a hash of the API key of the request, so keys are not exported.
+	APIKey        string
+	RequestBytes  int64
+	ResponseBytes int64
+	Duration      time.Duration
+}
+
+// UsageExporter sends batches of usage events to a billing system.
+type UsageExporter interface {
+	Export(ctx context.Context, events []UsageEvent) error
+}
+
+// UsageExporterFunc is an adapter allowing a function to be used as a UsageExporter.
+type UsageExporterFunc func(ctx context.Context, events []UsageEvent) error
+
+func (f UsageExporterFunc) Export(ctx context.Context, events []UsageEvent) error {
+	return f(ctx, events)
+}
+
+// MeteringConfig configures a Metering.
+type MeteringConfig struct {
+	Exporter UsageExporter
+	// BatchSize is the number of events exported together, 100 by default.
+	BatchSize int
+	// FlushInterval is the longest time an event waits for its batch, 10 seconds by default.
+	FlushInterval time.Duration
+	// QueueSize is the number of events waiting for export, 10000 by default. Events
+	// are dropped when the exporter cannot keep up, see Metering.Dropped.
+	QueueSize int
+	// APIKeyHeader is the request header with the API key, X-Api-Key by default.
+	APIKeyHeader string
+}
+
+// DefaultMeteringConfig is the default Metering config.
+var DefaultMeteringConfig = MeteringConfig{
+	BatchSize:     100,
+	FlushInterval: 10 * time.Second,
+	QueueSize:     10000,
+	APIKeyHeader:  "X-Api-Key",
+}
+
+// Metering records a UsageEvent per request and exports them in batches, for usage based
+// billing. Tenants are read from TenantKey.
+//
+// Usage:
+//
+//	metering := server.NewMetering(server.MeteringConfig{Exporter: exporter})
+//	defer metering.Close(ctx)
+//	s.Use(metering.Middleware())
+type Metering struct {
+	config  MeteringConfig
+	events  chan UsageEvent
+	flush   chan chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// NewMetering creates a Metering and starts exporting.
+func NewMetering(config MeteringConfig) *Metering {
+	if config.BatchSize == 0 {
+		config.BatchSize = DefaultMeteringConfig.BatchSize
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = DefaultMeteringConfig.FlushInterval
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = DefaultMeteringConfig.QueueSize
+	}
+	if config.APIKeyHeader == "" {
+		config.APIKeyHeader = DefaultMeteringConfig.APIKeyHeader
+	}
+	m := &Metering{
+		config: config,
+		events: make(chan UsageEvent, config.QueueSize),
+		flush:  make(chan chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// Middleware returns a middleware recording the usage of the requests.
+func (m *Metering) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+			body := &countingReader{ReadCloser: req.Body}
+			if req.Body != nil {
+				req.Body = body
+			}
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response so its size is recorded
+				c.Error(err)
+			}
+
+			event := UsageEvent{
+				Time:          start,
+				Method:        req.Method,
+				Route:         c.Path(),
+				Status:        c.Response().Status,
+				RequestBytes:  body.n,
+				ResponseBytes: c.Response().Size,
+				Duration:      time.Since(start),
+			}
+			event.Tenant, _ = Get(c, TenantKey)
+			if key := req.Header.Get(m.config.APIKeyHeader); key != "" {
+				sum := sha256.Sum256([]byte(key))
+				event.APIKey = hex.EncodeToString(sum[:8])
+			}
+			select {
+			case m.events <- event:
+			default:
+				m.dropped.Add(1)
+			}
+			return nil
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full.
+func (m *Metering) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
+// Flush exports the queued events.
+func (m *Metering) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case m.flush <- flushed:
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close exports the queued events and stops exporting. Requests must not be recorded
+// after Close.
+func (m *Metering) Close(ctx context.Context) error {
+	err := m.Flush(ctx)
+	m.once.Do(func() {
+		close(m.done)
+	})
+	return err
+}
+
+func (m *Metering) run() {
+	ticker := time.NewTicker(m.config.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]UsageEvent, 0, m.config.BatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := m.config.Exporter.Export(context.Background(), batch); err != nil {
+			log.Errorf("export %d usage events: %v", len(batch), err)
+		}
+		batch = make([]UsageEvent, 0, m.config.BatchSize)
+	}
+	for {
+		select {
+		case event := <-m.events:
+			batch = append(batch, event)
+			if len(batch) >= m.config.BatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case flushed := <-m.flush:
+			for drained := false; !drained; {
+				select {
+				case event := <-m.events:
+					batch = append(batch, event)
+					if len(batch) >= m.config.BatchSize {
+						export()
+					}
+				default:
+					drained = true
+				}
+			}
+			export()
+			close(flushed)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// countingReader counts the bytes read from the request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExporter struct {
+	mu      sync.Mutex
+	batches [][]UsageEvent
+}
+
+func (r *recordingExporter) Export(_ context.Context, events []UsageEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, events)
+	return nil
+}
+
+func (r *recordingExporter) events() []UsageEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []UsageEvent
+	for _, batch := range r.batches {
+		events = append(events, batch...)
+	}
+	return events
+}
+
+func TestMetering(t *testing.T) {
+	exporter := &recordingExporter{}
+	metering := NewMetering(MeteringConfig{Exporter: exporter, BatchSize: 2, FlushInterval: time.Hour})
+
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			Set(c, TenantKey, "acme")
+			return next(c)
+		}
+	}, metering.Middleware())
+	e.POST("/echo", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body)+string(body))
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello"))
+		req.Header.Set("X-Api-Key", "secret")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	// one batch is full, the other events are exported on close
+	assert.Eventually(t, func() bool { return len(exporter.events()) == 2 }, time.Second, time.Millisecond)
+	require.NoError(t, metering.Close(context.Background()))
+	events := exporter.events()
+	require.Len(t, events, 3)
+
+	event := events[0]
+	assert.Equal(t, http.MethodPost, event.Method)
+	assert.Equal(t, "/echo", event.Route)
+	assert.Equal(t, http.StatusOK, event.Status)
+	assert.Equal(t, "acme", event.Tenant)
+	assert.Len(t, event.APIKey, 16)
+	assert.NotContains(t, event.APIKey, "secret")
+	assert.Equal(t, int64(5), event.RequestBytes)
+	assert.Equal(t, int64(10), event.ResponseBytes)
+
+	assert.Equal(t, http.StatusNotFound, events[2].Status)
+	assert.Positive(t, events[2].ResponseBytes)
+	assert.Zero(t, metering.Dropped())
+}
+
+func TestMeteringDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	metering := NewMetering(MeteringConfig{
+		Exporter: UsageExporterFunc(func(ctx context.Context, events []UsageEvent) error {
+			<-release
+			return nil
+		}),
+		BatchSize: 1,
+		QueueSize: 1,
+	})
+	e := echo.New()
+	e.Use(metering.Middleware())
+
+	for i := 0; i < 5; i++ {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.Positive(t, metering.Dropped())
+	close(release)
+	require.NoError(t, metering.Close(context.Background()))
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// overridableMethods are the methods a POST request may be turned into.
+var overridableMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// UseMethodOverride lets clients behind restrictive proxies send PUT, PATCH and DELETE
+// requests as POST, with the real method in the X-HTTP-Method-Override header or in the
+// _method form field. The override runs before routing and is only applied to POST requests.
+func (s *KapetaServer) UseMethodOverride() {
+	s.Pre(middleware.MethodOverrideWithConfig(middleware.MethodOverrideConfig{
+		Getter: methodOverrideGetter,
+	}))
+}
+
+func methodOverrideGetter(c echo.Context) string {
+	method := middleware.MethodFromHeader(echo.HeaderXHTTPMethodOverride)(c)
+	if method == "" {
+		method = middleware.MethodFromForm("_method")(c)
+	}
+	method = strings.ToUpper(method)
+	if !overridableMethods[method] {
+		return ""
+	}
+	return method
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUseMethodOverride(t *testing.T) {
+	s := New()
+	s.UseMethodOverride()
+	s.DELETE("/users/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, "deleted")
+	})
+	s.POST("/users/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, "posted")
+	})
+	s.GET("/users/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, "fetched")
+	})
+
+	serve := func(req *http.Request) string {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	t.Run("header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/users/1", nil)
+		req.Header.Set(echo.HeaderXHTTPMethodOverride, "DELETE")
+		assert.Equal(t, "deleted", serve(req))
+	})
+	t.Run("form field", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader("_method=delete"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		assert.Equal(t, "deleted", serve(req))
+	})
+	t.Run("method not allowed as override", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/users/1", nil)
+		req.Header.Set(echo.HeaderXHTTPMethodOverride, "GET")
+		assert.Equal(t, "posted", serve(req))
+	})
+	t.Run("only post is overridden", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set(echo.HeaderXHTTPMethodOverride, "DELETE")
+		assert.Equal(t, "fetched", serve(req))
+	})
+}
@@ -0,0 +1,314 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// HeaderXMock marks the responses served by UseMock.
+const HeaderXMock = "X-Mock"
+
+// OpenAPIMock serves example responses of the operations of an OpenAPI 3 document, so
+// frontend teams can develop against a block before its handlers exist, see UseMock.
+type OpenAPIMock struct {
+	operations []mockOperation
+	schemas    map[string]*openAPISchema
+}
+
+type mockOperation struct {
+	method    string
+	path      string
+	responses map[string]openAPIResponse
+}
+
+type openAPIDocument struct {
+	Paths      map[string]map[string]yaml.Node `yaml:"paths"`
+	Components struct {
+		Schemas   map[string]*openAPISchema  `yaml:"schemas"`
+		Responses map[string]openAPIResponse `yaml:"responses"`
+	} `yaml:"components"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]openAPIResponse `yaml:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string                      `yaml:"$ref"`
+	Content map[string]openAPIMediaType `yaml:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema   *openAPISchema `yaml:"schema"`
+	Example  any            `yaml:"example"`
+	Examples map[string]struct {
+		Value any `yaml:"value"`
+	} `yaml:"examples"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `yaml:"$ref"`
+	Type       string                    `yaml:"type"`
+	Format     string                    `yaml:"format"`
+	Enum       []any                     `yaml:"enum"`
+	Default    any                       `yaml:"default"`
+	Example    any                       `yaml:"example"`
+	Properties map[string]*openAPISchema `yaml:"properties"`
+	Items      *openAPISchema            `yaml:"items"`
+	AllOf      []*openAPISchema          `yaml:"allOf"`
+	OneOf      []*openAPISchema          `yaml:"oneOf"`
+	AnyOf      []*openAPISchema          `yaml:"anyOf"`
+}
+
+var openAPIMethods = map[string]string{
+	"get":     http.MethodGet,
+	"put":     http.MethodPut,
+	"post":    http.MethodPost,
+	"delete":  http.MethodDelete,
+	"options": http.MethodOptions,
+	"head":    http.MethodHead,
+	"patch":   http.MethodPatch,
+	"trace":   http.MethodTrace,
+}
+
+// ParseOpenAPIMock parses an OpenAPI 3 document, in YAML or JSON.
+func ParseOpenAPIMock(data []byte) (*OpenAPIMock, error) {
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	mock := &OpenAPIMock{schemas: doc.Components.Schemas}
+	for path, item := range doc.Paths {
+		for key, node := range item {
+			method, ok := openAPIMethods[key]
+			if !ok {
+				continue
+			}
+			var operation openAPIOperation
+			if err := node.Decode(&operation); err != nil {
+				return nil, fmt.Errorf("parse OpenAPI document: %s %s: %w", method, path, err)
+			}
+			for status, response := range operation.Responses {
+				if name, ok := strings.CutPrefix(response.Ref, "#/components/responses/"); ok {
+					operation.Responses[status] = doc.Components.Responses[name]
+				}
+			}
+			// OpenAPI paths name their parameters like the http.ServeMux
+			echoPath, _ := routePattern(path)
+			mock.operations = append(mock.operations, mockOperation{
+				method:    method,
+				path:      echoPath,
+				responses: operation.Responses,
+			})
+		}
+	}
+	sort.Slice(mock.operations, func(i, j int) bool {
+		a, b := mock.operations[i], mock.operations[j]
+		return a.path < b.path || a.path == b.path && a.method < b.method
+	})
+	return mock, nil
+}
+
+// LoadOpenAPIMock reads an OpenAPI 3 document from a file, see ParseOpenAPIMock.
+func LoadOpenAPIMock(path string) (*OpenAPIMock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseOpenAPIMock(data)
+}
+
+// UseMock serves the operations of the document without a route on the server, so call
+// it after the handlers are registered. An operation responds with its lowest 2xx
+// response, in the content type the client accepts, with the example of the response,
+// or a value synthesized from its schema. Clients select another response or a named
+// example with the Prefer header, like "Prefer: code=404, example=missing". Responses
+// carry the X-Mock header.
+func (s *KapetaServer) UseMock(mock *OpenAPIMock) {
+	registered := map[string]bool{}
+	for _, route := range s.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for _, operation := range mock.operations {
+		if registered[operation.method+" "+operation.path] {
+			continue
+		}
+		operation := operation
+		s.Add(operation.method, operation.path, func(c echo.Context) error {
+			return mock.respond(c, operation)
+		})
+	}
+}
+
+func (m *OpenAPIMock) respond(c echo.Context, operation mockOperation) error {
+	c.Response().Header().Set(HeaderXMock, "true")
+	prefs := Prefer(c)
+	status, response, ok := selectMockResponse(operation.responses, prefs.Values["code"])
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotImplemented, "no mock response for "+operation.method+" "+operation.path)
+	}
+	if code := prefs.Values["code"]; code != "" && code == strconv.Itoa(status) {
+		PreferenceApplied(c, "code="+code)
+	}
+	if len(response.Content) == 0 {
+		return c.NoContent(status)
+	}
+
+	types := make([]string, 0, len(response.Content))
+	for contentType := range response.Content {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	contentType := types[0]
+	if _, ok := response.Content[echo.MIMEApplicationJSON]; ok {
+		contentType = echo.MIMEApplicationJSON
+	}
+	// negotiateContentType falls back on JSON, which the response may not have
+	if accepted, ok := negotiateContentType(c.Request().Header.Get(echo.HeaderAccept), types); ok {
+		if _, ok := response.Content[accepted]; ok {
+			contentType = accepted
+		}
+	}
+	media := response.Content[contentType]
+
+	name := prefs.Values["example"]
+	if _, ok := media.Examples[name]; ok {
+		PreferenceApplied(c, "example="+name)
+	}
+	value := m.example(media, name)
+	if text, ok := value.(string); ok && !strings.Contains(contentType, "json") {
+		return c.Blob(status, contentType, []byte(text))
+	}
+	serializer, ok := request.SerializerFor(contentType)
+	if !ok {
+		serializer = request.JSONSerializer{}
+	}
+	var buf bytes.Buffer
+	if err := serializer.Encode(&buf, value); err != nil {
+		return err
+	}
+	return c.Blob(status, contentType, buf.Bytes())
+}
+
+// selectMockResponse returns the response for the code, or the lowest 2xx response,
+// or the default response as 200 OK.
+func selectMockResponse(responses map[string]openAPIResponse, code string) (int, openAPIResponse, bool) {
+	if code != "" {
+		if response, ok := responses[code]; ok {
+			status, err := strconv.Atoi(code)
+			return status, response, err == nil
+		}
+	}
+	best := 0
+	for key := range responses {
+		if status, err := strconv.Atoi(key); err == nil && status >= 200 && status < 300 && (best == 0 || status < best) {
+			best = status
+		}
+	}
+	if best != 0 {
+		return best, responses[strconv.Itoa(best)], true
+	}
+	if response, ok := responses["default"]; ok {
+		return http.StatusOK, response, true
+	}
+	return 0, openAPIResponse{}, false
+}
+
+// example returns the named example, the example of the media type, or a value
+// synthesized from its schema.
+func (m *OpenAPIMock) example(media openAPIMediaType, name string) any {
+	if example, ok := media.Examples[name]; ok {
+		return example.Value
+	}
+	if media.Example != nil {
+		return media.Example
+	}
+	if len(media.Examples) > 0 {
+		names := make([]string, 0, len(media.Examples))
+		for name := range media.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return media.Examples[names[0]].Value
+	}
+	return m.synthesize(media.Schema, 0)
+}
+
+// maxMockDepth bounds the synthesis of recursive schemas.
+const maxMockDepth = 8
+
+func (m *OpenAPIMock) synthesize(schema *openAPISchema, depth int) any {
+	if schema == nil || depth > maxMockDepth {
+		return nil
+	}
+	if name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/"); ok {
+		return m.synthesize(m.schemas[name], depth+1)
+	}
+	switch {
+	case schema.Example != nil:
+		return schema.Example
+	case schema.Default != nil:
+		return schema.Default
+	case len(schema.Enum) > 0:
+		return schema.Enum[0]
+	case len(schema.AllOf) > 0:
+		merged := map[string]any{}
+		for _, part := range schema.AllOf {
+			if object, ok := m.synthesize(part, depth+1).(map[string]any); ok {
+				for key, value := range object {
+					merged[key] = value
+				}
+			}
+		}
+		return merged
+	case len(schema.OneOf) > 0:
+		return m.synthesize(schema.OneOf[0], depth+1)
+	case len(schema.AnyOf) > 0:
+		return m.synthesize(schema.AnyOf[0], depth+1)
+	}
+	switch schema.Type {
+	case "array":
+		return []any{m.synthesize(schema.Items, depth+1)}
+	case "string":
+		return mockString(schema.Format)
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	}
+	if schema.Type == "object" || schema.Properties != nil {
+		object := make(map[string]any, len(schema.Properties))
+		for name, property := range schema.Properties {
+			object[name] = m.synthesize(property, depth+1)
+		}
+		return object
+	}
+	return nil
+}
+
+func mockString(format string) string {
+	switch format {
+	case "date-time":
+		return "2023-01-01T00:00:00Z"
+	case "date":
+		return "2023-01-01"
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "https://example.com"
+	}
+	return "string"
+}
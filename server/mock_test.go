@@ -0,0 +1,168 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mockDocument = `
+openapi: 3.0.3
+paths:
+  /users:
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: "#/components/schemas/User"
+    post:
+      responses:
+        "201":
+          content:
+            application/json:
+              example: {id: 7, name: Ada}
+        "400":
+          $ref: "#/components/responses/Invalid"
+  /users/{id}:
+    parameters:
+      - {name: id, in: path}
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              examples:
+                ada: {value: {id: 1, name: Ada}}
+                grace: {value: {id: 2, name: Grace}}
+            text/plain:
+              example: Ada
+        "404":
+          description: not found
+    delete:
+      responses:
+        "204":
+          description: deleted
+components:
+  responses:
+    Invalid:
+      content:
+        application/json:
+          example: {error: invalid}
+  schemas:
+    User:
+      type: object
+      properties:
+        id: {type: integer}
+        name: {type: string}
+        email: {type: string, format: email}
+        role: {type: string, enum: [admin, user]}
+        created: {type: string, format: date-time}
+        active: {type: boolean, default: true}
+`
+
+func newMockServer(t *testing.T) *KapetaServer {
+	mock, err := ParseOpenAPIMock([]byte(mockDocument))
+	require.NoError(t, err)
+	s := &KapetaServer{Echo: echo.New()}
+	s.DELETE("/users/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, "deleted by handler")
+	})
+	s.UseMock(mock)
+	return s
+}
+
+func serveMock(s *KapetaServer, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMock(t *testing.T) {
+	s := newMockServer(t)
+
+	t.Run("synthesized from the schema", func(t *testing.T) {
+		rec := serveMock(s, http.MethodGet, "/users", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "true", rec.Header().Get(HeaderXMock))
+		assert.JSONEq(t, `[{"id":0,"name":"string","email":"user@example.com","role":"admin","created":"2023-01-01T00:00:00Z","active":true}]`, rec.Body.String())
+	})
+
+	t.Run("example", func(t *testing.T) {
+		rec := serveMock(s, http.MethodPost, "/users", nil)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id":7,"name":"Ada"}`, rec.Body.String())
+	})
+
+	t.Run("first named example", func(t *testing.T) {
+		rec := serveMock(s, http.MethodGet, "/users/1", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+		assert.JSONEq(t, `{"id":1,"name":"Ada"}`, rec.Body.String())
+	})
+
+	t.Run("preferred example", func(t *testing.T) {
+		rec := serveMock(s, http.MethodGet, "/users/2", http.Header{HeaderPrefer: {"example=grace"}})
+		assert.JSONEq(t, `{"id":2,"name":"Grace"}`, rec.Body.String())
+		assert.Equal(t, "example=grace", rec.Header().Get(HeaderPreferenceApplied))
+	})
+
+	t.Run("accepted content type", func(t *testing.T) {
+		rec := serveMock(s, http.MethodGet, "/users/1", http.Header{echo.HeaderAccept: {"text/plain"}})
+		assert.Equal(t, "text/plain", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "Ada", rec.Body.String())
+	})
+
+	t.Run("preferred code", func(t *testing.T) {
+		rec := serveMock(s, http.MethodGet, "/users/3", http.Header{HeaderPrefer: {"code=404"}})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Empty(t, rec.Body.String())
+		assert.Equal(t, "code=404", rec.Header().Get(HeaderPreferenceApplied))
+	})
+
+	t.Run("response reference", func(t *testing.T) {
+		rec := serveMock(s, http.MethodPost, "/users", http.Header{HeaderPrefer: {"code=400"}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error":"invalid"}`, rec.Body.String())
+	})
+
+	t.Run("handlers win", func(t *testing.T) {
+		rec := serveMock(s, http.MethodDelete, "/users/1", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "deleted by handler", rec.Body.String())
+		assert.Empty(t, rec.Header().Get(HeaderXMock))
+	})
+}
+
+func TestLoadOpenAPIMock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"paths":{"/ping":{"get":{"responses":{"default":{"content":{"application/json":{"example":"pong"}}}}}}}}`), 0o600))
+	mock, err := LoadOpenAPIMock(path)
+	require.NoError(t, err)
+	s := &KapetaServer{Echo: echo.New()}
+	s.UseMock(mock)
+
+	rec := serveMock(s, http.MethodGet, "/ping", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `"pong"`, rec.Body.String())
+
+	_, err = LoadOpenAPIMock(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+	_, err = ParseOpenAPIMock([]byte("paths: ["))
+	assert.Error(t, err)
+}
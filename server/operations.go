@@ -0,0 +1,186 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OperationStatus is the state of a long running operation.
+type OperationStatus string
+
+const (
+	OperationRunning   OperationStatus = "running"
+	OperationSucceeded OperationStatus = "succeeded"
+	OperationFailed    OperationStatus = "failed"
+)
+
+// Operation is the status resource of a long running operation.
+type Operation struct {
+	ID        string          `json:"id"`
+	Status    OperationStatus `json:"status"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	// Result is the JSON encoded result of a succeeded operation.
+	Result json.RawMessage `json:"result,omitempty"`
+	// Error is the error message of a failed operation.
+	Error string `json:"error,omitempty"`
+}
+
+// ErrOperationNotFound is returned by an OperationStore for unknown operation ids.
+var ErrOperationNotFound = errors.New("operation not found")
+
+// OperationStore persists operations. Use a shared store, like a database, when the
+// service runs more than one instance.
+type OperationStore interface {
+	Save(ctx context.Context, op Operation) error
+	// Get returns ErrOperationNotFound for unknown ids.
+	Get(ctx context.Context, id string) (Operation, error)
+}
+
+// MemoryOperationStore is an OperationStore keeping operations in memory, for tests
+// and single instance services. Operations are kept until the process exits.
+type MemoryOperationStore struct {
+	mu         sync.RWMutex
+	operations map[string]Operation
+}
+
+// NewMemoryOperationStore creates an empty MemoryOperationStore.
+func NewMemoryOperationStore() *MemoryOperationStore {
+	return &MemoryOperationStore{operations: map[string]Operation{}}
+}
+
+func (s *MemoryOperationStore) Save(_ context.Context, op Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations[op.ID] = op
+	return nil
+}
+
+func (s *MemoryOperationStore) Get(_ context.Context, id string) (Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	op, ok := s.operations[id]
+	if !ok {
+		return Operation{}, ErrOperationNotFound
+	}
+	return op, nil
+}
+
+// Operations runs long running operations in the background and serves their status.
+type Operations struct {
+	store    OperationStore
+	basePath string
+}
+
+// UseOperations registers GET {basePath}/:id serving the status of operations started
+// with Operations.Start, "/operations" by default.
+//
+// Usage:
+//
+//	ops := s.UseOperations(server.NewMemoryOperationStore(), "")
+//	s.POST("/exports", func(c echo.Context) error {
+//		return ops.Start(c, func(ctx context.Context) (any, error) {
+//			return runExport(ctx)
+//		})
+//	})
+func (s *KapetaServer) UseOperations(store OperationStore, basePath string) *Operations {
+	if basePath == "" {
+		basePath = "/operations"
+	}
+	ops := &Operations{store: store, basePath: strings.TrimSuffix(basePath, "/")}
+	s.GET(ops.basePath+"/:id", ops.getOperation)
+	return ops
+}
+
+// Start runs the function in the background and responds with 202 Accepted, the
+// operation as body and its status resource as Location. The function's context is
+// not canceled when the request ends, and it must not use the echo context, which is
+// reused for other requests. Its result is stored JSON encoded. A panic of the function
+// is logged and fails the operation.
+func (o *Operations) Start(c echo.Context, run func(ctx context.Context) (any, error)) error {
+	id, err := newRandomID()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	op := Operation{ID: id, Status: OperationRunning, CreatedAt: now, UpdatedAt: now}
+	if err := o.store.Save(c.Request().Context(), op); err != nil {
+		return err
+	}
+
+	ctx := context.WithoutCancel(c.Request().Context())
+	logger := c.Logger()
+	// the goroutine updates its own copy, the response is written from op
+	go func(running Operation) {
+		result, err := runOperation(ctx, run, func(r any, stack []byte) {
+			logger.Errorf("operation %s panicked: %v\n%s", running.ID, r, stack)
+		})
+		finished := running
+		finished.UpdatedAt = time.Now().UTC()
+		if err == nil {
+			finished.Result, err = json.Marshal(result)
+		}
+		if err != nil {
+			finished.Status = OperationFailed
+			finished.Error = err.Error()
+			finished.Result = nil
+		} else {
+			finished.Status = OperationSucceeded
+		}
+		if err := o.store.Save(ctx, finished); err != nil {
+			logger.Errorf("saving operation %s: %v", finished.ID, err)
+		}
+	}(op)
+
+	c.Response().Header().Set(echo.HeaderLocation, o.basePath+"/"+id)
+	return c.JSON(http.StatusAccepted, op)
+}
+
+func (o *Operations) getOperation(c echo.Context) error {
+	op, err := o.store.Get(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, ErrOperationNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "operation not found")
+	}
+	if err != nil {
+		return err
+	}
+	if op.Status == OperationRunning {
+		c.Response().Header().Set(echo.HeaderRetryAfter, "1")
+	}
+	return c.JSON(http.StatusOK, op)
+}
+
+// errOperationPanicked fails an operation whose function panicked.
+var errOperationPanicked = errors.New("operation panicked")
+
+// runOperation runs the function, failing the operation instead of the process when it
+// panics. The panic is passed to onPanic with its stack trace.
+func runOperation(ctx context.Context, run func(ctx context.Context) (any, error), onPanic func(r any, stack []byte)) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			onPanic(r, debug.Stack())
+			result, err = nil, errOperationPanicked
+		}
+	}()
+	return run(ctx)
+}
+
+func newRandomID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
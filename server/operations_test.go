@@ -0,0 +1,87 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperations(t *testing.T) {
+	s := New()
+	ops := s.UseOperations(NewMemoryOperationStore(), "")
+	release := make(chan struct{})
+	s.POST("/exports", func(c echo.Context) error {
+		fail := c.QueryParam("fail") == "true"
+		crash := c.QueryParam("panic") == "true"
+		return ops.Start(c, func(ctx context.Context) (any, error) {
+			<-release
+			if crash {
+				panic("export crashed")
+			}
+			if fail {
+				return nil, errors.New("export failed")
+			}
+			return echo.Map{"url": "/files/export.csv"}, nil
+		})
+	})
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+	getOperation := func(location string) Operation {
+		rec := serve(http.MethodGet, location)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var op Operation
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &op))
+		return op
+	}
+
+	rec := serve(http.MethodPost, "/exports")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	location := rec.Header().Get(echo.HeaderLocation)
+	var started Operation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &started))
+	assert.Equal(t, "/operations/"+started.ID, location)
+	assert.Equal(t, OperationRunning, started.Status)
+
+	rec = serve(http.MethodGet, location)
+	assert.Equal(t, "1", rec.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, OperationRunning, getOperation(location).Status)
+
+	release <- struct{}{}
+	require.Eventually(t, func() bool {
+		return getOperation(location).Status == OperationSucceeded
+	}, time.Second, time.Millisecond)
+	assert.JSONEq(t, `{"url": "/files/export.csv"}`, string(getOperation(location).Result))
+
+	rec = serve(http.MethodPost, "/exports?fail=true")
+	location = rec.Header().Get(echo.HeaderLocation)
+	release <- struct{}{}
+	require.Eventually(t, func() bool {
+		return getOperation(location).Status == OperationFailed
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "export failed", getOperation(location).Error)
+
+	// a panic fails the operation, not the process
+	rec = serve(http.MethodPost, "/exports?panic=true")
+	location = rec.Header().Get(echo.HeaderLocation)
+	release <- struct{}{}
+	require.Eventually(t, func() bool {
+		return getOperation(location).Status == OperationFailed
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "operation panicked", getOperation(location).Error)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/operations/unknown").Code)
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/netutil"
+)
+
+// Options holds the connection level settings used by StartWithOptions.
+// The zero value gives the same behaviour as Start.
+type Options struct {
+	// DisableKeepAlives closes every connection after a single request.
+	DisableKeepAlives bool
+	// IdleTimeout is how long an idle keep-alive connection is kept open.
+	// Zero keeps the idle timeout of the http.Server, which falls back to its read timeout
+	// when unset.
+	IdleTimeout time.Duration
+	// TCPKeepAlive is the period between TCP keep-alive probes on accepted connections.
+	// Zero uses the Go default, a negative value disables the probes.
+	TCPKeepAlive time.Duration
+	// MaxConnections limits the number of simultaneously accepted connections.
+	// Zero means unlimited.
+	MaxConnections int
+	// Control is called with the raw listening socket before it is bound, and can
+	// be used to set socket options such as SO_REUSEPORT.
+	Control func(network, address string, c syscall.RawConn) error
+}
+
+// Listen creates a listener for the address configured with the given options. In a
+// process started by Handover, the first call returns the socket passed by the previous
+// process instead.
+func (s *KapetaServer) Listen(address string, opts Options) (net.Listener, error) {
+	l, err := inheritedListener()
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		network := s.ListenerNetwork
+		if network == "" {
+			network = "tcp"
+		}
+		lc := net.ListenConfig{
+			KeepAlive: opts.TCPKeepAlive,
+			Control:   opts.Control,
+		}
+		l, err = lc.Listen(context.Background(), network, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.socket = l
+	if opts.MaxConnections > 0 {
+		l = netutil.LimitListener(l, opts.MaxConnections)
+	}
+	return l, nil
+}
+
+// StartWithOptions starts the HTTP server on the address using the given connection options.
+func (s *KapetaServer) StartWithOptions(address string, opts Options) error {
+	l, err := s.Listen(address, opts)
+	if err != nil {
+		return err
+	}
+	return s.startWithListener(address, l, opts)
+}
+
+// StartWithListener starts the HTTP server on a listener bound elsewhere, like a socket
+// passed by systemd, see SystemdListeners, or bound to a privileged port before
+// dropping privileges. TCPKeepAlive and Control do not apply, as the listener is bound,
+// the other options do.
+func (s *KapetaServer) StartWithListener(l net.Listener, opts Options) error {
+	s.socket = l
+	if opts.MaxConnections > 0 {
+		l = netutil.LimitListener(l, opts.MaxConnections)
+	}
+	return s.startWithListener(l.Addr().String(), l, opts)
+}
+
+func (s *KapetaServer) startWithListener(address string, l net.Listener, opts Options) error {
+	s.Listener = l
+	if opts.IdleTimeout != 0 {
+		// keep an idle timeout set on the http.Server
+		s.Server.IdleTimeout = opts.IdleTimeout
+	}
+	s.Server.SetKeepAlivesEnabled(!opts.DisableKeepAlives)
+	return s.Start(address)
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListen(t *testing.T) {
+	t.Run("control is applied", func(t *testing.T) {
+		called := false
+		s := New()
+		l, err := s.Listen("127.0.0.1:0", Options{
+			Control: func(network, address string, c syscall.RawConn) error {
+				called = true
+				return nil
+			},
+		})
+		assert.NoError(t, err)
+		defer l.Close()
+		assert.True(t, called)
+	})
+	t.Run("max connections", func(t *testing.T) {
+		s := New()
+		l, err := s.Listen("127.0.0.1:0", Options{MaxConnections: 1})
+		assert.NoError(t, err)
+		defer l.Close()
+
+		first, err := net.Dial("tcp", l.Addr().String())
+		assert.NoError(t, err)
+		defer first.Close()
+		accepted, err := l.Accept()
+		assert.NoError(t, err)
+
+		second, err := net.Dial("tcp", l.Addr().String())
+		assert.NoError(t, err)
+		defer second.Close()
+
+		done := make(chan struct{})
+		go func() {
+			conn, err := l.Accept()
+			if err == nil {
+				conn.Close()
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("second connection accepted while the limit was reached")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// releasing the first connection frees a slot
+		accepted.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("second connection was never accepted")
+		}
+	})
+}
+
+func TestStartWithOptions(t *testing.T) {
+	s := NewWithDefaults()
+	s.HideBanner = true
+	s.HidePort = true
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.StartWithOptions("127.0.0.1:0", Options{DisableKeepAlives: true, IdleTimeout: time.Second})
+	}()
+
+	var addr net.Addr
+	assert.Eventually(t, func() bool {
+		addr = s.ListenerAddr()
+		return addr != nil
+	}, time.Second, 10*time.Millisecond)
+
+	res, err := http.Get("http://" + addr.String() + "/.kapeta/health")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "OK", string(body))
+	assert.True(t, res.Close)
+	assert.Equal(t, time.Second, s.Server.IdleTimeout)
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.ErrorIs(t, <-errs, http.ErrServerClosed)
+}
+
+func TestStartWithListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := NewWithDefaults()
+	s.HideBanner = true
+	s.HidePort = true
+	s.Server.IdleTimeout = time.Minute
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.StartWithListener(l, Options{MaxConnections: 10})
+	}()
+	assert.Eventually(t, func() bool {
+		return s.ListenerAddr() != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, l.Addr().String(), s.ListenerAddr().String())
+	assert.Equal(t, time.Minute, s.Server.IdleTimeout)
+
+	res, err := http.Get("http://" + l.Addr().String() + "/.kapeta/health")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "OK", string(body))
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.ErrorIs(t, <-errs, http.ErrServerClosed)
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Plugin is an optional feature, like metrics, authentication or server-sent events,
+// or a third-party extension, composed into the server by UsePlugins. Embed BasePlugin
+// to implement only the methods the plugin needs.
+type Plugin interface {
+	// Name identifies the plugin, it must be unique on the server.
+	Name() string
+	// Init is called once when the plugin is registered, before its middlewares, routes
+	// and health checks are added.
+	Init(s *KapetaServer) error
+	// Middlewares are added to the server with Use, in order.
+	Middlewares() []echo.MiddlewareFunc
+	// Routes are added to the server.
+	Routes() []PluginRoute
+	// HealthChecks are registered on the Health registry passed to UsePlugins, named
+	// after the plugin, like "metrics/exporter" for the "exporter" check of "metrics".
+	HealthChecks() map[string]HealthCheck
+}
+
+// PluginRoute is a route added by a Plugin.
+type PluginRoute struct {
+	Method      string
+	Path        string
+	Handler     echo.HandlerFunc
+	Middlewares []echo.MiddlewareFunc
+}
+
+// BasePlugin implements the Plugin methods other than Name with no effect.
+type BasePlugin struct{}
+
+func (BasePlugin) Init(*KapetaServer) error { return nil }
+
+func (BasePlugin) Middlewares() []echo.MiddlewareFunc { return nil }
+
+func (BasePlugin) Routes() []PluginRoute { return nil }
+
+func (BasePlugin) HealthChecks() map[string]HealthCheck { return nil }
+
+// UsePlugins initializes the plugins in order and adds their middlewares, routes and
+// health checks to the server. The health checks are registered on health, which may
+// be nil when no plugin has health checks. It stops at the first failing plugin.
+func (s *KapetaServer) UsePlugins(health *Health, plugins ...Plugin) error {
+	for _, p := range plugins {
+		name := p.Name()
+		if name == "" {
+			return errors.New("plugin without a name")
+		}
+		if s.Plugin(name) != nil {
+			return fmt.Errorf("plugin %s: already registered", name)
+		}
+		checks := p.HealthChecks()
+		if len(checks) > 0 && health == nil {
+			return fmt.Errorf("plugin %s: health checks need a Health registry", name)
+		}
+
+		if err := p.Init(s); err != nil {
+			return fmt.Errorf("plugin %s: %w", name, err)
+		}
+		s.Use(p.Middlewares()...)
+		for _, route := range p.Routes() {
+			s.Add(route.Method, route.Path, route.Handler, route.Middlewares...)
+		}
+		for check, fn := range checks {
+			health.Register(name+"/"+check, fn, 0)
+		}
+		s.plugins = append(s.plugins, p)
+	}
+	return nil
+}
+
+// Plugin returns the registered plugin with the name, or nil.
+func (s *KapetaServer) Plugin(name string) Plugin {
+	for _, p := range s.plugins {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Plugins returns the registered plugins, in registration order.
+func (s *KapetaServer) Plugins() []Plugin {
+	return append([]Plugin(nil), s.plugins...)
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPlugin struct {
+	BasePlugin
+	name    string
+	initErr error
+	server  *KapetaServer
+}
+
+func (p *testPlugin) Name() string { return p.name }
+
+func (p *testPlugin) Init(s *KapetaServer) error {
+	p.server = s
+	return p.initErr
+}
+
+func (p *testPlugin) Middlewares() []echo.MiddlewareFunc {
+	return []echo.MiddlewareFunc{func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Add("X-Plugin", p.name)
+			return next(c)
+		}
+	}}
+}
+
+func (p *testPlugin) Routes() []PluginRoute {
+	return []PluginRoute{{
+		Method: http.MethodGet,
+		Path:   "/" + p.name,
+		Handler: func(c echo.Context) error {
+			return c.String(http.StatusOK, p.name)
+		},
+	}}
+}
+
+func (p *testPlugin) HealthChecks() map[string]HealthCheck {
+	return map[string]HealthCheck{"ready": func(ctx context.Context) error { return nil }}
+}
+
+type namedPlugin struct {
+	BasePlugin
+}
+
+func (namedPlugin) Name() string { return "named" }
+
+func TestUsePlugins(t *testing.T) {
+	s := New()
+	health := NewHealth(DefaultHealthConfig)
+	metrics := &testPlugin{name: "metrics"}
+	sse := &testPlugin{name: "sse"}
+	assert.NoError(t, s.UsePlugins(health, metrics, sse, namedPlugin{}))
+	assert.Same(t, s, metrics.server)
+	assert.Equal(t, []Plugin{metrics, sse, namedPlugin{}}, s.Plugins())
+	assert.Same(t, sse, s.Plugin("sse"))
+	assert.Nil(t, s.Plugin("auth"))
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sse", nil))
+	assert.Equal(t, "sse", rec.Body.String())
+	assert.Equal(t, []string{"metrics", "sse"}, rec.Header().Values("X-Plugin"))
+
+	report := health.Check(context.Background())
+	assert.Contains(t, report.Checks, "metrics/ready")
+	assert.Contains(t, report.Checks, "sse/ready")
+}
+
+func TestUsePluginsErrors(t *testing.T) {
+	s := New()
+	assert.EqualError(t, s.UsePlugins(nil, &testPlugin{name: "metrics"}), "plugin metrics: health checks need a Health registry")
+	assert.Empty(t, s.Plugins())
+
+	health := NewHealth(DefaultHealthConfig)
+	failing := &testPlugin{name: "auth", initErr: errors.New("missing key")}
+	err := s.UsePlugins(health, &testPlugin{name: "metrics"}, failing, namedPlugin{})
+	assert.ErrorIs(t, err, failing.initErr)
+	assert.EqualError(t, err, "plugin auth: missing key")
+	assert.Len(t, s.Plugins(), 1)
+
+	assert.EqualError(t, s.UsePlugins(health, &testPlugin{name: "metrics"}), "plugin metrics: already registered")
+	assert.EqualError(t, s.UsePlugins(health, &testPlugin{}), "plugin without a name")
+}
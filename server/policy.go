@@ -0,0 +1,202 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyRule is an access rule for the requests matching its path and methods.
+type PolicyRule struct {
+	// Path is matched against the request path. A segment like :id or * matches any
+	// single segment, and a last segment * matches the rest of the path.
+	Path string `yaml:"path"`
+	// Methods limits the rule to some methods, all methods when empty.
+	Methods []string `yaml:"methods"`
+	// Public allows requests without authentication.
+	Public bool `yaml:"public"`
+	// Scopes must all be granted to the caller.
+	Scopes []string `yaml:"scopes"`
+	// Roles requires the caller to have one of the roles.
+	Roles []string `yaml:"roles"`
+	// Tenant requires a tenant for the request, see TenantKey.
+	Tenant bool `yaml:"tenant"`
+	// TenantParam is a path parameter which must be the tenant of the request.
+	TenantParam string `yaml:"tenantParam"`
+}
+
+// Policy is a list of access rules, evaluated in order: the first rule matching a
+// request decides. Requests matching no rule are denied with DefaultDeny.
+type Policy struct {
+	DefaultDeny bool         `yaml:"defaultDeny"`
+	Rules       []PolicyRule `yaml:"rules"`
+}
+
+// ParsePolicy parses a YAML or JSON policy document:
+//
+//	defaultDeny: true
+//	rules:
+//	  - path: /health
+//	    public: true
+//	  - path: /tenants/:tenant/*
+//	    scopes: [orders:read]
+//	    tenantParam: tenant
+//	  - path: /admin/*
+//	    methods: [POST, DELETE]
+//	    roles: [admin]
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	// YAML is a superset of JSON, so the parser reads both
+	err := yaml.Unmarshal(data, policy)
+	if err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	for i, rule := range policy.Rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("parse policy: rule %d: path %q must start with /", i, rule.Path)
+		}
+	}
+	return policy, nil
+}
+
+// LoadPolicy reads a policy document from a file, see ParsePolicy.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// Middleware returns a middleware enforcing the policy with the claims stored under
+// AuthClaimsKey by the authentication middleware, which must run before it. Granted
+// scopes are read from the "scope" claim, a space separated list, or the "scopes" claim,
+// and roles from the "roles" claim. Requests without claims are rejected with 401
+// Unauthorized, and requests not allowed by the matching rule with 403 Forbidden.
+func (p *Policy) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			rule, ok := p.match(c.Request())
+			if !ok {
+				if p.DefaultDeny {
+					return echo.ErrForbidden
+				}
+				return next(c)
+			}
+			if rule.Public {
+				return next(c)
+			}
+			claims, ok := Get(c, AuthClaimsKey)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
+			if !rule.allows(c, claims) {
+				return echo.ErrForbidden
+			}
+			return next(c)
+		}
+	}
+}
+
+func (p *Policy) match(req *http.Request) (*PolicyRule, bool) {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if len(rule.Methods) > 0 && !containsFold(rule.Methods, req.Method) {
+			continue
+		}
+		if matchPolicyPath(rule.Path, req.URL.Path) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+func (r *PolicyRule) allows(c echo.Context, claims map[string]any) bool {
+	granted := claimStrings(claims, "scopes")
+	if scope, ok := claims["scope"].(string); ok {
+		granted = append(granted, strings.Fields(scope)...)
+	}
+	for _, scope := range r.Scopes {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	if len(r.Roles) > 0 {
+		roles := claimStrings(claims, "roles")
+		found := false
+		for _, role := range r.Roles {
+			found = found || slices.Contains(roles, role)
+		}
+		if !found {
+			return false
+		}
+	}
+	tenant, hasTenant := Get(c, TenantKey)
+	if (r.Tenant || r.TenantParam != "") && (!hasTenant || tenant == "") {
+		return false
+	}
+	if r.TenantParam != "" && pathSegment(c.Request().URL.Path, r.tenantParamIndex()) != tenant {
+		return false
+	}
+	return true
+}
+
+// tenantParamIndex returns the index of the TenantParam segment of the path. The value
+// is read from the request path, since the policy may run before the route is matched.
+func (r *PolicyRule) tenantParamIndex() int {
+	for i, segment := range strings.Split(r.Path, "/") {
+		if segment == ":"+r.TenantParam {
+			return i
+		}
+	}
+	return -1
+}
+
+func pathSegment(path string, index int) string {
+	segments := strings.Split(path, "/")
+	if index < 0 || index >= len(segments) {
+		return ""
+	}
+	return segments[index]
+}
+
+func matchPolicyPath(pattern, path string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	for i, segment := range patternSegments {
+		if i >= len(pathSegments) {
+			return false
+		}
+		if segment == "*" && i == len(patternSegments)-1 {
+			return true
+		}
+		if segment != "*" && !strings.HasPrefix(segment, ":") && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
+
+// claimStrings returns a claim holding a list of strings.
+func claimStrings(claims map[string]any, name string) []string {
+	switch values := claims[name].(type) {
+	case []string:
+		return values
+	case []any:
+		strs := make([]string, 0, len(values))
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
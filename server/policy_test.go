@@ -0,0 +1,109 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+defaultDeny: true
+rules:
+  - path: /health
+    public: true
+  - path: /tenants/:tenant/*
+    scopes: [orders:read]
+    tenantParam: tenant
+  - path: /admin/*
+    methods: [post, DELETE]
+    roles: [admin, ops]
+  - path: /admin/*
+    methods: [GET]
+`
+
+func TestPolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims := map[string]any{}
+			switch c.Request().Header.Get("X-User") {
+			case "":
+				return next(c)
+			case "reader":
+				claims["scope"] = "orders:read profile"
+			case "admin":
+				claims["roles"] = []any{"admin"}
+			}
+			Set(c, AuthClaimsKey, claims)
+			if tenant := c.Request().Header.Get("X-Tenant"); tenant != "" {
+				Set(c, TenantKey, tenant)
+			}
+			return next(c)
+		}
+	}, policy.Middleware())
+	e.Any("/*", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		method, path, user, tenant string
+		status                     int
+	}{
+		{http.MethodGet, "/health", "", "", http.StatusOK},
+		{http.MethodGet, "/tenants/acme/orders", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/tenants/acme/orders", "reader", "acme", http.StatusOK},
+		{http.MethodGet, "/tenants/acme/orders/1", "reader", "globex", http.StatusForbidden},
+		{http.MethodGet, "/tenants/acme/orders", "reader", "", http.StatusForbidden},
+		{http.MethodGet, "/tenants/acme/orders", "admin", "acme", http.StatusForbidden},
+		{http.MethodPost, "/admin/users", "admin", "", http.StatusOK},
+		{http.MethodDelete, "/admin/users", "reader", "", http.StatusForbidden},
+		{http.MethodGet, "/admin/users", "reader", "", http.StatusOK},
+		{http.MethodGet, "/other", "admin", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-User", tt.user)
+		req.Header.Set("X-Tenant", tt.tenant)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, "%s %s as %q", tt.method, tt.path, tt.user)
+	}
+}
+
+func TestParsePolicyJSON(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"rules": [{"path": "/users/*", "scopes": ["users:read"]}]}`))
+	require.NoError(t, err)
+	assert.False(t, policy.DefaultDeny)
+	assert.Equal(t, []PolicyRule{{Path: "/users/*", Scopes: []string{"users:read"}}}, policy.Rules)
+
+	_, err = ParsePolicy([]byte(`{"rules": [{"path": "users"}]}`))
+	assert.EqualError(t, err, `parse policy: rule 0: path "users" must start with /`)
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testPolicy), 0o600))
+	policy, err := LoadPolicy(path)
+	require.NoError(t, err)
+	assert.Len(t, policy.Rules, 4)
+}
+
+func TestMatchPolicyPath(t *testing.T) {
+	assert.True(t, matchPolicyPath("/users/:id", "/users/1"))
+	assert.False(t, matchPolicyPath("/users/:id", "/users/1/posts"))
+	assert.True(t, matchPolicyPath("/users/*", "/users/1/posts"))
+	assert.True(t, matchPolicyPath("/users/*", "/users/"))
+	assert.False(t, matchPolicyPath("/users/*", "/users"))
+	assert.True(t, matchPolicyPath("/users/*/posts", "/users/1/posts"))
+}
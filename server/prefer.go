@@ -0,0 +1,107 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// HeaderPrefer is the request header with the client preferences of RFC 7240.
+	HeaderPrefer = "Prefer"
+	// HeaderPreferenceApplied is the response header listing the honored preferences.
+	HeaderPreferenceApplied = "Preference-Applied"
+)
+
+// Values of the return preference.
+const (
+	ReturnMinimal        = "minimal"
+	ReturnRepresentation = "representation"
+)
+
+// Preferences are the preferences of a Prefer header.
+type Preferences struct {
+	// Return is "minimal", "representation" or empty.
+	Return string
+	// RespondAsync asks for a 202 Accepted instead of waiting for a long running operation.
+	RespondAsync bool
+	// Wait is the time the client is willing to wait for the response, 0 if not set.
+	Wait time.Duration
+	// Handling is "strict", "lenient" or empty.
+	Handling string
+	// Values holds every preference by lower case name, with its value or "" for flags.
+	Values map[string]string
+}
+
+// ParsePrefer parses the Prefer headers of a request. Parameters of a preference are
+// ignored, and the first occurrence of a preference wins, as RFC 7240 requires.
+func ParsePrefer(header http.Header) Preferences {
+	prefs := Preferences{Values: map[string]string{}}
+	for _, line := range header.Values(HeaderPrefer) {
+		for _, preference := range strings.Split(line, ",") {
+			preference, _, _ = strings.Cut(preference, ";")
+			name, value, _ := strings.Cut(strings.TrimSpace(preference), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, ok := prefs.Values[name]; ok {
+				continue
+			}
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			prefs.Values[name] = value
+			switch name {
+			case "return":
+				prefs.Return = strings.ToLower(value)
+			case "respond-async":
+				prefs.RespondAsync = true
+			case "wait":
+				if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+					prefs.Wait = time.Duration(seconds) * time.Second
+				}
+			case "handling":
+				prefs.Handling = strings.ToLower(value)
+			}
+		}
+	}
+	return prefs
+}
+
+// Prefer returns the preferences of the request of the echo context.
+func Prefer(c echo.Context) Preferences {
+	return ParsePrefer(c.Request().Header)
+}
+
+// PreferenceApplied adds a preference to the Preference-Applied header of the response.
+func PreferenceApplied(c echo.Context, preference string) {
+	c.Response().Header().Add(HeaderPreferenceApplied, preference)
+}
+
+// JSONPreferred responds to a create or update honoring the return preference: with
+// return=minimal the body is left out, and a 200 becomes 204 No Content, while other
+// statuses like 201 Created are kept with their Location header. Otherwise the body is
+// written as JSON. The applied preference is reported in Preference-Applied.
+//
+// Usage:
+//
+//	c.Response().Header().Set(echo.HeaderLocation, "/users/"+user.ID)
+//	return server.JSONPreferred(c, http.StatusCreated, user)
+func JSONPreferred(c echo.Context, status int, body any) error {
+	c.Response().Header().Add(echo.HeaderVary, HeaderPrefer)
+	switch Prefer(c).Return {
+	case ReturnMinimal:
+		PreferenceApplied(c, "return="+ReturnMinimal)
+		if status == http.StatusOK {
+			status = http.StatusNoContent
+		}
+		return c.NoContent(status)
+	case ReturnRepresentation:
+		PreferenceApplied(c, "return="+ReturnRepresentation)
+	}
+	return c.JSON(status, body)
+}
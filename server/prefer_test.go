@@ -0,0 +1,76 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrefer(t *testing.T) {
+	header := http.Header{}
+	header.Add(HeaderPrefer, `return=minimal; foo="bar", respond-async`)
+	header.Add(HeaderPrefer, `wait=10, handling=Lenient, return=representation, custom="x"`)
+
+	prefs := ParsePrefer(header)
+	assert.Equal(t, ReturnMinimal, prefs.Return)
+	assert.True(t, prefs.RespondAsync)
+	assert.Equal(t, 10*time.Second, prefs.Wait)
+	assert.Equal(t, "lenient", prefs.Handling)
+	assert.Equal(t, "x", prefs.Values["custom"])
+	assert.Equal(t, "", prefs.Values["respond-async"])
+
+	assert.Equal(t, Preferences{Values: map[string]string{}}, ParsePrefer(http.Header{}))
+}
+
+func TestJSONPreferred(t *testing.T) {
+	e := echo.New()
+	e.PUT("/users/1", func(c echo.Context) error {
+		return JSONPreferred(c, http.StatusOK, echo.Map{"id": 1})
+	})
+	e.POST("/users", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderLocation, "/users/1")
+		return JSONPreferred(c, http.StatusCreated, echo.Map{"id": 1})
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		prefer  string
+		code    int
+		body    string
+		applied string
+	}{
+		{name: "update minimal", method: http.MethodPut, path: "/users/1", prefer: "return=minimal", code: http.StatusNoContent, applied: "return=minimal"},
+		{name: "update representation", method: http.MethodPut, path: "/users/1", prefer: "return=representation", code: http.StatusOK, body: `{"id":1}`, applied: "return=representation"},
+		{name: "update without preference", method: http.MethodPut, path: "/users/1", code: http.StatusOK, body: `{"id":1}`},
+		{name: "create minimal", method: http.MethodPost, path: "/users", prefer: "return=minimal", code: http.StatusCreated, applied: "return=minimal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.prefer != "" {
+				req.Header.Set(HeaderPrefer, tt.prefer)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.code, rec.Code)
+			if tt.body == "" {
+				assert.Empty(t, rec.Body.String())
+			} else {
+				assert.JSONEq(t, tt.body, rec.Body.String())
+			}
+			assert.Equal(t, tt.applied, rec.Header().Get(HeaderPreferenceApplied))
+			if tt.method == http.MethodPost {
+				assert.Equal(t, "/users/1", rec.Header().Get(echo.HeaderLocation))
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Quota headers, see the IETF RateLimit header fields draft.
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+)
+
+// QuotaPolicy allows Limit requests per Window. Windows are fixed and aligned to UTC,
+// so a daily quota resets at midnight UTC.
+type QuotaPolicy struct {
+	Limit  int64
+	Window time.Duration
+}
+
+// PerMinute returns a policy allowing limit requests per minute.
+func PerMinute(limit int64) QuotaPolicy {
+	return QuotaPolicy{Limit: limit, Window: time.Minute}
+}
+
+// PerHour returns a policy allowing limit requests per hour.
+func PerHour(limit int64) QuotaPolicy {
+	return QuotaPolicy{Limit: limit, Window: time.Hour}
+}
+
+// Daily returns a policy allowing limit requests per day.
+func Daily(limit int64) QuotaPolicy {
+	return QuotaPolicy{Limit: limit, Window: 24 * time.Hour}
+}
+
+// QuotaStore keeps the request counters of the quota windows. Use a shared store, like
+// Redis, so counters persist across restarts and are shared by all instances.
+type QuotaStore interface {
+	// Increment adds delta to the counter of the key and returns the new count. The
+	// counter can be dropped after expires. A negative delta takes back the requests of
+	// a rejected request.
+	Increment(ctx context.Context, key string, delta int64, expires time.Time) (int64, error)
+}
+
+// MemoryQuotaStore is a QuotaStore keeping counters in memory until they expire.
+type MemoryQuotaStore struct {
+	mu        sync.Mutex
+	counters  map[string]quotaCounter
+	nextPrune time.Time
+	now       func() time.Time
+}
+
+type quotaCounter struct {
+	count   int64
+	expires time.Time
+}
+
+// NewMemoryQuotaStore creates an empty MemoryQuotaStore.
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{counters: map[string]quotaCounter{}, now: time.Now}
+}
+
+func (s *MemoryQuotaStore) Increment(_ context.Context, key string, delta int64, expires time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	// prune at most once a minute, so the map stays bounded by the active windows
+	if !now.Before(s.nextPrune) {
+		for k, counter := range s.counters {
+			if !now.Before(counter.expires) {
+				delete(s.counters, k)
+			}
+		}
+		s.nextPrune = now.Add(time.Minute)
+	}
+	counter := s.counters[key]
+	counter.count += delta
+	counter.expires = expires
+	s.counters[key] = counter
+	return counter.count, nil
+}
+
+// QuotaConfig configures the Quota middleware.
+type QuotaConfig struct {
+	// Policies apply to every tenant without its own policies.
+	Policies []QuotaPolicy
+	// TenantPolicies replaces the policies for some tenants, like those on a paid plan.
+	TenantPolicies map[string][]QuotaPolicy
+	// Store keeps the counters. Defaults to a MemoryQuotaStore.
+	Store QuotaStore
+	// TenantFunc returns the tenant of the request, or false for requests without quota.
+	// Defaults to the tenant stored under TenantKey.
+	TenantFunc func(c echo.Context) (string, bool)
+
+	now func() time.Time
+}
+
+// Quota returns a middleware enforcing request quotas per tenant, rejecting requests over
+// a quota with 429 Too Many Requests and a Retry-After header. Rejected requests do not
+// count against any quota, so retrying over the minute quota does not use up the daily
+// one. Responses carry the RateLimit headers of the policy with the fewest remaining
+// requests.
+//
+// Usage:
+//
+//	s.Use(server.Quota(server.QuotaConfig{
+//		Policies:       []server.QuotaPolicy{server.PerMinute(100), server.Daily(10_000)},
+//		TenantPolicies: map[string][]server.QuotaPolicy{"acme": {server.PerMinute(1000)}},
+//	}))
+func Quota(config QuotaConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryQuotaStore()
+	}
+	if config.TenantFunc == nil {
+		config.TenantFunc = func(c echo.Context) (string, bool) {
+			return Get(c, TenantKey)
+		}
+	}
+	if config.now == nil {
+		config.now = time.Now
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tenant, ok := config.TenantFunc(c)
+			if !ok {
+				return next(c)
+			}
+			policies, ok := config.TenantPolicies[tenant]
+			if !ok {
+				policies = config.Policies
+			}
+			if len(policies) == 0 {
+				return next(c)
+			}
+
+			now := config.now().UTC()
+			type window struct {
+				key   string
+				end   time.Time
+				count int64
+			}
+			windows := make([]window, len(policies))
+			exceeded := false
+			for i, policy := range policies {
+				start := now.Truncate(policy.Window)
+				w := window{
+					key: "quota:" + tenant + ":" + policy.Window.String() + ":" + strconv.FormatInt(start.Unix(), 10),
+					end: start.Add(policy.Window),
+				}
+				var err error
+				w.count, err = config.Store.Increment(c.Request().Context(), w.key, 1, w.end)
+				if err != nil {
+					return err
+				}
+				windows[i] = w
+				if w.count > policy.Limit {
+					exceeded = true
+				}
+			}
+			if exceeded {
+				// a rejected request is not counted
+				for i, w := range windows {
+					count, err := config.Store.Increment(c.Request().Context(), w.key, -1, w.end)
+					if err != nil {
+						return err
+					}
+					windows[i].count = count
+				}
+			}
+
+			var tightest struct {
+				policy    QuotaPolicy
+				remaining int64
+				reset     time.Duration
+			}
+			for i, policy := range policies {
+				remaining, reset := max(0, policy.Limit-windows[i].count), windows[i].end.Sub(now)
+				// on a tie the later reset is reported, so Retry-After covers all exceeded quotas
+				if i == 0 || remaining < tightest.remaining || remaining == tightest.remaining && reset > tightest.reset {
+					tightest.policy, tightest.remaining, tightest.reset = policy, remaining, reset
+				}
+			}
+
+			header := c.Response().Header()
+			resetSeconds := strconv.FormatInt(int64((tightest.reset+time.Second-1)/time.Second), 10)
+			header.Set(HeaderRateLimitLimit, strconv.FormatInt(tightest.policy.Limit, 10))
+			header.Set(HeaderRateLimitRemaining, strconv.FormatInt(tightest.remaining, 10))
+			header.Set(HeaderRateLimitReset, resetSeconds)
+			if exceeded {
+				header.Set(echo.HeaderRetryAfter, resetSeconds)
+				return echo.NewHTTPError(http.StatusTooManyRequests, "quota exceeded")
+			}
+			return next(c)
+		}
+	}
+}
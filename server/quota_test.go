@@ -0,0 +1,94 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 58, 30, 0, time.UTC)
+	config := QuotaConfig{
+		Policies:       []QuotaPolicy{PerMinute(2), Daily(3)},
+		TenantPolicies: map[string][]QuotaPolicy{"acme": {PerMinute(100)}},
+		now:            func() time.Time { return now },
+	}
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if tenant := c.QueryParam("tenant"); tenant != "" {
+				Set(c, TenantKey, tenant)
+			}
+			return next(c)
+		}
+	}, Quota(config))
+
+	serve := func(tenant string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?tenant="+tenant, nil))
+		return rec
+	}
+
+	rec := serve("globex")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "30", rec.Header().Get(HeaderRateLimitReset))
+
+	assert.Equal(t, http.StatusOK, serve("globex").Code)
+	for i := 0; i < 3; i++ {
+		rec = serve("globex")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "30", rec.Header().Get(echo.HeaderRetryAfter))
+	}
+
+	// the minute quota resets, and the rejected retries did not use up the daily quota
+	now = time.Date(2024, 5, 1, 23, 59, 10, 0, time.UTC)
+	rec = serve("globex")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+	rec = serve("globex")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	// the daily quota is exhausted, so the client must wait until midnight
+	assert.Equal(t, "50", rec.Header().Get(echo.HeaderRetryAfter))
+
+	// the next day
+	now = time.Date(2024, 5, 2, 0, 0, 1, 0, time.UTC)
+	assert.Equal(t, http.StatusOK, serve("globex").Code)
+
+	// tenants have their own counters and policies
+	rec = serve("acme")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "100", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "99", rec.Header().Get(HeaderRateLimitRemaining))
+
+	// requests without a tenant have no quota
+	rec = serve("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(HeaderRateLimitLimit))
+}
+
+func TestMemoryQuotaStorePrunes(t *testing.T) {
+	store := NewMemoryQuotaStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	count, err := store.Increment(context.Background(), "a", 1, now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	now = now.Add(2 * time.Minute)
+	count, err = store.Increment(context.Background(), "b", 1, now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Len(t, store.counters, 1)
+}
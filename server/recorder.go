@@ -0,0 +1,424 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Recording is a request and its response, recorded by the Record middleware.
+type Recording struct {
+	Time              time.Time   `json:"time"`
+	RequestID         string      `json:"request_id,omitempty"`
+	Method            string      `json:"method"`
+	URI               string      `json:"uri"`
+	Header            http.Header `json:"header,omitempty"`
+	Body              []byte      `json:"body,omitempty"`
+	Status            int         `json:"status"`
+	ResponseHeader    http.Header `json:"response_header,omitempty"`
+	ResponseBody      []byte      `json:"response_body,omitempty"`
+	BodyTruncated     bool        `json:"body_truncated,omitempty"`
+	ResponseTruncated bool        `json:"response_truncated,omitempty"`
+}
+
+// RecordingStore stores the recordings. Use a shared store, like a bucket, to replay the
+// recordings of every instance.
+type RecordingStore interface {
+	Save(ctx context.Context, recording Recording) error
+	// List returns the recordings, oldest first.
+	List(ctx context.Context) ([]Recording, error)
+}
+
+// MemoryRecordingStore is a RecordingStore keeping the latest recordings in memory.
+type MemoryRecordingStore struct {
+	mu         sync.Mutex
+	size       int
+	recordings []Recording
+}
+
+// NewMemoryRecordingStore creates a MemoryRecordingStore keeping at most size recordings.
+func NewMemoryRecordingStore(size int) *MemoryRecordingStore {
+	return &MemoryRecordingStore{size: size}
+}
+
+func (s *MemoryRecordingStore) Save(_ context.Context, recording Recording) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordings = append(s.recordings, recording)
+	if len(s.recordings) > s.size {
+		s.recordings = s.recordings[len(s.recordings)-s.size:]
+	}
+	return nil
+}
+
+func (s *MemoryRecordingStore) List(context.Context) ([]Recording, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Recording(nil), s.recordings...), nil
+}
+
+// FileRecordingStore is a RecordingStore appending the recordings to a file as JSON
+// lines, so they can be copied to a development machine and replayed there.
+type FileRecordingStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileRecordingStore creates a FileRecordingStore writing to the file at path.
+func NewFileRecordingStore(path string) *FileRecordingStore {
+	return &FileRecordingStore{path: path}
+}
+
+func (s *FileRecordingStore) Save(_ context.Context, recording Recording) error {
+	line, err := json.Marshal(recording)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileRecordingStore) List(context.Context) ([]Recording, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecordings(f)
+}
+
+// ReadRecordings reads recordings written as JSON lines, like by FileRecordingStore.
+func ReadRecordings(r io.Reader) ([]Recording, error) {
+	var recordings []Recording
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var recording Recording
+		if err := json.Unmarshal(scanner.Bytes(), &recording); err != nil {
+			return nil, fmt.Errorf("recording on line %d: %w", line, err)
+		}
+		recordings = append(recordings, recording)
+	}
+	return recordings, scanner.Err()
+}
+
+// RecordConfig configures the Record middleware.
+type RecordConfig struct {
+	// Store receives the recordings.
+	Store RecordingStore
+	// Percent is the part of the requests recorded, from 0 to 100.
+	Percent float64
+	// Toggle records requests only while it is on, e.g. switched through the Admin API.
+	Toggle *Toggle[bool]
+	// MaxBodySize is the largest request or response body recorded, 1 MiB by default.
+	// Larger bodies are not recorded, and their recordings marked as truncated.
+	MaxBodySize int
+	// Redactor removes sensitive data from the recorded headers, query strings and
+	// bodies. Bodies that are truncated, or neither JSON nor URL-encoded forms, are not
+	// recorded but replaced with [REDACTED]. Defaults to DefaultRedactor.
+	Redactor *Redactor
+}
+
+// DefaultRecordConfig is the default Record middleware config.
+var DefaultRecordConfig = RecordConfig{
+	MaxBodySize: 1 << 20,
+	Redactor:    DefaultRedactor,
+}
+
+// Record returns a middleware recording a sample of the requests and their responses,
+// redacted, to the store, for reproducing issues and validating refactors with
+// ReplayRecordings. The probes and the operational endpoints are not recorded. Errors of
+// the store are logged and do not fail the request.
+func Record(config RecordConfig) echo.MiddlewareFunc {
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultRecordConfig.MaxBodySize
+	}
+	if config.Redactor == nil {
+		config.Redactor = DefaultRecordConfig.Redactor
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if config.Toggle != nil && !config.Toggle.Get() || isOperationalPath(req.URL.Path) || rand.Float64()*100 >= config.Percent {
+				return next(c)
+			}
+
+			var reqBody []byte
+			if req.Body != nil {
+				var err error
+				reqBody, err = io.ReadAll(io.LimitReader(req.Body, int64(config.MaxBodySize)+1))
+				if err != nil {
+					return err
+				}
+				req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), req.Body))
+			}
+			recording := Recording{
+				Time:      time.Now(),
+				RequestID: requestID(c),
+				Method:    req.Method,
+				URI:       config.Redactor.URI(req.RequestURI),
+				Header:    config.Redactor.Header(req.Header),
+			}
+			if len(reqBody) > config.MaxBodySize {
+				reqBody = reqBody[:config.MaxBodySize]
+				recording.BodyTruncated = true
+			}
+			recording.Body = config.redactBody(reqBody, req.Header.Get(echo.HeaderContentType), recording.BodyTruncated)
+
+			writer := newCaptureResponseWriter(c.Response().Writer, config.MaxBodySize)
+			c.Response().Writer = writer
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response so it is recorded
+				c.Error(err)
+			}
+
+			recording.Status = c.Response().Status
+			recording.ResponseHeader = config.Redactor.Header(c.Response().Header())
+			recording.ResponseTruncated = writer.truncated
+			recording.ResponseBody = config.redactBody(writer.body.Bytes(), c.Response().Header().Get(echo.HeaderContentType), writer.truncated)
+			if err := config.Store.Save(context.WithoutCancel(req.Context()), recording); err != nil {
+				c.Logger().Errorf("record request: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
+// redactBody returns the body with its sensitive values replaced: the fields of JSON
+// documents and of URL-encoded forms. A truncated body or a body in another format is
+// replaced completely, as its sensitive fields cannot be found.
+func (config RecordConfig) redactBody(body []byte, contentType string, truncated bool) []byte {
+	if len(body) == 0 {
+		return nil
+	}
+	if truncated {
+		return []byte(redactedValue)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == echo.MIMEApplicationForm {
+		return []byte(config.Redactor.Form(string(body)))
+	}
+	if !json.Valid(body) {
+		return []byte(redactedValue)
+	}
+	return config.Redactor.JSON(body)
+}
+
+// ReplayRecordingsConfig configures ReplayRecordings.
+type ReplayRecordingsConfig struct {
+	// Handler serves the replayed requests in process, like a KapetaServer. Set either
+	// Handler or Target.
+	Handler http.Handler
+	// Target is the base url of the server receiving the replayed requests, like a new
+	// version of the service.
+	Target *url.URL
+	// Client sends the replayed requests to the Target, with a 10 second timeout by
+	// default.
+	Client *http.Client
+	// Header is set on every replayed request, e.g. to replace the redacted credentials.
+	Header http.Header
+	// CompareHeaders are the response headers compared, none by default since headers
+	// like Date differ on every response.
+	CompareHeaders []string
+	// IgnoreFields are JSON paths of the response bodies not compared, like "updated" or
+	// "items[*].id". A "*" segment matches any object key or array index.
+	IgnoreFields []string
+}
+
+// DefaultReplayRecordingsConfig is the default ReplayRecordings config.
+var DefaultReplayRecordingsConfig = ReplayRecordingsConfig{
+	Client: &http.Client{Timeout: 10 * time.Second},
+}
+
+// ReplayResult is the outcome of replaying a recording.
+type ReplayResult struct {
+	Recording Recording
+	// Status, Header and Body are the replayed response.
+	Status int
+	Header http.Header
+	Body   []byte
+	// Diffs describes the differences between the recorded and the replayed response,
+	// empty when they match.
+	Diffs []string
+	// Err is set when the request could not be replayed.
+	Err error
+}
+
+// Matches reports whether the request was replayed with the recorded response.
+func (r ReplayResult) Matches() bool {
+	return r.Err == nil && len(r.Diffs) == 0
+}
+
+// ReplayRecordings sends the recorded requests again, in order, to the handler or the
+// target and compares the responses with the recorded ones: the status, the compared
+// headers, and the bodies, field by field for JSON bodies. Redacted values match any
+// replayed value, as do truncated bodies any replayed body with the recorded prefix.
+// It returns early only when ctx is done.
+func ReplayRecordings(ctx context.Context, recordings []Recording, config ReplayRecordingsConfig) ([]ReplayResult, error) {
+	if config.Handler == nil && config.Target == nil {
+		return nil, fmt.Errorf("replay recordings: neither a handler nor a target is set")
+	}
+	if config.Client == nil {
+		config.Client = DefaultReplayRecordingsConfig.Client
+	}
+	ignored := &Redactor{Paths: config.IgnoreFields}
+	results := make([]ReplayResult, 0, len(recordings))
+	for _, recording := range recordings {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		result := ReplayResult{Recording: recording}
+		result.Status, result.Header, result.Body, result.Err = replayRecording(ctx, recording, config)
+		if result.Err == nil {
+			result.Diffs = diffResponses(recording, result, config.CompareHeaders, ignored)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func replayRecording(ctx context.Context, recording Recording, config ReplayRecordingsConfig) (int, http.Header, []byte, error) {
+	target := recording.URI
+	if config.Target != nil {
+		target = strings.TrimSuffix(config.Target.String(), "/") + recording.URI
+	}
+	req, err := http.NewRequestWithContext(ctx, recording.Method, target, bytes.NewReader(recording.Body))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	for name, values := range recording.Header {
+		if !containsFold([]string{echo.HeaderContentLength, "Host"}, name) && !containsFold(values, redactedValue) {
+			req.Header[name] = values
+		}
+	}
+	for name, values := range config.Header {
+		req.Header[name] = values
+	}
+
+	if config.Handler != nil {
+		rec := httptest.NewRecorder()
+		config.Handler.ServeHTTP(rec, req)
+		return rec.Code, rec.Header(), rec.Body.Bytes(), nil
+	}
+	resp, err := config.Client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header, body, err
+}
+
+func diffResponses(recording Recording, result ReplayResult, headers []string, ignored *Redactor) []string {
+	var diffs []string
+	if recording.Status != result.Status {
+		diffs = append(diffs, fmt.Sprintf("status: %d != %d", recording.Status, result.Status))
+	}
+	for _, name := range headers {
+		recorded, replayed := recording.ResponseHeader.Values(name), result.Header.Values(name)
+		if !containsFold(recorded, redactedValue) && !reflect.DeepEqual(recorded, replayed) {
+			diffs = append(diffs, fmt.Sprintf("header %s: %q != %q", http.CanonicalHeaderKey(name), recorded, replayed))
+		}
+	}
+
+	if recording.ResponseTruncated || string(recording.ResponseBody) == redactedValue {
+		// the body was not recorded
+		return diffs
+	}
+	var recorded, replayed any
+	if json.Unmarshal(recording.ResponseBody, &recorded) != nil || json.Unmarshal(result.Body, &replayed) != nil {
+		if !bytes.Equal(recording.ResponseBody, result.Body) {
+			diffs = append(diffs, fmt.Sprintf("body: %q != %q", recording.ResponseBody, result.Body))
+		}
+		return diffs
+	}
+	return append(diffs, diffJSON(recorded, replayed, nil, ignored)...)
+}
+
+// diffJSON describes the differences of two JSON documents by JSON path.
+func diffJSON(recorded, replayed any, location []string, ignored *Redactor) []string {
+	if len(location) > 0 && ignored.matchesPath(location) || recorded == redactedValue {
+		return nil
+	}
+	switch recordedValue := recorded.(type) {
+	case map[string]any:
+		replayedValue, ok := replayed.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(recordedValue)+len(replayedValue))
+		for key := range recordedValue {
+			keys = append(keys, key)
+		}
+		for key := range replayedValue {
+			if _, ok := recordedValue[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		var diffs []string
+		for _, key := range keys {
+			diffs = append(diffs, diffJSON(recordedValue[key], replayedValue[key], append(location[:len(location):len(location)], key), ignored)...)
+		}
+		return diffs
+	case []any:
+		replayedValue, ok := replayed.([]any)
+		if !ok || len(recordedValue) != len(replayedValue) {
+			break
+		}
+		var diffs []string
+		for i := range recordedValue {
+			diffs = append(diffs, diffJSON(recordedValue[i], replayedValue[i], append(location[:len(location):len(location)], strconv.Itoa(i)), ignored)...)
+		}
+		return diffs
+	}
+	if reflect.DeepEqual(recorded, replayed) {
+		return nil
+	}
+	recordedJSON, _ := json.Marshal(recorded)
+	replayedJSON, _ := json.Marshal(replayed)
+	return []string{fmt.Sprintf("body %s: %s != %s", jsonPath(location), recordedJSON, replayedJSON)}
+}
+
+func jsonPath(location []string) string {
+	if len(location) == 0 {
+		return "$"
+	}
+	return strings.Join(location, ".")
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecordedServer(store RecordingStore) *echo.Echo {
+	e := echo.New()
+	e.Use(Record(RecordConfig{Store: store, Percent: 100}))
+	e.POST("/users", func(c echo.Context) error {
+		return c.JSON(http.StatusCreated, map[string]any{"id": 1, "name": "Ada", "token": "abc"})
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusTeapot, "teapot")
+	})
+	e.GET(healthPath, func(c echo.Context) error {
+		return c.String(http.StatusOK, "OK")
+	})
+	return e
+}
+
+func TestRecord(t *testing.T) {
+	store := NewMemoryRecordingStore(10)
+	e := newRecordedServer(store)
+
+	req := httptest.NewRequest(http.MethodPost, "/users?api_key=secret", strings.NewReader(`{"name":"Ada","password":"hunter2"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer abc")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, healthPath, nil))
+
+	recordings, err := store.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, recordings, 2)
+
+	recording := recordings[0]
+	assert.Equal(t, http.MethodPost, recording.Method)
+	assert.Equal(t, "/users?api_key=%5BREDACTED%5D", recording.URI)
+	assert.Equal(t, redactedValue, recording.Header.Get(echo.HeaderAuthorization))
+	assert.JSONEq(t, `{"name":"Ada","password":"[REDACTED]"}`, string(recording.Body))
+	assert.Equal(t, http.StatusCreated, recording.Status)
+	assert.JSONEq(t, `{"id":1,"name":"Ada","token":"[REDACTED]"}`, string(recording.ResponseBody))
+
+	// the response written by the error handler is recorded
+	assert.Equal(t, http.StatusTeapot, recordings[1].Status)
+	assert.JSONEq(t, `{"message":"teapot"}`, string(recordings[1].ResponseBody))
+}
+
+func TestRecordTruncates(t *testing.T) {
+	store := NewMemoryRecordingStore(10)
+	e := echo.New()
+	e.Use(Record(RecordConfig{Store: store, Percent: 100, MaxBodySize: 4}))
+	e.POST("/echo", func(c echo.Context) error {
+		return c.Stream(http.StatusOK, echo.MIMETextPlain, c.Request().Body)
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("abcdefgh")))
+
+	// the handler still reads the whole body
+	assert.Equal(t, "abcdefgh", rec.Body.String())
+	recordings, _ := store.List(context.Background())
+	require.Len(t, recordings, 1)
+	assert.Equal(t, redactedValue, string(recordings[0].Body))
+	assert.True(t, recordings[0].BodyTruncated)
+	assert.Equal(t, redactedValue, string(recordings[0].ResponseBody))
+	assert.True(t, recordings[0].ResponseTruncated)
+}
+
+func TestRecordRedactsBodies(t *testing.T) {
+	store := NewMemoryRecordingStore(10)
+	e := echo.New()
+	e.Use(Record(RecordConfig{Store: store, Percent: 100, MaxBodySize: 32}))
+	e.POST("/login", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	serve := func(contentType, body string) Recording {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		recordings, err := store.List(context.Background())
+		require.NoError(t, err)
+		return recordings[len(recordings)-1]
+	}
+
+	form := serve(echo.MIMEApplicationForm, "user=bob&password=hunter2")
+	assert.Equal(t, "password=%5BREDACTED%5D&user=bob", string(form.Body))
+
+	truncated := serve(echo.MIMEApplicationJSON, `{"password":"hunter2","padding":"xxxxxxxxxxxxxxxx"}`)
+	assert.True(t, truncated.BodyTruncated)
+	assert.Equal(t, redactedValue, string(truncated.Body))
+
+	text := serve(echo.MIMETextPlain, "password: hunter2")
+	assert.Equal(t, redactedValue, string(text.Body))
+}
+
+func TestRecordToggle(t *testing.T) {
+	store := NewMemoryRecordingStore(10)
+	toggle := NewToggle(false)
+	e := echo.New()
+	e.Use(Record(RecordConfig{Store: store, Percent: 100, Toggle: toggle}))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	toggle.Set(true)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	recordings, _ := store.List(context.Background())
+	assert.Len(t, recordings, 1)
+}
+
+func TestMemoryRecordingStore(t *testing.T) {
+	store := NewMemoryRecordingStore(2)
+	for _, uri := range []string{"/1", "/2", "/3"} {
+		require.NoError(t, store.Save(context.Background(), Recording{URI: uri}))
+	}
+	recordings, err := store.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, recordings, 2)
+	assert.Equal(t, "/2", recordings[0].URI)
+	assert.Equal(t, "/3", recordings[1].URI)
+}
+
+func TestFileRecordingStore(t *testing.T) {
+	store := NewFileRecordingStore(filepath.Join(t.TempDir(), "recordings.jsonl"))
+	recordings, err := store.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, recordings)
+
+	require.NoError(t, store.Save(context.Background(), Recording{Method: http.MethodGet, URI: "/1", Body: []byte(`{"a":1}`)}))
+	require.NoError(t, store.Save(context.Background(), Recording{Method: http.MethodGet, URI: "/2"}))
+	recordings, err = store.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, recordings, 2)
+	assert.Equal(t, "/1", recordings[0].URI)
+	assert.Equal(t, `{"a":1}`, string(recordings[0].Body))
+
+	_, err = ReadRecordings(strings.NewReader("{}\nnot json\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestReplayRecordings(t *testing.T) {
+	store := NewMemoryRecordingStore(10)
+	e := newRecordedServer(store)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Ada"}`)))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	recordings, _ := store.List(context.Background())
+
+	t.Run("same version", func(t *testing.T) {
+		results, err := ReplayRecordings(context.Background(), recordings, ReplayRecordingsConfig{Handler: e})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		for _, result := range results {
+			assert.True(t, result.Matches(), result.Diffs)
+		}
+	})
+
+	t.Run("new version", func(t *testing.T) {
+		v2 := echo.New()
+		v2.POST("/users", func(c echo.Context) error {
+			c.Response().Header().Set("X-Version", "2")
+			return c.JSON(http.StatusCreated, map[string]any{"id": 2, "name": "Ada", "token": "xyz", "email": "ada@example.com"})
+		})
+		server := httptest.NewServer(v2)
+		defer server.Close()
+		target, _ := url.Parse(server.URL)
+
+		results, err := ReplayRecordings(context.Background(), recordings, ReplayRecordingsConfig{
+			Target:         target,
+			CompareHeaders: []string{"x-version"},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, []string{
+			`header X-Version: [] != ["2"]`,
+			`body email: null != "ada@example.com"`,
+			`body id: 1 != 2`,
+		}, results[0].Diffs)
+		assert.Equal(t, []string{
+			"status: 418 != 404",
+			"body message: \"teapot\" != \"Not Found\"",
+		}, results[1].Diffs)
+
+		results, err = ReplayRecordings(context.Background(), recordings[:1], ReplayRecordingsConfig{
+			Target:       target,
+			IgnoreFields: []string{"id", "email"},
+		})
+		require.NoError(t, err)
+		assert.True(t, results[0].Matches(), results[0].Diffs)
+	})
+
+	t.Run("unreachable target", func(t *testing.T) {
+		target, _ := url.Parse("http://127.0.0.1:1")
+		results, err := ReplayRecordings(context.Background(), recordings[:1], ReplayRecordingsConfig{Target: target})
+		require.NoError(t, err)
+		assert.Error(t, results[0].Err)
+		assert.False(t, results[0].Matches())
+	})
+
+	_, err := ReplayRecordings(context.Background(), recordings, ReplayRecordingsConfig{})
+	assert.Error(t, err)
+}
+
+func TestReplayRecordingsHeader(t *testing.T) {
+	e := echo.New()
+	e.GET("/me", func(c echo.Context) error {
+		if c.Request().Header.Get(echo.HeaderAuthorization) != "Bearer test" {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		return c.String(http.StatusOK, c.Request().Header.Get("X-Tenant"))
+	})
+	recordings := []Recording{{
+		Method:       http.MethodGet,
+		URI:          "/me",
+		Header:       http.Header{echo.HeaderAuthorization: {redactedValue}, "X-Tenant": {"acme"}},
+		Status:       http.StatusOK,
+		ResponseBody: []byte("acme"),
+	}}
+	results, err := ReplayRecordings(context.Background(), recordings, ReplayRecordingsConfig{
+		Handler: e,
+		Header:  http.Header{echo.HeaderAuthorization: {"Bearer test"}},
+	})
+	require.NoError(t, err)
+	assert.True(t, results[0].Matches(), results[0].Diffs)
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// Redactor removes sensitive data from headers, query strings and JSON documents before
+// they are logged. It is shared by the access logger of NewWithDefaults and the Dump middleware.
+type Redactor struct {
+	// Fields are case-insensitive glob patterns, in path.Match syntax, for JSON field and
+	// query parameter names whose values are replaced, like "*password*".
+	Fields []string
+	// Paths are JSON paths whose values are replaced, like "user.email" or "cards[*].number".
+	// A "*" segment matches any object key or array index.
+	Paths []string
+	// Headers are the names of headers whose values are replaced.
+	Headers []string
+	// Values are patterns replaced inside any string value, like email addresses.
+	Values []*regexp.Regexp
+}
+
+// DefaultRedactor redacts common credentials, email addresses and card numbers.
+var DefaultRedactor = &Redactor{
+	Fields:  []string{"*password*", "*secret*", "*token*", "api_key", "apikey", "authorization"},
+	Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+	Values: []*regexp.Regexp{
+		regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+	},
+}
+
+// Header returns a copy of the header with sensitive values replaced.
+func (r *Redactor) Header(header http.Header) http.Header {
+	result := make(http.Header, len(header))
+	for name, values := range header {
+		if containsFold(r.Headers, name) {
+			result[name] = []string{redactedValue}
+			continue
+		}
+		redacted := make([]string, len(values))
+		for i, value := range values {
+			redacted[i] = r.String(value)
+		}
+		result[name] = redacted
+	}
+	return result
+}
+
+// URI returns the request URI with sensitive query parameter values replaced.
+func (r *Redactor) URI(uri string) string {
+	p, rawQuery, ok := strings.Cut(uri, "?")
+	if !ok {
+		return r.String(uri)
+	}
+	return r.String(p) + "?" + r.Form(rawQuery)
+}
+
+// Form returns the URL-encoded form, like a query string or an
+// application/x-www-form-urlencoded body, with sensitive values replaced. A form
+// that cannot be parsed is replaced completely.
+func (r *Redactor) Form(form string) string {
+	values, err := url.ParseQuery(form)
+	if err != nil {
+		return redactedValue
+	}
+	for name, vals := range values {
+		for i, value := range vals {
+			if r.matchesField(name) {
+				vals[i] = redactedValue
+			} else {
+				vals[i] = r.String(value)
+			}
+		}
+	}
+	return values.Encode()
+}
+
+// JSON returns the JSON document with sensitive values replaced.
+// Bodies that are not valid JSON have only their sensitive value patterns replaced.
+func (r *Redactor) JSON(body []byte) []byte {
+	var doc any
+	if json.Unmarshal(body, &doc) != nil {
+		return []byte(r.String(string(body)))
+	}
+	redacted, err := json.Marshal(r.redact(doc, nil))
+	if err != nil {
+		return []byte(redactedValue)
+	}
+	return redacted
+}
+
+// String replaces the sensitive value patterns in s.
+func (r *Redactor) String(s string) string {
+	for _, pattern := range r.Values {
+		s = pattern.ReplaceAllString(s, redactedValue)
+	}
+	return s
+}
+
+func (r *Redactor) redact(doc any, location []string) any {
+	switch v := doc.(type) {
+	case map[string]any:
+		for key, value := range v {
+			child := append(location, key)
+			if r.matchesField(key) || r.matchesPath(child) {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = r.redact(value, child)
+		}
+	case []any:
+		for i, value := range v {
+			child := append(location, strconv.Itoa(i))
+			if r.matchesPath(child) {
+				v[i] = redactedValue
+				continue
+			}
+			v[i] = r.redact(value, child)
+		}
+	case string:
+		return r.String(v)
+	}
+	return doc
+}
+
+func (r *Redactor) matchesField(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range r.Fields {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) matchesPath(location []string) bool {
+	for _, p := range r.Paths {
+		segments := splitJSONPath(p)
+		if len(segments) != len(location) {
+			continue
+		}
+		matched := true
+		for i, segment := range segments {
+			if segment != "*" && segment != location[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// splitJSONPath splits "cards[*].number" into ["cards", "*", "number"].
+func splitJSONPath(p string) []string {
+	p = strings.NewReplacer("[", ".", "]", "").Replace(p)
+	return strings.Split(strings.Trim(p, "."), ".")
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
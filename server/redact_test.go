@@ -0,0 +1,63 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	t.Run("json fields and values", func(t *testing.T) {
+		body := DefaultRedactor.JSON([]byte(`{"user": {"name": "john", "email": "john@example.com", "Password": "hunter2"}, "card": "4111 1111 1111 1111", "refresh_token": "abc"}`))
+		assert.JSONEq(t, `{"user": {"name": "john", "email": "[REDACTED]", "Password": "[REDACTED]"}, "card": "[REDACTED]", "refresh_token": "[REDACTED]"}`, string(body))
+	})
+	t.Run("json paths", func(t *testing.T) {
+		r := &Redactor{Paths: []string{"user.name", "cards[*].number"}}
+		body := r.JSON([]byte(`{"user": {"name": "john", "id": 1}, "cards": [{"number": "1", "brand": "visa"}, {"number": "2"}], "name": "kept"}`))
+		assert.JSONEq(t, `{"user": {"name": "[REDACTED]", "id": 1}, "cards": [{"number": "[REDACTED]", "brand": "visa"}, {"number": "[REDACTED]"}], "name": "kept"}`, string(body))
+	})
+	t.Run("non json body", func(t *testing.T) {
+		body := DefaultRedactor.JSON([]byte(`contact john@example.com`))
+		assert.Equal(t, `contact [REDACTED]`, string(body))
+	})
+	t.Run("headers", func(t *testing.T) {
+		header := http.Header{"Authorization": {"Bearer x"}, "X-User": {"john@example.com"}, "Accept": {"text/html"}}
+		redacted := DefaultRedactor.Header(header)
+		assert.Equal(t, "[REDACTED]", redacted.Get("Authorization"))
+		assert.Equal(t, "[REDACTED]", redacted.Get("X-User"))
+		assert.Equal(t, "text/html", redacted.Get("Accept"))
+		assert.Equal(t, "Bearer x", header.Get("Authorization"))
+	})
+	t.Run("uri", func(t *testing.T) {
+		assert.Equal(t, "/users?access_token=%5BREDACTED%5D&page=2", DefaultRedactor.URI("/users?page=2&access_token=abc"))
+		assert.Equal(t, "/users/1", DefaultRedactor.URI("/users/1"))
+		assert.Equal(t, "password=%5BREDACTED%5D&user=bob", DefaultRedactor.Form("user=bob&password=hunter2"))
+		assert.Equal(t, redactedValue, DefaultRedactor.Form("user=%zz"))
+	})
+	t.Run("custom value pattern", func(t *testing.T) {
+		r := &Redactor{Values: []*regexp.Regexp{regexp.MustCompile(`\d{3}-\d{2}-\d{4}`)}}
+		assert.Equal(t, "ssn [REDACTED]", r.String("ssn 123-45-6789"))
+	})
+}
+
+func TestAccessLogRedaction(t *testing.T) {
+	s := NewWithDefaults()
+	logs := &bytes.Buffer{}
+	s.Logger.SetOutput(logs)
+	s.GET("/users", func(c echo.Context) error { return nil })
+
+	// the access logger writes to the middleware output, which defaults to the echo logger output
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?token=secret&page=1", nil))
+
+	assert.Contains(t, logs.String(), `"uri":"/users?page=1&token=%5BREDACTED%5D"`)
+	assert.NotContains(t, logs.String(), "secret")
+}
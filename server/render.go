@@ -0,0 +1,100 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+)
+
+// Render writes v with the status, in the content type the client prefers among the
+// content types with a Serializer registered by request.RegisterSerializer. Clients
+// without an Accept header, or accepting any type, get JSON. Clients accepting none of
+// the registered types get 406 Not Acceptable.
+//
+// Usage:
+//
+//	request.RegisterSerializer("application/cbor", "cbor", cborSerializer{})
+//	return server.Render(c, http.StatusOK, user)
+func Render(c echo.Context, status int, v any) error {
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	contentType, ok := negotiateContentType(c.Request().Header.Get(echo.HeaderAccept), request.ContentTypes())
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotAcceptable,
+			fmt.Sprintf("none of the accepted content types is supported, supported types: %s",
+				strings.Join(request.ContentTypes(), ", ")))
+	}
+	serializer, _ := request.SerializerFor(contentType)
+	var buf bytes.Buffer
+	if err := serializer.Encode(&buf, v); err != nil {
+		return err
+	}
+	return c.Blob(status, contentType, buf.Bytes())
+}
+
+type acceptedType struct {
+	mediaType string
+	q         float64
+}
+
+// negotiateContentType returns the supported content type preferred by the Accept
+// header, JSON when any type is accepted.
+func negotiateContentType(accept string, supported []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return echo.MIMEApplicationJSON, true
+	}
+	var accepted []acceptedType
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			accepted = append(accepted, acceptedType{mediaType, q})
+		}
+	}
+	// prefer higher quality, and more specific types on a tie
+	sort.SliceStable(accepted, func(i, j int) bool {
+		if accepted[i].q != accepted[j].q {
+			return accepted[i].q > accepted[j].q
+		}
+		return strings.Count(accepted[i].mediaType, "*") < strings.Count(accepted[j].mediaType, "*")
+	})
+	for _, a := range accepted {
+		switch {
+		case a.mediaType == "*/*":
+			return echo.MIMEApplicationJSON, true
+		case strings.HasSuffix(a.mediaType, "/*"):
+			prefix := strings.TrimSuffix(a.mediaType, "*")
+			if prefix == "application/" {
+				return echo.MIMEApplicationJSON, true
+			}
+			for _, contentType := range supported {
+				if strings.HasPrefix(contentType, prefix) {
+					return contentType, true
+				}
+			}
+		default:
+			for _, contentType := range supported {
+				if contentType == a.mediaType {
+					return contentType, true
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kapetacom/sdk-go-rest-server/request"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// upperSerializer writes JSON in upper case, standing in for formats like CBOR.
+type upperSerializer struct{}
+
+func (upperSerializer) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+func (upperSerializer) Encode(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, strings.ToUpper(string(data)))
+	return err
+}
+
+func TestRender(t *testing.T) {
+	request.RegisterSerializer("application/x-upper", "", upperSerializer{})
+	type user struct {
+		Name string `json:"name" xml:"name"`
+	}
+	e := echo.New()
+	e.GET("/user", func(c echo.Context) error {
+		return Render(c, http.StatusOK, user{Name: "alice"})
+	})
+	serve := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, `{"name":"alice"}`, rec.Body.String())
+	assert.Equal(t, echo.HeaderAccept, rec.Header().Get(echo.HeaderVary))
+
+	rec = serve("application/xml;q=0.5, application/x-upper")
+	assert.Equal(t, "application/x-upper", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `{"NAME":"ALICE"}`, rec.Body.String())
+
+	rec = serve("text/html, application/xml;q=0.9, */*;q=0.1")
+	assert.Equal(t, echo.MIMEApplicationXML, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `<user><name>alice</name></user>`, rec.Body.String())
+
+	rec = serve("text/*")
+	assert.Equal(t, echo.MIMETextXML, rec.Header().Get(echo.HeaderContentType))
+
+	rec = serve("text/html")
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+
+	rec = serve("text/html, */*;q=0.1")
+	assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NonceStore remembers the nonces used by requests. Use a shared store, like Redis,
+// when the service runs more than one instance.
+type NonceStore interface {
+	// Use records the nonce until expires, and returns false when it is already recorded.
+	Use(ctx context.Context, nonce string, expires time.Time) (bool, error)
+}
+
+// MemoryNonceStore is a NonceStore keeping nonces in memory until they expire.
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	nextPrune time.Time
+	now       func() time.Time
+}
+
+// NewMemoryNonceStore creates an empty MemoryNonceStore.
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: map[string]time.Time{}, now: time.Now}
+}
+
+func (s *MemoryNonceStore) Use(_ context.Context, nonce string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if expiry, ok := s.nonces[nonce]; ok && now.Before(expiry) {
+		return false, nil
+	}
+	// prune at most once a minute, so the map stays bounded by the requests in the window
+	if !now.Before(s.nextPrune) {
+		for key, expiry := range s.nonces {
+			if !now.Before(expiry) {
+				delete(s.nonces, key)
+			}
+		}
+		s.nextPrune = now.Add(time.Minute)
+	}
+	s.nonces[nonce] = expires
+	return true, nil
+}
+
+// ReplayConfig configures the ReplayProtection middleware.
+type ReplayConfig struct {
+	// TimestampHeader carries the time the request was signed, as unix seconds or
+	// RFC 3339. X-Timestamp by default.
+	TimestampHeader string
+	// NonceHeader carries a value unique to the request, X-Nonce by default.
+	NonceHeader string
+	// Window is how far the timestamp may be from the server time, 5 minutes by default.
+	Window time.Duration
+	// Store remembers the nonces seen in the window. Defaults to a MemoryNonceStore.
+	Store NonceStore
+}
+
+// DefaultReplayConfig is the default ReplayProtection middleware config.
+var DefaultReplayConfig = ReplayConfig{
+	TimestampHeader: "X-Timestamp",
+	NonceHeader:     "X-Nonce",
+	Window:          5 * time.Minute,
+}
+
+// ReplayProtection returns a middleware rejecting requests with 401 Unauthorized when
+// their timestamp is outside the freshness window or their nonce was already used.
+// It complements signature verification: the signature must cover both headers, e.g.
+// by verifying them with a WebhookVerifier before this middleware runs.
+func ReplayProtection(config ReplayConfig) echo.MiddlewareFunc {
+	if config.TimestampHeader == "" {
+		config.TimestampHeader = DefaultReplayConfig.TimestampHeader
+	}
+	if config.NonceHeader == "" {
+		config.NonceHeader = DefaultReplayConfig.NonceHeader
+	}
+	if config.Window == 0 {
+		config.Window = DefaultReplayConfig.Window
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryNonceStore()
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			timestamp, ok := parseRequestTimestamp(req.Header.Get(config.TimestampHeader))
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or invalid "+config.TimestampHeader)
+			}
+			now := time.Now()
+			if age := now.Sub(timestamp); age > config.Window || age < -config.Window {
+				return echo.NewHTTPError(http.StatusUnauthorized, "request timestamp outside the allowed window")
+			}
+			nonce := req.Header.Get(config.NonceHeader)
+			if nonce == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing "+config.NonceHeader)
+			}
+			// the nonce must be remembered until the timestamp leaves the window
+			fresh, err := config.Store.Use(req.Context(), nonce, timestamp.Add(config.Window))
+			if err != nil {
+				return err
+			}
+			if !fresh {
+				return echo.NewHTTPError(http.StatusUnauthorized, "request already processed")
+			}
+			return next(c)
+		}
+	}
+}
+
+func parseRequestTimestamp(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, err == nil
+}
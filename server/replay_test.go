@@ -0,0 +1,61 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayProtection(t *testing.T) {
+	e := echo.New()
+	e.POST("/transfer", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, ReplayProtection(ReplayConfig{}))
+
+	serve := func(timestamp, nonce string) int {
+		req := httptest.NewRequest(http.MethodPost, "/transfer", nil)
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Nonce", nonce)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	assert.Equal(t, http.StatusNoContent, serve(now, "n1"))
+	assert.Equal(t, http.StatusUnauthorized, serve(now, "n1"), "replayed nonce")
+	assert.Equal(t, http.StatusNoContent, serve(time.Now().UTC().Format(time.RFC3339), "n2"))
+	assert.Equal(t, http.StatusUnauthorized, serve(strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10), "n3"))
+	assert.Equal(t, http.StatusUnauthorized, serve(strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10), "n4"))
+	assert.Equal(t, http.StatusUnauthorized, serve("yesterday", "n5"))
+	assert.Equal(t, http.StatusUnauthorized, serve(now, ""))
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	fresh, err := store.Use(ctx, "a", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, _ = store.Use(ctx, "a", now.Add(time.Minute))
+	assert.False(t, fresh)
+
+	now = now.Add(2 * time.Minute)
+	fresh, _ = store.Use(ctx, "b", now.Add(time.Minute))
+	assert.True(t, fresh)
+	assert.NotContains(t, store.nonces, "a", "expired nonces are pruned")
+	fresh, _ = store.Use(ctx, "a", now.Add(time.Minute))
+	assert.True(t, fresh)
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// ResponseValidationConfig configures the ValidateResponse middleware.
+type ResponseValidationConfig struct {
+	// Fail replaces invalid responses with a 500 error instead of only logging them.
+	Fail bool
+}
+
+// ValidateResponse returns a development middleware checking that successful JSON
+// responses of the route decode into T without unknown fields or type mismatches,
+// catching drift between a handler and its declared response type before clients do.
+// Mismatches are logged with the echo logger regardless of its level. A handler error is
+// passed on as is, without validating what the handler wrote. The response is
+// buffered until the handler returns, so do not use it in production or on streams.
+//
+// Usage:
+//
+//	e.GET("/users/:id", getUser, server.ValidateResponse[User](server.ResponseValidationConfig{}))
+func ValidateResponse[T any](config ResponseValidationConfig) echo.MiddlewareFunc {
+	typeName := reflect.TypeOf((*T)(nil)).Elem().String()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			writer := &bufferedResponseWriter{ResponseWriter: res.Writer}
+			res.Writer = writer
+			err := next(c)
+			res.Writer = writer.ResponseWriter
+			if !writer.written {
+				return err
+			}
+			if err != nil {
+				// the error of the handler is passed on, with what it wrote unvalidated
+				if flushErr := writer.flush(); flushErr != nil {
+					c.Logger().Errorf("writing response: %v", flushErr)
+				}
+				return err
+			}
+
+			validationErr := validateResponseBody[T](res, writer)
+			if validationErr == nil {
+				return writer.flush()
+			}
+			c.Logger().Printj(log.JSON{
+				"level":            "WARN",
+				"invalid_response": c.Request().Method + " " + c.Path(),
+				"request_id":       requestID(c),
+				"declared_type":    typeName,
+				"validation_error": validationErr.Error(),
+			})
+			if !config.Fail {
+				return writer.flush()
+			}
+			res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+			res.Header().Del(echo.HeaderContentLength)
+			writer.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+			return json.NewEncoder(writer.ResponseWriter).Encode(echo.Map{
+				"message": fmt.Sprintf("response does not match %s: %v", typeName, validationErr),
+			})
+		}
+	}
+}
+
+func validateResponseBody[T any](res *echo.Response, writer *bufferedResponseWriter) error {
+	if writer.status < http.StatusOK || writer.status >= http.StatusMultipleChoices ||
+		!strings.HasPrefix(res.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(writer.body.Bytes()))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(new(T))
+}
+
+// bufferedResponseWriter holds back the response until it is validated.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.written = true
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) flush() error {
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	return err
+}
+
+// reset discards the buffered response, so the response can be written again, e.g. by
+// the error handler.
+func (w *bufferedResponseWriter) reset(res *echo.Response) {
+	w.status = 0
+	w.written = false
+	w.body.Reset()
+	res.Header().Del(echo.HeaderContentType)
+	res.Header().Del(echo.HeaderContentLength)
+	res.Committed = false
+	res.Status = http.StatusOK
+	res.Size = 0
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateResponse(t *testing.T) {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	e := echo.New()
+	var logs bytes.Buffer
+	e.Logger.SetOutput(&logs)
+	handler := func(c echo.Context) error {
+		switch c.QueryParam("case") {
+		case "unknown field":
+			return c.JSON(http.StatusOK, echo.Map{"id": 1, "name": "John", "email": "john@example.com"})
+		case "wrong type":
+			return c.JSON(http.StatusOK, echo.Map{"id": "1"})
+		case "error":
+			return c.JSON(http.StatusNotFound, echo.Map{"message": "not found"})
+		}
+		return c.JSON(http.StatusCreated, user{ID: 1, Name: "John"})
+	}
+	e.GET("/log", handler, ValidateResponse[user](ResponseValidationConfig{}))
+	e.GET("/fail", handler, ValidateResponse[user](ResponseValidationConfig{Fail: true}))
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		logs.Reset()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		rec := serve("/fail")
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id":1,"name":"John"}`, rec.Body.String())
+		assert.Empty(t, logs.String())
+	})
+	t.Run("error responses are not validated", func(t *testing.T) {
+		rec := serve("/fail?case=error")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Empty(t, logs.String())
+	})
+	t.Run("mismatch is logged", func(t *testing.T) {
+		rec := serve("/log?case=unknown+field")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "john@example.com")
+		assert.Contains(t, logs.String(), `unknown field \"email\"`)
+		assert.Contains(t, logs.String(), `"declared_type":"server.user"`)
+	})
+	t.Run("mismatch fails", func(t *testing.T) {
+		rec := serve("/fail?case=wrong+type")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "response does not match server.user")
+		assert.NotEmpty(t, logs.String())
+	})
+	t.Run("handler errors are passed on", func(t *testing.T) {
+		e := echo.New()
+		var handled error
+		e.HTTPErrorHandler = func(err error, c echo.Context) {
+			handled = err
+		}
+		handlerErr := errors.New("downstream failed")
+		e.GET("/", func(c echo.Context) error {
+			if err := c.JSON(http.StatusOK, echo.Map{"id": "1"}); err != nil {
+				return err
+			}
+			return handlerErr
+		}, ValidateResponse[user](ResponseValidationConfig{Fail: true}))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, handlerErr, handled)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":"1"}`, rec.Body.String())
+	})
+}
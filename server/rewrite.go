@@ -0,0 +1,158 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ResponseTransform describes changes to outgoing responses.
+type ResponseTransform struct {
+	// RemoveHeaders lists headers to delete.
+	RemoveHeaders []string
+	// SetHeaders maps header names to values replacing those set by the handler.
+	SetHeaders map[string]string
+	// StatusMap maps status codes to the codes sent instead.
+	StatusMap map[int]int
+	// RewriteURLs maps url prefixes to replacements, applied to the Location header and
+	// to JSON bodies, e.g. to replace internal urls behind a reverse proxy.
+	RewriteURLs map[string]string
+}
+
+// TransformResponse returns a middleware modifying responses, counterpart of TransformRequest.
+// Bodies are rewritten while they are written, so streamed responses are not buffered.
+//
+// Usage:
+//
+//	s.Use(server.TransformResponse(server.ResponseTransform{
+//		RewriteURLs: map[string]string{"http://users:8080/": "https://api.example.com/users/"},
+//	}))
+func TransformResponse(t ResponseTransform) echo.MiddlewareFunc {
+	var olds []string
+	for old := range t.RewriteURLs {
+		olds = append(olds, old)
+	}
+	// longest first, so overlapping prefixes pick the most specific replacement
+	sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			writer := &rewriteResponseWriter{ResponseWriter: res.Writer, olds: olds, replacements: t.RewriteURLs}
+			res.Before(func() {
+				header := res.Header()
+				for _, name := range t.RemoveHeaders {
+					header.Del(name)
+				}
+				for name, value := range t.SetHeaders {
+					header.Set(name, value)
+				}
+				if status, ok := t.StatusMap[res.Status]; ok {
+					res.Status = status
+				}
+				if location := header.Get(echo.HeaderLocation); location != "" {
+					header.Set(echo.HeaderLocation, rewritePrefix(location, olds, t.RewriteURLs))
+				}
+				if len(olds) > 0 && isJSONContentType(header.Get(echo.HeaderContentType)) {
+					header.Del(echo.HeaderContentLength)
+					writer.rewrite = true
+				}
+			})
+			res.Writer = writer
+			defer func() {
+				res.Writer = writer.ResponseWriter
+			}()
+
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response so it is rewritten too
+				c.Error(err)
+			}
+			_, err = writer.finish()
+			return err
+		}
+	}
+}
+
+func rewritePrefix(s string, olds []string, replacements map[string]string) string {
+	for _, old := range olds {
+		if rest, ok := strings.CutPrefix(s, old); ok {
+			return replacements[old] + rest
+		}
+	}
+	return s
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == echo.MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json"))
+}
+
+// rewriteResponseWriter replaces the url prefixes in the body while it is written. Bytes
+// which may be the start of a prefix split across writes are held back until the next write.
+type rewriteResponseWriter struct {
+	http.ResponseWriter
+	rewrite      bool
+	olds         []string
+	replacements map[string]string
+	pending      []byte
+}
+
+func (w *rewriteResponseWriter) Write(b []byte) (int, error) {
+	if !w.rewrite {
+		return w.ResponseWriter.Write(b)
+	}
+	w.pending = append(w.pending, b...)
+	if _, err := w.ResponseWriter.Write(w.replace(false)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// replace returns the rewritten pending bytes, keeping a possible partial match unless final.
+func (w *rewriteResponseWriter) replace(final bool) []byte {
+	var out bytes.Buffer
+	p := w.pending
+	i := 0
+scan:
+	for i < len(p) {
+		rest := p[i:]
+		for _, old := range w.olds {
+			if bytes.HasPrefix(rest, []byte(old)) {
+				out.WriteString(w.replacements[old])
+				i += len(old)
+				continue scan
+			}
+			if !final && len(rest) < len(old) && strings.HasPrefix(old, string(rest)) {
+				break scan
+			}
+		}
+		out.WriteByte(p[i])
+		i++
+	}
+	w.pending = append(w.pending[:0], p[i:]...)
+	return out.Bytes()
+}
+
+func (w *rewriteResponseWriter) finish() (int, error) {
+	if len(w.pending) == 0 {
+		return 0, nil
+	}
+	return w.ResponseWriter.Write(w.replace(true))
+}
+
+func (w *rewriteResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *rewriteResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformResponse(t *testing.T) {
+	e := echo.New()
+	e.Use(TransformResponse(ResponseTransform{
+		RemoveHeaders: []string{"X-Internal"},
+		SetHeaders:    map[string]string{"X-Served-By": "gateway"},
+		StatusMap:     map[int]int{http.StatusTeapot: http.StatusOK},
+		RewriteURLs: map[string]string{
+			"http://users:8080/":       "https://api.example.com/users/",
+			"http://users:8080/admin/": "https://admin.example.com/",
+		},
+	}))
+	e.GET("/users", func(c echo.Context) error {
+		c.Response().Header().Set("X-Internal", "pod-1")
+		c.Response().Header().Set(echo.HeaderLocation, "http://users:8080/1")
+		return c.JSON(http.StatusTeapot, echo.Map{
+			"self":  "http://users:8080/1",
+			"admin": "http://users:8080/admin/1",
+			"other": "http://orders:8080/1",
+		})
+	})
+	e.GET("/text", func(c echo.Context) error {
+		return c.String(http.StatusOK, "http://users:8080/1")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("X-Internal"))
+	assert.Equal(t, "gateway", rec.Header().Get("X-Served-By"))
+	assert.Equal(t, "https://api.example.com/users/1", rec.Header().Get(echo.HeaderLocation))
+	assert.JSONEq(t, `{
+		"self": "https://api.example.com/users/1",
+		"admin": "https://admin.example.com/1",
+		"other": "http://orders:8080/1"
+	}`, rec.Body.String())
+
+	// only JSON bodies are rewritten
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/text", nil))
+	assert.Equal(t, "http://users:8080/1", rec.Body.String())
+}
+
+func TestTransformResponseStreaming(t *testing.T) {
+	e := echo.New()
+	e.Use(TransformResponse(ResponseTransform{
+		RewriteURLs: map[string]string{"http://users:8080": "https://api.example.com"},
+	}))
+	e.GET("/stream", func(c echo.Context) error {
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res.Header().Set(echo.HeaderContentLength, "100")
+		res.WriteHeader(http.StatusOK)
+		// the prefix is split across writes
+		for _, chunk := range []string{`["http://us`, `ers:8080/1",`, `"http://users:8080/2","http://users`} {
+			if _, err := res.Write([]byte(chunk)); err != nil {
+				return err
+			}
+			res.Flush()
+		}
+		_, err := res.Write([]byte(`"]`))
+		return err
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Empty(t, rec.Header().Get(echo.HeaderContentLength))
+	assert.Equal(t, `["https://api.example.com/1","https://api.example.com/2","http://users"]`, rec.Body.String())
+}
+
+func TestTransformResponseError(t *testing.T) {
+	e := echo.New()
+	e.Use(TransformResponse(ResponseTransform{
+		StatusMap:  map[int]int{http.StatusNotFound: http.StatusGone},
+		SetHeaders: map[string]string{"X-Served-By": "gateway"},
+	}))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Equal(t, "gateway", rec.Header().Get("X-Served-By"))
+}
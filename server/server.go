@@ -3,35 +3,75 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// accessLogFormat is the default echo access log format, with the uri written by
+// redactedURITag so credentials in query strings are not logged, and the correlation id
+// set by CorrelationID.
+var accessLogFormat = strings.NewReplacer(
+	`"uri":"${uri}"`, `"uri":${custom}`,
+	`"id":"${id}",`, `"id":"${id}","correlation_id":"${header:`+HeaderXCorrelationID+`}",`,
+).Replace(middleware.DefaultLoggerConfig.Format)
+
+func redactedURITag(c echo.Context, buf *bytes.Buffer) (int, error) {
+	var uri bytes.Buffer
+	encoder := json.NewEncoder(&uri)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(DefaultRedactor.URI(c.Request().RequestURI))
+	if err != nil {
+		return 0, err
+	}
+	return buf.Write(bytes.TrimSuffix(uri.Bytes(), []byte("\n")))
+}
+
 type KapetaServer struct {
 	*echo.Echo
+
+	plugins []Plugin
+	// socket is the listener created by Listen, passed on by Handover
+	socket net.Listener
+	// shutdownHooks are run by Shutdown, see OnShutdown
+	shutdownHooks []func(ctx context.Context) error
 }
 
 // New creates a new instance of the KapetaServer with default settings
 func NewWithDefaults() *KapetaServer {
 	e := echo.New()
-	e.Add("GET", "/.kapeta/health", func(c echo.Context) error {
+	// assign every request an id, used by the access log and error reports
+	e.Pre(middleware.RequestID())
+	e.Pre(CorrelationID())
+	e.Add("GET", healthPath, func(c echo.Context) error {
 		return c.String(200, "OK")
 	})
-	// add skipper to skip logging for health check
+	// add skipper to skip logging for the health, readiness and startup probes
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Skipper: func(c echo.Context) bool {
-			return c.Path() == "/.kapeta/health"
+			return isProbePath(c.Path())
 		},
+		Format:        accessLogFormat,
+		CustomTagFunc: redactedURITag,
 	}))
-	// add recover middleware to recover from panics
-	e.Use(middleware.Recover())
+	// add recover middleware to recover from panics, rendered as problem+json
+	e.Use(Recover())
+	e.HTTPErrorHandler = ProblemErrorHandler(e.DefaultHTTPErrorHandler)
+
+	// expose the matched echo context to the httpin directives
+	e.Use(EchoContextMiddleware())
 
 	// register the path directive to extract path parameters from the request in the httpin library
 	UseEchoPathRouter(e)
-	return &KapetaServer{e}
+	return &KapetaServer{Echo: e}
 }
 
 // New creates a new instance of the KapetaServer, with no default settings
 func New() *KapetaServer {
-	return &KapetaServer{echo.New()}
+	return &KapetaServer{Echo: echo.New()}
 }
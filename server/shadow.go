@@ -0,0 +1,145 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderXShadowRequest is set on the requests sent by Shadow to the shadow target.
+const HeaderXShadowRequest = "X-Shadow-Request"
+
+// ShadowConfig configures the Shadow middleware.
+type ShadowConfig struct {
+	// Target is the base url of the service receiving the copies.
+	Target *url.URL
+	// Percent is the part of the requests mirrored, from 0 to 100.
+	Percent float64
+	// Client sends the copies, with a 5 second timeout by default.
+	Client *http.Client
+	// MaxBodySize is the largest request body mirrored, 1 MiB by default. Requests
+	// with larger bodies are not mirrored.
+	MaxBodySize int64
+	// Concurrency is the number of copies in flight, 10 by default. Copies beyond it
+	// are dropped so a slow target does not pile up goroutines.
+	Concurrency int
+	// ForwardCredentials keeps the Authorization, Proxy-Authorization, Cookie and
+	// X-Api-Key headers on the copies. They are removed by default, so the target does
+	// not receive the credentials of production callers.
+	ForwardCredentials bool
+	// OnResponse is called with the response of the target, e.g. to compare it with
+	// production. The body is closed after it returns.
+	OnResponse func(req *http.Request, resp *http.Response, err error)
+}
+
+// DefaultShadowConfig is the default Shadow middleware config.
+var DefaultShadowConfig = ShadowConfig{
+	Client:      &http.Client{Timeout: 5 * time.Second},
+	MaxBodySize: 1 << 20,
+	Concurrency: 10,
+}
+
+// Shadow returns a middleware sending a copy of a sample of the requests to a secondary
+// target, ignoring its responses, for validating a rewritten service against production
+// traffic. Copies are sent in the background and do not delay the response.
+func Shadow(config ShadowConfig) echo.MiddlewareFunc {
+	if config.Client == nil {
+		config.Client = DefaultShadowConfig.Client
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultShadowConfig.MaxBodySize
+	}
+	if config.Concurrency == 0 {
+		config.Concurrency = DefaultShadowConfig.Concurrency
+	}
+	slots := make(chan struct{}, config.Concurrency)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if rand.Float64()*100 >= config.Percent {
+				return next(c)
+			}
+			req := c.Request()
+			if req.ContentLength > config.MaxBodySize {
+				return next(c)
+			}
+			var body []byte
+			if req.Body != nil {
+				var err error
+				body, err = io.ReadAll(io.LimitReader(req.Body, config.MaxBodySize+1))
+				if err != nil {
+					return err
+				}
+				req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+				if int64(len(body)) > config.MaxBodySize {
+					return next(c)
+				}
+			}
+
+			select {
+			case slots <- struct{}{}:
+				shadowReq := newShadowRequest(req, config, body)
+				go func() {
+					defer func() { <-slots }()
+					sendShadowRequest(config, shadowReq)
+				}()
+			default:
+			}
+			return next(c)
+		}
+	}
+}
+
+func newShadowRequest(req *http.Request, config ShadowConfig, body []byte) *http.Request {
+	target := config.Target
+	// the copy outlives the request, so it must not be cancelled with it
+	shadowReq := req.Clone(context.WithoutCancel(req.Context()))
+	shadowReq.RequestURI = ""
+	shadowReq.URL.Scheme = target.Scheme
+	shadowReq.URL.Host = target.Host
+	shadowReq.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
+	// the escaped path of the request no longer matches the joined path
+	shadowReq.URL.RawPath = ""
+	shadowReq.Host = target.Host
+	shadowReq.Body = io.NopCloser(bytes.NewReader(body))
+	shadowReq.ContentLength = int64(len(body))
+	if !config.ForwardCredentials {
+		for _, name := range credentialHeaders {
+			shadowReq.Header.Del(name)
+		}
+	}
+	shadowReq.Header.Set(HeaderXShadowRequest, "true")
+	return shadowReq
+}
+
+func sendShadowRequest(config ShadowConfig, req *http.Request) {
+	resp, err := config.Client.Do(req)
+	if config.OnResponse != nil {
+		config.OnResponse(req, resp, err)
+	}
+	if err == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := len(a) > 0 && a[len(a)-1] == '/'
+	bslash := len(b) > 0 && b[0] == '/'
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash && a != "" && b != "":
+		return a + "/" + b
+	case a == "" && !bslash:
+		return "/" + b
+	}
+	return a + b
+}
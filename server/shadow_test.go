@@ -0,0 +1,123 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shadowedRequest struct {
+	path, body, header string
+}
+
+func TestShadow(t *testing.T) {
+	received := make(chan shadowedRequest, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- shadowedRequest{r.URL.RequestURI(), string(body), r.Header.Get(HeaderXShadowRequest)}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer target.Close()
+	targetURL, err := url.Parse(target.URL + "/v2")
+	require.NoError(t, err)
+
+	responses := make(chan int, 1)
+	e := echo.New()
+	e.POST("/users", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusCreated, string(body))
+	}, Shadow(ShadowConfig{
+		Target:  targetURL,
+		Percent: 100,
+		OnResponse: func(req *http.Request, resp *http.Response, err error) {
+			if err == nil {
+				responses <- resp.StatusCode
+			}
+		},
+	}))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users?dry=true", strings.NewReader(`{"name":"a"}`)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, `{"name":"a"}`, rec.Body.String())
+
+	select {
+	case req := <-received:
+		assert.Equal(t, "/v2/users?dry=true", req.path)
+		assert.Equal(t, `{"name":"a"}`, req.body)
+		assert.Equal(t, "true", req.header)
+	case <-time.After(time.Second):
+		t.Fatal("request was not mirrored")
+	}
+	assert.Equal(t, http.StatusTeapot, <-responses)
+}
+
+func TestShadowSkipped(t *testing.T) {
+	mirrored := make(chan struct{}, 2)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- struct{}{}
+	}))
+	defer target.Close()
+	targetURL, err := url.Parse(target.URL)
+	require.NoError(t, err)
+
+	e := echo.New()
+	handler := func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	}
+	e.POST("/none", handler, Shadow(ShadowConfig{Target: targetURL}))
+	e.POST("/large", handler, Shadow(ShadowConfig{Target: targetURL, Percent: 100, MaxBodySize: 4}))
+
+	for _, path := range []string{"/none", "/large"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("0123456789"))
+		req.ContentLength = -1
+		e.ServeHTTP(rec, req)
+		// the body is restored for the handler
+		assert.Equal(t, "0123456789", rec.Body.String())
+	}
+	select {
+	case <-mirrored:
+		t.Fatal("request was mirrored")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNewShadowRequest(t *testing.T) {
+	target, err := url.Parse("http://shadow.internal/v2")
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/files/a%2Fb", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+	req.Header.Set(echo.HeaderCookie, "session=secret")
+	req.Header.Set("X-Api-Key", "secret")
+	req.Header.Set("X-Request-Id", "42")
+
+	shadowReq := newShadowRequest(req, ShadowConfig{Target: target}, nil)
+	assert.Equal(t, "http://shadow.internal/v2/files/a/b", shadowReq.URL.String())
+	assert.Empty(t, shadowReq.Header.Get(echo.HeaderAuthorization))
+	assert.Empty(t, shadowReq.Header.Get(echo.HeaderCookie))
+	assert.Empty(t, shadowReq.Header.Get("X-Api-Key"))
+	assert.Equal(t, "42", shadowReq.Header.Get("X-Request-Id"))
+	assert.Equal(t, "Bearer secret", req.Header.Get(echo.HeaderAuthorization))
+
+	shadowReq = newShadowRequest(req, ShadowConfig{Target: target, ForwardCredentials: true}, nil)
+	assert.Equal(t, "Bearer secret", shadowReq.Header.Get(echo.HeaderAuthorization))
+	assert.Equal(t, "session=secret", shadowReq.Header.Get(echo.HeaderCookie))
+}
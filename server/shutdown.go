@@ -0,0 +1,30 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"errors"
+)
+
+// OnShutdown registers a hook run by Shutdown once the server stopped serving requests,
+// like the Shutdown of an events.Bus delivering the events the last requests published:
+//
+//	bus := events.NewBus(events.Config{})
+//	s.OnShutdown(bus.Shutdown)
+//
+// The hooks are run in reverse order of registration, with the context of Shutdown.
+func (s *KapetaServer) OnShutdown(hook func(ctx context.Context) error) {
+	s.shutdownHooks = append(s.shutdownHooks, hook)
+}
+
+// Shutdown stops the server gracefully, like the Shutdown of echo, and then runs the
+// OnShutdown hooks, also when the server did not stop before ctx is done. It returns
+// the errors of the server and of the hooks joined.
+func (s *KapetaServer) Shutdown(ctx context.Context) error {
+	errs := []error{s.Echo.Shutdown(ctx)}
+	for i := len(s.shutdownHooks) - 1; i >= 0; i-- {
+		errs = append(errs, s.shutdownHooks[i](ctx))
+	}
+	return errors.Join(errs...)
+}
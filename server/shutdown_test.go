@@ -0,0 +1,63 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kapetacom/sdk-go-rest-server/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shutdownEvent struct {
+	ID string
+}
+
+func TestShutdownDrainsEventBus(t *testing.T) {
+	s := New()
+	bus := events.NewBus(events.Config{})
+	delivered := make(chan string, 1)
+	events.Subscribe(bus, func(ctx context.Context, e shutdownEvent) error {
+		time.Sleep(20 * time.Millisecond)
+		delivered <- e.ID
+		return nil
+	})
+	var order []string
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "bus")
+		return bus.Shutdown(ctx)
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Start("127.0.0.1:0")
+	}()
+	require.Eventually(t, func() bool { return s.ListenerAddr() != nil }, time.Second, time.Millisecond)
+	require.NoError(t, events.Publish(context.Background(), bus, shutdownEvent{ID: "1"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+	assert.ErrorIs(t, <-errs, http.ErrServerClosed)
+	// the event is delivered before Shutdown returns
+	require.Len(t, delivered, 1)
+	assert.Equal(t, "1", <-delivered)
+	assert.Equal(t, []string{"bus", "first"}, order)
+	assert.ErrorIs(t, events.Publish(context.Background(), bus, shutdownEvent{}), events.ErrClosed)
+}
+
+func TestShutdownHookErrors(t *testing.T) {
+	s := New()
+	failed := errors.New("flush failed")
+	s.OnShutdown(func(ctx context.Context) error { return failed })
+	assert.ErrorIs(t, s.Shutdown(context.Background()), failed)
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// SlowRequestConfig configures the SlowRequests middleware.
+type SlowRequestConfig struct {
+	// Budget is the latency budget of routes not in Routes, 1 second by default.
+	Budget time.Duration
+	// Routes overrides the budget per route, keyed by method and path as registered,
+	// e.g. "GET /users/:id".
+	Routes map[string]time.Duration
+	// RecordStages enables the stage breakdown recorded with StartStage.
+	RecordStages bool
+	// OnSlow is called for every request exceeding its budget, after it is logged.
+	// Use it to increment a metric.
+	OnSlow func(c echo.Context, slow SlowRequest)
+}
+
+// DefaultSlowRequestConfig is the default SlowRequests middleware config.
+var DefaultSlowRequestConfig = SlowRequestConfig{
+	Budget: time.Second,
+}
+
+// SlowRequest describes a request exceeding its latency budget.
+type SlowRequest struct {
+	Method   string
+	Route    string
+	Status   int
+	Duration time.Duration
+	Budget   time.Duration
+	// Stages is the time spent in each stage, when RecordStages is enabled.
+	Stages []Stage
+}
+
+// Stage is the time spent in a named part of the request, like binding or serialization.
+type Stage struct {
+	Name     string
+	Duration time.Duration
+}
+
+// stagesKey holds the stages recorded for the request.
+var stagesKey = NewKey[*stages]("kapeta.slow_request.stages")
+
+type stages struct {
+	mu     sync.Mutex
+	stages []Stage
+}
+
+// StartStage starts timing a stage of the request and returns the function ending it.
+// It does nothing unless the SlowRequests middleware records stages.
+//
+// Usage:
+//
+//	end := server.StartStage(c, "binding")
+//	params, err := request.MustBind[Params](c)
+//	end()
+func StartStage(c echo.Context, name string) func() {
+	recorded, ok := Get(c, stagesKey)
+	if !ok {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		recorded.mu.Lock()
+		defer recorded.mu.Unlock()
+		recorded.stages = append(recorded.stages, Stage{Name: name, Duration: time.Since(start)})
+	}
+}
+
+// SlowRequests returns a middleware logging requests exceeding their latency budget,
+// written with the echo logger regardless of its level.
+func SlowRequests(config SlowRequestConfig) echo.MiddlewareFunc {
+	if config.Budget == 0 {
+		config.Budget = DefaultSlowRequestConfig.Budget
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var recorded *stages
+			if config.RecordStages {
+				recorded = &stages{}
+				Set(c, stagesKey, recorded)
+			}
+			start := time.Now()
+			err := next(c)
+			duration := time.Since(start)
+
+			route := c.Request().Method + " " + c.Path()
+			budget, ok := config.Routes[route]
+			if !ok {
+				budget = config.Budget
+			}
+			if duration <= budget {
+				return err
+			}
+
+			slow := SlowRequest{
+				Method:   c.Request().Method,
+				Route:    c.Path(),
+				Status:   c.Response().Status,
+				Duration: duration,
+				Budget:   budget,
+			}
+			if err != nil {
+				slow.Status = errorStatus(err)
+			}
+			entry := log.JSON{
+				"level":        "WARN",
+				"slow_request": route,
+				"request_id":   requestID(c),
+				"status":       slow.Status,
+				"latency":      duration.String(),
+				"budget":       budget.String(),
+			}
+			if recorded != nil {
+				recorded.mu.Lock()
+				slow.Stages = recorded.stages
+				recorded.mu.Unlock()
+				breakdown := make(map[string]string, len(slow.Stages))
+				for _, stage := range slow.Stages {
+					breakdown[stage.Name] = stage.Duration.String()
+				}
+				entry["stages"] = breakdown
+			}
+			c.Logger().Printj(entry)
+			if config.OnSlow != nil {
+				config.OnSlow(c, slow)
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowRequests(t *testing.T) {
+	var slowRequests []SlowRequest
+	e := echo.New()
+	var logs bytes.Buffer
+	e.Logger.SetOutput(&logs)
+	e.Use(SlowRequests(SlowRequestConfig{
+		Budget:       time.Hour,
+		Routes:       map[string]time.Duration{"GET /slow/:id": time.Millisecond},
+		RecordStages: true,
+		OnSlow: func(c echo.Context, slow SlowRequest) {
+			slowRequests = append(slowRequests, slow)
+		},
+	}))
+	handler := func(c echo.Context) error {
+		end := StartStage(c, "binding")
+		time.Sleep(2 * time.Millisecond)
+		end()
+		return c.NoContent(http.StatusAccepted)
+	}
+	e.GET("/slow/:id", handler)
+	e.GET("/fast/:id", handler)
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast/1", nil))
+	assert.Empty(t, slowRequests)
+	assert.Empty(t, logs.String())
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow/1", nil))
+	require.Len(t, slowRequests, 1)
+	slow := slowRequests[0]
+	assert.Equal(t, http.MethodGet, slow.Method)
+	assert.Equal(t, "/slow/:id", slow.Route)
+	assert.Equal(t, http.StatusAccepted, slow.Status)
+	assert.Equal(t, time.Millisecond, slow.Budget)
+	assert.Greater(t, slow.Duration, slow.Budget)
+	require.Len(t, slow.Stages, 1)
+	assert.Equal(t, "binding", slow.Stages[0].Name)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "GET /slow/:id", entry["slow_request"])
+	assert.Equal(t, "1ms", entry["budget"])
+	assert.Contains(t, entry["stages"], "binding")
+}
+
+func TestSlowRequestsError(t *testing.T) {
+	var slow SlowRequest
+	e := echo.New()
+	e.Logger.SetOutput(&bytes.Buffer{})
+	e.Use(SlowRequests(SlowRequestConfig{
+		Budget: time.Nanosecond,
+		OnSlow: func(c echo.Context, s SlowRequest) { slow = s },
+	}))
+	e.GET("/", func(c echo.Context) error {
+		time.Sleep(time.Millisecond)
+		return echo.ErrNotFound
+	})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, slow.Status)
+	assert.Nil(t, slow.Stages)
+}
+
+func TestStartStageWithoutMiddleware(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.NotPanics(t, StartStage(c, "binding"))
+}
@@ -0,0 +1,308 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMETextEventStream is the content type of server-sent events.
+const MIMETextEventStream = "text/event-stream"
+
+// HeaderLastEventID is sent by reconnecting event stream clients.
+const HeaderLastEventID = "Last-Event-ID"
+
+// ErrInvalidEvent is returned for an event whose id or type contains a line break,
+// which would end the field and let the rest be read as other fields or events.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Event is a server-sent event.
+type Event struct {
+	// ID is set by the SSEHub when empty.
+	ID string
+	// Event is the event type, "message" when empty.
+	Event string
+	// Data is the payload, written as one data line per line, with \n, \r\n or \r line
+	// breaks.
+	Data string
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// WriteEvent writes the event in the text/event-stream format. It returns ErrInvalidEvent,
+// writing nothing, for an id or type containing a line break.
+func WriteEvent(w io.Writer, e Event) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(lineBreaks.Replace(e.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// lineBreaks normalizes the line breaks of the event stream format to \n.
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+func (e Event) validate() error {
+	if strings.ContainsAny(e.ID, "\r\n") {
+		return fmt.Errorf("%w: line break in id %q", ErrInvalidEvent, e.ID)
+	}
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return fmt.Errorf("%w: line break in event type %q", ErrInvalidEvent, e.Event)
+	}
+	return nil
+}
+
+// SSEHubConfig configures an SSEHub.
+type SSEHubConfig struct {
+	// BufferSize is the number of events queued per client, 16 by default. Clients not
+	// keeping up are disconnected, and replay the missed events when they reconnect.
+	BufferSize int
+	// Replay is the number of recent events kept per topic, for clients reconnecting with
+	// a Last-Event-ID header, 100 by default.
+	Replay int
+	// Heartbeat is the interval of the comments keeping idle connections open, 15 seconds
+	// by default.
+	Heartbeat time.Duration
+}
+
+// DefaultSSEHubConfig is the default SSEHub config.
+var DefaultSSEHubConfig = SSEHubConfig{
+	BufferSize: 16,
+	Replay:     100,
+	Heartbeat:  15 * time.Second,
+}
+
+// SSEHubMetrics describes the clients of an SSEHub.
+type SSEHubMetrics struct {
+	// Clients is the number of connected clients.
+	Clients int
+	// Topics is the number of connected clients per topic.
+	Topics map[string]int
+	// Dropped counts the clients disconnected because they did not keep up.
+	Dropped uint64
+}
+
+// SSEHub broadcasts server-sent events to the clients subscribed to their topic, so
+// handlers publish events without managing connections.
+//
+// Usage:
+//
+//	hub := server.NewSSEHub(server.DefaultSSEHubConfig)
+//	s.GET("/events", hub.Handler(server.QueryTopics("topic")))
+//	...
+//	err := hub.Publish("orders", server.Event{Event: "created", Data: string(body)})
+type SSEHub struct {
+	config SSEHubConfig
+
+	mu      sync.Mutex
+	seq     uint64
+	clients map[*sseClient]struct{}
+	history map[string][]sseEntry
+	dropped uint64
+}
+
+type sseClient struct {
+	topics map[string]bool
+	events chan Event
+}
+
+type sseEntry struct {
+	seq   uint64
+	event Event
+}
+
+// NewSSEHub creates an SSEHub.
+func NewSSEHub(config SSEHubConfig) *SSEHub {
+	if config.BufferSize == 0 {
+		config.BufferSize = DefaultSSEHubConfig.BufferSize
+	}
+	if config.Replay == 0 {
+		config.Replay = DefaultSSEHubConfig.Replay
+	}
+	if config.Heartbeat == 0 {
+		config.Heartbeat = DefaultSSEHubConfig.Heartbeat
+	}
+	return &SSEHub{
+		config:  config,
+		clients: map[*sseClient]struct{}{},
+		history: map[string][]sseEntry{},
+	}
+}
+
+// Publish sends the event to the clients subscribed to the topic. Events without an id
+// get the next sequence number of the hub. It returns ErrInvalidEvent for an id or type
+// containing a line break.
+func (h *SSEHub) Publish(topic string, e Event) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	if e.ID == "" {
+		e.ID = strconv.FormatUint(h.seq, 10)
+	}
+	history := append(h.history[topic], sseEntry{seq: h.seq, event: e})
+	if len(history) > h.config.Replay {
+		history = history[len(history)-h.config.Replay:]
+	}
+	h.history[topic] = history
+
+	for client := range h.clients {
+		if !client.topics[topic] {
+			continue
+		}
+		select {
+		case client.events <- e:
+		default:
+			h.removeLocked(client)
+			h.dropped++
+		}
+	}
+	return nil
+}
+
+// Metrics returns the metrics of the connected clients.
+func (h *SSEHub) Metrics() SSEHubMetrics {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	metrics := SSEHubMetrics{Clients: len(h.clients), Topics: map[string]int{}, Dropped: h.dropped}
+	for client := range h.clients {
+		for topic := range client.topics {
+			metrics.Topics[topic]++
+		}
+	}
+	return metrics
+}
+
+// QueryTopics returns the topics of a client from the values of a query parameter.
+func QueryTopics(name string) func(c echo.Context) []string {
+	return func(c echo.Context) []string {
+		return c.QueryParams()[name]
+	}
+}
+
+// Handler returns a handler streaming the events of the topics returned by topics.
+// Clients reconnecting with a Last-Event-ID header first receive the events they missed,
+// as far as they are kept.
+func (h *SSEHub) Handler(topics func(c echo.Context) []string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		names := topics(c)
+		if len(names) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "no topics")
+		}
+		client := &sseClient{topics: map[string]bool{}, events: make(chan Event, h.config.BufferSize)}
+		for _, name := range names {
+			client.topics[name] = true
+		}
+		replay := h.subscribe(client, c.Request().Header.Get(HeaderLastEventID))
+		defer h.remove(client)
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, MIMETextEventStream)
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.WriteHeader(http.StatusOK)
+		for _, e := range replay {
+			if err := WriteEvent(res, e); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+
+		heartbeat := time.NewTicker(h.config.Heartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case e, ok := <-client.events:
+				if !ok {
+					// dropped for not keeping up
+					return nil
+				}
+				if err := WriteEvent(res, e); err != nil {
+					return nil
+				}
+			case <-heartbeat.C:
+				if _, err := io.WriteString(res, ": ping\n\n"); err != nil {
+					return nil
+				}
+			}
+			res.Flush()
+		}
+	}
+}
+
+// subscribe adds the client and returns the events it missed since the last event id.
+func (h *SSEHub) subscribe(client *sseClient, lastEventID string) []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[client] = struct{}{}
+	if lastEventID == "" {
+		return nil
+	}
+	// find the sequence number of the last event
+	var last uint64
+	found := false
+	for topic := range client.topics {
+		for _, entry := range h.history[topic] {
+			if entry.event.ID == lastEventID {
+				last, found = entry.seq, true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	var missed []sseEntry
+	for topic := range client.topics {
+		for _, entry := range h.history[topic] {
+			if entry.seq > last {
+				missed = append(missed, entry)
+			}
+		}
+	}
+	sort.Slice(missed, func(i, j int) bool { return missed[i].seq < missed[j].seq })
+	replay := make([]Event, len(missed))
+	for i, entry := range missed {
+		replay[i] = entry.event
+	}
+	return replay
+}
+
+func (h *SSEHub) remove(client *sseClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(client)
+}
+
+func (h *SSEHub) removeLocked(client *sseClient) {
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.events)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteEvent(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteEvent(&b, Event{ID: "1", Event: "created", Data: "a\nb", Retry: time.Second}))
+	assert.Equal(t, "id: 1\nevent: created\nretry: 1000\ndata: a\ndata: b\n\n", b.String())
+
+	b.Reset()
+	require.NoError(t, WriteEvent(&b, Event{Data: "a\r\nb\rc"}))
+	assert.Equal(t, "data: a\ndata: b\ndata: c\n\n", b.String())
+
+	b.Reset()
+	assert.ErrorIs(t, WriteEvent(&b, Event{ID: "1\n\nevent: admin", Data: "x"}), ErrInvalidEvent)
+	assert.ErrorIs(t, WriteEvent(&b, Event{Event: "created\rdata: forged", Data: "x"}), ErrInvalidEvent)
+	assert.Empty(t, b.String())
+	assert.ErrorIs(t, NewSSEHub(SSEHubConfig{}).Publish("orders", Event{ID: "1\n"}), ErrInvalidEvent)
+}
+
+// readEvents reads the data lines of count events from the stream.
+func readEvents(t *testing.T, reader *bufio.Reader, count int) []string {
+	var events []string
+	for len(events) < count {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			events = append(events, strings.TrimSuffix(data, "\n"))
+		}
+	}
+	return events
+}
+
+func TestSSEHub(t *testing.T) {
+	hub := NewSSEHub(DefaultSSEHubConfig)
+	e := echo.New()
+	e.GET("/events", hub.Handler(QueryTopics("topic")))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	require.NoError(t, hub.Publish("orders", Event{Data: "before"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events?topic=orders&topic=users", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, MIMETextEventStream, resp.Header.Get(echo.HeaderContentType))
+
+	assert.Eventually(t, func() bool { return hub.Metrics().Clients == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, map[string]int{"orders": 1, "users": 1}, hub.Metrics().Topics)
+
+	require.NoError(t, hub.Publish("orders", Event{Data: "order"}))
+	require.NoError(t, hub.Publish("other", Event{Data: "other"}))
+	require.NoError(t, hub.Publish("users", Event{Data: "user"}))
+	assert.Equal(t, []string{"order", "user"}, readEvents(t, bufio.NewReader(resp.Body), 2))
+
+	cancel()
+	assert.Eventually(t, func() bool { return hub.Metrics().Clients == 0 }, time.Second, time.Millisecond)
+}
+
+func TestSSEHubReplay(t *testing.T) {
+	hub := NewSSEHub(DefaultSSEHubConfig)
+	e := echo.New()
+	e.GET("/events", hub.Handler(QueryTopics("topic")))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	require.NoError(t, hub.Publish("orders", Event{Data: "1"}))
+	require.NoError(t, hub.Publish("users", Event{Data: "2"}))
+	require.NoError(t, hub.Publish("orders", Event{Data: "3"}))
+	require.NoError(t, hub.Publish("users", Event{Data: "4"}))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/events?topic=orders&topic=users", nil)
+	require.NoError(t, err)
+	req.Header.Set(HeaderLastEventID, "2")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, []string{"3", "4"}, readEvents(t, bufio.NewReader(resp.Body), 2))
+}
+
+func TestSSEHubDropsSlowClients(t *testing.T) {
+	hub := NewSSEHub(SSEHubConfig{BufferSize: 1})
+	client := &sseClient{topics: map[string]bool{"orders": true}, events: make(chan Event, 1)}
+	hub.subscribe(client, "")
+
+	require.NoError(t, hub.Publish("orders", Event{Data: "1"}))
+	require.NoError(t, hub.Publish("orders", Event{Data: "2"}))
+	metrics := hub.Metrics()
+	assert.Equal(t, 0, metrics.Clients)
+	assert.Equal(t, uint64(1), metrics.Dropped)
+	assert.Equal(t, "1", (<-client.events).Data)
+	_, ok := <-client.events
+	assert.False(t, ok)
+}
+
+func TestSSEHubNoTopics(t *testing.T) {
+	hub := NewSSEHub(DefaultSSEHubConfig)
+	e := echo.New()
+	e.GET("/events", hub.Handler(QueryTopics("topic")))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
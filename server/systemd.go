@@ -0,0 +1,64 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD is the first file descriptor passed by systemd socket activation.
+const systemdFirstFD = 3
+
+// SystemdListener is a socket passed by systemd socket activation.
+type SystemdListener struct {
+	net.Listener
+	// Name is the FileDescriptorName of the socket unit, "unknown" when not set.
+	Name string
+}
+
+// SystemdListeners returns the sockets passed by systemd socket activation, with the
+// LISTEN_FDS protocol, or nil when the process was not socket activated. Use them with
+// StartWithListener, so the service can listen on a privileged port without running as
+// root, and is started on demand by the first connection. The sockets are returned only
+// once, the environment variables are unset so child processes do not inherit them.
+func SystemdListeners() ([]SystemdListener, error) {
+	return systemdListeners(systemdFirstFD)
+}
+
+func systemdListeners(firstFD int) ([]SystemdListener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]SystemdListener, 0, count)
+	for i := 0; i < count; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(firstFD+i), name)
+		l, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+		listeners = append(listeners, SystemdListener{Listener: l, Name: name})
+	}
+	return listeners, nil
+}
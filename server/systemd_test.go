@@ -0,0 +1,50 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdListeners(t *testing.T) {
+	t.Run("not socket activated", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", "1")
+		t.Setenv("LISTEN_FDS", "1")
+		listeners, err := SystemdListeners()
+		assert.NoError(t, err)
+		assert.Nil(t, listeners)
+	})
+	t.Run("socket activated", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		file, err := l.(*net.TCPListener).File()
+		require.NoError(t, err)
+		// the tested code closes the descriptor it is passed, as it owns the systemd sockets
+		fd, err := syscall.Dup(int(file.Fd()))
+		file.Close()
+		require.NoError(t, err)
+
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		t.Setenv("LISTEN_FDS", "1")
+		t.Setenv("LISTEN_FDNAMES", "http")
+		listeners, err := systemdListeners(fd)
+		require.NoError(t, err)
+		require.Len(t, listeners, 1)
+		defer listeners[0].Close()
+		assert.Equal(t, "http", listeners[0].Name)
+		assert.Equal(t, l.Addr().String(), listeners[0].Addr().String())
+		_, ok := os.LookupEnv("LISTEN_FDS")
+		assert.False(t, ok)
+	})
+}
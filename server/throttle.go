@@ -0,0 +1,142 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// ThrottleConfig configures the Throttle middleware.
+type ThrottleConfig struct {
+	// BytesPerSecond is the bandwidth of a response, or of all responses to a client
+	// when PerClient is set.
+	BytesPerSecond int
+	// Burst is the number of bytes that may be written at once, BytesPerSecond by default.
+	Burst int
+	// PerClient shares the bandwidth between all concurrent responses to the same
+	// client IP, instead of limiting each response on its own.
+	PerClient bool
+}
+
+// Throttle returns a middleware limiting the bytes per second written to response
+// bodies, so large downloads cannot starve other requests on small instances.
+//
+// Usage:
+//
+//	e.GET("/downloads/*", download, server.Throttle(server.ThrottleConfig{BytesPerSecond: 1 << 20}))
+//
+// It panics when BytesPerSecond is not positive.
+func Throttle(config ThrottleConfig) echo.MiddlewareFunc {
+	if config.BytesPerSecond <= 0 {
+		panic(fmt.Sprintf("throttle: BytesPerSecond must be positive, got %d", config.BytesPerSecond))
+	}
+	if config.Burst <= 0 {
+		config.Burst = config.BytesPerSecond
+	}
+	clients := &clientLimiters{limiters: map[string]*clientLimiter{}}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var limiter *rate.Limiter
+			if config.PerClient {
+				client := clients.acquire(c.RealIP(), config)
+				defer clients.release(client)
+				limiter = client.limiter
+			} else {
+				limiter = rate.NewLimiter(rate.Limit(config.BytesPerSecond), config.Burst)
+			}
+			res := c.Response()
+			res.Writer = &throttledWriter{
+				ResponseWriter: res.Writer,
+				limiter:        limiter,
+				ctx:            c.Request().Context(),
+			}
+			return next(c)
+		}
+	}
+}
+
+// throttledWriter waits for the limiter before writing each chunk of the body.
+type throttledWriter struct {
+	http.ResponseWriter
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := min(len(b), w.limiter.Burst())
+		if err := w.limiter.WaitN(w.ctx, chunk); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(b[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[chunk:]
+	}
+	return written, nil
+}
+
+func (w *throttledWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// clientLimiters holds the limiter of each client, dropping limiters idle for a minute.
+type clientLimiters struct {
+	mu        sync.Mutex
+	limiters  map[string]*clientLimiter
+	nextPrune time.Time
+}
+
+type clientLimiter struct {
+	limiter *rate.Limiter
+	// inFlight is the number of responses using the limiter, which is not dropped
+	// while a long download is running
+	inFlight int
+	lastUsed time.Time
+}
+
+// acquire returns the limiter of the client for a response, until it is released.
+func (l *clientLimiters) acquire(ip string, config ThrottleConfig) *clientLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.After(l.nextPrune) {
+		for key, client := range l.limiters {
+			if client.inFlight == 0 && now.Sub(client.lastUsed) > time.Minute {
+				delete(l.limiters, key)
+			}
+		}
+		l.nextPrune = now.Add(time.Minute)
+	}
+	client, ok := l.limiters[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(config.BytesPerSecond), config.Burst)}
+		l.limiters[ip] = client
+	}
+	client.inFlight++
+	client.lastUsed = now
+	return client
+}
+
+func (l *clientLimiters) release(client *clientLimiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	client.inFlight--
+	client.lastUsed = time.Now()
+}
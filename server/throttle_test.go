@@ -0,0 +1,88 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	body := strings.Repeat("x", 3000)
+	handler := func(c echo.Context) error {
+		return c.String(http.StatusOK, body)
+	}
+
+	t.Run("per response", func(t *testing.T) {
+		e := echo.New()
+		e.GET("/", handler, Throttle(ThrottleConfig{BytesPerSecond: 10000, Burst: 1000}))
+
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		// the first 1000 bytes are the burst, the other 2000 take 200ms
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+		assert.Equal(t, body, rec.Body.String())
+	})
+	t.Run("per client", func(t *testing.T) {
+		e := echo.New()
+		e.GET("/", handler, Throttle(ThrottleConfig{BytesPerSecond: 20000, Burst: 1000, PerClient: true}))
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				assert.Equal(t, body, rec.Body.String())
+			}()
+		}
+		wg.Wait()
+		// both responses share 20000 bytes per second: 5000 bytes beyond the burst take 250ms
+		assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	})
+	t.Run("canceled request", func(t *testing.T) {
+		e := echo.New()
+		e.GET("/", handler, Throttle(ThrottleConfig{BytesPerSecond: 10, Burst: 10}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		e.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestThrottleInvalidConfig(t *testing.T) {
+	assert.Panics(t, func() { Throttle(ThrottleConfig{}) })
+	assert.Panics(t, func() { Throttle(ThrottleConfig{BytesPerSecond: -1}) })
+}
+
+func TestClientLimitersKeepInFlightLimiters(t *testing.T) {
+	clients := &clientLimiters{limiters: map[string]*clientLimiter{}}
+	config := ThrottleConfig{BytesPerSecond: 100, Burst: 100}
+	download := clients.acquire("10.0.0.1", config)
+	idle := clients.acquire("10.0.0.2", config)
+	clients.release(idle)
+
+	// a long download started more than a minute ago
+	download.lastUsed = time.Now().Add(-2 * time.Minute)
+	idle.lastUsed = time.Now().Add(-2 * time.Minute)
+	clients.nextPrune = time.Time{}
+	other := clients.acquire("10.0.0.3", config)
+	defer clients.release(other)
+
+	assert.Same(t, download, clients.acquire("10.0.0.1", config), "the limiter of a running download is shared")
+	assert.NotContains(t, clients.limiters, "10.0.0.2")
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// RequestTransform describes changes to incoming requests, applied in the order of the
+// fields: renames, then removals, then values set.
+type RequestTransform struct {
+	// RenameHeaders maps old header names to new ones.
+	RenameHeaders map[string]string
+	// RemoveHeaders lists headers to delete.
+	RemoveHeaders []string
+	// SetHeaders maps header names to values replacing those sent.
+	SetHeaders map[string]string
+	// RenameQuery maps old query parameter names to new ones.
+	RenameQuery map[string]string
+	// RemoveQuery lists query parameters to delete.
+	RemoveQuery []string
+	// SetQuery maps query parameter names to values replacing those sent.
+	SetQuery map[string]string
+	// Rewrite maps path patterns to replacements, with the syntax of echo's
+	// middleware.Rewrite, like "/v1/*": "/$1".
+	Rewrite map[string]string
+}
+
+// TransformRequest returns a middleware adapting requests before they are routed, so
+// blocks can serve legacy clients without bespoke handlers. Register it with Pre, so
+// path rewrites apply to routing.
+//
+// Usage:
+//
+//	s.Pre(server.TransformRequest(server.RequestTransform{
+//		RenameHeaders: map[string]string{"X-Auth-Token": echo.HeaderAuthorization},
+//		RenameQuery:   map[string]string{"pageSize": "per_page"},
+//		Rewrite:       map[string]string{"/api/v1/*": "/api/$1"},
+//	}))
+func TransformRequest(t RequestTransform) echo.MiddlewareFunc {
+	var rewrite echo.MiddlewareFunc
+	if len(t.Rewrite) > 0 {
+		rewrite = middleware.Rewrite(t.Rewrite)
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		handler := func(c echo.Context) error {
+			t.apply(c)
+			return next(c)
+		}
+		if rewrite != nil {
+			return rewrite(handler)
+		}
+		return handler
+	}
+}
+
+func (t RequestTransform) apply(c echo.Context) {
+	req := c.Request()
+	header := req.Header
+	for from, to := range t.RenameHeaders {
+		if values := header.Values(from); len(values) > 0 {
+			header.Del(from)
+			header[http.CanonicalHeaderKey(to)] = values
+		}
+	}
+	for _, name := range t.RemoveHeaders {
+		header.Del(name)
+	}
+	for name, value := range t.SetHeaders {
+		header.Set(name, value)
+	}
+
+	if len(t.RenameQuery) == 0 && len(t.RemoveQuery) == 0 && len(t.SetQuery) == 0 {
+		return
+	}
+	query := req.URL.Query()
+	for from, to := range t.RenameQuery {
+		if values, ok := query[from]; ok {
+			delete(query, from)
+			query[to] = values
+		}
+	}
+	for _, name := range t.RemoveQuery {
+		query.Del(name)
+	}
+	for name, value := range t.SetQuery {
+		query.Set(name, value)
+	}
+	req.URL.RawQuery = query.Encode()
+}
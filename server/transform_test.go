@@ -0,0 +1,66 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformRequest(t *testing.T) {
+	e := echo.New()
+	e.Pre(TransformRequest(RequestTransform{
+		RenameHeaders: map[string]string{"X-Auth-Token": "authorization"},
+		RemoveHeaders: []string{"X-Debug"},
+		SetHeaders:    map[string]string{"X-Client": "legacy"},
+		RenameQuery:   map[string]string{"pageSize": "per_page"},
+		RemoveQuery:   []string{"cacheBust"},
+		SetQuery:      map[string]string{"format": "json"},
+		Rewrite:       map[string]string{"/api/v1/*": "/api/$1"},
+	}))
+	e.GET("/api/users", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{
+			"auth":     c.Request().Header.Get(echo.HeaderAuthorization),
+			"token":    c.Request().Header.Get("X-Auth-Token"),
+			"debug":    c.Request().Header.Get("X-Debug"),
+			"client":   c.Request().Header.Get("X-Client"),
+			"per_page": c.QueryParam("per_page"),
+			"bust":     c.QueryParam("cacheBust"),
+			"format":   c.QueryParam("format"),
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users?pageSize=10&cacheBust=123&format=xml", nil)
+	req.Header.Set("X-Auth-Token", "Bearer abc")
+	req.Header.Set("X-Debug", "1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"auth": "Bearer abc",
+		"token": "",
+		"debug": "",
+		"client": "legacy",
+		"per_page": "10",
+		"bust": "",
+		"format": "json"
+	}`, rec.Body.String())
+}
+
+func TestTransformRequestHeadersOnly(t *testing.T) {
+	e := echo.New()
+	e.Pre(TransformRequest(RequestTransform{SetHeaders: map[string]string{"X-Client": "legacy"}}))
+	e.GET("/users", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Request().URL.RawQuery+" "+c.Request().Header.Get("X-Client"))
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?b=2&a=1", nil))
+	// the query is left as sent
+	assert.Equal(t, "b=2&a=1 legacy", rec.Body.String())
+}
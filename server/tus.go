@@ -0,0 +1,462 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tusVersion              = "1.0.0"
+	tusExtensions           = "creation,expiration,termination"
+	headerTusResumable      = "Tus-Resumable"
+	headerUploadOffset      = "Upload-Offset"
+	headerUploadLength      = "Upload-Length"
+	headerUploadMetadata    = "Upload-Metadata"
+	headerUploadExpires     = "Upload-Expires"
+	mimeOffsetOctetStream   = "application/offset+octet-stream"
+	defaultUploadExpiration = 24 * time.Hour
+
+	defaultUploadSweepInterval = time.Hour
+)
+
+var (
+	// ErrUploadNotFound is returned by an UploadStore for unknown upload ids.
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrOffsetMismatch is returned by an UploadStore appending at an offset other than
+	// the offset of the upload, like a concurrent PATCH did.
+	ErrOffsetMismatch = errors.New("offset does not match the upload")
+)
+
+// UploadInfo describes a resumable upload.
+type UploadInfo struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// ExpiresAt is when an incomplete upload is discarded.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Complete reports whether all bytes of the upload are received.
+func (u UploadInfo) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// Expired reports whether the upload is incomplete and expired at now.
+func (u UploadInfo) Expired(now time.Time) bool {
+	return !u.Complete() && now.After(u.ExpiresAt)
+}
+
+// UploadStore stores resumable uploads.
+type UploadStore interface {
+	Create(ctx context.Context, info UploadInfo) error
+	// Info returns ErrUploadNotFound for unknown ids.
+	Info(ctx context.Context, id string) (UploadInfo, error)
+	// Append writes the data at the offset of the upload, which must be its current
+	// offset, or else returns ErrOffsetMismatch, and returns the updated info. Data read
+	// before an error is kept.
+	Append(ctx context.Context, id string, offset int64, data io.Reader) (UploadInfo, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// UploadSweeper is implemented by UploadStores deleting the uploads expired before a
+// time, to discard uploads abandoned by their clients.
+type UploadSweeper interface {
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// TusConfig configures the resumable upload endpoints.
+type TusConfig struct {
+	Store UploadStore
+	// BasePath is where the endpoints are mounted, "/files" by default.
+	BasePath string
+	// MaxSize is the largest upload accepted, unlimited when 0.
+	MaxSize int64
+	// Expiration is how long an incomplete upload is kept, 24 hours by default.
+	Expiration time.Duration
+	// SweepInterval is how often the expired uploads are deleted, for stores implementing
+	// UploadSweeper, 1 hour by default. A negative interval disables the sweep, expired
+	// uploads are then only deleted when they are requested.
+	SweepInterval time.Duration
+	// OnComplete is called once, by the PATCH receiving the last byte of an upload.
+	OnComplete func(c echo.Context, info UploadInfo) error
+}
+
+// UseTus mounts the tus.io 1.0 resumable upload protocol at the base path, with the
+// creation, expiration and termination extensions: POST creates an upload, HEAD
+// returns its offset, PATCH appends to it and DELETE discards it.
+func (s *KapetaServer) UseTus(config TusConfig) {
+	if config.BasePath == "" {
+		config.BasePath = "/files"
+	}
+	if config.Expiration == 0 {
+		config.Expiration = defaultUploadExpiration
+	}
+	if config.SweepInterval == 0 {
+		config.SweepInterval = defaultUploadSweepInterval
+	}
+	if sweeper, ok := config.Store.(UploadSweeper); ok && config.SweepInterval > 0 {
+		s.sweepUploads(sweeper, config.SweepInterval)
+	}
+	t := &tus{config: config}
+	g := s.Group(strings.TrimSuffix(config.BasePath, "/"), t.protocol)
+	g.OPTIONS("", t.options)
+	g.POST("", t.create)
+	g.HEAD("/:id", t.head)
+	g.PATCH("/:id", t.patch)
+	g.DELETE("/:id", t.delete)
+}
+
+type tus struct {
+	config TusConfig
+}
+
+// sweepUploads deletes the expired uploads of the store every interval, until the server
+// shuts down.
+func (s *KapetaServer) sweepUploads(sweeper UploadSweeper, interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.OnShutdown(func(context.Context) error {
+		cancel()
+		return nil
+	})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := sweeper.DeleteExpired(ctx, now); err != nil {
+					s.Logger.Errorf("deleting expired uploads: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// protocol checks the protocol version and sets the tus response headers.
+func (t *tus) protocol(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(headerTusResumable, tusVersion)
+		if c.Request().Method != http.MethodOptions && c.Request().Header.Get(headerTusResumable) != tusVersion {
+			c.Response().Header().Set("Tus-Version", tusVersion)
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "unsupported tus version")
+		}
+		return next(c)
+	}
+}
+
+func (t *tus) options(c echo.Context) error {
+	header := c.Response().Header()
+	header.Set("Tus-Version", tusVersion)
+	header.Set("Tus-Extension", tusExtensions)
+	if t.config.MaxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(t.config.MaxSize, 10))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (t *tus) create(c echo.Context) error {
+	length, err := strconv.ParseInt(c.Request().Header.Get(headerUploadLength), 10, 64)
+	if err != nil || length < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing or invalid Upload-Length")
+	}
+	if t.config.MaxSize > 0 && length > t.config.MaxSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "upload exceeds Tus-Max-Size")
+	}
+	metadata, err := parseUploadMetadata(c.Request().Header.Get(headerUploadMetadata))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return err
+	}
+	info := UploadInfo{
+		ID:        id,
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(t.config.Expiration).UTC(),
+	}
+	if err := t.config.Store.Create(c.Request().Context(), info); err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderLocation, strings.TrimSuffix(t.config.BasePath, "/")+"/"+id)
+	c.Response().Header().Set(headerUploadExpires, info.ExpiresAt.Format(http.TimeFormat))
+	if length == 0 && t.config.OnComplete != nil {
+		if err := t.config.OnComplete(c, info); err != nil {
+			return err
+		}
+	}
+	return c.NoContent(http.StatusCreated)
+}
+
+func (t *tus) head(c echo.Context) error {
+	info, err := t.info(c)
+	if err != nil {
+		return err
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set(headerUploadOffset, strconv.FormatInt(info.Offset, 10))
+	header.Set(headerUploadLength, strconv.FormatInt(info.Length, 10))
+	header.Set(headerUploadExpires, info.ExpiresAt.Format(http.TimeFormat))
+	return c.NoContent(http.StatusOK)
+}
+
+func (t *tus) patch(c echo.Context) error {
+	req := c.Request()
+	if req.Header.Get(echo.HeaderContentType) != mimeOffsetOctetStream {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be "+mimeOffsetOctetStream)
+	}
+	offset, err := strconv.ParseInt(req.Header.Get(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing or invalid Upload-Offset")
+	}
+	info, err := t.info(c)
+	if err != nil {
+		return err
+	}
+	if offset != info.Offset {
+		return echo.NewHTTPError(http.StatusConflict, "Upload-Offset does not match the upload")
+	}
+
+	wasComplete := info.Complete()
+	info, err = t.config.Store.Append(req.Context(), info.ID, offset, io.LimitReader(req.Body, info.Length-offset))
+	if errors.Is(err, ErrOffsetMismatch) {
+		return echo.NewHTTPError(http.StatusConflict, "Upload-Offset does not match the upload").SetInternal(err)
+	}
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(headerUploadOffset, strconv.FormatInt(info.Offset, 10))
+	c.Response().Header().Set(headerUploadExpires, info.ExpiresAt.Format(http.TimeFormat))
+	// a PATCH replayed on a complete upload does not complete it again
+	if !wasComplete && info.Complete() && t.config.OnComplete != nil {
+		if err := t.config.OnComplete(c, info); err != nil {
+			return err
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (t *tus) delete(c echo.Context) error {
+	info, err := t.info(c)
+	if err != nil {
+		return err
+	}
+	if err := t.config.Store.Delete(c.Request().Context(), info.ID); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// info returns the upload of the request, discarding it when it expired.
+func (t *tus) info(c echo.Context) (UploadInfo, error) {
+	ctx := c.Request().Context()
+	info, err := t.config.Store.Info(ctx, c.Param("id"))
+	if errors.Is(err, ErrUploadNotFound) {
+		return info, echo.NewHTTPError(http.StatusNotFound, "upload not found")
+	}
+	if err != nil {
+		return info, err
+	}
+	if info.Expired(time.Now()) {
+		if err := t.config.Store.Delete(ctx, info.ID); err != nil {
+			return info, err
+		}
+		return info, echo.NewHTTPError(http.StatusGone, "upload expired")
+	}
+	return info, nil
+}
+
+// parseUploadMetadata parses the "key base64value,key2 base64value" list of Upload-Metadata.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if key == "" || err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata %q", pair)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// FileUploadStore is an UploadStore keeping uploads as files in a directory, with the
+// data in <id>.bin and the info in <id>.json.
+type FileUploadStore struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+// uploadLock is the lock of an upload, kept while operations hold or wait for it.
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewFileUploadStore creates a FileUploadStore in the directory, which must exist.
+func NewFileUploadStore(dir string) *FileUploadStore {
+	return &FileUploadStore{dir: dir, locks: map[string]*uploadLock{}}
+}
+
+// DataPath returns the path of the data file of the upload, to read completed uploads.
+func (s *FileUploadStore) DataPath(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".bin")
+}
+
+func (s *FileUploadStore) infoPath(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+// lock serializes the operations on an upload, without blocking other uploads. The lock
+// is dropped once no operation uses it, so unknown ids do not accumulate.
+func (s *FileUploadStore) lock(id string) func() {
+	s.mu.Lock()
+	l := s.locks[id]
+	if l == nil {
+		l = &uploadLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *FileUploadStore) Create(_ context.Context, info UploadInfo) error {
+	defer s.lock(info.ID)()
+	if err := os.WriteFile(s.DataPath(info.ID), nil, 0o600); err != nil {
+		return err
+	}
+	return s.writeInfo(info)
+}
+
+func (s *FileUploadStore) Info(_ context.Context, id string) (UploadInfo, error) {
+	defer s.lock(id)()
+	return s.readInfo(id)
+}
+
+func (s *FileUploadStore) Append(_ context.Context, id string, offset int64, data io.Reader) (UploadInfo, error) {
+	defer s.lock(id)()
+	info, err := s.readInfo(id)
+	if err != nil {
+		return info, err
+	}
+	if offset != info.Offset {
+		return info, fmt.Errorf("%w: append at offset %d, upload is at %d", ErrOffsetMismatch, offset, info.Offset)
+	}
+	file, err := os.OpenFile(s.DataPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return info, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return info, err
+	}
+	written, copyErr := io.Copy(file, data)
+	info.Offset += written
+	if err := s.writeInfo(info); err != nil {
+		return info, err
+	}
+	return info, copyErr
+}
+
+func (s *FileUploadStore) Delete(_ context.Context, id string) error {
+	defer s.lock(id)()
+	return s.delete(id)
+}
+
+// DeleteExpired deletes the uploads expired at now.
+func (s *FileUploadStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		errs = append(errs, s.deleteExpired(strings.TrimSuffix(filepath.Base(path), ".json"), now))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *FileUploadStore) deleteExpired(id string, now time.Time) error {
+	defer s.lock(id)()
+	info, err := s.readInfo(id)
+	if errors.Is(err, ErrUploadNotFound) {
+		// deleted meanwhile
+		return nil
+	}
+	if err != nil || !info.Expired(now) {
+		return err
+	}
+	return s.delete(id)
+}
+
+// delete removes the files of the upload, with its lock held.
+func (s *FileUploadStore) delete(id string) error {
+	err := os.Remove(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrUploadNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.DataPath(id))
+}
+
+func (s *FileUploadStore) readInfo(id string) (UploadInfo, error) {
+	var info UploadInfo
+	data, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return info, ErrUploadNotFound
+	}
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+func (s *FileUploadStore) writeInfo(info UploadInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.infoPath(info.ID), data, 0o600)
+}
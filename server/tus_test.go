@@ -0,0 +1,194 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTus(t *testing.T) {
+	store := NewFileUploadStore(t.TempDir())
+	var completed []UploadInfo
+	s := New()
+	s.UseTus(TusConfig{
+		Store:   store,
+		MaxSize: 1 << 20,
+		OnComplete: func(c echo.Context, info UploadInfo) error {
+			completed = append(completed, info)
+			return nil
+		},
+	})
+
+	serve := func(method, target string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set(headerTusResumable, tusVersion)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+	patch := func(location, offset, data string) *httptest.ResponseRecorder {
+		return serve(http.MethodPatch, location, strings.NewReader(data), map[string]string{
+			echo.HeaderContentType: mimeOffsetOctetStream,
+			headerUploadOffset:     offset,
+		})
+	}
+
+	t.Run("options", func(t *testing.T) {
+		rec := serve(http.MethodOptions, "/files", nil, nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, tusExtensions, rec.Header().Get("Tus-Extension"))
+		assert.Equal(t, "1048576", rec.Header().Get("Tus-Max-Size"))
+	})
+
+	rec := serve(http.MethodPost, "/files", nil, map[string]string{
+		headerUploadLength:   "11",
+		headerUploadMetadata: "filename " + base64.StdEncoding.EncodeToString([]byte("hello.txt")),
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	location := rec.Header().Get(echo.HeaderLocation)
+	assert.True(t, strings.HasPrefix(location, "/files/"))
+	assert.NotEmpty(t, rec.Header().Get(headerUploadExpires))
+
+	t.Run("resumes at the offset", func(t *testing.T) {
+		rec := patch(location, "0", "hello")
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "5", rec.Header().Get(headerUploadOffset))
+
+		rec = serve(http.MethodHead, location, nil, nil)
+		assert.Equal(t, "5", rec.Header().Get(headerUploadOffset))
+		assert.Equal(t, "11", rec.Header().Get(headerUploadLength))
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+
+		assert.Equal(t, http.StatusConflict, patch(location, "0", "hello").Code)
+		assert.Empty(t, completed)
+
+		rec = patch(location, "5", " world and more")
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "11", rec.Header().Get(headerUploadOffset))
+		require.Len(t, completed, 1)
+		assert.Equal(t, "hello.txt", completed[0].Metadata["filename"])
+
+		data, err := os.ReadFile(store.DataPath(completed[0].ID))
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(data))
+
+		// a replayed final PATCH does not complete the upload again
+		rec = patch(location, "11", "")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Len(t, completed, 1)
+	})
+	t.Run("terminates", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, location, nil, nil).Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodHead, location, nil, nil).Code)
+	})
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/files", nil)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/files", nil, nil).Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, serve(http.MethodPost, "/files", nil, map[string]string{headerUploadLength: "2000000"}).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/files", nil, map[string]string{headerUploadLength: "1", headerUploadMetadata: "name !!"}).Code)
+
+		rec = serve(http.MethodPost, "/files", nil, map[string]string{headerUploadLength: "3"})
+		other := rec.Header().Get(echo.HeaderLocation)
+		rec = serve(http.MethodPatch, other, strings.NewReader("abc"), map[string]string{headerUploadOffset: "0"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+	t.Run("expires", func(t *testing.T) {
+		ctx := context.Background()
+		require.NoError(t, store.Create(ctx, UploadInfo{ID: "old", Length: 10, ExpiresAt: time.Now().Add(-time.Minute)}))
+		assert.Equal(t, http.StatusGone, serve(http.MethodHead, "/files/old", nil, nil).Code)
+		_, err := store.Info(ctx, "old")
+		assert.ErrorIs(t, err, ErrUploadNotFound)
+	})
+}
+
+// racingUploadStore appends a byte before every Append, like a concurrent PATCH.
+type racingUploadStore struct {
+	*FileUploadStore
+}
+
+func (s racingUploadStore) Append(ctx context.Context, id string, offset int64, data io.Reader) (UploadInfo, error) {
+	if _, err := s.FileUploadStore.Append(ctx, id, offset, strings.NewReader("x")); err != nil {
+		return UploadInfo{}, err
+	}
+	return s.FileUploadStore.Append(ctx, id, offset, data)
+}
+
+func TestTusConcurrentPatch(t *testing.T) {
+	s := New()
+	s.UseTus(TusConfig{Store: racingUploadStore{NewFileUploadStore(t.TempDir())}})
+	req := httptest.NewRequest(http.MethodPost, "/files", nil)
+	req.Header.Set(headerTusResumable, tusVersion)
+	req.Header.Set(headerUploadLength, "5")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPatch, rec.Header().Get(echo.HeaderLocation), strings.NewReader("hello"))
+	req.Header.Set(headerTusResumable, tusVersion)
+	req.Header.Set(echo.HeaderContentType, mimeOffsetOctetStream)
+	req.Header.Set(headerUploadOffset, "0")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestFileUploadStoreLocks(t *testing.T) {
+	store := NewFileUploadStore(t.TempDir())
+	s := New()
+	s.UseTus(TusConfig{Store: store})
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest(http.MethodHead, "/files/unknown"+strconv.Itoa(i), nil)
+		req.Header.Set(headerTusResumable, tusVersion)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.Empty(t, store.locks)
+}
+
+func TestTusSweep(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileUploadStore(t.TempDir())
+	expired := time.Now().Add(-time.Minute)
+	require.NoError(t, store.Create(ctx, UploadInfo{ID: "abandoned", Length: 10, ExpiresAt: expired}))
+	require.NoError(t, store.Create(ctx, UploadInfo{ID: "complete", Length: 0, ExpiresAt: expired}))
+	require.NoError(t, store.Create(ctx, UploadInfo{ID: "running", Length: 10, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	s := New()
+	s.UseTus(TusConfig{Store: store, SweepInterval: 10 * time.Millisecond})
+	defer s.Shutdown(ctx)
+
+	require.Eventually(t, func() bool {
+		_, err := store.Info(ctx, "abandoned")
+		return errors.Is(err, ErrUploadNotFound)
+	}, time.Second, 10*time.Millisecond)
+	_, err := os.Stat(store.DataPath("abandoned"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = store.Info(ctx, "complete")
+	assert.NoError(t, err)
+	_, err = store.Info(ctx, "running")
+	assert.NoError(t, err)
+}
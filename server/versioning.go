@@ -0,0 +1,98 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderAcceptVersion is the request header selecting the API version of a Versioned route.
+const HeaderAcceptVersion = "Accept-Version"
+
+// HeaderAPIVersion is the response header with the API version that served the request.
+const HeaderAPIVersion = "API-Version"
+
+// APIVersionKey holds the API version selected by a Versioned route.
+var APIVersionKey = NewKey[string]("kapeta.api_version")
+
+// vendorVersion matches the version of a vendored media type, e.g. application/vnd.acme.v2+json.
+var vendorVersion = regexp.MustCompile(`^application/vnd\.[^+]+\.v([^.+]+)(\+[a-z]+)?$`)
+
+// Versioned returns a handler dispatching to the handler registered for the requested
+// API version. The version is read from the Accept-Version header, or from a vendored
+// media type in the Accept header, either as application/vnd.acme.v2+json or as
+// application/json;version=2. Versions may be written with or without a leading "v".
+// Requests without a version are served by defaultVersion, unknown versions are
+// rejected with 406 Not Acceptable.
+//
+// Usage:
+//
+//	e.GET("/users/:id", server.Versioned("1", map[string]echo.HandlerFunc{
+//		"1": getUserV1,
+//		"2": getUserV2,
+//	}))
+func Versioned(defaultVersion string, handlers map[string]echo.HandlerFunc) echo.HandlerFunc {
+	defaultVersion = normalizeVersion(defaultVersion)
+	versions := make(map[string]echo.HandlerFunc, len(handlers))
+	supported := make([]string, 0, len(handlers))
+	for version, handler := range handlers {
+		version = normalizeVersion(version)
+		versions[version] = handler
+		supported = append(supported, version)
+	}
+	sort.Strings(supported)
+	if _, ok := versions[defaultVersion]; !ok {
+		panic(fmt.Sprintf("default API version %q has no handler", defaultVersion))
+	}
+
+	return func(c echo.Context) error {
+		c.Response().Header().Add(echo.HeaderVary, HeaderAcceptVersion)
+		c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+		version := requestedVersion(c.Request())
+		if version == "" {
+			version = defaultVersion
+		}
+		handler, ok := versions[version]
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotAcceptable,
+				fmt.Sprintf("unsupported API version %q, supported versions: %s", version, strings.Join(supported, ", ")))
+		}
+		Set(c, APIVersionKey, version)
+		c.Response().Header().Set(HeaderAPIVersion, version)
+		return handler(c)
+	}
+}
+
+func requestedVersion(req *http.Request) string {
+	if version := req.Header.Get(HeaderAcceptVersion); version != "" {
+		return normalizeVersion(version)
+	}
+	for _, accept := range strings.Split(req.Header.Get(echo.HeaderAccept), ",") {
+		mediaType, params, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+		if version := params["version"]; version != "" {
+			return normalizeVersion(version)
+		}
+		if match := vendorVersion.FindStringSubmatch(mediaType); match != nil {
+			return normalizeVersion(match[1])
+		}
+	}
+	return ""
+}
+
+func normalizeVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if len(version) > 1 && (version[0] == 'v' || version[0] == 'V') {
+		return version[1:]
+	}
+	return version
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersioned(t *testing.T) {
+	e := echo.New()
+	handler := func(name string) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			version, _ := Get(c, APIVersionKey)
+			return c.String(http.StatusOK, name+":"+version)
+		}
+	}
+	e.GET("/users", Versioned("v1", map[string]echo.HandlerFunc{
+		"1":  handler("first"),
+		"v2": handler("second"),
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+		want   string
+	}{
+		{name: "default", code: http.StatusOK, want: "first:1"},
+		{name: "accept version", header: HeaderAcceptVersion, value: "2", code: http.StatusOK, want: "second:2"},
+		{name: "accept version with prefix", header: HeaderAcceptVersion, value: "v2", code: http.StatusOK, want: "second:2"},
+		{name: "vendored media type", header: echo.HeaderAccept, value: "application/vnd.kapeta.v2+json", code: http.StatusOK, want: "second:2"},
+		{name: "version parameter", header: echo.HeaderAccept, value: "text/html, application/json;version=1", code: http.StatusOK, want: "first:1"},
+		{name: "plain accept", header: echo.HeaderAccept, value: "application/json", code: http.StatusOK, want: "first:1"},
+		{name: "unknown version", header: HeaderAcceptVersion, value: "3", code: http.StatusNotAcceptable, want: `unsupported API version \"3\", supported versions: 1, 2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.code, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.want)
+			assert.Equal(t, HeaderAcceptVersion, rec.Header().Get(echo.HeaderVary))
+		})
+	}
+}
+
+func TestVersionedUnknownDefault(t *testing.T) {
+	assert.Panics(t, func() {
+		Versioned("2", map[string]echo.HandlerFunc{"1": func(c echo.Context) error { return nil }})
+	})
+}
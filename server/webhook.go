@@ -0,0 +1,195 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrInvalidSignature is returned by a WebhookVerifier for requests it does not accept.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// WebhookVerifier checks the signature of an inbound webhook request.
+type WebhookVerifier interface {
+	Verify(header http.Header, body []byte) error
+}
+
+// WebhookConfig configures the VerifyWebhookWithConfig middleware.
+type WebhookConfig struct {
+	// Verifier checks the signature of the requests.
+	Verifier WebhookVerifier
+	// MaxBodySize is the largest body buffered for the verifier, 1 MiB by default. Larger
+	// requests are rejected with 413 Request Entity Too Large.
+	MaxBodySize int64
+}
+
+// DefaultWebhookConfig is the default VerifyWebhookWithConfig middleware config.
+var DefaultWebhookConfig = WebhookConfig{
+	MaxBodySize: 1 << 20,
+}
+
+// VerifyWebhook returns a middleware verifying the signature of requests with the
+// verifier, see VerifyWebhookWithConfig.
+//
+// Usage:
+//
+//	e.POST("/webhooks/github", handleGitHub, server.VerifyWebhook(&server.GitHubVerifier{Secret: secret}))
+func VerifyWebhook(verifier WebhookVerifier) echo.MiddlewareFunc {
+	return VerifyWebhookWithConfig(WebhookConfig{Verifier: verifier})
+}
+
+// VerifyWebhookWithConfig returns a middleware rejecting requests whose signature is not
+// accepted by the verifier with 401 Unauthorized. The body is buffered for the verifier
+// and restored, so handlers and the binder read it as usual.
+func VerifyWebhookWithConfig(config WebhookConfig) echo.MiddlewareFunc {
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultWebhookConfig.MaxBodySize
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > config.MaxBodySize {
+				return webhookTooLarge(config)
+			}
+			var body []byte
+			if req.Body != nil {
+				var err error
+				body, err = io.ReadAll(io.LimitReader(req.Body, config.MaxBodySize+1))
+				if err != nil {
+					return err
+				}
+				if int64(len(body)) > config.MaxBodySize {
+					return webhookTooLarge(config)
+				}
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			if err := config.Verifier.Verify(req.Header, body); err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid webhook signature").SetInternal(err)
+			}
+			return next(c)
+		}
+	}
+}
+
+func webhookTooLarge(config WebhookConfig) error {
+	return echo.NewHTTPError(http.StatusRequestEntityTooLarge,
+		fmt.Sprintf("webhook body exceeds %d bytes", config.MaxBodySize))
+}
+
+// HMACVerifier verifies a generic HMAC-SHA256 signature of the body sent in a header.
+type HMACVerifier struct {
+	Secret []byte
+	// Header carries the signature, X-Signature by default.
+	Header string
+	// Prefix is removed from the header value before decoding, e.g. "sha256=".
+	Prefix string
+	// Base64 decodes the signature as standard base64 instead of hex.
+	Base64 bool
+}
+
+func (v *HMACVerifier) Verify(header http.Header, body []byte) error {
+	name := v.Header
+	if name == "" {
+		name = "X-Signature"
+	}
+	value, ok := strings.CutPrefix(header.Get(name), v.Prefix)
+	if !ok || value == "" {
+		return fmt.Errorf("%w: missing %s", ErrInvalidSignature, name)
+	}
+	var signature []byte
+	var err error
+	if v.Base64 {
+		signature, err = base64.StdEncoding.DecodeString(value)
+	} else {
+		signature, err = hex.DecodeString(value)
+	}
+	if err != nil || !hmac.Equal(signature, hmacSHA256(v.Secret, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// GitHubVerifier verifies the X-Hub-Signature-256 header of GitHub webhooks.
+type GitHubVerifier struct {
+	Secret []byte
+}
+
+func (v *GitHubVerifier) Verify(header http.Header, body []byte) error {
+	hmacVerifier := HMACVerifier{Secret: v.Secret, Header: "X-Hub-Signature-256", Prefix: "sha256="}
+	return hmacVerifier.Verify(header, body)
+}
+
+// StripeVerifier verifies the Stripe-Signature header, "t=<unix time>,v1=<signature>",
+// signing the timestamp and the body. Several v1 signatures are accepted during secret rotation.
+type StripeVerifier struct {
+	Secret []byte
+	// Header carries the signature, Stripe-Signature by default, for services using the same scheme.
+	Header string
+	// Tolerance is the maximum age of the timestamp, 5 minutes by default.
+	Tolerance time.Duration
+
+	now func() time.Time
+}
+
+func (v *StripeVerifier) Verify(header http.Header, body []byte) error {
+	name := v.Header
+	if name == "" {
+		name = "Stripe-Signature"
+	}
+	tolerance := v.Tolerance
+	if tolerance == 0 {
+		tolerance = 5 * time.Minute
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header.Get(name), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return fmt.Errorf("%w: malformed %s", ErrInvalidSignature, name)
+	}
+	if age := now().Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp outside the tolerance", ErrInvalidSignature)
+	}
+
+	expected := hmacSHA256(v.Secret, append([]byte(timestamp+"."), body...))
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func hmacSHA256(secret, message []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
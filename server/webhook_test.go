@@ -0,0 +1,117 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	webhookSecret = []byte("whsec_test")
+	webhookBody   = []byte(`{"event":"paid"}`)
+)
+
+func TestHMACVerifier(t *testing.T) {
+	signature := hmacSHA256(webhookSecret, webhookBody)
+
+	header := http.Header{}
+	header.Set("X-Signature", hex.EncodeToString(signature))
+	assert.NoError(t, (&HMACVerifier{Secret: webhookSecret}).Verify(header, webhookBody))
+	assert.ErrorIs(t, (&HMACVerifier{Secret: webhookSecret}).Verify(header, []byte(`{}`)), ErrInvalidSignature)
+	assert.ErrorIs(t, (&HMACVerifier{Secret: webhookSecret}).Verify(http.Header{}, webhookBody), ErrInvalidSignature)
+
+	header = http.Header{}
+	header.Set("X-Custom", base64.StdEncoding.EncodeToString(signature))
+	assert.NoError(t, (&HMACVerifier{Secret: webhookSecret, Header: "X-Custom", Base64: true}).Verify(header, webhookBody))
+}
+
+func TestGitHubVerifier(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(hmacSHA256(webhookSecret, webhookBody)))
+	verifier := &GitHubVerifier{Secret: webhookSecret}
+	assert.NoError(t, verifier.Verify(header, webhookBody))
+
+	header.Set("X-Hub-Signature-256", hex.EncodeToString(hmacSHA256(webhookSecret, webhookBody)))
+	assert.ErrorIs(t, verifier.Verify(header, webhookBody), ErrInvalidSignature)
+}
+
+func TestStripeVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	verifier := &StripeVerifier{Secret: webhookSecret, now: func() time.Time { return now }}
+	sign := func(timestamp time.Time, secret []byte) string {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		return hex.EncodeToString(hmacSHA256(secret, append([]byte(ts+"."), webhookBody...)))
+	}
+	verify := func(value string) error {
+		header := http.Header{}
+		header.Set("Stripe-Signature", value)
+		return verifier.Verify(header, webhookBody)
+	}
+
+	assert.NoError(t, verify("t=1700000000,v1="+sign(now, webhookSecret)))
+	assert.NoError(t, verify("t=1700000000,v1="+sign(now, []byte("old"))+",v1="+sign(now, webhookSecret)))
+	assert.ErrorIs(t, verify("t=1700000000,v1="+sign(now, []byte("other"))), ErrInvalidSignature)
+	old := now.Add(-time.Hour)
+	assert.ErrorContains(t, verify("t="+strconv.FormatInt(old.Unix(), 10)+",v1="+sign(old, webhookSecret)), "tolerance")
+	assert.ErrorContains(t, verify("v1="+sign(now, webhookSecret)), "malformed")
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	e := echo.New()
+	e.POST("/webhooks", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	}, VerifyWebhook(&GitHubVerifier{Secret: webhookSecret}))
+
+	serve := func(signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(string(webhookBody)))
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("sha256=" + hex.EncodeToString(hmacSHA256(webhookSecret, webhookBody)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, string(webhookBody), rec.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, serve("sha256=00").Code)
+}
+
+func TestVerifyWebhookMaxBodySize(t *testing.T) {
+	e := echo.New()
+	e.POST("/webhooks", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, VerifyWebhookWithConfig(WebhookConfig{
+		Verifier:    &GitHubVerifier{Secret: webhookSecret},
+		MaxBodySize: int64(len(webhookBody)),
+	}))
+	signature := "sha256=" + hex.EncodeToString(hmacSHA256(webhookSecret, webhookBody))
+
+	serve := func(body io.Reader) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", body)
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, serve(strings.NewReader(string(webhookBody))))
+	large := string(webhookBody) + " "
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(strings.NewReader(large)))
+	// without a content length, the limit applies to the bytes read
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(io.MultiReader(strings.NewReader(large))))
+}
@@ -0,0 +1,277 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+// ErrSendQueueFull is returned by WSConn.Send when the client does not keep up. The
+// connection is closed.
+var ErrSendQueueFull = errors.New("websocket send queue full")
+
+// ErrConnClosed is returned by WSConn.Send after the connection closed.
+var ErrConnClosed = errors.New("websocket connection closed")
+
+// WSHubConfig configures a WSHub.
+type WSHubConfig struct {
+	// SendQueue is the number of messages queued per connection, 16 by default.
+	SendQueue int
+	// Authorize is called with the rooms a client asks to join before the connection is
+	// upgraded. It rejects the client by returning an error, like echo.ErrForbidden.
+	Authorize func(c echo.Context, rooms []string) error
+	// CheckOrigin accepts the Origin of the upgrade request. By default the origin must be
+	// absent or have the host of the request.
+	CheckOrigin func(req *http.Request) bool
+	// OnJoin and OnLeave are called when a connection joins and leaves a room.
+	OnJoin  func(conn *WSConn, room string)
+	OnLeave func(conn *WSConn, room string)
+	// OnMessage is called with every message received from a connection.
+	OnMessage func(conn *WSConn, msg []byte)
+}
+
+// DefaultWSHubConfig is the default WSHub config.
+var DefaultWSHubConfig = WSHubConfig{
+	SendQueue:   16,
+	CheckOrigin: sameOrigin,
+}
+
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == req.Host
+}
+
+// WSHub manages WebSocket connections grouped in rooms, with broadcast and a send queue
+// per connection, so realtime features do not start from raw upgraded connections.
+//
+// Usage:
+//
+//	hub := server.NewWSHub(server.WSHubConfig{OnMessage: func(conn *server.WSConn, msg []byte) {
+//		hub.Broadcast("chat", msg)
+//	}})
+//	s.GET("/ws", hub.Handler(server.QueryTopics("room")))
+type WSHub struct {
+	config WSHubConfig
+
+	mu    sync.Mutex
+	rooms map[string]map[*WSConn]struct{}
+}
+
+// WSConn is a WebSocket connection of a WSHub.
+type WSConn struct {
+	hub  *WSHub
+	ws   *websocket.Conn
+	send chan []byte
+
+	// Request is the upgrade request, holding the identity of the client.
+	Request *http.Request
+
+	mu     sync.Mutex
+	closed bool
+	rooms  map[string]struct{}
+}
+
+// NewWSHub creates a WSHub.
+func NewWSHub(config WSHubConfig) *WSHub {
+	if config.SendQueue == 0 {
+		config.SendQueue = DefaultWSHubConfig.SendQueue
+	}
+	if config.CheckOrigin == nil {
+		config.CheckOrigin = DefaultWSHubConfig.CheckOrigin
+	}
+	return &WSHub{config: config, rooms: map[string]map[*WSConn]struct{}{}}
+}
+
+// Handler returns a handler upgrading requests to WebSocket connections, which join the
+// rooms returned by rooms.
+func (h *WSHub) Handler(rooms func(c echo.Context) []string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		names := rooms(c)
+		if h.config.Authorize != nil {
+			if err := h.config.Authorize(c, names); err != nil {
+				return err
+			}
+		}
+		server := websocket.Server{
+			Handshake: func(config *websocket.Config, req *http.Request) error {
+				if !h.config.CheckOrigin(req) {
+					return errors.New("origin not allowed")
+				}
+				return nil
+			},
+			Handler: func(ws *websocket.Conn) {
+				h.serve(ws, c.Request(), names)
+			},
+		}
+		server.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
+
+func (h *WSHub) serve(ws *websocket.Conn, req *http.Request, rooms []string) {
+	conn := &WSConn{
+		hub:     h,
+		ws:      ws,
+		send:    make(chan []byte, h.config.SendQueue),
+		Request: req,
+		rooms:   map[string]struct{}{},
+	}
+	for _, room := range rooms {
+		conn.Join(room)
+	}
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		conn.writeLoop()
+	}()
+
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			break
+		}
+		if h.config.OnMessage != nil {
+			h.config.OnMessage(conn, msg)
+		}
+	}
+	conn.Close()
+	<-writerDone
+}
+
+// Broadcast queues the message for every connection in the room.
+func (h *WSHub) Broadcast(room string, msg []byte) {
+	for _, conn := range h.members(room) {
+		// a full queue closes the connection
+		_ = conn.Send(msg)
+	}
+}
+
+// Members returns the number of connections in the room.
+func (h *WSHub) Members(room string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.rooms[room])
+}
+
+func (h *WSHub) members(room string) []*WSConn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	conns := make([]*WSConn, 0, len(h.rooms[room]))
+	for conn := range h.rooms[room] {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// Join adds the connection to the room.
+func (conn *WSConn) Join(room string) {
+	h := conn.hub
+	// the connection is locked before the hub, so a concurrent Close either sees the
+	// room or prevents the join
+	conn.mu.Lock()
+	if _, ok := conn.rooms[room]; ok || conn.closed {
+		conn.mu.Unlock()
+		return
+	}
+	conn.rooms[room] = struct{}{}
+	h.mu.Lock()
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[*WSConn]struct{}{}
+	}
+	h.rooms[room][conn] = struct{}{}
+	h.mu.Unlock()
+	conn.mu.Unlock()
+
+	if h.config.OnJoin != nil {
+		h.config.OnJoin(conn, room)
+	}
+}
+
+// Leave removes the connection from the room.
+func (conn *WSConn) Leave(room string) {
+	conn.mu.Lock()
+	left := conn.leave(room)
+	conn.mu.Unlock()
+	if left && conn.hub.config.OnLeave != nil {
+		conn.hub.config.OnLeave(conn, room)
+	}
+}
+
+// leave removes the connection from the room, with conn.mu held, and reports whether
+// it was in the room.
+func (conn *WSConn) leave(room string) bool {
+	if _, ok := conn.rooms[room]; !ok {
+		return false
+	}
+	delete(conn.rooms, room)
+	h := conn.hub
+	h.mu.Lock()
+	delete(h.rooms[room], conn)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+	h.mu.Unlock()
+	return true
+}
+
+// Send queues a message for the connection, sent as a text frame. The connection is closed when its queue is
+// full, as the client does not keep up.
+func (conn *WSConn) Send(msg []byte) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.closed {
+		return ErrConnClosed
+	}
+	select {
+	case conn.send <- msg:
+		return nil
+	default:
+		go conn.Close()
+		return ErrSendQueueFull
+	}
+}
+
+// Close leaves all rooms and closes the connection.
+func (conn *WSConn) Close() {
+	conn.mu.Lock()
+	if conn.closed {
+		conn.mu.Unlock()
+		return
+	}
+	conn.closed = true
+	close(conn.send)
+	rooms := make([]string, 0, len(conn.rooms))
+	for room := range conn.rooms {
+		rooms = append(rooms, room)
+	}
+	for _, room := range rooms {
+		conn.leave(room)
+	}
+	conn.mu.Unlock()
+
+	if onLeave := conn.hub.config.OnLeave; onLeave != nil {
+		for _, room := range rooms {
+			onLeave(conn, room)
+		}
+	}
+	_ = conn.ws.Close()
+}
+
+func (conn *WSConn) writeLoop() {
+	for msg := range conn.send {
+		if err := websocket.Message.Send(conn.ws, string(msg)); err != nil {
+			_ = conn.ws.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 Kapeta Inc.
+// SPDX-License-Identifier: MIT
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func dialWS(t *testing.T, srv *httptest.Server, path string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + path
+	ws, err := websocket.Dial(url, "", srv.URL)
+	require.NoError(t, err)
+	return ws
+}
+
+func receiveWS(t *testing.T, ws *websocket.Conn) string {
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(time.Second)))
+	var msg string
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	return msg
+}
+
+func TestWSHub(t *testing.T) {
+	var mu sync.Mutex
+	var joined, left []string
+	var hub *WSHub
+	hub = NewWSHub(WSHubConfig{
+		OnJoin: func(conn *WSConn, room string) {
+			mu.Lock()
+			defer mu.Unlock()
+			joined = append(joined, room)
+		},
+		OnLeave: func(conn *WSConn, room string) {
+			mu.Lock()
+			defer mu.Unlock()
+			left = append(left, room)
+		},
+		OnMessage: func(conn *WSConn, msg []byte) {
+			hub.Broadcast("chat", msg)
+		},
+	})
+	e := echo.New()
+	e.GET("/ws", hub.Handler(QueryTopics("room")))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	alice := dialWS(t, srv, "/ws?room=chat")
+	bob := dialWS(t, srv, "/ws?room=chat&room=news")
+	assert.Eventually(t, func() bool { return hub.Members("chat") == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, hub.Members("news"))
+
+	require.NoError(t, websocket.Message.Send(alice, "hello"))
+	assert.Equal(t, "hello", receiveWS(t, alice))
+	assert.Equal(t, "hello", receiveWS(t, bob))
+
+	hub.Broadcast("news", []byte("breaking"))
+	assert.Equal(t, "breaking", receiveWS(t, bob))
+
+	require.NoError(t, bob.Close())
+	assert.Eventually(t, func() bool { return hub.Members("chat") == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, hub.Members("news"))
+	require.NoError(t, alice.Close())
+	assert.Eventually(t, func() bool { return hub.Members("chat") == 0 }, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"chat", "chat", "news"}, joined)
+	assert.ElementsMatch(t, []string{"chat", "chat", "news"}, left)
+}
+
+func TestWSHubAuthorize(t *testing.T) {
+	hub := NewWSHub(WSHubConfig{Authorize: func(c echo.Context, rooms []string) error {
+		if c.Request().Header.Get(echo.HeaderAuthorization) == "" {
+			return echo.ErrUnauthorized
+		}
+		return nil
+	}})
+	e := echo.New()
+	e.GET("/ws", hub.Handler(QueryTopics("room")))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ws?room=chat", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestWSHubCheckOrigin(t *testing.T) {
+	hub := NewWSHub(WSHubConfig{})
+	e := echo.New()
+	e.GET("/ws", hub.Handler(QueryTopics("room")))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	_, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", "", "https://evil.example.com")
+	assert.Error(t, err)
+}
+
+func TestWSConnSendQueueFull(t *testing.T) {
+	hub := NewWSHub(WSHubConfig{SendQueue: 1})
+	e := echo.New()
+	connected := make(chan *WSConn, 1)
+	hub.config.OnJoin = func(conn *WSConn, room string) {
+		connected <- conn
+	}
+	e.GET("/ws", hub.Handler(QueryTopics("room")))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	ws := dialWS(t, srv, "/ws?room=chat")
+	defer ws.Close()
+	conn := <-connected
+
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = conn.Send([]byte(strings.Repeat("x", 1<<16)))
+	}
+	assert.ErrorIs(t, err, ErrSendQueueFull)
+	assert.Eventually(t, func() bool { return hub.Members("chat") == 0 }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, conn.Send([]byte("late")), ErrConnClosed)
+}
+
+func TestWSConnJoinRacesClose(t *testing.T) {
+	hub := NewWSHub(WSHubConfig{})
+	e := echo.New()
+	connected := make(chan *WSConn, 1)
+	hub.config.OnJoin = func(conn *WSConn, room string) {
+		if room == "lobby" {
+			connected <- conn
+		}
+	}
+	e.GET("/ws", hub.Handler(QueryTopics("room")))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	ws := dialWS(t, srv, "/ws?room=lobby")
+	defer ws.Close()
+	conn := <-connected
+
+	rooms := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	var wg sync.WaitGroup
+	for _, room := range rooms {
+		wg.Add(1)
+		go func(room string) {
+			defer wg.Done()
+			conn.Join(room)
+		}(room)
+	}
+	conn.Close()
+	wg.Wait()
+
+	for _, room := range append(rooms, "lobby") {
+		assert.Equal(t, 0, hub.Members(room), room)
+	}
+	conn.Join("late")
+	assert.Equal(t, 0, hub.Members("late"))
+}